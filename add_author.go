@@ -0,0 +1,154 @@
+package duet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// NewAuthor is an author for AddAuthor to add to an authors file
+type NewAuthor struct {
+	Initials string
+	Name     string
+	Username string
+	Email    string
+}
+
+// authorsKeyRegexp matches the line starting the top-level `authors` mapping,
+// or `pairs` in files of version 0
+var authorsKeyRegexp = regexp.MustCompile(`^(?:authors|pairs)\s*:\s*(?:#.*)?$`)
+
+// AddAuthor adds author to the `authors` of the YAML authors file filename,
+// as "Name; username" or, if it has an email, as a structured entry (see
+// authorSpec). The entry goes after the last author, the rest of the file
+// (comments included) is left as it is. Returns an error if the initials are
+// taken in pairs (the authors as loaded, e.g. by Configuration.LoadPairs),
+// by an author or a team.
+func AddAuthor(filename string, pairs *Pairs, author NewAuthor) (err error) {
+	if format, err := authorsFileFormat(filename, filename); err != nil {
+		return err
+	} else if format != AuthorsFormatYAML {
+		return fmt.Errorf("%s is a TOML file, authors can only be added to YAML authors files", filename)
+	}
+	if cache, err := AuthorsFileCacheDir(); err == nil && filepath.Dir(filename) == cache {
+		return fmt.Errorf("%s is the cached copy of an authors file fetched from a URL, add %s to the file at the URL instead",
+			filename, author.Initials)
+	}
+
+	initials := strings.TrimSpace(author.Initials)
+	switch {
+	case initials == "":
+		return fmt.Errorf("the initials of the author to add are empty")
+	case looksUnsplit(initials):
+		return fmt.Errorf("initials %q cannot be typed as one person's, leave out whitespace and any of ,+;/&|", initials)
+	case strings.TrimSpace(author.Name) == "":
+		return fmt.Errorf("the author to add as %s has no name", initials)
+	case strings.Contains(author.Name+author.Username, ";"):
+		return fmt.Errorf("the name and username of %s cannot contain ;", initials)
+	case author.Email != "" && !isEmailAddress(author.Email):
+		return fmt.Errorf("email %q for %s is not a valid email address", author.Email, initials)
+	}
+
+	normalized := pairs.file.normalizeInitials(initials)
+	if existing, ok := pairs.file.Pairs[normalized]; ok {
+		name, _, _ := parseAuthor(existing)
+		return fmt.Errorf("initials %s are already taken by %s", initials, name)
+	}
+	for key := range pairs.file.Authors {
+		if pairs.file.normalizeInitials(key) == normalized {
+			return fmt.Errorf("initials %s are already taken by a team or a broken author", initials)
+		}
+	}
+
+	value := authorValue{author: author.Name}
+	if author.Email != "" {
+		value = authorValue{spec: &authorSpec{Name: author.Name, Username: author.Username, Email: author.Email}}
+	} else if author.Username != "" {
+		value.author = fmt.Sprintf("%s; %s", author.Name, author.Username)
+	}
+	entry, err := yaml.Marshal(map[string]authorValue{initials: value})
+	if err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	added, err := insertAuthor(contents, string(entry))
+	if err != nil {
+		return fmt.Errorf("could not add %s to %s: %v", initials, filename, err)
+	}
+	// the file is edited line by line, make sure it still says what was meant
+	if af, _, err := parsePairsFile(added); err != nil || af.Pairs[normalized] != value.String() {
+		return fmt.Errorf("could not add %s to %s, add it by hand", initials, filename)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, added, info.Mode())
+}
+
+// insertAuthor inserts entry, the YAML of an author keyed by its initials,
+// after the last line of the top-level `authors` (or `pairs`) mapping in
+// contents, indented like the authors before it
+func insertAuthor(contents []byte, entry string) (inserted []byte, err error) {
+	newline := "\n"
+	if strings.Contains(string(contents), "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.SplitAfter(string(contents), "\n")
+
+	start := -1
+	for i, line := range lines {
+		if authorsKeyRegexp.MatchString(strings.TrimRight(line, "\r\n")) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("there is no `authors:` mapping to add it to")
+	}
+
+	last, indent := start, 0
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r\n")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if len(line) == len(content) {
+			break
+		}
+		if indent == 0 {
+			indent = len(line) - len(content)
+		}
+		last = i
+	}
+	if indent == 0 {
+		indent = 2
+	}
+
+	var b strings.Builder
+	for _, line := range lines[:last+1] {
+		b.WriteString(line)
+	}
+	if !strings.HasSuffix(lines[last], "\n") {
+		b.WriteString(newline)
+	}
+	for _, line := range strings.Split(strings.TrimRight(entry, "\n"), "\n") {
+		b.WriteString(strings.Repeat(" ", indent) + line + newline)
+	}
+	for _, line := range lines[last+1:] {
+		b.WriteString(line)
+	}
+
+	return []byte(b.String()), nil
+}
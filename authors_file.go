@@ -0,0 +1,201 @@
+package duet
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkTargetMissingError is returned when the authors file is a symlink
+// (possibly through a chain of symlinks) whose final target does not exist
+type SymlinkTargetMissingError struct {
+	Path   string
+	Target string
+}
+
+func (e *SymlinkTargetMissingError) Error() string {
+	return fmt.Sprintf("%s is a symlink but its target %s is missing", e.Path, e.Target)
+}
+
+// EmptyAuthorsFileError is returned when the authors file exists but does not
+// list any authors (e.g. it is empty or only contains comments)
+// A missing file is reported as an *os.PathError instead (see os.IsNotExist).
+type EmptyAuthorsFileError struct {
+	Path string
+}
+
+func (e *EmptyAuthorsFileError) Error() string {
+	return fmt.Sprintf(`%s does not contain any authors, list them under "authors:", e.g.
+
+authors:
+  jd: Jane Doe; jane
+email:
+  domain: example.com`, e.Path)
+}
+
+// AuthorsFileNotFoundError is returned when `duet.authorsfile` points at a file
+// that does not exist, Tried lists the locations consulted
+type AuthorsFileNotFoundError struct {
+	Tried []string
+}
+
+func (e *AuthorsFileNotFoundError) Error() string {
+	return fmt.Sprintf("could not find authors file, tried:\n  %s", strings.Join(e.Tried, "\n  "))
+}
+
+// AuthorsFormatYAML and AuthorsFormatTOML are the formats an authors file can
+// be written in (see authorsFileFormat)
+const (
+	AuthorsFormatYAML = "yaml"
+	AuthorsFormatTOML = "toml"
+)
+
+// authorsFileFormat returns the format of the authors file name, resolved to
+// the file resolved: the one its extension (.toml, .yml or .yaml) says, or
+// else $GIT_DUET_AUTHORS_FORMAT, YAML if not set
+func authorsFileFormat(name, resolved string) (format string, err error) {
+	for _, file := range []string{resolved, name} {
+		switch strings.ToLower(path.Ext(file)) {
+		case ".toml":
+			return AuthorsFormatTOML, nil
+		case ".yml", ".yaml":
+			return AuthorsFormatYAML, nil
+		}
+	}
+
+	switch format = strings.ToLower(os.Getenv("GIT_DUET_AUTHORS_FORMAT")); format {
+	case "", AuthorsFormatYAML, "yml":
+		return AuthorsFormatYAML, nil
+	case AuthorsFormatTOML:
+		return AuthorsFormatTOML, nil
+	}
+	return "", fmt.Errorf("GIT_DUET_AUTHORS_FORMAT is %q, it should be yaml or toml", format)
+}
+
+// osFS is the OS filesystem as an fs.FS, the default for reading authors
+// files. Unlike os.DirFS it takes OS paths (absolute or relative to the
+// working directory) as names.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadLink(name string) (string, error)       { return os.Readlink(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Glob(pattern string) ([]string, error)      { return filepath.Glob(pattern) }
+
+// fsName returns the name of the OS path file in fsys: the path itself for the
+// OS filesystem, otherwise the path relative to the root of fsys (so that
+// os.DirFS("/") reads the same files as the OS filesystem)
+func fsName(fsys fs.FS, file string) string {
+	if _, ok := fsys.(osFS); ok {
+		return file
+	}
+	return strings.TrimPrefix(filepath.ToSlash(file), "/")
+}
+
+// readLinkFS is a filesystem with symlinks, like fs.ReadLinkFS in newer Go
+// versions (which osFS and fstest.MapFS satisfy)
+type readLinkFS interface {
+	Lstat(name string) (fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+}
+
+// lstat is fs.Stat without following a final symlink if fsys supports them
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if links, ok := fsys.(readLinkFS); ok {
+		return links.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// resolveAuthorsFile follows symlinks to the real authors file in fsys, if it
+// supports them (see readLinkFS)
+func resolveAuthorsFile(fsys fs.FS, filename string) (resolved string, err error) {
+	if _, ok := fsys.(osFS); !ok {
+		return resolveAuthorsFileFS(fsys, filename)
+	}
+
+	resolved, err = filepath.EvalSymlinks(filename)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	// find the last link in the chain to report where it points
+	target := filename
+	for i := 0; i < 255; i++ {
+		info, lerr := os.Lstat(target)
+		if lerr != nil {
+			break
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return "", err
+		}
+		link, lerr := os.Readlink(target)
+		if lerr != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(target), link)
+		}
+		target = link
+	}
+
+	if target != filename {
+		return "", &SymlinkTargetMissingError{Path: filename, Target: target}
+	}
+
+	return "", err
+}
+
+// resolveAuthorsFileFS is resolveAuthorsFile for filesystems other than the
+// OS one, where only the final element of the name can be a symlink
+func resolveAuthorsFileFS(fsys fs.FS, filename string) (resolved string, err error) {
+	links, ok := fsys.(readLinkFS)
+	if !ok {
+		return filename, nil
+	}
+
+	target := filename
+	for i := 0; i < 255; i++ {
+		info, err := links.Lstat(target)
+		if errors.Is(err, fs.ErrNotExist) && target != filename {
+			return "", &SymlinkTargetMissingError{Path: filename, Target: target}
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return target, nil
+		}
+
+		link, err := links.ReadLink(target)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(link) {
+			target = strings.TrimPrefix(link, "/")
+		} else {
+			target = path.Join(path.Dir(target), link)
+		}
+	}
+
+	return "", fmt.Errorf("%s: too many levels of symbolic links", filename)
+}
+
+// describeAuthorsFile names the authors file in errors, including the symlink
+// target if it differs from the requested path
+func describeAuthorsFile(filename, resolved string) string {
+	if resolved == "" || resolved == filename {
+		return filename
+	}
+	return fmt.Sprintf("%s (-> %s)", filename, resolved)
+}
@@ -0,0 +1,128 @@
+package duet
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// LookupCommandError is returned by NewPairsFromFile when an email (or signing
+// key, see WithKeyLookup) lookup command cannot be run (see
+// WithDeferredLookupCheck), Source is where it was configured if not the
+// global one (e.g. `lookup_overrides for jd`) and Lookup what it looks up
+// ("email" if empty)
+type LookupCommandError struct {
+	Command       string
+	Source        string
+	Lookup        string
+	NotExecutable bool
+	Err           error
+}
+
+func (e *LookupCommandError) Error() string {
+	prefix := ""
+	if e.Source != "" {
+		prefix = e.Source + ": "
+	}
+	lookup := e.Lookup
+	if lookup == "" {
+		lookup = emailLookupKind
+	}
+	switch {
+	case e.NotExecutable:
+		return fmt.Sprintf("%s%s lookup command '%s' is not executable", prefix, lookup, e.Command)
+	case strings.ContainsAny(e.Command, `/\`):
+		return fmt.Sprintf("%s%s lookup command '%s' does not exist", prefix, lookup, e.Command)
+	}
+	return fmt.Sprintf("%s%s lookup command '%s' not found in PATH", prefix, lookup, e.Command)
+}
+
+func (e *LookupCommandError) Unwrap() error {
+	return e.Err
+}
+
+// checkLookupCommand returns a *LookupCommandError unless command can be run,
+// looking it up in $PATH (with the extensions of $PATHEXT on Windows) unless
+// it is a path
+func checkLookupCommand(command, source, lookup string) error {
+	_, err := exec.LookPath(command)
+	if err == nil || isErrDot(err) {
+		return nil
+	}
+
+	e := &LookupCommandError{Command: command, Source: source, Lookup: lookup, Err: err}
+	if errors.Is(err, fs.ErrPermission) {
+		e.NotExecutable = true
+	} else if errors.Is(err, exec.ErrNotFound) && !strings.ContainsAny(command, `/\`) {
+		// $PATH lookups skip files that are not executable
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			if info, statErr := os.Stat(filepath.Join(dir, command)); statErr == nil && !info.IsDir() {
+				e.NotExecutable = true
+				break
+			}
+		}
+	}
+	return e
+}
+
+// splitCommand splits a command line into words the way a POSIX shell would,
+// honouring single and double quotes and backslash escapes (no expansions)
+func splitCommand(line string) (words []string, err error) {
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("trailing backslash in %q", line)
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, line)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
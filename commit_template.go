@@ -0,0 +1,200 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// commitTemplateBegin and commitTemplateEnd delimit the section of the
+// commit.template file that UpdateCommitTemplate manages. Both are comments,
+// so git strips them from the commit message.
+const (
+	commitTemplateBegin = "# --- git-duet co-authors (updated by git duet, do not edit) ---"
+	commitTemplateEnd   = "# --- end of git-duet co-authors ---"
+)
+
+// CommitTemplateLocationError is returned by UpdateCommitTemplate without force
+// for a template outside the user's home and the repository
+type CommitTemplateLocationError struct {
+	Path string
+}
+
+func (e *CommitTemplateLocationError) Error() string {
+	return fmt.Sprintf("refusing to edit commit.template %s outside your home and the repository, "+
+		"set GIT_DUET_COMMIT_TEMPLATE_FORCE to edit it anyway", e.Path)
+}
+
+// CommitTemplatePath returns the file configured as commit.template (empty if
+// there is none), relative paths being relative to the repository like git
+func CommitTemplatePath() (file string, err error) {
+	output := new(bytes.Buffer)
+	cmd := exec.Command("git", "config", "--path", "commit.template")
+	cmd.Stdout = output
+	if err = newIgnorableCommand(cmd, 1).Run(); err != nil {
+		return "", err
+	}
+
+	file = strings.TrimSpace(output.String())
+	if file == "" || filepath.IsAbs(file) {
+		return file, nil
+	}
+	if toplevel, err := repoToplevel(); err == nil {
+		return filepath.Join(toplevel, file), nil
+	}
+	return filepath.Abs(file)
+}
+
+// UpdateCommitTemplate replaces the git-duet section of the commit template at
+// file with the given trailers, adding the section at the end if there is none
+// yet and removing it entirely if there are no trailers. The rest of the file
+// is left as is. Unless force is set, only templates in the user's home or the
+// current repository are edited (see CommitTemplateLocationError).
+func UpdateCommitTemplate(file string, trailers []string, force bool) (err error) {
+	return PlanUpdateCommitTemplate(nil, file, trailers, force)
+}
+
+// PlanUpdateCommitTemplate is UpdateCommitTemplate recording the change in plan
+// instead of making it (making it if plan is nil)
+func PlanUpdateCommitTemplate(plan *Plan, file string, trailers []string, force bool) (err error) {
+	if !force {
+		if err = checkCommitTemplateLocation(file); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("could not read commit.template: %v", err)
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not read commit.template: %v", err)
+	}
+
+	updated, err := replaceCommitTemplateSection(string(contents), trailers)
+	if err != nil {
+		return fmt.Errorf("could not update commit.template %s: %v", file, err)
+	}
+	if updated == string(contents) {
+		return nil
+	}
+
+	return plan.writeFile(file, []byte(updated), info.Mode().Perm())
+}
+
+// replaceCommitTemplateSection returns contents with its git-duet section (the
+// lines from the begin marker to the end marker) replaced by one listing the
+// trailers, or without it if there are none
+func replaceCommitTemplateSection(contents string, trailers []string) (string, error) {
+	var section string
+	if len(trailers) > 0 {
+		// the empty line keeps the trailers in a paragraph of their own
+		section = commitTemplateBegin + "\n\n" + strings.Join(trailers, "\n") + "\n" + commitTemplateEnd + "\n"
+	}
+
+	lines := strings.SplitAfter(contents, "\n")
+	start, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimRight(line, "\r\n") {
+		case commitTemplateBegin:
+			if start < 0 {
+				start = i
+			}
+		case commitTemplateEnd:
+			if start >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+
+	if start < 0 {
+		if section == "" {
+			return contents, nil
+		}
+		if contents != "" && !strings.HasSuffix(contents, "\n") {
+			contents += "\n"
+		}
+		return contents + section, nil
+	}
+	if end < 0 {
+		return "", fmt.Errorf("the git-duet section has no end marker (%s)", commitTemplateEnd)
+	}
+
+	return strings.Join(lines[:start], "") + section + strings.Join(lines[end+1:], ""), nil
+}
+
+// checkCommitTemplateLocation returns a *CommitTemplateLocationError unless
+// file is in the user's home or the current repository
+func checkCommitTemplateLocation(file string) error {
+	var roots []string
+	if home, err := os.UserHomeDir(); err == nil {
+		roots = append(roots, home)
+	}
+	if toplevel, err := repoToplevel(); err == nil {
+		roots = append(roots, toplevel)
+	}
+
+	resolved := file
+	if abs, err := filepath.Abs(file); err == nil {
+		resolved = abs
+	}
+	if real, err := filepath.EvalSymlinks(resolved); err == nil {
+		resolved = real
+	}
+
+	for _, root := range roots {
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+
+	return &CommitTemplateLocationError{Path: file}
+}
+
+func repoToplevel() (toplevel string, err error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// SyncCommitTemplate updates the git-duet section of commit.template with the
+// trailers of the co-authors configured in gitConfig (removing it when working
+// solo or cleared). It is a no-op unless config.CommitTemplate is set or if no
+// commit.template is configured. The change is recorded in gitConfig.DryRun if
+// set.
+func (config *Configuration) SyncCommitTemplate(gitConfig *GitConfig) (err error) {
+	if !config.CommitTemplate {
+		return nil
+	}
+
+	file, err := CommitTemplatePath()
+	if err != nil || file == "" {
+		return err
+	}
+
+	coAuthors, err := gitConfig.GetCommitters()
+	if err != nil {
+		return err
+	}
+
+	var trailers []string
+	if len(coAuthors) > 0 {
+		key, err := config.CoAuthorTrailerKey()
+		if err != nil {
+			return err
+		}
+		trailers = CoAuthorTrailers(key, OrderCoAuthors(config.TrailerOrder, coAuthors))
+	}
+
+	return PlanUpdateCommitTemplate(gitConfig.DryRun, file, trailers, config.CommitTemplateForce)
+}
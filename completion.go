@@ -0,0 +1,116 @@
+package duet
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Shells WriteCompletionScript has a script for
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+// The scripts complete the initials `git duet completion initials` prints
+// (see WriteCompletionCandidates), for `git duet` and `git solo` as well as
+// git-duet and git-solo
+const (
+	bashCompletion = `# bash completion for git duet and git solo, load it with
+#   source <(git duet completion bash)
+__git_duet_initials() {
+	git duet completion initials 2>/dev/null | cut -f1
+}
+
+# __git_duet_match completes the initials starting with $1, matched in bash
+# rather than by compgen -W, which would expand what the authors file says
+__git_duet_match() {
+	local word
+	COMPREPLY=()
+	while IFS= read -r word; do
+		[[ $word == "$1"* ]] && COMPREPLY+=("$word")
+	done < <(__git_duet_initials)
+}
+
+# called by git's own completion for ` + "`git duet`" + ` and ` + "`git solo`" + `
+_git_duet() {
+	__git_duet_match "$cur"
+}
+
+_git_solo() {
+	_git_duet
+}
+
+__git_duet_complete() {
+	__git_duet_match "${COMP_WORDS[COMP_CWORD]}"
+}
+
+complete -o default -F __git_duet_complete git-duet git-solo
+`
+
+	zshCompletion = `#compdef git-duet git-solo
+# zsh completion for git duet and git solo, load it with
+#   source <(git duet completion zsh)
+_git-duet() {
+	local -a initials
+	initials=(${(f)"$(git duet completion initials 2>/dev/null | sed -e 's/:/\\:/g' -e $'s/\t/:/')"})
+	_describe -t initials initials initials
+}
+
+_git-solo() {
+	_git-duet "$@"
+}
+
+# lets git's own completion call them for ` + "`git duet`" + ` and ` + "`git solo`" + `
+zstyle ':completion:*:*:git:*' user-commands duet:'set the pair' solo:'work solo'
+compdef _git-duet git-duet
+compdef _git-solo git-solo
+`
+
+	fishCompletion = `# fish completion for git duet and git solo, load it with
+#   git duet completion fish | source
+function __git_duet_initials
+	git duet completion initials 2>/dev/null
+end
+
+complete -c git -n '__fish_seen_subcommand_from duet solo' -f -a '(__git_duet_initials)'
+complete -c git-duet -f -a '(__git_duet_initials)'
+complete -c git-solo -f -a '(__git_duet_initials)'
+`
+)
+
+// WriteCompletionScript writes the completion script for shell (bash, zsh or
+// fish) to w
+func WriteCompletionScript(w io.Writer, shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unknown shell %q, must be one of: bash, zsh, fish", shell)
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// WriteCompletionCandidates writes the initials of every author of pairs and
+// their name, then the name of every squad and its members, separated by a
+// tab, one per line, as the completion scripts read them. No email is resolved.
+func WriteCompletionCandidates(w io.Writer, pairs *Pairs) error {
+	authors, err := pairs.Search("", false)
+	if err != nil {
+		return err
+	}
+
+	flatten := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+	for _, p := range authors {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", p.Initials, flatten.Replace(p.Name)); err != nil {
+			return err
+		}
+	}
+	for _, squad := range pairs.Squads() {
+		members := strings.Join(pairs.SquadMembers(squad), " ")
+		if _, err := fmt.Fprintf(w, "%s\tsquad: %s\n", squad, flatten.Replace(members)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,9 +2,13 @@ package duet
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -12,26 +16,176 @@ import (
 
 // Configuration represents package configuration (shared by commands)
 type Configuration struct {
-	Namespace        string
-	PairsFile        string
-	EmailLookup      string
-	CoAuthoredBy     bool
-	Global           bool
+	Namespace string
+	// PairsFile is the name of the authors file in FS, which is the OS
+	// filesystem if nil (see NewConfigurationFS)
+	PairsFile string
+	// PairsFileLayers are the authors files PairsFile is layered on, lowest
+	// first: the organization defaults file (see SystemDefaultsFile) and,
+	// when PairsFile is the repository's .git-authors, ~/.git-authors (or
+	// the other files listed in $GIT_DUET_AUTHORS_FILE, last first)
+	PairsFileLayers []string
+	// PairsFileSource is where PairsFile was found, e.g.
+	// "$GIT_DUET_AUTHORS_FILE" or "~/.git-authors"
+	PairsFileSource string
+	// PairsFileWarnings are problems fetching the authors files given as
+	// URLs that fell back to the cached copy, printed by LoadPairs
+	PairsFileWarnings []error
+	FS                fs.FS
+	EmailLookup       string
+	// UntrustedPairsFiles are the files of the stack found in the repository
+	// or fetched from a URL, with where they come from, whose
+	// `lookup_overrides` are rejected unless TrustAuthorsFileCommands is set
+	// (see WithUntrustedAuthorsFile)
+	UntrustedPairsFiles map[string]string
+	// TrustAuthorsFileCommands is duet.trustAuthorsFileCommands in git config
+	// (see TrustAuthorsFileCommandsConfigKey)
+	TrustAuthorsFileCommands bool
+	// KeyLookup is the signing key lookup command (see WithKeyLookup)
+	KeyLookup string
+	// AllowedSignersFile is $GIT_DUET_ALLOWED_SIGNERS_FILE, expanded (see
+	// GitConfig.AllowedSignersFile)
+	AllowedSignersFile string
+	CoAuthoredBy       bool
+	// Global makes commands use the global git config rather than the
+	// repository's: $GIT_DUET_GLOBAL if set, otherwise duet.global in git
+	// config (see GlobalConfigKey). --global and --local override it.
+	Global bool
+	// RotateAuthor rotates the author after commits when RotatePolicy says
+	// so: $GIT_DUET_ROTATE_AUTHOR if set, otherwise whether duet.rotatePolicy
+	// is set in git config (see RotatePolicyConfigKey)
 	RotateAuthor     bool
+	RotatePolicy     RotatePolicy
 	SetGitUserConfig bool
 	StaleCutoff      time.Duration
+	ExpireAfter      time.Duration
+	RandomSeed       int64
+	TrailerKey       string
+	// TrailerOrder is the order of the co-author trailers (see
+	// ParseTrailerOrder): $GIT_DUET_TRAILER_ORDER if set, otherwise
+	// duet.trailerOrder in git config (see TrailerOrderConfigKey)
+	TrailerOrder string
+	// EmailLookupCacheTTL and EmailLookupNegativeCacheTTL control how long
+	// successful and failed email lookups are cached (zero disables caching)
+	EmailLookupCacheTTL         time.Duration
+	EmailLookupNegativeCacheTTL time.Duration
+	EmailLookupConcurrency      int
+	EmailLookupFallback         bool
+	// EmailLookupTimeout fails lookups taking longer (zero waits forever, see
+	// WithLookupTimeout)
+	EmailLookupTimeout time.Duration
+	// ResolverTimeout and ResolverBudget bound the requests to code hosts
+	// (zero keeps the defaults, see WithResolverTimeouts)
+	ResolverTimeout time.Duration
+	ResolverBudget  time.Duration
+	// EmailLookupDeferCheck skips checking the lookup commands exist when
+	// loading the authors file (see WithDeferredLookupCheck)
+	EmailLookupDeferCheck bool
+	InitialsHintLimit     int
+	PrefixInitials        bool
+	Debug                 bool
+	// GitHubAPIURL and GitHubNoreplyDomain override `github_noreply` in the
+	// authors file, GitLabURL and GitLabNoreplyDomain override `gitlab`
+	GitHubAPIURL        string
+	GitHubNoreplyDomain string
+	GitLabURL           string
+	GitLabNoreplyDomain string
+	// CommitTemplate keeps the co-authors in a section of commit.template,
+	// CommitTemplateForce edits it wherever it is (see UpdateCommitTemplate)
+	CommitTemplate      bool
+	CommitTemplateForce bool
+	// PrivateEmail is the value of duet.privateEmail in git config (see
+	// ParsePrivateEmailConfig), empty if not set
+	PrivateEmail string
+	// EmailLabel is the value of duet.emailLabel in git config (see
+	// WithEmailLabel), empty if not set
+	EmailLabel string
+	// Invert makes the last initials given the author (see InvertRoles)
+	Invert bool
+	// DuplicatePeople lets pairs have someone twice (see WithDuplicatePeople),
+	// it is not read from the environment
+	DuplicatePeople bool
 }
 
 // NewConfiguration initializes Configuration from the environment
-// Returns an error if it cannot parse the staleness timeout as an integer or
-// the global var as a bool
+// Returns an error if it cannot parse the staleness timeout, expiry, lookup
+// cache TTLs, lookup concurrency, initials hint limit or random seed as an
+// integer or the global, lookup fallback, deferred lookup check, prefix
+// initials, debug, commit template or invert vars as a bool, or the trailer
+// order (see ParseTrailerOrder)
 func NewConfiguration() (config *Configuration, err error) {
+	return NewConfigurationFS(osFS{})
+}
+
+// NewConfigurationFS is NewConfiguration looking for and reading the authors
+// file in fsys rather than the OS filesystem. Paths (from the environment, git
+// config and the repo toplevel) are looked up relative to the root of fsys,
+// e.g. os.DirFS("/") or a fstest.MapFS with a "home/jane/.git-authors" file.
+// Nothing is ever written to fsys.
+func NewConfigurationFS(fsys fs.FS) (config *Configuration, err error) {
 	config = &Configuration{
+		FS:          fsys,
 		Namespace:   getenvDefault("GIT_DUET_CONFIG_NAMESPACE", "duet.env"),
-		EmailLookup: os.Getenv("GIT_DUET_EMAIL_LOOKUP_COMMAND"),
+		EmailLookup: expandCommandPath(os.Getenv("GIT_DUET_EMAIL_LOOKUP_COMMAND")),
+		KeyLookup:   expandCommandPath(os.Getenv("GIT_DUET_KEY_LOOKUP_COMMAND")),
+		TrailerKey:  os.Getenv("GIT_DUET_TRAILER_KEY"),
+
+		AllowedSignersFile: ExpandPath(os.Getenv("GIT_DUET_ALLOWED_SIGNERS_FILE")),
+
+		GitHubAPIURL:        os.Getenv("GIT_DUET_GITHUB_API_URL"),
+		GitHubNoreplyDomain: os.Getenv("GIT_DUET_GITHUB_NOREPLY_DOMAIN"),
+		GitLabURL:           os.Getenv("GIT_DUET_GITLAB_URL"),
+		GitLabNoreplyDomain: os.Getenv("GIT_DUET_GITLAB_NOREPLY_DOMAIN"),
+	}
+
+	if config.TrailerKey != "" {
+		if err = ValidateTrailerKey(config.TrailerKey); err != nil {
+			return nil, err
+		}
+	}
+
+	var discovered []string
+	if config.PairsFile, config.PairsFileLayers, config.PairsFileSource, discovered, err = getPairsFile(fsys); err != nil {
+		return nil, err
+	}
+	for _, file := range discovered {
+		config.untrust(file, "was found in the repository")
+	}
+	if err = config.fetchRemotePairsFiles(false); err != nil {
+		return nil, err
+	}
+	if config.TrustAuthorsFileCommands, err = getBoolConfig(TrustAuthorsFileCommandsConfigKey); err != nil {
+		return nil, err
+	}
+
+	// only checked when expanded, a plain command name is looked up in $PATH
+	lookup := os.Getenv("GIT_DUET_EMAIL_LOOKUP_COMMAND")
+	if isExpanded(lookup) {
+		if _, err = os.Stat(config.EmailLookup); os.IsNotExist(err) {
+			return nil, fmt.Errorf("$GIT_DUET_EMAIL_LOOKUP_COMMAND: %s does not exist", describeExpandedPath(lookup, config.EmailLookup))
+		}
+	}
+	if keyLookup := os.Getenv("GIT_DUET_KEY_LOOKUP_COMMAND"); isExpanded(keyLookup) {
+		if _, err = os.Stat(config.KeyLookup); os.IsNotExist(err) {
+			return nil, fmt.Errorf("$GIT_DUET_KEY_LOOKUP_COMMAND: %s does not exist", describeExpandedPath(keyLookup, config.KeyLookup))
+		}
+	}
+
+	if config.PrivateEmail, err = (&GitConfig{}).getUnnamespacedKey(PrivateEmailConfigKey); err != nil {
+		return nil, err
+	}
+
+	if config.EmailLabel, err = (&GitConfig{}).getUnnamespacedKey(EmailLabelConfigKey); err != nil {
+		return nil, err
 	}
 
-	if config.PairsFile, err = getPairsFile(); err != nil {
+	order := os.Getenv("GIT_DUET_TRAILER_ORDER")
+	if order == "" {
+		if order, err = (&GitConfig{}).getUnnamespacedKey(TrailerOrderConfigKey); err != nil {
+			return nil, err
+		}
+	}
+	if config.TrailerOrder, err = ParseTrailerOrder(order); err != nil {
 		return nil, err
 	}
 
@@ -40,11 +194,25 @@ func NewConfiguration() (config *Configuration, err error) {
 		return nil, err
 	}
 
-	if config.Global, err = strconv.ParseBool(getenvDefault("GIT_DUET_GLOBAL", "0")); err != nil {
+	if global := os.Getenv("GIT_DUET_GLOBAL"); global != "" {
+		if config.Global, err = strconv.ParseBool(global); err != nil {
+			return nil, err
+		}
+	} else if config.Global, err = getGlobalConfig(); err != nil {
 		return nil, err
 	}
 
-	if config.RotateAuthor, err = strconv.ParseBool(getenvDefault("GIT_DUET_ROTATE_AUTHOR", "0")); err != nil {
+	config.RotatePolicy = RotatePolicy{Kind: RotateEveryCommit}
+	policy, err := (&GitConfig{}).getUnnamespacedKey(RotatePolicyConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	if policy != "" {
+		if config.RotatePolicy, err = ParseRotatePolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+	if config.RotateAuthor, err = strconv.ParseBool(getenvDefault("GIT_DUET_ROTATE_AUTHOR", strconv.FormatBool(policy != ""))); err != nil {
 		return nil, err
 	}
 
@@ -62,32 +230,444 @@ func NewConfiguration() (config *Configuration, err error) {
 
 	config.StaleCutoff = time.Duration(cutoff) * time.Second
 
+	expireAfter, err := strconv.Atoi(getenvDefault("GIT_DUET_EXPIRE_AFTER", "0"))
+	if err != nil {
+		return nil, err
+	}
+	config.ExpireAfter = time.Duration(expireAfter) * time.Second
+
+	lookupTTL, err := strconv.Atoi(getenvDefault("GIT_DUET_EMAIL_LOOKUP_CACHE_TTL", "0"))
+	if err != nil {
+		return nil, err
+	}
+	config.EmailLookupCacheTTL = time.Duration(lookupTTL) * time.Second
+
+	negativeLookupTTL, err := strconv.Atoi(getenvDefault("GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL", "0"))
+	if err != nil {
+		return nil, err
+	}
+	config.EmailLookupNegativeCacheTTL = time.Duration(negativeLookupTTL) * time.Second
+	if config.EmailLookupNegativeCacheTTL > config.EmailLookupCacheTTL {
+		return nil, fmt.Errorf("GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL (%d) must not be longer than GIT_DUET_EMAIL_LOOKUP_CACHE_TTL (%d)", negativeLookupTTL, lookupTTL)
+	}
+
+	lookupTimeout, err := strconv.Atoi(getenvDefault("GIT_DUET_EMAIL_LOOKUP_TIMEOUT", "0"))
+	if err != nil {
+		return nil, err
+	}
+	config.EmailLookupTimeout = time.Duration(lookupTimeout) * time.Second
+
+	resolverTimeout, err := strconv.Atoi(getenvDefault("GIT_DUET_RESOLVER_TIMEOUT", "0"))
+	if err != nil {
+		return nil, err
+	}
+	config.ResolverTimeout = time.Duration(resolverTimeout) * time.Second
+
+	resolverBudget, err := strconv.Atoi(getenvDefault("GIT_DUET_RESOLVER_BUDGET", "0"))
+	if err != nil {
+		return nil, err
+	}
+	config.ResolverBudget = time.Duration(resolverBudget) * time.Second
+
+	if config.EmailLookupFallback, err = strconv.ParseBool(getenvDefault("GIT_DUET_EMAIL_LOOKUP_FALLBACK", "0")); err != nil {
+		return nil, err
+	}
+
+	if config.EmailLookupDeferCheck, err = strconv.ParseBool(getenvDefault("GIT_DUET_EMAIL_LOOKUP_DEFER_CHECK", "0")); err != nil {
+		return nil, err
+	}
+
+	if config.EmailLookupConcurrency, err = strconv.Atoi(getenvDefault(
+		"GIT_DUET_EMAIL_LOOKUP_CONCURRENCY", strconv.Itoa(DefaultLookupConcurrency))); err != nil {
+		return nil, err
+	}
+
+	if config.InitialsHintLimit, err = strconv.Atoi(getenvDefault(
+		"GIT_DUET_INITIALS_HINT_LIMIT", strconv.Itoa(DefaultInitialsHintLimit))); err != nil {
+		return nil, err
+	}
+
+	if config.PrefixInitials, err = strconv.ParseBool(getenvDefault("GIT_DUET_PREFIX_INITIALS", "0")); err != nil {
+		return nil, err
+	}
+
+	if config.Debug, err = strconv.ParseBool(getenvDefault("GIT_DUET_DEBUG", "0")); err != nil {
+		return nil, err
+	}
+
+	if config.CommitTemplate, err = strconv.ParseBool(getenvDefault("GIT_DUET_COMMIT_TEMPLATE", "0")); err != nil {
+		return nil, err
+	}
+
+	if config.CommitTemplateForce, err = strconv.ParseBool(getenvDefault("GIT_DUET_COMMIT_TEMPLATE_FORCE", "0")); err != nil {
+		return nil, err
+	}
+
+	if config.Invert, err = strconv.ParseBool(getenvDefault("GIT_DUET_INVERT", "0")); err != nil {
+		return nil, err
+	}
+
+	config.RandomSeed = time.Now().UnixNano()
+	if seed, ok := os.LookupEnv("GIT_DUET_RANDOM_SEED"); ok && seed != "" {
+		if config.RandomSeed, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
 	return config, nil
 }
 
-func getPairsFile() (value string, err error) {
+// LoadPairs reads the authors file with the email lookup settings of config
+// Broken authors are left out with a warning on stderr rather than failing.
+func (config *Configuration) LoadPairs() (pairs *Pairs, err error) {
+	opts, err := config.pairsOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, warning := range config.PairsFileWarnings {
+		fmt.Fprintf(os.Stderr, "git-duet: warning: %v\n", warning)
+	}
+	if pairs, err = NewPairsFromLayers(config.fs(), config.pairsFiles(), config.EmailLookup, opts...); err != nil {
+		return nil, err
+	}
+	for _, warning := range pairs.Warnings() {
+		fmt.Fprintf(os.Stderr, "git-duet: warning: %v\n", warning)
+	}
+
+	return pairs, nil
+}
+
+// pairsOptions returns the options loading the authors file with the
+// configuration takes
+func (config *Configuration) pairsOptions() (opts []Option, err error) {
+	opts = []Option{
+		WithLookupConcurrency(config.EmailLookupConcurrency),
+		WithInitialsHintLimit(config.InitialsHintLimit),
+		WithLenientEntries(),
+	}
+	opts = append(opts, config.trustOptions()...)
+	if config.Debug {
+		opts = append(opts, WithDebug(os.Stderr))
+	}
+	if config.EmailLookupDeferCheck {
+		opts = append(opts, WithDeferredLookupCheck())
+	}
+	if config.EmailLookupFallback {
+		opts = append(opts, WithLookupFailureFallback())
+	}
+	if config.EmailLookupTimeout > 0 {
+		opts = append(opts, WithLookupTimeout(config.EmailLookupTimeout))
+	}
+	if config.ResolverTimeout > 0 || config.ResolverBudget > 0 {
+		opts = append(opts, WithResolverTimeouts(config.ResolverTimeout, config.ResolverBudget))
+	}
+	if config.PrefixInitials {
+		opts = append(opts, WithPrefixMatching())
+	}
+	if config.GitHubAPIURL != "" || config.GitHubNoreplyDomain != "" {
+		opts = append(opts, WithGitHubNoreply(config.GitHubAPIURL, config.GitHubNoreplyDomain))
+	}
+	if config.GitLabURL != "" || config.GitLabNoreplyDomain != "" {
+		opts = append(opts, WithGitLab(config.GitLabURL, config.GitLabNoreplyDomain))
+	}
+	if config.DuplicatePeople {
+		opts = append(opts, WithDuplicatePeople())
+	}
+	if config.EmailLabel != "" {
+		opts = append(opts, WithEmailLabel(config.EmailLabel))
+	}
+	if config.PrivateEmail != "" {
+		opts = append(opts, WithPrivateEmail(ParsePrivateEmailConfig(config.PrivateEmail)))
+	}
+	if config.KeyLookup != "" {
+		opts = append(opts, WithKeyLookup(config.KeyLookup))
+	}
+	if config.EmailLookupCacheTTL > 0 || config.EmailLookupNegativeCacheTTL > 0 {
+		file, err := EmailLookupCacheFile()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithEmailLookupCache(file, config.EmailLookupCacheTTL, config.EmailLookupNegativeCacheTTL))
+	}
+
+	return opts, nil
+}
+
+// CoAuthorTrailerKey returns the trailer key used to credit co-authors:
+// $GIT_DUET_TRAILER_KEY, then `trailer_key` from the authors file (if there is
+// one), then DefaultTrailerKey
+func (config *Configuration) CoAuthorTrailerKey() (key string, err error) {
+	if config.TrailerKey != "" {
+		return config.TrailerKey, nil
+	}
+
+	if _, err = fs.Stat(config.fs(), config.PairsFile); errors.Is(err, fs.ErrNotExist) {
+		return DefaultTrailerKey, nil
+	}
+
+	pairs, err := NewPairsFromLayers(config.fs(), config.pairsFiles(), "", WithLenientEntries())
+	if _, empty := err.(*EmptyAuthorsFileError); empty {
+		return DefaultTrailerKey, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if key = pairs.TrailerKey(); key != "" {
+		return key, nil
+	}
+
+	return DefaultTrailerKey, nil
+}
+
+// GlobalConfigKey is the git config key consulted for the default scope
+// (see Configuration.Global) when $GIT_DUET_GLOBAL is not set
+const GlobalConfigKey = "duet.global"
+
+// TrustAuthorsFileCommandsConfigKey is the git config key that makes git-duet
+// run the `lookup_overrides` of every authors file, including the ones found
+// in the repository, included or fetched from a URL
+const TrustAuthorsFileCommandsConfigKey = "duet.trustAuthorsFileCommands"
+
+// getGlobalConfig reads GlobalConfigKey as a git boolean, false if not set
+func getGlobalConfig() (global bool, err error) {
+	return getBoolConfig(GlobalConfigKey)
+}
+
+// getBoolConfig reads key from git config as a git boolean, false if not set
+func getBoolConfig(key string) (value bool, err error) {
+	raw, err := (&GitConfig{}).getUnnamespacedKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(raw) {
+	case "", "false", "no", "off", "0":
+		return false, nil
+	case "true", "yes", "on", "1":
+		return true, nil
+	}
+	return false, fmt.Errorf("%s: invalid boolean %q", key, raw)
+}
+
+// untrust marks file, one of the stack, as untrusted (see UntrustedPairsFiles)
+func (config *Configuration) untrust(file, why string) {
+	if config.UntrustedPairsFiles == nil {
+		config.UntrustedPairsFiles = map[string]string{}
+	}
+	config.UntrustedPairsFiles[file] = why
+}
+
+// trustOptions returns the options telling which authors files are trusted
+// to run commands (see UntrustedPairsFiles)
+func (config *Configuration) trustOptions() (opts []Option) {
+	if config.TrustAuthorsFileCommands {
+		return []Option{WithTrustedAuthorsFileCommands()}
+	}
+	for file, why := range config.UntrustedPairsFiles {
+		opts = append(opts, WithUntrustedAuthorsFile(file, why))
+	}
+	return opts
+}
+
+// pairsFiles returns the stack of authors files to read, lowest first
+func (config *Configuration) pairsFiles() []string {
+	return append(append([]string{}, config.PairsFileLayers...), config.PairsFile)
+}
+
+// fs returns the filesystem the authors file is read from
+func (config *Configuration) fs() fs.FS {
+	if config.FS == nil {
+		return osFS{}
+	}
+	return config.FS
+}
+
+// AuthorsFileConfigKey is the git config key consulted for the authors file
+// location when $GIT_DUET_AUTHORS_FILE is not set
+const AuthorsFileConfigKey = "duet.authorsfile"
+
+// SetAuthorsFileConfig points git-duet at the given authors file via git config
+// (duet.authorsfile) in the repo config or, if global is set, the user config.
+// A relative path is stored as an absolute one, as it is given relative to the
+// working directory but read relative to the repo root; paths starting with
+// `~` (see ExpandPath) and URLs are stored as they are.
+func SetAuthorsFileConfig(path string, global bool) (err error) {
+	if !isAuthorsURL(path) && !isExpanded(path) && !filepath.IsAbs(path) {
+		if path, err = filepath.Abs(path); err != nil {
+			return err
+		}
+	}
+
+	gc := &GitConfig{Scope: Local}
+	if global {
+		gc.Scope = Global
+	}
+	return gc.setUnnamespacedKey(AuthorsFileConfigKey, path)
+}
+
+// getPairsFile looks for the authors file in order of precedence:
+// $GIT_DUET_AUTHORS_FILE (a list of files or URLs separated like $PATH, each
+// layered under the one before it), duet.authorsfile in the repo then user git config,
+// .git-authors in the working directory or a directory above it up to the
+// repo root and finally ~/.git-authors, returning its name in fsys and where
+// it was found (see Configuration.PairsFileSource). The organization defaults
+// file (see getDefaultsFile) is layered under it, and so are ~/.git-authors
+// and those further up in the repo under the nearest one. If none of them
+// exists, the defaults file is used on its own. Discovered are the files of
+// the stack found in the repository.
+func getPairsFile(fsys fs.FS) (value string, layers []string, source string, discovered []string, err error) {
 	authorsFile := ".git-authors"
-	defaultAuthorsFile := path.Join(os.Getenv("HOME"), authorsFile)
+	defaultAuthorsFile := fsName(fsys, path.Join(os.Getenv("HOME"), authorsFile))
+
+	defaults, defaultsSource, err := getDefaultsFile(fsys)
+	if err != nil {
+		return "", nil, "", nil, err
+	}
+	if defaults != "" {
+		layers = []string{defaults}
+	}
+	// the file given is the top of the stack, below the defaults unless it is
+	// the defaults file itself
+	explicit := func(file, source string) (string, []string, string, []string, error) {
+		if file == defaults {
+			return file, nil, source, nil, nil
+		}
+		return file, layers, source, nil, nil
+	}
 
-	if os.Getenv("GIT_DUET_AUTHORS_FILE") != "" {
-		return os.Getenv("GIT_DUET_AUTHORS_FILE"), nil
+	if list := os.Getenv("GIT_DUET_AUTHORS_FILE"); list != "" {
+		var files []string
+		for _, original := range splitAuthorsFileList(list) {
+			if original == "" {
+				continue
+			}
+			if isAuthorsURL(original) {
+				// fetched once the stack is known (see fetchRemotePairsFiles)
+				files = append(files, original)
+				continue
+			}
+			expanded := ExpandPath(original)
+			if isExpanded(original) {
+				// a typo in ~user or %VAR% is easier to spot with both in the error
+				if _, err := lstat(fsys, fsName(fsys, expanded)); errors.Is(err, fs.ErrNotExist) {
+					return "", nil, "", nil, &AuthorsFileNotFoundError{Tried: []string{fmt.Sprintf("$GIT_DUET_AUTHORS_FILE (%s does not exist)",
+						describeExpandedPath(original, expanded))}}
+				}
+			}
+			files = append(files, fsName(fsys, expanded))
+		}
+		if len(files) > 0 {
+			// the first file wins, as in $PATH
+			for i := len(files) - 1; i > 0; i-- {
+				if files[i] != defaults {
+					layers = append(layers, files[i])
+				}
+			}
+			return explicit(files[0], "$GIT_DUET_AUTHORS_FILE")
+		}
 	}
+	tried := []string{"$GIT_DUET_AUTHORS_FILE (not set)"}
 
-	gitDirectory, err := exec.Command("git", "rev-parse", "--show-toplevel").CombinedOutput()
+	gitDirectory, err := exec.Command("git", "rev-parse", "--show-toplevel", "--show-prefix").CombinedOutput()
 	if err != nil {
-		if bytes.Contains(gitDirectory, []byte("Not a git repository")) ||
-			bytes.Contains(gitDirectory, []byte("not a git repository")) {
-			return defaultAuthorsFile, nil
+		if !bytes.Contains(gitDirectory, []byte("Not a git repository")) &&
+			!bytes.Contains(gitDirectory, []byte("not a git repository")) {
+			return "", nil, "", nil, err
 		}
-		return "", err
+		gitDirectory = nil
+	}
+	// the prefix is the working directory relative to the root, if below it
+	toplevel, prefix := strings.TrimSpace(string(gitDirectory)), ""
+	if i := strings.Index(toplevel, "\n"); i >= 0 {
+		toplevel, prefix = strings.TrimSpace(toplevel[:i]), strings.Trim(strings.TrimSpace(toplevel[i+1:]), "/")
+	}
+
+	configs := []*GitConfig{{Scope: Global}}
+	if toplevel != "" {
+		configs = []*GitConfig{{Scope: Local}, {Scope: Global}}
 	}
+	for _, gc := range configs {
+		configured, err := gc.getUnnamespacedKey(AuthorsFileConfigKey)
+		if err != nil {
+			return "", nil, "", nil, err
+		}
+		source := fmt.Sprintf("git config --global %s", AuthorsFileConfigKey)
+		if gc.Scope == Local {
+			source = fmt.Sprintf("git config --local %s", AuthorsFileConfigKey)
+		}
+		if configured == "" {
+			tried = append(tried, source+" (not set)")
+			continue
+		}
 
-	gitDirectoryAuthors := path.Join(strings.TrimSpace(string(gitDirectory)), authorsFile)
-	if _, err := os.Stat(gitDirectoryAuthors); err == nil {
-		return gitDirectoryAuthors, nil
+		original := configured
+		configured = expandAuthorsFilePath(configured, toplevel)
+		if _, err := lstat(fsys, fsName(fsys, configured)); errors.Is(err, fs.ErrNotExist) {
+			tried = append(tried, fmt.Sprintf("%s (%s does not exist)", source, describeExpandedPath(original, configured)))
+			return "", nil, "", nil, &AuthorsFileNotFoundError{Tried: tried}
+		}
+		return explicit(fsName(fsys, configured), source)
 	}
 
-	return defaultAuthorsFile, nil
+	stack, source := layers, defaultsSource
+	if _, err := fs.Stat(fsys, defaultAuthorsFile); err == nil {
+		stack, source = append(stack, defaultAuthorsFile), "~/.git-authors"
+	}
+	if toplevel != "" {
+		// from the root down to the working directory, the nearest on top
+		dirs := []string{toplevel}
+		if prefix != "" {
+			for _, part := range strings.Split(prefix, "/") {
+				dirs = append(dirs, path.Join(dirs[len(dirs)-1], part))
+			}
+		}
+		for i, dir := range dirs {
+			gitDirectoryAuthors := fsName(fsys, path.Join(dir, authorsFile))
+			if _, err := fs.Stat(fsys, gitDirectoryAuthors); err != nil || gitDirectoryAuthors == defaultAuthorsFile {
+				continue
+			}
+			stack, source = append(stack, gitDirectoryAuthors), ".git-authors at the repository root"
+			discovered = append(discovered, gitDirectoryAuthors)
+			if i > 0 {
+				source = fmt.Sprintf(".git-authors in %s", strings.Join(strings.Split(prefix, "/")[:i], "/"))
+			}
+		}
+	}
+
+	if len(stack) == 0 {
+		return defaultAuthorsFile, nil, "~/.git-authors", nil, nil
+	}
+	return stack[len(stack)-1], stack[:len(stack)-1], source, discovered, nil
+}
+
+// getDefaultsFile returns the name in fsys of the organization defaults file
+// and where it was found: $GIT_DUET_DEFAULTS_FILE, which must exist, otherwise
+// SystemDefaultsFile if it exists, otherwise nothing
+func getDefaultsFile(fsys fs.FS) (value, source string, err error) {
+	if original := os.Getenv("GIT_DUET_DEFAULTS_FILE"); original != "" {
+		expanded := ExpandPath(original)
+		if _, err := fs.Stat(fsys, fsName(fsys, expanded)); errors.Is(err, fs.ErrNotExist) {
+			return "", "", &AuthorsFileNotFoundError{Tried: []string{fmt.Sprintf("$GIT_DUET_DEFAULTS_FILE (%s does not exist)",
+				describeExpandedPath(original, expanded))}}
+		}
+		return fsName(fsys, expanded), "$GIT_DUET_DEFAULTS_FILE", nil
+	}
+
+	if _, err := fs.Stat(fsys, fsName(fsys, SystemDefaultsFile)); err == nil {
+		return fsName(fsys, SystemDefaultsFile), SystemDefaultsFile, nil
+	}
+	return "", "", nil
+}
+
+// expandAuthorsFilePath expands file (see ExpandPath) and resolves relative
+// paths against the repo toplevel (if there is one)
+func expandAuthorsFilePath(file, toplevel string) string {
+	file = ExpandPath(file)
+	if !filepath.IsAbs(file) && toplevel != "" {
+		return path.Join(toplevel, file)
+	}
+	return file
 }
 
 func getenvDefault(key, defaultValue string) (value string) {
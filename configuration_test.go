@@ -0,0 +1,150 @@
+package duet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// isolate runs the test outside any repository, with no git config but its
+// own and none of the GIT_DUET_ environment variables set, HOME being
+// /home/jane
+func isolate(t *testing.T) {
+	t.Helper()
+	chdir(t, t.TempDir())
+	for _, env := range os.Environ() {
+		if name := strings.SplitN(env, "=", 2)[0]; strings.HasPrefix(name, "GIT_DUET_") {
+			setenv(t, name, "")
+		}
+	}
+	setenv(t, "GIT_CONFIG_GLOBAL", os.DevNull)
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+	setenv(t, "HOME", "/home/jane")
+}
+
+// setenv sets the environment variable name for the test, like t.Setenv in
+// newer Go versions
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+	previous, set := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// chdir changes the working directory to dir for the test, like t.Chdir in
+// newer Go versions
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+const testAuthorsFile = `authors:
+  jd: Jane Doe; jane
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+`
+
+func TestNewConfigurationFS(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		files      fstest.MapFS
+		wantFile   string
+		wantLayers []string
+		wantSource string
+	}{
+		{
+			name:       "home",
+			files:      fstest.MapFS{"home/jane/.git-authors": {Data: []byte(testAuthorsFile)}},
+			wantFile:   "home/jane/.git-authors",
+			wantSource: "~/.git-authors",
+		},
+		{
+			name:       "environment",
+			env:        map[string]string{"GIT_DUET_AUTHORS_FILE": "/work/authors.yml"},
+			files:      fstest.MapFS{"work/authors.yml": {Data: []byte(testAuthorsFile)}},
+			wantFile:   "work/authors.yml",
+			wantSource: "$GIT_DUET_AUTHORS_FILE",
+		},
+		{
+			name: "layered over the defaults",
+			env:  map[string]string{"GIT_DUET_DEFAULTS_FILE": "/etc/org.yml"},
+			files: fstest.MapFS{
+				"etc/org.yml":            {Data: []byte("email:\n  domain: org.local\n")},
+				"home/jane/.git-authors": {Data: []byte(testAuthorsFile)},
+			},
+			wantFile:   "home/jane/.git-authors",
+			wantLayers: []string{"etc/org.yml"},
+			wantSource: "~/.git-authors",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			for name, value := range tt.env {
+				setenv(t, name, value)
+			}
+
+			config, err := NewConfigurationFS(tt.files)
+			if err != nil {
+				t.Fatalf("NewConfigurationFS: %v", err)
+			}
+			if config.PairsFile != tt.wantFile {
+				t.Errorf("PairsFile = %q, want %q", config.PairsFile, tt.wantFile)
+			}
+			if strings.Join(config.PairsFileLayers, ",") != strings.Join(tt.wantLayers, ",") {
+				t.Errorf("PairsFileLayers = %q, want %q", config.PairsFileLayers, tt.wantLayers)
+			}
+			if config.PairsFileSource != tt.wantSource {
+				t.Errorf("PairsFileSource = %q, want %q", config.PairsFileSource, tt.wantSource)
+			}
+
+			pairs, err := config.LoadPairs()
+			if err != nil {
+				t.Fatalf("LoadPairs: %v", err)
+			}
+			pair, err := pairs.ByInitials("jd")
+			if err != nil {
+				t.Fatalf("ByInitials: %v", err)
+			}
+			if pair.Email != "jane@hamster.info.local" {
+				t.Errorf("Email = %q, want jane@hamster.info.local", pair.Email)
+			}
+		})
+	}
+}
+
+func TestNewConfigurationFSMissingFile(t *testing.T) {
+	isolate(t)
+	gitconfig := filepath.Join(t.TempDir(), "gitconfig")
+	if err := os.WriteFile(gitconfig, []byte("[duet]\n\tauthorsfile = /work/authors.yml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "GIT_CONFIG_GLOBAL", gitconfig)
+
+	_, err := NewConfigurationFS(fstest.MapFS{"home/jane/.git-authors": {Data: []byte(testAuthorsFile)}})
+	var notFound *AuthorsFileNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("NewConfigurationFS: got %v, want an AuthorsFileNotFoundError", err)
+	}
+}
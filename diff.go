@@ -0,0 +1,136 @@
+package duet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// PairsDiff is what changed between two authors files (see DiffPairs), by
+// initials: the authors only in the new file, those only in the old one and
+// those in both with a different name, username, email or signing key
+type PairsDiff struct {
+	Added   []*Pair        `json:"added"`
+	Removed []*Pair        `json:"removed"`
+	Changed []AuthorChange `json:"changed"`
+}
+
+// AuthorChange is an author in both files of a PairsDiff, with the fields that
+// differ in order of Pair
+type AuthorChange struct {
+	Initials string        `json:"initials"`
+	Fields   []FieldChange `json:"fields"`
+}
+
+// FieldChange is a field of an author that differs between two authors files
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Empty reports whether the two authors files have the same authors
+func (d *PairsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffPairs compares the authors of old and new by initials. Each side is
+// resolved with its own settings, so a new email domain shows up as a changed
+// email for every author it applies to.
+func DiffPairs(old, new *Pairs) (diff *PairsDiff, err error) {
+	oldPairs, err := old.All()
+	if err != nil {
+		return nil, err
+	}
+	newPairs, err := new.All()
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[string]*Pair, len(oldPairs))
+	for _, p := range oldPairs {
+		before[p.Initials] = p
+	}
+	after := make(map[string]*Pair, len(newPairs))
+	for _, p := range newPairs {
+		after[p.Initials] = p
+	}
+
+	// both lists are sorted by initials (see All)
+	diff = &PairsDiff{Added: []*Pair{}, Removed: []*Pair{}, Changed: []AuthorChange{}}
+	for _, p := range oldPairs {
+		if _, ok := after[p.Initials]; !ok {
+			diff.Removed = append(diff.Removed, p)
+		}
+	}
+	for _, p := range newPairs {
+		o, ok := before[p.Initials]
+		if !ok {
+			diff.Added = append(diff.Added, p)
+			continue
+		}
+		if fields := diffPair(o, p); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, AuthorChange{Initials: p.Initials, Fields: fields})
+		}
+	}
+
+	return diff, nil
+}
+
+func diffPair(old, new *Pair) (fields []FieldChange) {
+	for _, f := range []FieldChange{
+		{"name", old.Name, new.Name},
+		{"username", old.Username, new.Username},
+		{"email", old.Email, new.Email},
+		{"signing_key", old.SigningKey, new.SigningKey},
+	} {
+		if f.Old != f.New {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// WriteDiff writes diff to w, one line per added (+) or removed (-) author
+// and per changed field (~), or as JSON
+func WriteDiff(w io.Writer, diff *PairsDiff, asJSON bool) error {
+	if asJSON {
+		output, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(output))
+		return err
+	}
+
+	if diff.Empty() {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+	for _, p := range diff.Added {
+		if _, err := fmt.Fprintf(w, "+ %s %s <%s>\n", p.Initials, p.Name, p.Email); err != nil {
+			return err
+		}
+	}
+	for _, p := range diff.Removed {
+		if _, err := fmt.Fprintf(w, "- %s %s <%s>\n", p.Initials, p.Name, p.Email); err != nil {
+			return err
+		}
+	}
+	for _, c := range diff.Changed {
+		for _, f := range c.Fields {
+			if _, err := fmt.Fprintf(w, "~ %s %s: %s -> %s\n", c.Initials, f.Field, quoteEmpty(f.Old), quoteEmpty(f.New)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// quoteEmpty shows an empty field as "" rather than nothing
+func quoteEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
@@ -0,0 +1,364 @@
+package duet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinimumGitVersion is the oldest git with `git interpret-trailers --in-place`,
+// which the prepare-commit-msg hook relies on
+const MinimumGitVersion = "2.8.0"
+
+// doctorLookupTimeout is how long Doctor waits for the email lookup command
+const doctorLookupTimeout = 5 * time.Second
+
+// Severity tells how bad a Diagnostic is
+type Severity int
+
+// SeverityOK is a check that passed, SeverityWarning one that works but is
+// likely to surprise someone and SeverityError one that breaks git-duet
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// String returns the name of the severity (ok, warning or error)
+func (s Severity) String() string {
+	switch s {
+	case SeverityOK:
+		return "ok"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// MarshalText encodes the severity by name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Codes of the diagnostics returned by Doctor and Lint. Like the error codes (see
+// NewErrorReport) they are never renamed or removed.
+const (
+	DiagnosticGitVersion           = "git_version"
+	DiagnosticGitTooOld            = "git_too_old"
+	DiagnosticGitMissing           = "git_missing"
+	DiagnosticConfigurationInvalid = "configuration_invalid"
+	DiagnosticAuthorsFile          = "authors_file"
+	DiagnosticAuthorsFileMissing   = "authors_file_missing"
+	DiagnosticAuthorsFileInvalid   = "authors_file_invalid"
+	DiagnosticAuthorsFileStale     = "authors_file_stale"
+	DiagnosticBrokenAuthor         = "broken_author"
+	DiagnosticLookupNotConfigured  = "lookup_not_configured"
+	DiagnosticLookup               = "lookup"
+	DiagnosticLookupMissing        = "lookup_missing"
+	DiagnosticLookupFailed         = "lookup_failed"
+	DiagnosticLookupTimeout        = "lookup_timeout"
+	DiagnosticPair                 = "pair"
+	DiagnosticPairNotConfigured    = "pair_not_configured"
+	DiagnosticPairStale            = "pair_stale"
+	DiagnosticPairExpired          = "pair_expired"
+	DiagnosticPairInvalid          = "pair_invalid"
+	DiagnosticNotInRepository      = "not_in_repository"
+	DiagnosticHooksNotInstalled    = "hooks_not_installed"
+	DiagnosticHookCurrent          = "hook_current"
+	DiagnosticHookOutdated         = "hook_outdated"
+	DiagnosticHookForeign          = "hook_foreign"
+	DiagnosticHooksUnreadable      = "hooks_unreadable"
+	DiagnosticDuplicateKey         = "duplicate_key"
+	DiagnosticAuthorInvalid        = "author_invalid"
+	DiagnosticSharedEmail          = "shared_email"
+	DiagnosticSquadInvalid         = "squad_invalid"
+	DiagnosticSquadShadowed        = "squad_shadowed"
+)
+
+// Diagnostic is the outcome of one of the checks of Doctor or Lint: Check
+// names what was checked (e.g. "authors file"), Code is one of the Diagnostic
+// constants and Message explains it to humans
+type Diagnostic struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+// Doctor checks the usual suspects when git-duet misbehaves: the git version,
+// the authors file (and where it was found), the email lookup command (run
+// for the first author), the pair of the current repository (or the global
+// one outside of a repository) and the hooks installed. Checks that do not
+// apply (e.g. hooks outside of a repository) or cannot run because an earlier
+// one failed are left out.
+func Doctor() (diagnostics []Diagnostic) {
+	diagnostics = append(diagnostics, checkGitVersion())
+
+	config, err := NewConfiguration()
+	if err != nil {
+		code := DiagnosticConfigurationInvalid
+		if _, ok := err.(*AuthorsFileNotFoundError); ok {
+			code = DiagnosticAuthorsFileMissing
+		}
+		diagnostics = append(diagnostics, Diagnostic{"configuration", SeverityError, code, err.Error()})
+		return append(diagnostics, checkHooks()...)
+	}
+
+	pairs, authors := config.checkAuthorsFile()
+	diagnostics = append(diagnostics, authors...)
+	if pairs != nil {
+		diagnostics = append(diagnostics, config.checkLookup(pairs))
+	}
+	diagnostics = append(diagnostics, config.checkPair()...)
+
+	return append(diagnostics, checkHooks()...)
+}
+
+// DiagnosticsPassed returns whether none of diagnostics is an error
+func DiagnosticsPassed(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteDiagnostics writes diagnostics to w as a report, a line per diagnostic
+// and the overall outcome, or as a JSON object with `passed` and
+// `diagnostics`
+func WriteDiagnostics(w io.Writer, diagnostics []Diagnostic, asJSON bool) error {
+	passed := DiagnosticsPassed(diagnostics)
+	if asJSON {
+		if diagnostics == nil {
+			diagnostics = []Diagnostic{}
+		}
+		output, err := json.Marshal(struct {
+			Passed      bool         `json:"passed"`
+			Diagnostics []Diagnostic `json:"diagnostics"`
+		}{passed, diagnostics})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(output))
+		return err
+	}
+
+	counts := map[Severity]int{}
+	for _, d := range diagnostics {
+		counts[d.Severity]++
+		if _, err := fmt.Fprintf(w, "%-8s %s: %s\n", d.Severity, d.Check, d.Message); err != nil {
+			return err
+		}
+	}
+
+	outcome := "passed"
+	if !passed {
+		outcome = "failed"
+	}
+	_, err := fmt.Fprintf(w, "\n%s (%s, %s)\n", outcome,
+		plural(counts[SeverityError], "error"), plural(counts[SeverityWarning], "warning"))
+	return err
+}
+
+// plural returns "1 thing" or "n things"
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
+
+var gitVersionRegexp = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// checkGitVersion compares the version of git with MinimumGitVersion
+func checkGitVersion() Diagnostic {
+	output, err := exec.Command("git", "version").Output()
+	if err != nil {
+		return Diagnostic{"git", SeverityError, DiagnosticGitMissing, fmt.Sprintf("could not run git: %v", err)}
+	}
+	version := strings.TrimSpace(string(output))
+
+	if compareVersions(gitVersionRegexp.FindString(version), MinimumGitVersion) < 0 {
+		return Diagnostic{"git", SeverityError, DiagnosticGitTooOld,
+			fmt.Sprintf("%s is too old, the hooks need git %s or newer", version, MinimumGitVersion)}
+	}
+	return Diagnostic{"git", SeverityOK, DiagnosticGitVersion, version}
+}
+
+// compareVersions compares dotted versions numerically, -1 if a is older than
+// b, 1 if newer and 0 if they are the same. Missing parts count as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// checkAuthorsFile loads the authors file, returning nil pairs if it cannot be
+// loaded. Broken authors are reported as warnings.
+func (config *Configuration) checkAuthorsFile() (pairs *Pairs, diagnostics []Diagnostic) {
+	pairs, err := NewPairsFromLayers(config.fs(), config.pairsFiles(), config.EmailLookup,
+		append(config.trustOptions(), WithLenientEntries(), WithDeferredLookupCheck())...)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, []Diagnostic{{"authors file", SeverityError, DiagnosticAuthorsFileMissing,
+			fmt.Sprintf("there is no authors file at %s (%s), create one or point $GIT_DUET_AUTHORS_FILE at one",
+				config.PairsFile, config.PairsFileSource)}}
+	}
+	if err != nil {
+		return nil, []Diagnostic{{"authors file", SeverityError, DiagnosticAuthorsFileInvalid,
+			fmt.Sprintf("%v (found via %s)", err, config.PairsFileSource)}}
+	}
+
+	message := fmt.Sprintf("%s (found via %s) lists %d authors", config.PairsFile, config.PairsFileSource, pairs.Len())
+	if len(config.PairsFileLayers) > 0 {
+		message += ", layered on " + strings.Join(config.PairsFileLayers, ", ")
+	}
+	diagnostics = append(diagnostics, Diagnostic{"authors file", SeverityOK, DiagnosticAuthorsFile, message})
+	for _, warning := range config.PairsFileWarnings {
+		diagnostics = append(diagnostics, Diagnostic{"authors file", SeverityWarning, DiagnosticAuthorsFileStale, warning.Error()})
+	}
+	for _, warning := range pairs.Warnings() {
+		diagnostics = append(diagnostics, Diagnostic{"authors file", SeverityWarning, DiagnosticBrokenAuthor, warning.Error()})
+	}
+
+	return pairs, diagnostics
+}
+
+// checkLookup checks the email lookup commands exist and runs the global one
+// for the first author
+func (config *Configuration) checkLookup(pairs *Pairs) Diagnostic {
+	if err := pairs.checkLookupCommands(); err != nil {
+		return Diagnostic{"email lookup", SeverityError, DiagnosticLookupMissing, err.Error()}
+	}
+	if config.EmailLookup == "" {
+		return Diagnostic{"email lookup", SeverityOK, DiagnosticLookupNotConfigured, "no email lookup command configured"}
+	}
+
+	initials := pairs.Initials()[0]
+	name, username, _ := pairs.file.author(initials)
+	ctx, cancel := context.WithTimeout(context.Background(), doctorLookupTimeout)
+	defer cancel()
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, config.EmailLookup, initials, name, username)
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return Diagnostic{"email lookup", SeverityError, DiagnosticLookupTimeout,
+			fmt.Sprintf("%s did not answer for %s within %s", config.EmailLookup, initials, doctorLookupTimeout)}
+	}
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == LookupNoEmailExitCode {
+		err = nil
+	}
+	if err != nil {
+		lookupErr := &LookupFailedError{Initials: initials, Err: err, Stderr: strings.TrimSpace(stderr.String())}
+		return Diagnostic{"email lookup", SeverityError, DiagnosticLookupFailed, lookupErr.Error()}
+	}
+
+	email := strings.TrimSpace(string(normalizeNewlines(out.Bytes())))
+	if email == "" {
+		email = "no email"
+	}
+	return Diagnostic{"email lookup", SeverityOK, DiagnosticLookup,
+		fmt.Sprintf("%s answered %s for %s in %s", config.EmailLookup, email, initials, elapsed)}
+}
+
+// checkPair reports the pair git-duet would commit as and whether it is stale
+func (config *Configuration) checkPair() (diagnostics []Diagnostic) {
+	gitConfig := &GitConfig{Namespace: config.Namespace}
+	if config.Global {
+		gitConfig.Scope = Global
+	}
+
+	duetConfig, err := gitConfig.GetConfig()
+	switch err.(type) {
+	case nil:
+	case *NotConfiguredError:
+		return []Diagnostic{{"pair", SeverityWarning, DiagnosticPairNotConfigured,
+			"no pair configured, set one with `git duet` or `git solo`"}}
+	case *PairExpiredError:
+		return []Diagnostic{{"pair", SeverityWarning, DiagnosticPairExpired, err.Error()}}
+	default:
+		return []Diagnostic{{"pair", SeverityError, DiagnosticPairInvalid, err.Error()}}
+	}
+
+	var people []string
+	if duetConfig.Author != nil {
+		people = append(people, duetConfig.Author.Initials)
+	}
+	for _, p := range duetConfig.CoAuthors {
+		people = append(people, p.Initials)
+	}
+	message := fmt.Sprintf("%s (%s config)", strings.Join(people, " "), duetConfig.Scope)
+	if duetConfig.Mtime.IsZero() {
+		return []Diagnostic{{"pair", SeverityOK, DiagnosticPair, message}}
+	}
+
+	age := time.Since(duetConfig.Mtime).Round(time.Second)
+	message = fmt.Sprintf("%s, set %s ago", message, age)
+	if duetConfig.Mtime.Add(config.StaleCutoff).Before(time.Now()) {
+		return []Diagnostic{{"pair", SeverityWarning, DiagnosticPairStale,
+			fmt.Sprintf("%s, the pre-commit hook rejects commits after %s, set it again with `git duet` or `git solo`",
+				message, config.StaleCutoff)}}
+	}
+	return []Diagnostic{{"pair", SeverityOK, DiagnosticPair, message}}
+}
+
+// checkHooks reports the state of every hook of the current repository
+func checkHooks() (diagnostics []Diagnostic) {
+	if !insideRepo() {
+		return []Diagnostic{{"hooks", SeverityOK, DiagnosticNotInRepository, "not in a git repository, hooks not checked"}}
+	}
+
+	reports, err := CheckHooks(".")
+	if err != nil {
+		return []Diagnostic{{"hooks", SeverityError, DiagnosticHooksUnreadable, err.Error()}}
+	}
+	if len(reports) == 0 {
+		return []Diagnostic{{"hooks", SeverityOK, DiagnosticHooksNotInstalled,
+			"no hooks installed, install them with `git duet-install-hook`"}}
+	}
+
+	for _, report := range reports {
+		check := report.Hook + " hook"
+		switch report.Status {
+		case HookCurrent:
+			diagnostics = append(diagnostics, Diagnostic{check, SeverityOK, DiagnosticHookCurrent, report.Path})
+		case HookOutdated:
+			diagnostics = append(diagnostics, Diagnostic{check, SeverityWarning, DiagnosticHookOutdated,
+				fmt.Sprintf("%s is version %d of %d, upgrade it with `git duet-install-hook --force %s`",
+					report.Path, report.Version, HookVersion, report.Hook)})
+		default:
+			diagnostics = append(diagnostics, Diagnostic{check, SeverityOK, DiagnosticHookForeign,
+				fmt.Sprintf("%s was not installed by git-duet", report.Path)})
+		}
+	}
+	return diagnostics
+}
@@ -1,6 +1,37 @@
 package duet
 
-import "os/exec"
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// replayMarkers are left in the git dir while existing commits are replayed
+var replayMarkers = []string{"rebase-merge", "rebase-apply", "CHERRY_PICK_HEAD"}
+
+// ReplayInProgress returns whether git is replaying existing commits (a rebase
+// or cherry-pick), whose authorship is left alone
+func ReplayInProgress() bool {
+	output, err := exec.Command("git", "rev-parse", "--git-dir").Output()
+	if err != nil {
+		return false
+	}
+	gitDir := strings.TrimSpace(string(output))
+
+	for _, marker := range replayMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeInProgress returns whether a merge is being concluded (a commit made now
+// is the merge commit)
+func MergeInProgress() bool {
+	return exec.Command("git", "rev-parse", "-q", "--verify", "MERGE_HEAD").Run() == nil
+}
 
 type ignorableCommand struct {
 	*exec.Cmd
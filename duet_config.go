@@ -0,0 +1,133 @@
+package duet
+
+import (
+	"os/exec"
+	"time"
+)
+
+// DuetConfig is everything git-duet has configured (see GitConfig.GetConfig)
+// Committer is the next committer and CoAuthors are all committers in order
+// (credited as co-authors in co-authored-by mode). Unset values are nil/zero.
+// AuthorsFile is left for the commands to fill in from Configuration.PairsFile.
+type DuetConfig struct {
+	Author       *Pair      `json:"author"`
+	Committer    *Pair      `json:"committer"`
+	CoAuthors    []*Pair    `json:"co_authors"`
+	Mtime        time.Time  `json:"mtime"`
+	Expires      *time.Time `json:"expires,omitempty"`
+	Session      *Session   `json:"session,omitempty"`
+	Scope        scope      `json:"scope"`
+	CoAuthoredBy bool       `json:"co_authored_by"`
+	AuthorsFile  string     `json:"authors_file,omitempty"`
+}
+
+// Session is when the configured people started pairing and how many seconds
+// ago that was (see GitConfig.SessionDuration)
+type Session struct {
+	Start   time.Time `json:"start"`
+	Seconds int64     `json:"seconds"`
+}
+
+// NotConfiguredError is returned by GetConfig when neither an author nor
+// committers are configured
+type NotConfiguredError struct{}
+
+func (e *NotConfiguredError) Error() string {
+	return "neither an author nor committers are configured"
+}
+
+// AuthorNotSetError is returned when committing (or looking for the config to
+// commit with) without an author configured
+type AuthorNotSetError struct{}
+
+func (e *AuthorNotSetError) Error() string {
+	return "git-author not set"
+}
+
+// GetConfig reads back the full configuration
+// If scope is Default the repo config is used if anything is configured there,
+// otherwise the user config (Scope reports which one was read). Returns a
+// *PairExpiredError if the configuration has expired.
+func (gc *GitConfig) GetConfig() (config *DuetConfig, err error) {
+	sources := []*GitConfig{gc}
+	if gc.Scope == Default {
+		sources = []*GitConfig{{Namespace: gc.Namespace, Scope: Global}}
+		if insideRepo() {
+			sources = append([]*GitConfig{{Namespace: gc.Namespace, Scope: Local}}, sources...)
+		}
+	}
+
+	for _, source := range sources {
+		config = &DuetConfig{Scope: source.Scope, CoAuthoredBy: gc.CoAuthoredBy}
+		if config.Author, err = source.GetAuthor(); err != nil {
+			return nil, err
+		}
+		if config.CoAuthors, err = source.GetCommitters(); err != nil {
+			return nil, err
+		}
+		if config.Mtime, err = source.GetMtime(); err != nil {
+			return nil, err
+		}
+
+		if config.Author == nil && config.CoAuthors == nil {
+			continue
+		}
+		if err = source.CheckExpiry(); err != nil {
+			return nil, err
+		}
+		if expires, err := source.GetExpiry(); err != nil {
+			return nil, err
+		} else if !expires.IsZero() {
+			config.Expires = &expires
+		}
+		if start, err := source.GetSessionStart(); err != nil {
+			return nil, err
+		} else if !start.IsZero() {
+			config.Session = &Session{Start: start, Seconds: int64(sessionDuration(start, time.Now()).Seconds())}
+		}
+		if len(config.CoAuthors) > 0 {
+			config.Committer = config.CoAuthors[0]
+		}
+		return config, nil
+	}
+
+	return nil, &NotConfiguredError{}
+}
+
+// ShadowedGlobalAuthor returns the authors configured in both the repository
+// and the global config, in which case the repository's is the one used for
+// commits unless Configuration.Global is set. Both are nil otherwise (or
+// outside a repository).
+func ShadowedGlobalAuthor(namespace string) (local, global *Pair, err error) {
+	if !insideRepo() {
+		return nil, nil, nil
+	}
+	if local, err = (&GitConfig{Namespace: namespace, Scope: Local}).GetAuthor(); err != nil || local == nil {
+		return nil, nil, err
+	}
+	if global, err = (&GitConfig{Namespace: namespace, Scope: Global}).GetAuthor(); err != nil || global == nil {
+		return nil, nil, err
+	}
+	return local, global, nil
+}
+
+// String returns the name of the scope (default, local or global)
+func (s scope) String() string {
+	switch s {
+	case Local:
+		return "local"
+	case Global:
+		return "global"
+	default:
+		return "default"
+	}
+}
+
+// MarshalText encodes the scope by name
+func (s scope) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func insideRepo() bool {
+	return exec.Command("git", "rev-parse", "--git-dir").Run() == nil
+}
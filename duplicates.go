@@ -0,0 +1,49 @@
+package duet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DuplicatePersonError is returned when someone would be in a pair twice,
+// either given twice (Initials are the same) or under initials resolving to
+// the same email
+type DuplicatePersonError struct {
+	Initials [2]string
+	Email    string
+}
+
+func (e *DuplicatePersonError) Error() string {
+	if e.Initials[0] == e.Initials[1] {
+		return fmt.Sprintf("%s is given more than once", e.Initials[0])
+	}
+	return fmt.Sprintf("%s and %s are the same person (%s)", e.Initials[0], e.Initials[1], e.Email)
+}
+
+// CheckDistinctPeople returns a *DuplicatePersonError for the first two of
+// people with the same initials or email (ignoring case). In private mode, the
+// addresses they replaced are compared as well.
+func CheckDistinctPeople(people []*Pair) error {
+	for i, p := range people {
+		for _, other := range people[:i] {
+			if other.Initials == p.Initials {
+				return &DuplicatePersonError{Initials: [2]string{other.Initials, p.Initials}, Email: p.Email}
+			}
+			if email := sameEmail(other, p); email != "" {
+				return &DuplicatePersonError{Initials: [2]string{other.Initials, p.Initials}, Email: email}
+			}
+		}
+	}
+	return nil
+}
+
+// sameEmail returns the email shared by a and b, if any
+func sameEmail(a, b *Pair) string {
+	if strings.EqualFold(a.Email, b.Email) {
+		return a.Email
+	}
+	if a.RealEmail != "" && strings.EqualFold(a.RealEmail, b.RealEmail) {
+		return a.RealEmail
+	}
+	return ""
+}
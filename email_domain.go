@@ -0,0 +1,45 @@
+package duet
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// NoEmailDomainError is returned when the email of the authors with the given
+// initials has to be made up from their name or username and `email.domain`
+// is not set. UserEmailDomain is the domain of user.email in git config, if
+// any, as a hint.
+type NoEmailDomainError struct {
+	Initials        []string
+	UserEmailDomain string
+}
+
+func (e *NoEmailDomainError) Error() string {
+	message := fmt.Sprintf("cannot make up an email for %s: email.domain is not set in the authors file. "+
+		"Set it, or give an email with an email entry, email_addresses, email_template or "+
+		"GIT_DUET_EMAIL_LOOKUP_COMMAND", strings.Join(e.Initials, ", "))
+	if e.UserEmailDomain != "" {
+		message += fmt.Sprintf(" (user.email is at %s, `email: {domain: %s}` would use it)", e.UserEmailDomain, e.UserEmailDomain)
+	}
+	return message
+}
+
+// noEmailDomain returns a *NoEmailDomainError for initials
+func noEmailDomain(initials ...string) *NoEmailDomainError {
+	return &NoEmailDomainError{Initials: initials, UserEmailDomain: userEmailDomain()}
+}
+
+// userEmailDomain returns the domain of user.email in git config, empty if it
+// is not set
+func userEmailDomain() string {
+	output, err := exec.Command("git", "config", "user.email").Output()
+	if err != nil {
+		return ""
+	}
+	email := strings.TrimSpace(string(output))
+	if !isEmailAddress(email) {
+		return ""
+	}
+	return email[strings.Index(email, "@")+1:]
+}
@@ -0,0 +1,136 @@
+package duet
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EmailLabelConfigKey is the git config key selecting which of the labeled
+// addresses in `email_addresses` authors use (see WithEmailLabel)
+const EmailLabelConfigKey = "duet.emailLabel"
+
+// emailAddresses is an `email_addresses` entry, either an address or labeled
+// addresses (e.g. `work` and `oss`) in the order of the file, the first being
+// the default. Entries that are neither are kept (invalid) so they can be
+// reported per author.
+type emailAddresses struct {
+	address string
+	labels  []string
+	labeled map[string]string
+	invalid bool
+}
+
+func (e *emailAddresses) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.address); err == nil {
+		return nil
+	}
+
+	var labeled yaml.MapSlice
+	if err := unmarshal(&labeled); err != nil {
+		e.invalid = true
+		return nil
+	}
+	e.labeled = map[string]string{}
+	for _, item := range labeled {
+		label, ok := item.Key.(string)
+		address, isString := item.Value.(string)
+		if !ok || !isString {
+			e.invalid = true
+			return nil
+		}
+		e.labels = append(e.labels, label)
+		e.labeled[label] = address
+	}
+	return nil
+}
+
+func (e emailAddresses) MarshalYAML() (interface{}, error) {
+	if e.labeled == nil {
+		return e.address, nil
+	}
+	labeled := yaml.MapSlice{}
+	for _, label := range e.labels {
+		labeled = append(labeled, yaml.MapItem{Key: label, Value: e.labeled[label]})
+	}
+	return labeled, nil
+}
+
+// all returns every address of the entry
+func (e emailAddresses) all() (addresses []string) {
+	if e.labeled == nil {
+		return []string{e.address}
+	}
+	for _, label := range e.labels {
+		addresses = append(addresses, e.labeled[label])
+	}
+	return addresses
+}
+
+// problem describes what is wrong with the entry, if anything
+func (e emailAddresses) problem() string {
+	switch {
+	case e.invalid:
+		return "has an entry in email_addresses that is neither an address nor labeled addresses"
+	case e.labeled != nil && len(e.labels) == 0:
+		return "has no addresses in email_addresses"
+	}
+	for _, address := range e.all() {
+		if isEmailTemplate(address) {
+			// the address it makes up is checked once rendered
+			if _, err := parseEmailTemplate(emailAddressTemplateKey, address, false); err != nil {
+				return "has an " + err.Error()
+			}
+		} else if !isEmailAddress(address) {
+			return fmt.Sprintf("has an invalid email address %q in email_addresses", address)
+		}
+	}
+	return ""
+}
+
+// pick returns the address with the given label and that label, the default
+// one if label is empty. Plain addresses are used whatever the label (and
+// have none).
+func (e emailAddresses) pick(initials, label string) (address, picked string, err error) {
+	if e.labeled == nil {
+		return e.address, "", nil
+	}
+	if label == "" {
+		label = e.labels[0]
+	}
+	address, ok := e.labeled[label]
+	if !ok {
+		return "", "", &UnknownEmailLabelError{Initials: initials, Label: label, Labels: e.labels}
+	}
+	return address, label, nil
+}
+
+// UnknownEmailLabelError is returned when an author has labeled addresses in
+// `email_addresses` but none with the requested label
+type UnknownEmailLabelError struct {
+	Initials string
+	Label    string
+	Labels   []string
+}
+
+func (e *UnknownEmailLabelError) Error() string {
+	return fmt.Sprintf("unknown email label %s for %s, known labels are: %s",
+		e.Label, e.Initials, strings.Join(e.Labels, ", "))
+}
+
+// WithEmailLabel picks the addresses with the given label for authors with
+// labeled addresses in `email_addresses` (see ByInitialsWithLabel)
+func WithEmailLabel(label string) Option {
+	return func(a *Pairs) {
+		a.emailLabel = label
+	}
+}
+
+// ByInitialsWithLabel is ByInitials picking the address with the given label
+// (rather than the one selected WithEmailLabel) if the author has labeled
+// addresses in `email_addresses`. Returns an *UnknownEmailLabelError if they
+// have no address with that label. An empty label picks their first address.
+func (a *Pairs) ByInitialsWithLabel(initials, label string) (pair *Pair, err error) {
+	return a.byInitials(initials, label)
+}
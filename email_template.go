@@ -0,0 +1,115 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Keys of the authors file whose values can be email templates (see
+// EmailTemplateError)
+const (
+	emailTemplateKey        = "email_template"
+	emailAddressTemplateKey = "email_addresses template"
+)
+
+// EmailTemplateError is returned when `email_template` or a templated
+// `email_addresses` value (Key tells which) cannot be parsed or fails for an
+// author. Line and Column are the position in Template the error points at
+// (zero if unknown), Pair is the author being rendered (nil for parse errors).
+// Err is the text/template error.
+type EmailTemplateError struct {
+	Key      string
+	Template string
+	Line     int
+	Column   int
+	Pair     *Pair
+	Err      error
+}
+
+// templateErrorRegexp matches the `template: NAME:LINE[:COL]: ` prefix of
+// text/template errors
+var templateErrorRegexp = regexp.MustCompile(`(?s)^template: [^:]*:(\d+)(?::(\d+))?: (.*)$`)
+
+func newEmailTemplateError(key, tmpl string, pair *Pair, err error) *EmailTemplateError {
+	e := &EmailTemplateError{Key: key, Template: tmpl, Pair: pair, Err: err}
+	if match := templateErrorRegexp.FindStringSubmatch(err.Error()); match != nil {
+		e.Line, _ = strconv.Atoi(match[1])
+		e.Column, _ = strconv.Atoi(match[2])
+	}
+	return e
+}
+
+func (e *EmailTemplateError) Error() string {
+	message := e.Err.Error()
+	if match := templateErrorRegexp.FindStringSubmatch(message); match != nil {
+		message = match[3]
+	}
+
+	position := ""
+	if e.Line > 0 {
+		position = fmt.Sprintf(" at line %d", e.Line)
+		if e.Column > 0 {
+			position += fmt.Sprintf(", column %d", e.Column)
+		}
+	}
+
+	if e.Pair == nil {
+		return fmt.Sprintf("invalid %s %q%s: %s", e.Key, e.Template, position, message)
+	}
+	p := e.Pair
+	return fmt.Sprintf("%s %q failed for %s%s: %s (name %q, username %q, team %q, extra %q, meta %q)",
+		e.Key, e.Template, p.Initials, position, message, p.Name, p.Username, p.Team, p.Extra, p.Meta)
+}
+
+func (e *EmailTemplateError) Unwrap() error {
+	return e.Err
+}
+
+// isEmailTemplate reports whether an `email_addresses` value is a template
+// rather than an address
+func isEmailTemplate(address string) bool {
+	return strings.Contains(address, "{{")
+}
+
+// parseEmailTemplate parses `email_template` or a templated `email_addresses`
+// value (see key), a missing map key (e.g. `.Meta.missing`) is an error rather
+// than empty if strict is set
+func parseEmailTemplate(key, tmpl string, strict bool) (t *template.Template, err error) {
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+
+	if t, err = template.New("email").Funcs(templateFuncs).Option(missingKey).Parse(tmpl); err != nil {
+		return nil, newEmailTemplateError(key, tmpl, nil, err)
+	}
+	return t, nil
+}
+
+// emailTemplateData is what email templates are rendered with: the fields of
+// the author plus the `email` domain and prefix of the authors file
+type emailTemplateData struct {
+	*Pair
+	Domain string
+	Prefix string
+}
+
+// renderEmailTemplate renders `email_template` or a templated `email_addresses`
+// value (see key) for pair, with `email_template_strict` applying to both
+func (a *Pairs) renderEmailTemplate(key, tmpl string, pair *Pair) (email string, err error) {
+	t, err := parseEmailTemplate(key, tmpl, a.file.EmailTemplateStrict)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	data := emailTemplateData{Pair: pair, Domain: a.file.Email.Domain, Prefix: a.file.Email.Prefix}
+	if err = t.Execute(&out, data); err != nil {
+		return "", newEmailTemplateError(key, tmpl, pair, err)
+	}
+	return strings.Replace(out.String(), "\r", "", -1), nil
+}
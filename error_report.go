@@ -0,0 +1,282 @@
+package duet
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Codes of the errors rendered by NewErrorReport. They are a compatibility
+// contract for editor integrations and are never renamed or removed.
+const (
+	// ErrorCodeUnknownInitials is an *UnknownInitialsError (initials,
+	// suggestions)
+	ErrorCodeUnknownInitials = "unknown_initials"
+	// ErrorCodeAmbiguousInitials is an *AmbiguousInitialsError (initials,
+	// candidates)
+	ErrorCodeAmbiguousInitials = "ambiguous_initials"
+	// ErrorCodeEmptyInitials is an *EmptyInitialsError (argument)
+	ErrorCodeEmptyInitials = "empty_initials"
+	// ErrorCodeDuplicatePerson is a *DuplicatePersonError (people, email)
+	ErrorCodeDuplicatePerson = "duplicate_person"
+	// ErrorCodeUnknownEmailLabel is an *UnknownEmailLabelError (initials,
+	// label, labels)
+	ErrorCodeUnknownEmailLabel = "unknown_email_label"
+	// ErrorCodeAuthorEntry is an *AuthorEntryError (initials, problem)
+	ErrorCodeAuthorEntry = "author_entry"
+	// ErrorCodeAuthors is an *AuthorErrors with several errors (errors), one
+	// with a single error is reported as that error
+	ErrorCodeAuthors = "authors"
+	// ErrorCodeLookupFailed is a *LookupFailedError (initials, stderr)
+	ErrorCodeLookupFailed = "lookup_failed"
+	// ErrorCodeAuthorsFileMissing is an *AuthorsFileNotFoundError (tried) or
+	// an *os.PathError for a file that does not exist (path), the authors file
+	// being the only file the commands cannot do without
+	ErrorCodeAuthorsFileMissing = "authors_file_missing"
+	// ErrorCodeAuthorsFileEmpty is an *EmptyAuthorsFileError (path)
+	ErrorCodeAuthorsFileEmpty = "authors_file_empty"
+	// ErrorCodeSymlinkTargetMissing is a *SymlinkTargetMissingError (path,
+	// target)
+	ErrorCodeSymlinkTargetMissing = "symlink_target_missing"
+	// ErrorCodeNotConfigured is a *NotConfiguredError or an *AuthorNotSetError
+	ErrorCodeNotConfigured = "not_configured"
+	// ErrorCodePairExpired is a *PairExpiredError (expired)
+	ErrorCodePairExpired = "pair_expired"
+	// ErrorCodeExistingHook is an *ExistingHookError (hook, path)
+	ErrorCodeExistingHook = "existing_hook"
+	// ErrorCodeCommitTemplateLocation is a *CommitTemplateLocationError (path)
+	ErrorCodeCommitTemplateLocation = "commit_template_location"
+	// ErrorCodeUnsafeExport is an *UnsafeExportError (variable)
+	ErrorCodeUnsafeExport = "unsafe_export"
+	// ErrorCodeNetwork is a *NetworkError (endpoint)
+	ErrorCodeNetwork = "network"
+	// ErrorCodeUserNotFound is a *UserNotFoundError (host, username)
+	ErrorCodeUserNotFound = "user_not_found"
+	// ErrorCodeNoEmailDomain is a *NoEmailDomainError (people)
+	ErrorCodeNoEmailDomain = "no_email_domain"
+	// ErrorCodeDuplicateAuthor is a *DuplicateAuthorError (initials, files)
+	ErrorCodeDuplicateAuthor = "duplicate_author"
+	// ErrorCodeEmailTemplate is an *EmailTemplateError (key, template, line,
+	// column, initials)
+	ErrorCodeEmailTemplate = "email_template"
+	// ErrorCodeMultipleDocuments is a *MultipleDocumentsError (documents,
+	// line)
+	ErrorCodeMultipleDocuments = "multiple_documents"
+	// ErrorCodeLookupCommand is a *LookupCommandError (command, source,
+	// lookup, not_executable)
+	ErrorCodeLookupCommand = "lookup_command"
+	// ErrorCodeLayer is a *LayerError (path, errors with the report of the
+	// error in that file)
+	ErrorCodeLayer = "layer"
+	// ErrorCodeRepoInitials is a *RepoInitialsError (path, people)
+	ErrorCodeRepoInitials = "repo_initials"
+	// ErrorCodeSquad is a *SquadError (squad, errors with the report of the
+	// error in that squad)
+	ErrorCodeSquad = "squad"
+	// ErrorCodeGeneric is any other error, only the message tells them apart
+	ErrorCodeGeneric = "error"
+)
+
+// ErrorReport is the machine-readable form of an error (see NewErrorReport)
+// Code and Message are always set, the other fields depend on the code.
+type ErrorReport struct {
+	Code          string         `json:"code"`
+	Message       string         `json:"message"`
+	Initials      string         `json:"initials,omitempty"`
+	Suggestions   []string       `json:"suggestions,omitempty"`
+	Candidates    []string       `json:"candidates,omitempty"`
+	Argument      string         `json:"argument,omitempty"`
+	People        []string       `json:"people,omitempty"`
+	Email         string         `json:"email,omitempty"`
+	Label         string         `json:"label,omitempty"`
+	Labels        []string       `json:"labels,omitempty"`
+	Problem       string         `json:"problem,omitempty"`
+	Stderr        string         `json:"stderr,omitempty"`
+	Path          string         `json:"path,omitempty"`
+	Target        string         `json:"target,omitempty"`
+	Tried         []string       `json:"tried,omitempty"`
+	Files         []string       `json:"files,omitempty"`
+	Expired       *time.Time     `json:"expired,omitempty"`
+	Hook          string         `json:"hook,omitempty"`
+	Variable      string         `json:"variable,omitempty"`
+	Endpoint      string         `json:"endpoint,omitempty"`
+	Host          string         `json:"host,omitempty"`
+	Username      string         `json:"username,omitempty"`
+	Key           string         `json:"key,omitempty"`
+	Template      string         `json:"template,omitempty"`
+	Line          int            `json:"line,omitempty"`
+	Column        int            `json:"column,omitempty"`
+	Documents     int            `json:"documents,omitempty"`
+	Command       string         `json:"command,omitempty"`
+	Source        string         `json:"source,omitempty"`
+	Lookup        string         `json:"lookup,omitempty"`
+	NotExecutable bool           `json:"not_executable,omitempty"`
+	Squad         string         `json:"squad,omitempty"`
+	Errors        []*ErrorReport `json:"errors,omitempty"`
+}
+
+// NewErrorReport converts err to an ErrorReport, using the code of the first
+// error of the package found in its chain (see errors.As) and ErrorCodeGeneric
+// if there is none. The message is always err's. Errors naming where the
+// error they wrap comes from (a file, a squad) report it in Errors.
+func NewErrorReport(err error) *ErrorReport {
+	report := &ErrorReport{Code: ErrorCodeGeneric, Message: err.Error()}
+
+	var (
+		unknownInitials   *UnknownInitialsError
+		ambiguousInitials *AmbiguousInitialsError
+		emptyInitials     *EmptyInitialsError
+		duplicatePerson   *DuplicatePersonError
+		unknownEmailLabel *UnknownEmailLabelError
+		authorEntry       *AuthorEntryError
+		authors           *AuthorErrors
+		lookupFailed      *LookupFailedError
+		notFound          *AuthorsFileNotFoundError
+		emptyAuthorsFile  *EmptyAuthorsFileError
+		symlinkMissing    *SymlinkTargetMissingError
+		notConfigured     *NotConfiguredError
+		authorNotSet      *AuthorNotSetError
+		pairExpired       *PairExpiredError
+		existingHook      *ExistingHookError
+		templateLocation  *CommitTemplateLocationError
+		unsafeExport      *UnsafeExportError
+		network           *NetworkError
+		userNotFound      *UserNotFoundError
+		noDomain          *NoEmailDomainError
+		duplicateAuthor   *DuplicateAuthorError
+		emailTemplate     *EmailTemplateError
+		multipleDocuments *MultipleDocumentsError
+		lookupCommand     *LookupCommandError
+		layer             *LayerError
+		repoInitials      *RepoInitialsError
+		squad             *SquadError
+		pathError         *os.PathError
+	)
+
+	switch {
+	case errors.As(err, &layer):
+		report.Code = ErrorCodeLayer
+		report.Path = layer.File
+		report.Errors = []*ErrorReport{NewErrorReport(layer.Err)}
+	case errors.As(err, &squad):
+		report.Code = ErrorCodeSquad
+		report.Squad = squad.Squad
+		report.Errors = []*ErrorReport{NewErrorReport(squad.Err)}
+	case errors.As(err, &authors):
+		if len(authors.Initials) == 1 {
+			return NewErrorReport(authors.Errors[authors.Initials[0]])
+		}
+		report.Code = ErrorCodeAuthors
+		for _, initials := range authors.Initials {
+			report.Errors = append(report.Errors, NewErrorReport(authors.Errors[initials]))
+		}
+	case errors.As(err, &unknownInitials):
+		report.Code = ErrorCodeUnknownInitials
+		report.Initials = unknownInitials.Initials
+		report.Suggestions = unknownInitials.Known
+	case errors.As(err, &ambiguousInitials):
+		report.Code = ErrorCodeAmbiguousInitials
+		report.Initials = ambiguousInitials.Initials
+		report.Candidates = ambiguousInitials.Candidates
+	case errors.As(err, &emptyInitials):
+		report.Code = ErrorCodeEmptyInitials
+		report.Argument = emptyInitials.Arg
+	case errors.As(err, &duplicatePerson):
+		report.Code = ErrorCodeDuplicatePerson
+		report.People = []string{duplicatePerson.Initials[0], duplicatePerson.Initials[1]}
+		report.Email = duplicatePerson.Email
+	case errors.As(err, &unknownEmailLabel):
+		report.Code = ErrorCodeUnknownEmailLabel
+		report.Initials = unknownEmailLabel.Initials
+		report.Label = unknownEmailLabel.Label
+		report.Labels = unknownEmailLabel.Labels
+	case errors.As(err, &authorEntry):
+		report.Code = ErrorCodeAuthorEntry
+		report.Initials = authorEntry.Initials
+		report.Problem = authorEntry.Problem
+	case errors.As(err, &lookupFailed):
+		report.Code = ErrorCodeLookupFailed
+		report.Initials = lookupFailed.Initials
+		report.Stderr = lookupFailed.Stderr
+	case errors.As(err, &notFound):
+		report.Code = ErrorCodeAuthorsFileMissing
+		report.Tried = notFound.Tried
+	case errors.As(err, &emptyAuthorsFile):
+		report.Code = ErrorCodeAuthorsFileEmpty
+		report.Path = emptyAuthorsFile.Path
+	case errors.As(err, &symlinkMissing):
+		report.Code = ErrorCodeSymlinkTargetMissing
+		report.Path = symlinkMissing.Path
+		report.Target = symlinkMissing.Target
+	case errors.As(err, &notConfigured), errors.As(err, &authorNotSet):
+		report.Code = ErrorCodeNotConfigured
+	case errors.As(err, &pairExpired):
+		report.Code = ErrorCodePairExpired
+		expired := pairExpired.Expired.UTC()
+		report.Expired = &expired
+	case errors.As(err, &existingHook):
+		report.Code = ErrorCodeExistingHook
+		report.Hook = existingHook.Hook
+		report.Path = existingHook.Path
+	case errors.As(err, &templateLocation):
+		report.Code = ErrorCodeCommitTemplateLocation
+		report.Path = templateLocation.Path
+	case errors.As(err, &unsafeExport):
+		report.Code = ErrorCodeUnsafeExport
+		report.Variable = unsafeExport.Variable
+	case errors.As(err, &network):
+		report.Code = ErrorCodeNetwork
+		report.Endpoint = network.Endpoint
+	case errors.As(err, &userNotFound):
+		report.Code = ErrorCodeUserNotFound
+		report.Host = userNotFound.Host
+		report.Username = userNotFound.Username
+	case errors.As(err, &noDomain):
+		report.Code = ErrorCodeNoEmailDomain
+		report.People = noDomain.Initials
+	case errors.As(err, &duplicateAuthor):
+		report.Code = ErrorCodeDuplicateAuthor
+		report.Initials = duplicateAuthor.Initials
+		report.Files = duplicateAuthor.Files
+	case errors.As(err, &emailTemplate):
+		report.Code = ErrorCodeEmailTemplate
+		report.Key = emailTemplate.Key
+		report.Template = emailTemplate.Template
+		report.Line = emailTemplate.Line
+		report.Column = emailTemplate.Column
+		if emailTemplate.Pair != nil {
+			report.Initials = emailTemplate.Pair.Initials
+		}
+	case errors.As(err, &multipleDocuments):
+		report.Code = ErrorCodeMultipleDocuments
+		report.Documents = multipleDocuments.Documents
+		report.Line = multipleDocuments.Line
+	case errors.As(err, &lookupCommand):
+		report.Code = ErrorCodeLookupCommand
+		report.Command = lookupCommand.Command
+		report.Source = lookupCommand.Source
+		report.Lookup = lookupCommand.Lookup
+		report.NotExecutable = lookupCommand.NotExecutable
+	case errors.As(err, &repoInitials):
+		report.Code = ErrorCodeRepoInitials
+		report.Path = repoInitials.File
+		report.People = repoInitials.Initials
+	case errors.As(err, &pathError) && os.IsNotExist(pathError):
+		report.Code = ErrorCodeAuthorsFileMissing
+		report.Path = pathError.Path
+	}
+
+	return report
+}
+
+// WriteErrorReport writes the ErrorReport of err to w as a single line of JSON
+func WriteErrorReport(w io.Writer, err error) error {
+	output, jsonErr := json.Marshal(NewErrorReport(err))
+	if jsonErr != nil {
+		return jsonErr
+	}
+	_, jsonErr = w.Write(append(output, '\n'))
+	return jsonErr
+}
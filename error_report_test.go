@@ -0,0 +1,53 @@
+package duet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteErrorReport(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "layer",
+			err:  &LayerError{File: "/etc/git-duet/authors.yml", Err: &UnknownInitialsError{Initials: "kg"}},
+			want: `{"code":"layer","message":"/etc/git-duet/authors.yml: unknown initials kg","path":"/etc/git-duet/authors.yml",` +
+				`"errors":[{"code":"unknown_initials","message":"unknown initials kg","initials":"kg"}]}`,
+		},
+		{
+			name: "layer wrapping another error",
+			err:  &LayerError{File: "/etc/git-duet/authors.yml", Err: errors.New("email for jd is not a valid email address")},
+			want: `{"code":"layer","message":"/etc/git-duet/authors.yml: email for jd is not a valid email address","path":"/etc/git-duet/authors.yml",` +
+				`"errors":[{"code":"error","message":"email for jd is not a valid email address"}]}`,
+		},
+		{
+			name: "wrapped layer",
+			err:  fmt.Errorf("lint: %w", &LayerError{File: "a.yml", Err: errors.New("broken")}),
+			want: `{"code":"layer","message":"lint: a.yml: broken","path":"a.yml","errors":[{"code":"error","message":"broken"}]}`,
+		},
+		{
+			name: "not executable lookup command",
+			err:  &LookupCommandError{Command: "lookup", Source: "duet.emailLookupCommand", Lookup: "email", NotExecutable: true},
+			want: `{"code":"lookup_command","message":"duet.emailLookupCommand: email lookup command 'lookup' is not executable",` +
+				`"command":"lookup","source":"duet.emailLookupCommand","lookup":"email","not_executable":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := WriteErrorReport(&b, tt.err); err != nil {
+				t.Fatalf("WriteErrorReport: %v", err)
+			}
+			if got := strings.TrimSuffix(b.String(), "\n"); got != tt.want {
+				t.Errorf("WriteErrorReport =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build go1.19
+// +build go1.19
+
+package duet
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// isErrDot reports whether exec.LookPath found the command relative to the
+// current directory, which is fine for lookup commands
+func isErrDot(err error) bool {
+	return errors.Is(err, exec.ErrDot)
+}
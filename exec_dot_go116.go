@@ -0,0 +1,10 @@
+//go:build !go1.19
+// +build !go1.19
+
+package duet
+
+// isErrDot is always false before Go 1.19, where exec.LookPath finds commands
+// relative to the current directory without an error
+func isErrDot(err error) bool {
+	return false
+}
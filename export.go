@@ -0,0 +1,88 @@
+package duet
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Shells whose syntax WriteExports can write
+const (
+	ShellPOSIX = "posix"
+	ShellFish  = "fish"
+)
+
+// UnsafeExportError is returned by WriteExports for a value containing a
+// newline, which no quoting keeps from breaking scripts reading the output
+type UnsafeExportError struct {
+	Variable string
+	Value    string
+}
+
+func (e *UnsafeExportError) Error() string {
+	return fmt.Sprintf("refusing to print %s=%q: it contains a newline", e.Variable, e.Value)
+}
+
+// ValidateShell returns an error unless shell is ShellPOSIX or ShellFish
+func ValidateShell(shell string) error {
+	switch shell {
+	case ShellPOSIX, ShellFish:
+		return nil
+	}
+	return fmt.Errorf("unknown shell %q, must be one of: %s, %s", shell, ShellPOSIX, ShellFish)
+}
+
+// QuotePOSIX quotes s in single quotes for POSIX shells, replacing every
+// single quote in s by a quote closing the string, an escaped quote and a
+// quote reopening it
+func QuotePOSIX(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// QuoteFish quotes s for fish, in single quotes within which fish only
+// treats backslashes and single quotes specially
+func QuoteFish(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// WriteExports writes the GIT_AUTHOR_* variables of author and the
+// GIT_COMMITTER_* variables of committer (both may be nil) in the syntax of
+// shell, so that `eval` sets them: `VAR='value'` for ShellPOSIX and
+// `set -gx VAR 'value'` for ShellFish. Nothing is written if a value contains
+// a newline, an *UnsafeExportError is returned instead.
+func WriteExports(w io.Writer, shell string, author, committer *Pair) error {
+	if err := ValidateShell(shell); err != nil {
+		return err
+	}
+
+	var exports [][2]string
+	if author != nil {
+		exports = append(exports,
+			[2]string{"GIT_AUTHOR_NAME", author.Name},
+			[2]string{"GIT_AUTHOR_EMAIL", author.Email})
+	}
+	if committer != nil {
+		exports = append(exports,
+			[2]string{"GIT_COMMITTER_NAME", committer.Name},
+			[2]string{"GIT_COMMITTER_EMAIL", committer.Email})
+	}
+
+	for _, export := range exports {
+		if strings.ContainsAny(export[1], "\r\n") {
+			return &UnsafeExportError{Variable: export[0], Value: export[1]}
+		}
+	}
+
+	for _, export := range exports {
+		var line string
+		if shell == ShellFish {
+			line = fmt.Sprintf("set -gx %s %s\n", export[0], QuoteFish(export[1]))
+		} else {
+			line = fmt.Sprintf("%s=%s\n", export[0], QuotePOSIX(export[1]))
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package duet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var identRegexp = regexp.MustCompile(`^(.*) <(.*)> (\d+ [+-]\d{4})$`)
+
+// ident is the name, email and date of the author or committer of a commit
+type ident struct {
+	Name, Email, Date string
+}
+
+func parseIdent(line string) (*ident, error) {
+	match := identRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("could not parse %q", line)
+	}
+	return &ident{Name: match[1], Email: match[2], Date: match[3]}, nil
+}
+
+// commitObject is what git duet rewrites of a commit
+type commitObject struct {
+	tree, encoding, message string
+	parents                 []string
+	author, committer       *ident
+	// signed is whether the commit carries a signature (gpgsig), mergetag
+	// whether it carries the signed tag it merges
+	signed, mergetag bool
+}
+
+// readCommit reads the commit id
+func readCommit(id string) (commit *commitObject, err error) {
+	raw, err := exec.Command("git", "cat-file", "commit", id).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not read commit %s: %v", id, err)
+	}
+	parts := strings.SplitN(string(raw), "\n\n", 2)
+	commit = &commitObject{}
+	if len(parts) == 2 {
+		commit.message = parts[1]
+	}
+
+	for _, line := range strings.Split(parts[0], "\n") {
+		field := strings.SplitN(line, " ", 2)
+		if len(field) != 2 {
+			continue
+		}
+		switch field[0] {
+		case "tree":
+			commit.tree = field[1]
+		case "parent":
+			commit.parents = append(commit.parents, field[1])
+		case "author":
+			commit.author, err = parseIdent(field[1])
+		case "committer":
+			commit.committer, err = parseIdent(field[1])
+		case "encoding":
+			commit.encoding = field[1]
+		case "gpgsig", "gpgsig-sha256":
+			commit.signed = true
+		case "mergetag":
+			commit.mergetag = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read commit %s: %v", id, err)
+		}
+	}
+	if commit.tree == "" || commit.author == nil || commit.committer == nil {
+		return nil, fmt.Errorf("could not read commit %s", id)
+	}
+	return commit, nil
+}
+
+// write writes commit as a new commit object, keeping the author date, with
+// the environment env (e.g. the committer) and returns its id. A signed commit
+// is signed again with the user's signing key, as the signature does not hold
+// for the new object. A commit merging a signed tag is not written, since
+// commit-tree cannot keep the tag.
+func (commit *commitObject) write(env ...string) (id string, err error) {
+	if commit.mergetag {
+		return "", errors.New("it merges a signed tag, which would be dropped")
+	}
+	args := []string{"commit-tree", commit.tree}
+	if commit.signed {
+		args = append(args, "-S")
+	}
+	for _, parent := range commit.parents {
+		args = append(args, "-p", parent)
+	}
+	if commit.encoding != "" {
+		// the message is kept as is, in the encoding it was written in
+		args = append([]string{"-c", "i18n.commitEncoding=" + commit.encoding}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(commit.message)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(append(os.Environ(),
+		fmt.Sprintf("GIT_AUTHOR_NAME=%s", commit.author.Name),
+		fmt.Sprintf("GIT_AUTHOR_EMAIL=%s", commit.author.Email),
+		fmt.Sprintf("GIT_AUTHOR_DATE=@%s", commit.author.Date),
+	), env...)
+	output := new(bytes.Buffer)
+	cmd.Stdout = output
+	if err = cmd.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// head returns the commit HEAD points at
+func head() (id string, err error) {
+	output, err := exec.Command("git", "rev-parse", "--verify", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not find HEAD: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// moveHead moves HEAD from old to rewritten, unless something else moved it
+func moveHead(reason, old, rewritten string) error {
+	update := exec.Command("git", "update-ref", "-m", "git-duet: "+reason, "HEAD", rewritten, old)
+	update.Stderr = os.Stderr
+	if err := update.Run(); err != nil {
+		return fmt.Errorf("could not move HEAD to the rewritten commit: %v", err)
+	}
+	return nil
+}
+
+// FixCommitter rewrites HEAD with committer as its committer, keeping its
+// tree, parents, author and message, unless committer committed it already.
+// Returns whether HEAD was rewritten. HEAD is only moved if nothing else moved
+// it meanwhile.
+func FixCommitter(committer *Pair) (fixed bool, err error) {
+	id, err := head()
+	if err != nil {
+		return false, err
+	}
+	commit, err := readCommit(id)
+	if err != nil {
+		return false, err
+	}
+
+	if commit.committer.Name == committer.Name && commit.committer.Email == committer.Email {
+		return false, nil
+	}
+
+	rewritten, err := commit.write(
+		fmt.Sprintf("GIT_COMMITTER_NAME=%s", committer.Name),
+		fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", committer.Email),
+	)
+	if err != nil {
+		return false, fmt.Errorf("could not rewrite commit %s: %v", id, err)
+	}
+	if err = moveHead("fix committer", id, rewritten); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CoAuthorCommits rewrites the commits after base up to HEAD, which have to
+// follow each other, adding trailers crediting coAuthors under key to their
+// messages and keeping everything else (the committer date too). A commit
+// credits neither its own author nor those its message credits already.
+// Returns how many commits were rewritten. HEAD is only moved if nothing else
+// moved it meanwhile.
+func CoAuthorCommits(base, key string, coAuthors []*Pair) (rewritten int, err error) {
+	id, err := head()
+	if err != nil {
+		return 0, err
+	}
+	output, err := exec.Command("git", "rev-list", "--reverse", "--first-parent", base+".."+id).Output()
+	if err != nil {
+		return 0, fmt.Errorf("could not list the commits after %s: %v", base, err)
+	}
+
+	// the id a commit was rewritten to, for the next one to point at it
+	parent := map[string]string{}
+	last := id
+	for _, commitID := range strings.Fields(string(output)) {
+		commit, err := readCommit(commitID)
+		if err != nil {
+			return 0, err
+		}
+		changed := false
+		for i, p := range commit.parents {
+			if rewrittenParent, ok := parent[p]; ok && rewrittenParent != p {
+				commit.parents[i] = rewrittenParent
+				changed = true
+			}
+		}
+
+		args := []string{"interpret-trailers"}
+		for _, p := range coAuthors {
+			if !strings.EqualFold(p.Email, commit.author.Email) && !HasCoAuthorTrailerFor([]byte(commit.message), key, p) {
+				args = append(args, "--trailer", Trailer(key, p))
+			}
+		}
+		if len(args) > 1 {
+			interpret := exec.Command("git", args...)
+			interpret.Stdin = strings.NewReader(commit.message)
+			interpret.Stderr = os.Stderr
+			message, err := interpret.Output()
+			if err != nil {
+				return 0, fmt.Errorf("could not add trailers to commit %s: %v", commitID, err)
+			}
+			commit.message = string(message)
+			rewritten++
+		} else if !changed {
+			// kept as it is, signature included
+			parent[commitID], last = commitID, commitID
+			continue
+		}
+
+		last, err = commit.write(
+			fmt.Sprintf("GIT_COMMITTER_NAME=%s", commit.committer.Name),
+			fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", commit.committer.Email),
+			fmt.Sprintf("GIT_COMMITTER_DATE=@%s", commit.committer.Date),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("could not rewrite commit %s: %v", commitID, err)
+		}
+		parent[commitID] = last
+	}
+
+	if rewritten == 0 {
+		return 0, nil
+	}
+	return rewritten, moveHead("co-author commits", id, last)
+}
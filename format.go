@@ -0,0 +1,76 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FormatPresets are the named formats accepted in place of a template
+var FormatPresets = map[string]string{
+	"email": "{{.Email}}",
+	"short": "{{.Initials}}:{{.Email}}",
+	"full":  "{{.Initials}}\t{{.Name}}\t{{.Email}}",
+}
+
+// FormatJSON is the format printing the whole configuration as JSON (see
+// DuetConfig) instead of each person
+const FormatJSON = "json"
+
+// FormatPrompt is the format printing the whole configuration as a shell
+// prompt segment (see PromptSegment) instead of each person
+const FormatPrompt = "prompt"
+
+// PromptSegment renders config for a shell prompt: the initials of the author
+// and committers joined by +, followed by how long they have been pairing if
+// known (e.g. jd+fb (2h13m)). Empty if nothing is configured.
+func PromptSegment(config *DuetConfig) string {
+	if config == nil {
+		return ""
+	}
+
+	var initials []string
+	if config.Author != nil {
+		initials = append(initials, config.Author.Initials)
+	}
+	for _, p := range config.CoAuthors {
+		initials = append(initials, p.Initials)
+	}
+	segment := strings.Join(initials, "+")
+	if config.Session != nil {
+		segment += fmt.Sprintf(" (%s)", FormatSessionDuration(time.Duration(config.Session.Seconds)*time.Second))
+	}
+	return segment
+}
+
+// ParseFormat parses format as a text/template with the same functions as
+// `email_template`, after resolving it if it names one of the FormatPresets
+func ParseFormat(format string) (t *template.Template, err error) {
+	if preset, ok := FormatPresets[format]; ok {
+		format = preset
+	}
+
+	t, err = template.New("format").Funcs(templateFuncs).Option("missingkey=zero").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format %q: %v", format, err)
+	}
+
+	return t, nil
+}
+
+// FormatPair renders p using format (see ParseFormat)
+func FormatPair(p *Pair, format string) (output string, err error) {
+	t, err := ParseFormat(format)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err = t.Execute(&out, p); err != nil {
+		return "", fmt.Errorf("could not format %s: %v", p.Initials, err)
+	}
+
+	return out.String(), nil
+}
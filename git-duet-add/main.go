@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	duet "github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
+	"github.com/pborman/getopt"
+)
+
+var (
+	// VersionString is the git tag this binary is associated with
+	VersionString string
+	// RevisionString is the git rev this binary is associated with
+	RevisionString string
+)
+
+// git duet-add adds an author to the authors file, e.g. from onboarding
+// scripts
+func main() {
+	var (
+		email    = getopt.StringLong("email", 'e', "", "Email of the author, used as is", "EMAIL")
+		username = getopt.StringLong("username", 'u', "", "Username of the author", "USERNAME")
+		quiet    = getopt.BoolLong("quiet", 'q', "Silence output")
+		jsonErrs = getopt.BoolLong("json-errors", 0, "Print errors as JSON on stderr")
+		help     = getopt.BoolLong("help", 'h', "Help")
+		version  = getopt.BoolLong("version", 'v', "Version")
+	)
+
+	getopt.SetParameters("<initials> <name>")
+	getopt.Parse()
+	// options may come after the initials and the name too
+	var args []string
+	for rest := getopt.Args(); len(rest) > 0; rest = getopt.Args() {
+		args = append(args, rest[0])
+		getopt.CommandLine.Parse(rest)
+	}
+	cmd.JSONErrors = *jsonErrs
+
+	if *help {
+		getopt.Usage()
+		os.Exit(0)
+	}
+
+	if *version {
+		fmt.Printf("%s (%s)\n", VersionString, RevisionString)
+		os.Exit(0)
+	}
+
+	if len(args) != 2 {
+		getopt.Usage()
+		os.Exit(1)
+	}
+
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+
+	author := duet.NewAuthor{Initials: args[0], Name: args[1], Username: *username, Email: *email}
+	if err = duet.AddAuthor(configuration.PairsFile, pairs, author); err != nil {
+		cmd.Fail(err, 1)
+	}
+
+	if !*quiet {
+		fmt.Printf("git-duet-add: Added %s to %s\n", author.Initials, configuration.PairsFile)
+	}
+}
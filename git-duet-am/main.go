@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
+)
+
+// coAuthoredByOption makes git duet-am credit the pair in the applied patches
+const coAuthoredByOption = "--co-authored-by"
+
+func main() {
+	var args []string
+	coAuthoredBy := false
+	for _, arg := range cmd.TakeJSONErrors(os.Args[1:]) {
+		if arg == coAuthoredByOption {
+			coAuthoredBy = true
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	am := cmd.NewCommitterOnly("am")
+	am.Args = args
+	err := am.Execute()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// git am explained what went wrong (conflicts, --continue...)
+		os.Exit(exitErr.ExitCode())
+	}
+	if err == nil && coAuthoredBy {
+		err = coAuthor()
+	}
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+}
+
+// coAuthor adds co-author trailers crediting the pair to the commits git am
+// made since it started (ORIG_HEAD), soloing credits nobody
+func coAuthor() error {
+	author, committers, err := cmd.Pair()
+	if err != nil || len(committers) == 0 {
+		return err
+	}
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		return err
+	}
+	trailerKey, err := configuration.CoAuthorTrailerKey()
+	if err != nil {
+		return err
+	}
+
+	_, err = duet.CoAuthorCommits("ORIG_HEAD", trailerKey,
+		duet.OrderCoAuthors(configuration.TrailerOrder, append([]*duet.Pair{author}, committers...)))
+	return err
+}
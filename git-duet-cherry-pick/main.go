@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
+	"github.com/git-duet/git-duet/internal/picker"
+)
+
+// editorEnv is set for git cherry-pick, which runs git duet-cherry-pick again
+// as the editor of the message of every picked commit (see coAuthor). It is
+// the editor of the user to run afterwards, or ":" to run none.
+const editorEnv = "GIT_DUET_CHERRY_PICK_EDITOR"
+
+// editMarker is left in the sequencer directory of a cherry-pick that stopped
+// (removed by git along with it when done) if it was asked to edit the
+// messages, so that resuming it keeps editing them
+const editMarker = "sequencer/git-duet-edit"
+
+// actions resume or end a cherry-pick in progress, git cherry-pick takes no
+// other options with them
+var actions = map[string]bool{
+	"--continue": true,
+	"--skip":     true,
+	"--abort":    true,
+	"--quit":     true,
+}
+
+// git duet-cherry-pick cherry-picks with the configured pair as the committer
+// of the picked commits, keeping their authors, and credits the pair with
+// co-author trailers in their messages
+func main() {
+	if editor := os.Getenv(editorEnv); editor != "" {
+		file := os.Args[len(os.Args)-1]
+		if err := coAuthor(file, os.Getenv("GIT_AUTHOR_EMAIL")); err != nil {
+			cmd.Fail(err, 1)
+		}
+		if editor != ":" {
+			exit(runEditor(editor, file))
+		}
+		return
+	}
+
+	args := cmd.TakeJSONErrors(os.Args[1:])
+
+	action, noCommit, resume := false, false, false
+	for _, arg := range args {
+		action = action || actions[arg]
+		noCommit = noCommit || arg == "-n" || arg == "--no-commit"
+		resume = resume || arg == "--continue"
+	}
+	edit := editing(args)
+	if action {
+		edit = fileExists(gitPath(editMarker))
+	}
+
+	committer, err := cmd.Committer()
+	if resume && committer != nil {
+		// the commit stopped by conflicts is credited and committed first,
+		// edited like git does (when asked to, or on a terminal)
+		if err = coAuthorStopped(committer, edit || picker.IsTerminal(os.Stdin)); err != nil {
+			exit(err)
+		}
+		if !fileExists(gitPath("sequencer")) {
+			return
+		}
+	}
+	if !action {
+		if err != nil {
+			exit(err)
+		}
+		if !noCommit {
+			args = append([]string{"--edit"}, args...)
+		}
+	}
+
+	// the user's editor, for git duet-cherry-pick to run once it credited
+	// the pair (see coAuthor)
+	editor := ":"
+	if edit {
+		output, err := exec.Command("git", "var", "GIT_EDITOR").Output()
+		if err != nil {
+			exit(fmt.Errorf("could not find your editor: %v", err))
+		}
+		editor = strings.TrimSpace(string(output))
+	}
+
+	pick := exec.Command("git", append([]string{"cherry-pick"}, args...)...)
+	pick.Env = append(os.Environ(),
+		editorEnv+"="+editor,
+		"GIT_EDITOR=git duet-cherry-pick",
+	)
+	err = run(pick, committer)
+	if err != nil && edit && fileExists(gitPath("sequencer")) {
+		// stopped, remember to edit the rest when resumed
+		ioutil.WriteFile(gitPath(editMarker), nil, 0644)
+	}
+	exit(err)
+}
+
+// editing returns whether the arguments of git cherry-pick ask to edit the
+// messages (the last of `-e`, `--edit` and `--no-edit`)
+func editing(args []string) (edit bool) {
+	for _, arg := range args {
+		switch arg {
+		case "-e", "--edit":
+			edit = true
+		case "--no-edit":
+			edit = false
+		}
+	}
+	return edit
+}
+
+// run runs the git command with committer (if any, --abort and the like work
+// without a pair) as the committer
+func run(git *exec.Cmd, committer *duet.Pair) error {
+	git.Stdin = os.Stdin
+	git.Stdout = os.Stdout
+	git.Stderr = os.Stderr
+	if git.Env == nil {
+		git.Env = os.Environ()
+	}
+	git.Env = append(git.Env, cmd.WrappedEnv+"=1")
+	if committer != nil {
+		git.Env = append(git.Env,
+			fmt.Sprintf("GIT_COMMITTER_NAME=%s", committer.Name),
+			fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", committer.Email),
+		)
+	}
+	return git.Run()
+}
+
+// runEditor runs editor, a command line as git takes them, on file
+func runEditor(editor, file string) error {
+	edit := exec.Command("sh", "-c", editor+` "$@"`, editor, file)
+	edit.Stdin = os.Stdin
+	edit.Stdout = os.Stdout
+	edit.Stderr = os.Stderr
+	return edit.Run()
+}
+
+// exit exits with the exit code of err if git or the editor failed, since
+// they explained what went wrong (conflicts...), 1 with err if anything else
+// did (see cmd.Fail), and 0 if nothing did
+func exit(err error) {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	os.Exit(0)
+}
+
+// gitPath returns the path of name in the git directory
+func gitPath(name string) string {
+	output, err := exec.Command("git", "rev-parse", "--git-path", name).Output()
+	if err != nil {
+		return name
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// coAuthorStopped adds the co-author trailers to the message of the commit
+// the cherry-pick stopped at, if any, and commits it as committer, opening the
+// user's editor on the message if edit
+func coAuthorStopped(committer *duet.Pair, edit bool) error {
+	output, err := exec.Command("git", "show", "-s", "--format=%ae", "CHERRY_PICK_HEAD").Output()
+	if err != nil {
+		// not stopped at a commit (e.g. it was committed already)
+		return nil
+	}
+	if file := gitPath("MERGE_MSG"); fileExists(file) {
+		if err = coAuthor(file, strings.TrimSpace(string(output))); err != nil {
+			return err
+		}
+	}
+
+	commit := exec.Command("git", "commit", "--no-edit", "--cleanup=strip")
+	if edit {
+		commit.Args[2] = "--edit"
+	}
+	return run(commit, committer)
+}
+
+// coAuthor adds co-author trailers for the people of the pair to the message
+// file of a picked commit, leaving out its author (by email) and those the
+// message credits already. Soloing credits nobody.
+func coAuthor(file, authorEmail string) error {
+	author, committers, err := cmd.Pair()
+	if err != nil || len(committers) == 0 {
+		return err
+	}
+
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		return err
+	}
+	trailerKey, err := configuration.CoAuthorTrailerKey()
+	if err != nil {
+		return err
+	}
+
+	msg, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"interpret-trailers", "--in-place"}
+	for _, p := range duet.OrderCoAuthors(configuration.TrailerOrder, append([]*duet.Pair{author}, committers...)) {
+		if strings.EqualFold(p.Email, authorEmail) || duet.HasCoAuthorTrailerFor(msg, trailerKey, p) {
+			continue
+		}
+		args = append(args, "--trailer", duet.Trailer(trailerKey, p))
+	}
+	if len(args) == 2 {
+		return nil
+	}
+
+	interpret := exec.Command("git", append(args, file)...)
+	interpret.Stderr = os.Stderr
+	return interpret.Run()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/git-duet/git-duet"
+	"github.com/pborman/getopt"
+)
+
+// git duet-commit-msg rejects commit messages whose co-author trailers are
+// malformed, credit people who are not in the authors file, or are missing
+// while pairing in co-authored-by mode
+func main() {
+	getopt.Parse()
+	if getopt.NArgs() < 1 {
+		getopt.Usage()
+		os.Exit(1)
+	}
+	commitMsgFile := getopt.Arg(0)
+
+	commitMsg, err := ioutil.ReadFile(commitMsgFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if duet.MergeInProgress() || duet.TrailerCheckExempt(commitMsg) {
+		os.Exit(0)
+	}
+
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// trailers are only required for the co-authors of a current pair, and
+	// not for commits being replayed, which keep their authorship
+	var coAuthors []*duet.Pair
+	if configuration.CoAuthoredBy && !duet.ReplayInProgress() {
+		if coAuthors, err = configuredCoAuthors(configuration); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	trailerKey, err := configuration.CoAuthorTrailerKey()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	problems, err := duet.ValidateCoAuthorTrailers(commitMsg, trailerKey, pairs, duet.OrderCoAuthors(configuration.TrailerOrder, coAuthors))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(problems) == 0 {
+		os.Exit(0)
+	}
+
+	fmt.Println("git-duet: the co-author trailers of the commit message are wrong:")
+	for _, problem := range problems {
+		fmt.Printf("  %v\n", problem)
+	}
+	fmt.Printf("your message is kept in %s\n", commitMsgFile)
+	os.Exit(1)
+}
+
+// configuredCoAuthors returns the co-authors of the configured pair, none if
+// no pair is configured or it expired
+func configuredCoAuthors(configuration *duet.Configuration) ([]*duet.Pair, error) {
+	gitConfig := &duet.GitConfig{
+		Namespace:     configuration.Namespace,
+		SetUserConfig: configuration.SetGitUserConfig,
+	}
+	if configuration.Global {
+		gitConfig.Scope = duet.Global
+	}
+
+	if err := gitConfig.CheckExpiry(); err != nil {
+		if _, expired := err.(*duet.PairExpiredError); expired {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return gitConfig.GetCommitters()
+}
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/git-duet/git-duet/internal/cmd"
 	"github.com/git-duet/git-duet/internal/cmdrunner"
 )
@@ -11,7 +8,6 @@ import (
 func main() {
 	err := cmdrunner.Execute(cmd.NewWithSignoff("commit"))
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
 	}
 }
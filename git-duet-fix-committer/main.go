@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
+)
+
+// git duet-fix-committer makes the configured pair the committer of HEAD, as
+// an --exec step of `git rebase` (see git-duet-rebase)
+func main() {
+	committer, err := cmd.Committer()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if _, err = duet.FixCommitter(committer); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
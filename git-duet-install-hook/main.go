@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
@@ -11,25 +10,23 @@ import (
 	"strings"
 
 	duet "github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
 	"github.com/pborman/getopt"
 )
 
-const preCommit = "pre-commit"
-const prepareCommitMsg = "prepare-commit-msg"
-const postCommit = "post-commit"
-const sheBangBash = "#!/usr/bin/env bash\n"
-const preCommitHook = `exec git duet-pre-commit "$@"`
-const prepareCommitMsgHook = `exec git duet-prepare-commit-msg "$@"`
-const postCommitHook = `exec git duet-post-commit "$@"`
-
 func main() {
 	var (
-		quiet = getopt.BoolLong("quiet", 'q', "Silence output")
-		help  = getopt.BoolLong("help", 'h', "Help")
+		quiet    = getopt.BoolLong("quiet", 'q', "Silence output")
+		force    = getopt.BoolLong("force", 'f', "Upgrade an outdated hook, or run an existing hook before the git-duet one")
+		dryRun   = getopt.BoolLong("dry-run", 'n', "Print the changes instead of making them")
+		format   = getopt.StringLong("format", 0, "", "Print the --dry-run changes as json")
+		jsonErrs = getopt.BoolLong("json-errors", 0, "Print errors as JSON on stderr")
+		help     = getopt.BoolLong("help", 'h', "Help")
 	)
 
 	getopt.Parse()
-	getopt.SetParameters(fmt.Sprintf("{ %s | %s | %s }", preCommit, prepareCommitMsg, postCommit))
+	cmd.JSONErrors = *jsonErrs
+	getopt.SetParameters(fmt.Sprintf("{ %s }", strings.Join(duet.Hooks, " | ")))
 
 	if *help {
 		getopt.Usage()
@@ -41,105 +38,81 @@ func main() {
 		getopt.Usage()
 		os.Exit(1)
 	}
-	hookFileName := args[0]
+	hook := args[0]
 
-	var hook string
-	if hookFileName == preCommit {
-		hook = preCommitHook
-	} else if hookFileName == prepareCommitMsg {
-		hook = prepareCommitMsgHook
-	} else if hookFileName == postCommit {
-		hook = postCommitHook
-	} else {
+	known := false
+	for _, h := range duet.Hooks {
+		known = known || h == hook
+	}
+	if !known {
 		getopt.Usage()
 		os.Exit(1)
 	}
 
+	if *format != "" && *format != duet.FormatJSON {
+		cmd.Fail(fmt.Errorf("unknown format %q, --format only accepts %s", *format, duet.FormatJSON), 1)
+	}
+
 	config, err := duet.NewConfiguration()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
+	}
+
+	var plan *duet.Plan
+	if *dryRun {
+		plan = &duet.Plan{}
 	}
 
 	var hooksDir string
 	if config.Global {
-		gitConfig := &duet.GitConfig{Namespace: config.Namespace, SetUserConfig: config.SetGitUserConfig}
+		gitConfig := &duet.GitConfig{Namespace: config.Namespace, SetUserConfig: config.SetGitUserConfig, DryRun: plan}
 		gitConfig.Scope = duet.Global
 		templateDir, err := gitConfig.GetInitTemplateDir()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			cmd.Fail(err, 1)
 		}
 		if templateDir == "" {
 			usr, err := user.Current()
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				cmd.Fail(err, 1)
 			}
 			templateDir = path.Join(usr.HomeDir, ".git-template")
 			if err := gitConfig.SetInitTemplateDir(templateDir); err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				cmd.Fail(err, 1)
 			}
 		}
-		if err := os.MkdirAll(path.Join(templateDir, "hooks"), os.ModePerm); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		if err := plan.MkdirAll(path.Join(templateDir, "hooks"), os.ModePerm); err != nil {
+			cmd.Fail(err, 1)
 		}
 		hooksDir = path.Join(templateDir, "hooks")
 	} else {
 		hooksDir = getLocalHooksDir()
 	}
 
-	hookPath := path.Join(hooksDir, hookFileName)
-
-	hookFile, err := os.OpenFile(hookPath, os.O_CREATE|os.O_RDWR, os.ModePerm)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	defer hookFile.Close()
-
-	b, err := ioutil.ReadAll(hookFile)
+	hookPath, written, err := duet.PlanInstallHook(plan, hooksDir, hook, *force)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	contents := strings.TrimSpace(string(b))
-	if contents != "" {
-		if hook == preCommitHook && !strings.Contains(contents, preCommitHook) ||
-			hook == prepareCommitMsgHook && !strings.Contains(contents, prepareCommitMsgHook) ||
-			hook == postCommitHook && !strings.Contains(contents, postCommitHook) {
-			fmt.Printf(`It seems you already have a "%s" hook.
-To enable the git-duet hook, please append:
-
-  %s
-
-to your %s file.`, hookFileName, hook, hookPath)
+		if _, exists := err.(*duet.ExistingHookError); exists && !cmd.JSONErrors {
+			fmt.Print(err)
 			os.Exit(1)
 		}
-		os.Exit(0) // hook file with the desired content already exists
+		cmd.Fail(err, 1)
 	}
 
-	if _, err = hookFile.WriteString(sheBangBash + hook); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	if !*quiet {
+	if plan != nil {
+		if err = duet.WritePlan(os.Stdout, plan, *format == duet.FormatJSON); err != nil {
+			cmd.Fail(err, 1)
+		}
+	} else if written && !*quiet {
 		fmt.Printf("git-duet-install-hook: Installed hook to %s\n", hookPath)
 	}
-
 }
 
 func getLocalHooksDir() string {
 	output := new(bytes.Buffer)
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	cmd.Stdout = output
-	if err := cmd.Run(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	toplevel := exec.Command("git", "rev-parse", "--show-toplevel")
+	toplevel.Stdout = output
+	if err := toplevel.Run(); err != nil {
+		cmd.Fail(err, 1)
 	}
 	return path.Join(strings.TrimSpace(output.String()), ".git", "hooks")
 }
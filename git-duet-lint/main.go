@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	duet "github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
+	"github.com/pborman/getopt"
+)
+
+var (
+	// VersionString is the git tag this binary is associated with
+	VersionString string
+	// RevisionString is the git rev this binary is associated with
+	RevisionString string
+)
+
+// git duet-lint checks the authors file for the problems that would
+// otherwise only show when committing, exiting nonzero if there are errors
+func main() {
+	var (
+		format   = getopt.StringLong("format", 0, "", "Print the diagnostics as json")
+		jsonErrs = getopt.BoolLong("json-errors", 0, "Print errors as JSON on stderr")
+		help     = getopt.BoolLong("help", 'h', "Help")
+		version  = getopt.BoolLong("version", 'v', "Version")
+	)
+
+	getopt.SetParameters("[authors file]")
+	getopt.Parse()
+	cmd.JSONErrors = *jsonErrs
+
+	if *help {
+		getopt.Usage()
+		os.Exit(0)
+	}
+
+	if *version {
+		fmt.Printf("%s (%s)\n", VersionString, RevisionString)
+		os.Exit(0)
+	}
+
+	args := getopt.Args()
+	if len(args) > 1 {
+		getopt.Usage()
+		os.Exit(1)
+	}
+	file := ""
+	if len(args) == 1 {
+		file = args[0]
+	}
+
+	if *format != "" && *format != duet.FormatJSON {
+		cmd.Fail(fmt.Errorf("unknown format %q, --format only accepts %s", *format, duet.FormatJSON), 1)
+	}
+
+	if file != "" {
+		// the rest of the configuration is still that of the repository
+		os.Setenv("GIT_DUET_AUTHORS_FILE", file)
+	}
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+
+	diagnostics := configuration.Lint(file)
+	if err := duet.WriteDiagnostics(os.Stdout, diagnostics, *format == duet.FormatJSON); err != nil {
+		cmd.Fail(err, 1)
+	}
+	if !duet.DiagnosticsPassed(diagnostics) {
+		os.Exit(1)
+	}
+}
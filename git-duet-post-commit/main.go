@@ -4,11 +4,28 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
 	"github.com/git-duet/git-duet/internal/cmdrunner"
 )
 
 func main() {
-	err := cmdrunner.Execute() // rotates authors
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// a no-op unless rotating, for commits the wrapper commands already rotate
+	// after and for rebased or cherry-picked commits
+	if !configuration.RotateAuthor || os.Getenv(cmd.WrappedEnv) != "" || duet.ReplayInProgress() {
+		os.Exit(0)
+	}
+	if _, err = duet.GetAuthorConfig(configuration.Namespace, configuration.SetGitUserConfig); err != nil {
+		os.Exit(0)
+	}
+
+	err = cmdrunner.Execute() // rotates authors
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -5,7 +5,6 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"regexp"
 
 	"github.com/git-duet/git-duet"
 	"github.com/pborman/getopt"
@@ -50,26 +49,53 @@ func main() {
 		os.Exit(0)
 	}
 
+	// rebased or cherry-picked commits keep their authorship, amending them
+	// (e.g. `git rebase --exec 'git duet-commit --amend'`) credits the pair
+	if duet.ReplayInProgress() && commitMsgSource != "commit" {
+		os.Exit(0)
+	}
+
+	// an expired pair is not credited
+	if err = gitConfig.CheckExpiry(); err != nil {
+		if _, expired := err.(*duet.PairExpiredError); expired {
+			os.Exit(0)
+		}
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	trailerKey, err := configuration.CoAuthorTrailerKey()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	commitMsg, err := ioutil.ReadFile(commitMsgFile)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	coAuthorTrailerRegexp := regexp.MustCompile(`Co-authored-by:\s.+\s<.+>`)
-	trailerExists := coAuthorTrailerRegexp.Match(commitMsg)
-	if trailerExists && commitMsgSource != "commit" {
-		/* The goal here is to not add trailers in interactive rebasing or cherry-picking
-		   since authorship doesn't get changed. Since this hook doesn't know whether it is invoked
-		   as part of rebasing or cherry-picking, at the very least, it checks for existing trailers,
-		   and if there is one, no new trailers will be appended.
-		   Trailers will still be appended for "git commit --amend" in which case the
-		   commitMsgSource's value is "commit". */
-		os.Exit(0)
+	trailerExists := duet.HasCoAuthorTrailer(commitMsg, trailerKey)
+	if commitMsgSource == "commit" {
+		// amending: re-add the trailers of the current co-authors in the configured order
+		commitMsg = duet.RemoveCoAuthorTrailers(commitMsg, trailerKey, committers)
+	}
+	// the co-authors credited already (e.g. written by hand, or by a template)
+	// are left where they are, only credited once
+	commitMsg = duet.DeduplicateCoAuthorTrailers(commitMsg, trailerKey)
+	if err = ioutil.WriteFile(commitMsgFile, commitMsg, 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	for _, c := range committers {
-		trailer := "Co-authored-by: " + c.Name + " <" + c.Email + ">"
+	var missing []*duet.Pair
+	for _, p := range committers {
+		if !duet.HasCoAuthorTrailerFor(commitMsg, trailerKey, p) {
+			missing = append(missing, p)
+		}
+	}
+	for _, trailer := range duet.CoAuthorTrailers(trailerKey, duet.OrderCoAuthors(configuration.TrailerOrder, missing)) {
 		cmd := exec.Command("git", "interpret-trailers", "--in-place", "--trailer", trailer, commitMsgFile)
 		err := cmd.Run()
 		if err != nil {
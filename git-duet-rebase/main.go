@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/git-duet/git-duet/internal/cmd"
+)
+
+// actions resume or end a rebase in progress, git rebase takes no other
+// options with them
+var actions = map[string]bool{
+	"--continue":           true,
+	"--skip":               true,
+	"--abort":              true,
+	"--quit":               true,
+	"--edit-todo":          true,
+	"--show-current-patch": true,
+}
+
+// git duet-rebase rebases with the configured pair as the committer of every
+// rewritten commit, exporting it to git rebase (and the commands it runs) and
+// running git duet-fix-committer after each commit for those it misses. The
+// author is not rotated for the rewritten commits.
+func main() {
+	args := cmd.TakeJSONErrors(os.Args[1:])
+
+	action := false
+	for _, arg := range args {
+		action = action || actions[arg]
+	}
+	committer, err := cmd.Committer()
+	if !action {
+		// fail before rewriting anything rather than at every commit
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		args = append([]string{"--exec", "git duet-fix-committer"}, args...)
+	}
+
+	rebase := exec.Command("git", append([]string{"rebase"}, args...)...)
+	rebase.Stdin = os.Stdin
+	rebase.Stdout = os.Stdout
+	rebase.Stderr = os.Stderr
+	rebase.Env = append(os.Environ(), cmd.WrappedEnv+"=1")
+	if committer != nil {
+		// --abort and the like work without a pair
+		rebase.Env = append(rebase.Env,
+			fmt.Sprintf("GIT_COMMITTER_NAME=%s", committer.Name),
+			fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", committer.Email),
+		)
+	}
+	err = rebase.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// git rebase explained what went wrong (conflicts...)
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+}
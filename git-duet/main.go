@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 
 	"github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
+	"github.com/git-duet/git-duet/internal/picker"
 	"github.com/pborman/getopt"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -16,15 +24,72 @@ var (
 	RevisionString string
 )
 
+// dryRun is set by --dry-run, planAsJSON by --format json with it (see
+// flushPlan)
+var dryRun, planAsJSON bool
+
+// subcommands are the first arguments taken as a subcommand, after which the
+// flags can still be given
+var subcommands = map[string]bool{
+	"authors-file":    true,
+	"completion":      true,
+	"migrate-authors": true,
+	"pair-email":      true,
+}
+
 func main() {
 	var (
-		quiet   = getopt.BoolLong("quiet", 'q', "Silence output")
-		global  = getopt.BoolLong("global", 'g', "Change global config")
-		help    = getopt.BoolLong("help", 'h', "Help")
-		version = getopt.BoolLong("version", 'v', "Version")
+		quiet        = getopt.BoolLong("quiet", 'q', "Silence output")
+		global       = getopt.BoolLong("global", 'g', "Change global config")
+		local        = getopt.BoolLong("local", 'l', "Change repository config, even if GIT_DUET_GLOBAL is set")
+		show         = getopt.BoolLong("show", 's', "Show current config without prompting")
+		format       = getopt.StringLong("format", 'f', "", "Print each person using a Go template or one of: email, short, full, json, prompt")
+		jsonFormat   = getopt.BoolLong("json", 0, "Same as --format json")
+		random       = getopt.BoolLong("random", 'r', "Pick the remaining pair member(s) at random")
+		suggest      = getopt.BoolLong("suggest", 'S', "Suggest the least recent pairing partner")
+		yes          = getopt.BoolLong("yes", 'y', "Apply a random or suggested pair without confirmation")
+		porcelain    = getopt.BoolLong("porcelain", 0, "Print stable key value output for scripts")
+		shell        = getopt.StringLong("shell", 0, duet.ShellPOSIX, "Print variables for this shell: posix or fish")
+		null         = getopt.BoolLong("null", 'z', "Terminate porcelain records with NUL")
+		reset        = getopt.BoolLong("clear", 0, "Forget the configured author and committers")
+		swap         = getopt.BoolLong("swap", 0, "Swap author and committer (rotate a mob by one)")
+		rotate       = getopt.BoolLong("rotate", 0, "Same as --swap")
+		clearLookups = getopt.BoolLong("clear-lookup-cache", 0, "Forget cached email lookups")
+		refresh      = getopt.BoolLong("refresh-authors", 0, "Fetch the authors files given as URLs again, however fresh the cached copies are")
+		importHist   = getopt.BoolLong("import-history", 0, "Print an authors file made from the commit authors of the repository")
+		importCSV    = getopt.StringLong("import-csv", 0, "", "Print an authors file made from a CSV roster (- for stdin)", "FILE")
+		doctor       = getopt.BoolLong("doctor", 0, "Check the setup for common problems (as JSON with --format json)")
+		diffFiles    = getopt.BoolLong("diff", 0, "Compare the authors of two authors files (as JSON with --format json)")
+		exportJSON   = getopt.BoolLong("export-authors", 0, "Print every author of the authors file as JSON")
+		allRepos     = getopt.StringLong("all-repos", 0, "", "Set the pair in every git repository directly in this directory", "DIR")
+		list         = getopt.BoolLong("list", 0, "Print the authors (whose initials, name, username or team contain the argument, if given) as a table")
+		columns      = getopt.StringLong("columns", 0, "", "Columns of --list, comma-separated: initials, name, username, email, team", "COLUMNS")
+		noHeader     = getopt.BoolLong("no-header", 0, "Leave the header line out of --list")
+		noEmails     = getopt.BoolLong("without-emails", 0, "Leave emails out of --export-authors or --list instead of resolving them")
+		duplicates   = getopt.BoolLong("allow-duplicates", 0, "Allow someone to be in the pair twice")
+		invert       = getopt.BoolLong("invert", 'i', "Make the last initials given the author")
+		dryRunFlag   = getopt.BoolLong("dry-run", 'n', "Print the changes instead of making them (as JSON with --format json)")
+		jsonErrs     = getopt.BoolLong("json-errors", 0, "Print errors as JSON on stderr")
+		help         = getopt.BoolLong("help", 'h', "Help")
+		version      = getopt.BoolLong("version", 'v', "Version")
 	)
 
 	getopt.Parse()
+	// the flags can also follow a subcommand
+	subcommand := ""
+	if args := getopt.Args(); len(args) > 0 && subcommands[args[0]] {
+		subcommand = args[0]
+		getopt.CommandLine.Parse(args)
+	}
+	cmd.JSONErrors = *jsonErrs
+	if *jsonFormat {
+		if *format != "" && *format != duet.FormatJSON {
+			cmd.Fail(errors.New("--json and --format are mutually exclusive"), 1)
+		}
+		*format = duet.FormatJSON
+	}
+	dryRun = *dryRunFlag
+	planAsJSON = dryRun && *format == duet.FormatJSON
 
 	if *help {
 		getopt.Usage()
@@ -36,42 +101,285 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *clearLookups {
+		if err := duet.ClearEmailLookupCache(); err != nil {
+			cmd.Fail(err, 1)
+		}
+		os.Exit(0)
+	}
+
+	if *refresh {
+		if err := duet.RefreshAuthorsFiles(); err != nil {
+			cmd.Fail(err, 1)
+		}
+		os.Exit(0)
+	}
+
+	// the script needs no configuration, unlike the initials it completes
+	if subcommand == "completion" && (getopt.NArgs() != 1 || getopt.Arg(0) != "initials") {
+		if getopt.NArgs() != 1 {
+			cmd.Fail(errors.New("completion takes the shell to complete for: bash, zsh or fish"), 1)
+		}
+		if err := duet.WriteCompletionScript(os.Stdout, getopt.Arg(0)); err != nil {
+			cmd.Fail(err, 1)
+		}
+		os.Exit(0)
+	}
+
+	if *importHist {
+		importHistory()
+		os.Exit(0)
+	}
+
+	if *importCSV != "" {
+		importRoster(*importCSV)
+		os.Exit(0)
+	}
+
+	if *doctor {
+		diagnostics := duet.Doctor()
+		if err := duet.WriteDiagnostics(os.Stdout, diagnostics, *format == duet.FormatJSON); err != nil {
+			cmd.Fail(err, 1)
+		}
+		if !duet.DiagnosticsPassed(diagnostics) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *diffFiles {
+		diffAuthorsFiles(getopt.Args(), *format == duet.FormatJSON)
+		os.Exit(0)
+	}
+
+	if *noEmails && !*exportJSON && !*list {
+		cmd.Fail(errors.New("--without-emails only goes with --export-authors or --list"), 1)
+	}
+
+	if (*columns != "" || *noHeader) && !*list {
+		cmd.Fail(errors.New("--columns and --no-header only go with --list"), 1)
+	}
+
+	if *global && *local {
+		cmd.Fail(errors.New("--global and --local are mutually exclusive"), 1)
+	}
+
+	if *allRepos != "" && (*global || dryRun) {
+		cmd.Fail(errors.New("--all-repos sets the pair in the config of each repository, it does not go with --global or --dry-run"), 1)
+	}
+
+	if *format != "" && *porcelain {
+		cmd.Fail(errors.New("--format and --porcelain are mutually exclusive"), 1)
+	}
+
+	if *format != "" && *quiet {
+		cmd.Fail(errors.New("--format and --quiet are mutually exclusive"), 1)
+	}
+
+	if *format != "" {
+		if _, err := duet.ParseFormat(*format); err != nil {
+			cmd.Fail(err, 1)
+		}
+	}
+
+	if err := duet.ValidateShell(*shell); err != nil {
+		cmd.Fail(err, 1)
+	}
+
+	if subcommand == "authors-file" {
+		if getopt.NArgs() != 1 {
+			cmd.Fail(errors.New("authors-file takes the path of the authors file"), 1)
+		}
+		if err := duet.SetAuthorsFileConfig(getopt.Arg(0), *global); err != nil {
+			cmd.Fail(err, 1)
+		}
+		os.Exit(0)
+	}
+
 	configuration, err := duet.NewConfiguration()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
+	}
+	if !dryRun {
+		duet.NudgeOutdatedHooks(os.Stderr)
+	}
+
+	configuration.DuplicatePeople = *duplicates
+
+	if subcommand == "migrate-authors" {
+		migrateAuthors(configuration, getopt.Args())
+		os.Exit(0)
+	}
+
+	if subcommand == "pair-email" {
+		pairEmail(configuration, getopt.Args())
+		os.Exit(0)
+	}
+
+	if subcommand == "completion" {
+		pairs, err := configuration.LoadPairs()
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		if err = duet.WriteCompletionCandidates(os.Stdout, pairs); err != nil {
+			cmd.Fail(err, 1)
+		}
+		os.Exit(0)
+	}
+
+	if *exportJSON {
+		pairs, err := configuration.LoadPairs()
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		if err = pairs.ExportJSON(os.Stdout, !*noEmails); err != nil {
+			cmd.Fail(err, 1)
+		}
+		os.Exit(0)
+	}
+
+	if *list {
+		listAuthors(configuration, getopt.Args(), *columns, *noHeader, *noEmails)
+		os.Exit(0)
 	}
 
-	gitConfig := &duet.GitConfig{Namespace: configuration.Namespace, SetUserConfig: configuration.SetGitUserConfig}
-	if *global || configuration.Global {
+	gitConfig := &duet.GitConfig{
+		Namespace:       configuration.Namespace,
+		SetUserConfig:   configuration.SetGitUserConfig,
+		CoAuthoredBy:    configuration.CoAuthoredBy,
+		ExpireAfter:     configuration.ExpireAfter,
+		DuplicatePeople: configuration.DuplicatePeople,
+
+		AllowedSignersFile: configuration.AllowedSignersFile,
+	}
+	// flags take precedence over $GIT_DUET_GLOBAL, which takes precedence
+	// over duet.global in git config
+	if *local {
+		gitConfig.Scope = duet.Local
+	} else if *global || configuration.Global {
 		gitConfig.Scope = duet.Global
 	}
+	if dryRun {
+		gitConfig.DryRun = &duet.Plan{}
+	}
+
+	if *reset {
+		if err = gitConfig.ClearConfig(); err != nil {
+			cmd.Fail(err, 1)
+		}
+		syncCommitTemplate(configuration, gitConfig)
+		flushPlan(gitConfig)
+		os.Exit(0)
+	}
+
+	if *swap || *rotate {
+		pairs, err := configuration.LoadPairs()
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+
+		author, committers, err := gitConfig.SwapRoles(pairs)
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		syncCommitTemplate(configuration, gitConfig)
+
+		if dryRun {
+			flushPlan(gitConfig)
+		} else {
+			printConfigured(configuration, gitConfig, *format, *shell, *porcelain, *null, *quiet, author, committers)
+		}
+		os.Exit(0)
+	}
+
+	initials, err := duet.SplitInitials(getopt.Args())
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	var pairs *duet.Pairs
+	if len(initials) > 0 {
+		if pairs, err = configuration.LoadPairs(); err != nil {
+			cmd.Fail(err, 1)
+		}
+		if initials, err = pairs.ExpandSquads(initials); err != nil {
+			cmd.Fail(err, 86)
+		}
+	}
+	if *random {
+		if initials, err = randomInitials(configuration, initials, *yes, *quiet); err != nil {
+			cmd.Fail(err, 1)
+		}
+		if initials == nil {
+			cmd.Fail(errors.New("aborting"), 1)
+		}
+	}
+
+	if *suggest {
+		if initials, err = suggestInitials(configuration, gitConfig, initials, *yes, *quiet); err != nil {
+			cmd.Fail(err, 1)
+		}
+		if initials == nil {
+			cmd.Fail(errors.New("aborting"), 1)
+		}
+	}
+
+	if *allRepos != "" {
+		if len(initials) < 2 {
+			cmd.Fail(errors.New("must specify at least two sets of initials"), 1)
+		}
+		setPairInRepos(configuration, *allRepos, initials, *format == duet.FormatJSON)
+	}
+
+	if len(initials) == 0 && !*show && picker.IsTerminal(os.Stdin) {
+		if initials, err = pickInitials(configuration); err != nil {
+			cmd.Fail(err, 1)
+		}
+		if initials == nil {
+			os.Exit(0)
+		}
+	}
 
-	if getopt.NArgs() == 0 {
+	if len(initials) == 0 {
 		author, err := gitConfig.GetAuthor()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			cmd.Fail(err, 1)
 		}
 		committers, err := gitConfig.GetCommitters()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			cmd.Fail(err, 1)
 		}
 
-		if committers == nil && author != nil {
-			committers = []*duet.Pair{author}
-		}
+		if dryRun {
+			// only the changes are printed
+		} else if *porcelain {
+			err = cmd.PrintPorcelain(gitConfig, *null, author, committers...)
+		} else if *format == duet.FormatJSON {
+			err = cmd.PrintJSON(configuration, gitConfig)
+		} else if *format == duet.FormatPrompt {
+			err = cmd.PrintPrompt(gitConfig)
+		} else if *format != "" {
+			err = cmd.PrintFormatted(*format, author, committers...)
+		} else {
+			if committers == nil && author != nil {
+				committers = []*duet.Pair{author}
+			}
 
-		printAuthor(author)
-		printNextComitter(committers)
+			printExports(*shell, author, committers)
+			printSessionDuration(gitConfig)
+		}
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		if err = cmd.WarnShadowed(configuration, gitConfig, false); err != nil {
+			cmd.Fail(err, 1)
+		}
 		if configuration.CoAuthoredBy {
 			installHook("prepare-commit-msg")
 			// SetAuthor is needed in case neither GIT_DUET_CO_AUTHORED_BY nor GIT_DUET_SET_GIT_USER_CONFIG was set previously
 			if err = gitConfig.SetAuthor(author); err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				cmd.Fail(err, 1)
 			}
+			flushPlan(gitConfig)
 			if configuration.RotateAuthor {
 				installHook("post-commit")
 			}
@@ -79,47 +387,46 @@ func main() {
 		os.Exit(0)
 	}
 
-	if getopt.NArgs() < 2 {
-		fmt.Println("must specify at least two sets of initials")
-		os.Exit(1)
+	if len(initials) < 2 {
+		cmd.Fail(errors.New("must specify at least two sets of initials"), 1)
 	}
 
-	pairs, err := duet.NewPairsFromFile(configuration.PairsFile, configuration.EmailLookup)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(0)
+	if pairs == nil {
+		if pairs, err = configuration.LoadPairs(); err != nil {
+			cmd.Fail(err, 1)
+		}
 	}
 
-	author, err := pairs.ByInitials(getopt.Arg(0))
+	resolved, err := pairs.ByInitialsMany(initials...)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(86)
+		cmd.Fail(err, 86)
 	}
-	if err = gitConfig.SetAuthor(author); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	var committers []*duet.Pair
-
-	for _, initials := range getopt.Args()[1:] {
-		committer, err := pairs.ByInitials(initials)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(86)
+	if *invert || configuration.Invert {
+		resolved = duet.InvertRoles(resolved)
+		if !*quiet && !*porcelain && *format == "" {
+			fmt.Fprintf(os.Stderr, "git-duet: roles inverted, %s is the author\n", resolved[0].Initials)
 		}
+	}
+	author, committers := resolved[0], resolved[1:]
 
-		committers = append(committers, committer)
+	if err = gitConfig.SetAuthor(author); err != nil {
+		cmd.Fail(err, 1)
 	}
 
 	if err = gitConfig.SetCommitters(committers...); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
 	}
+	syncCommitTemplate(configuration, gitConfig)
 
-	if !*quiet {
-		printAuthor(author)
-		printNextComitter(committers)
+	if dryRun {
+		flushPlan(gitConfig)
+	} else {
+		printConfigured(configuration, gitConfig, *format, *shell, *porcelain, *null, *quiet, author, committers)
+	}
+	if gitConfig.Scope != duet.Default {
+		if err = cmd.WarnShadowed(configuration, gitConfig, *quiet); err != nil {
+			cmd.Fail(err, 1)
+		}
 	}
 
 	if configuration.CoAuthoredBy {
@@ -130,32 +437,395 @@ func main() {
 	}
 }
 
-func printAuthor(author *duet.Pair) {
-	if author == nil {
-		return
+// printConfigured prints the newly configured author and committers
+func printConfigured(configuration *duet.Configuration, gitConfig *duet.GitConfig, format, shell string, porcelain, null, quiet bool, author *duet.Pair, committers []*duet.Pair) {
+	var err error
+	if porcelain {
+		err = cmd.PrintPorcelain(gitConfig, null, author, committers...)
+	} else if format == duet.FormatJSON {
+		err = cmd.PrintJSON(configuration, gitConfig)
+	} else if format == duet.FormatPrompt {
+		err = cmd.PrintPrompt(gitConfig)
+	} else if format != "" {
+		err = cmd.PrintFormatted(format, author, committers...)
+	} else if !quiet {
+		printExports(shell, author, committers)
 	}
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+}
 
-	fmt.Printf("GIT_AUTHOR_NAME='%s'\n", author.Name)
-	fmt.Printf("GIT_AUTHOR_EMAIL='%s'\n", author.Email)
+// printSessionDuration prints how long the configured people have been
+// pairing as a comment, so that the exports can still be eval'd
+func printSessionDuration(gitConfig *duet.GitConfig) {
+	d, ok, err := gitConfig.SessionDuration()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	if ok {
+		fmt.Printf("# pairing for %s\n", duet.FormatSessionDuration(d))
+	}
 }
 
-func printNextComitter(committers []*duet.Pair) {
-	if committers == nil || len(committers) == 0 {
-		return
+// printExports prints the author and the next committer as variables for shell
+func printExports(shell string, author *duet.Pair, committers []*duet.Pair) {
+	var committer *duet.Pair
+	if len(committers) > 0 {
+		committer = committers[0]
 	}
 
-	fmt.Printf("GIT_COMMITTER_NAME='%s'\n", committers[0].Name)
-	fmt.Printf("GIT_COMMITTER_EMAIL='%s'\n", committers[0].Email)
+	if err := duet.WriteExports(os.Stdout, shell, author, committer); err != nil {
+		cmd.Fail(err, 1)
+	}
+}
+
+// syncCommitTemplate updates the co-authors in commit.template (if enabled)
+func syncCommitTemplate(configuration *duet.Configuration, gitConfig *duet.GitConfig) {
+	if err := configuration.SyncCommitTemplate(gitConfig); err != nil {
+		cmd.Fail(err, 1)
+	}
+}
+
+// flushPlan prints the changes planned so far with --dry-run, so that they
+// show up in order with the ones of git-duet-install-hook (see installHook)
+func flushPlan(gitConfig *duet.GitConfig) {
+	if gitConfig.DryRun == nil {
+		return
+	}
+	if err := duet.WritePlan(os.Stdout, gitConfig.DryRun, planAsJSON); err != nil {
+		cmd.Fail(err, 1)
+	}
+	gitConfig.DryRun.Changes = nil
 }
 
 func installHook(hookType string) {
-	cmd := exec.Command("git-duet-install-hook", hookType)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+	args := []string{hookType}
+	if cmd.JSONErrors {
+		args = append([]string{cmd.JSONErrorsOption}, args...)
+	}
+	if dryRun {
+		args = append([]string{"--dry-run"}, args...)
+	}
+	if planAsJSON {
+		args = append([]string{"--format", duet.FormatJSON}, args...)
+	}
+	install := exec.Command("git-duet-install-hook", args...)
+	install.Stderr = os.Stderr
+	install.Stdout = os.Stdout
 
-	err := cmd.Run()
-	if err != nil {
-		fmt.Println(err)
+	err := install.Run()
+	if _, failed := err.(*exec.ExitError); failed && cmd.JSONErrors {
+		// git-duet-install-hook reported the error already
 		os.Exit(1)
 	}
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+}
+
+// importHistory prints an authors file made from the history of the current
+// repository, reporting people who still have several addresses or were
+// skipped on stderr
+func importHistory() {
+	pairs, report, err := duet.ImportHistory()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+
+	output, err := yaml.Marshal(pairs)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	fmt.Print(string(output))
+
+	for _, duplicate := range report.Duplicates {
+		fmt.Fprintf(os.Stderr, "git-duet: warning: %v\n", duplicate)
+	}
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(os.Stderr, "git-duet: warning: %v\n", skipped)
+	}
+}
+
+// importRoster prints an authors file made from the CSV roster in file (stdin
+// for -)
+func importRoster(file string) {
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	pairs, err := duet.ImportCSV(in)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	output, err := yaml.Marshal(pairs)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	fmt.Print(string(output))
+}
+
+// pairEmail prints the shared email `git pair` uses for the pair with the
+// given initials (see Pairs.PairEmail)
+func pairEmail(configuration *duet.Configuration, args []string) {
+	initials, err := duet.SplitInitials(args)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	if len(initials) < 2 {
+		cmd.Fail(errors.New("pair-email takes the initials of at least two people"), 1)
+	}
+
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	if initials, err = pairs.ExpandSquads(initials); err != nil {
+		cmd.Fail(err, 86)
+	}
+	people, err := pairs.ByInitialsMany(initials...)
+	if err != nil {
+		cmd.Fail(err, 86)
+	}
+	email, err := pairs.PairEmail(people...)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	fmt.Println(email)
+}
+
+// migrateAuthors rewrites the authors of the authors file given as strings as
+// structured entries, with the emails they resolve to now. With --dry-run, the
+// file migrated is printed instead.
+func migrateAuthors(configuration *duet.Configuration, args []string) {
+	if len(args) > 0 {
+		cmd.Fail(fmt.Errorf("migrate-authors migrates %s, it takes no arguments", configuration.PairsFile), 1)
+	}
+
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	migrated, skipped, err := duet.StructureAuthorsFile(configuration.PairsFile, pairs, dryRun)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	for _, warning := range skipped {
+		fmt.Fprintf(os.Stderr, "git-duet: warning: %v\n", warning)
+	}
+
+	if migrated == nil {
+		fmt.Fprintf(os.Stderr, "%s has no authors to migrate\n", configuration.PairsFile)
+	} else if dryRun {
+		fmt.Print(string(migrated))
+	}
+}
+
+// diffAuthorsFiles prints what changed between the two authors files given,
+// each resolved on its own without the email lookup settings of the environment
+func diffAuthorsFiles(files []string, asJSON bool) {
+	if len(files) != 2 {
+		cmd.Fail(errors.New("--diff needs the old and the new authors file"), 1)
+	}
+
+	sides := make([]*duet.Pairs, 2)
+	for i, file := range files {
+		pairs, err := duet.NewPairsFromFile(file, "", duet.WithLenientEntries())
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		for _, warning := range pairs.Warnings() {
+			fmt.Fprintf(os.Stderr, "git-duet: warning: %v\n", warning)
+		}
+		sides[i] = pairs
+	}
+
+	diff, err := duet.DiffPairs(sides[0], sides[1])
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	if err = duet.WriteDiff(os.Stdout, diff, asJSON); err != nil {
+		cmd.Fail(err, 1)
+	}
+}
+
+// listAuthors prints the authors matching the words given (all of them if
+// none) as a table fitting in $COLUMNS characters, 80 if not set
+func listAuthors(configuration *duet.Configuration, words []string, columns string, noHeader, noEmails bool) {
+	opts := duet.TableOptions{NoHeader: noHeader, Width: 80}
+	if columns != "" {
+		var err error
+		if opts.Columns, err = duet.ParseTableColumns(columns); err != nil {
+			cmd.Fail(err, 1)
+		}
+	}
+	if noEmails {
+		if opts.Columns == nil {
+			opts.Columns = []duet.TableColumn{duet.ColumnInitials, duet.ColumnName, duet.ColumnUsername, duet.ColumnTeam}
+		}
+		for _, c := range opts.Columns {
+			if c == duet.ColumnEmail {
+				cmd.Fail(errors.New("--without-emails leaves out the email column"), 1)
+			}
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil {
+		opts.Width = width
+	}
+
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	matches, err := pairs.Search(strings.Join(words, " "), !noEmails)
+	if err != nil {
+		cmd.Fail(err, 86)
+	}
+	if err = duet.RenderTable(os.Stdout, matches, opts); err != nil {
+		cmd.Fail(err, 1)
+	}
+}
+
+// setPairInRepos sets the pair in every repository in workspace and exits,
+// with 1 if it could not be set in some of them
+func setPairInRepos(configuration *duet.Configuration, workspace string, initials []string, asJSON bool) {
+	repos, err := duet.FindRepos(workspace)
+	if err != nil {
+		cmd.Fail(err, 1)
+	}
+	if len(repos) == 0 {
+		cmd.Fail(fmt.Errorf("there are no git repositories in %s", workspace), 1)
+	}
+
+	results, err := configuration.SetPairInRepos(repos, initials)
+	if err != nil {
+		cmd.Fail(err, 86)
+	}
+	if err = duet.WriteRepoResults(os.Stdout, results, asJSON); err != nil {
+		cmd.Fail(err, 1)
+	}
+
+	for _, result := range results {
+		if result.Status != duet.RepoSet {
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+// pickInitials lets the user choose the pair from the authors file when no
+// initials were given on the command line (first selected becomes the author)
+func pickInitials(configuration *duet.Configuration) (initials []string, err error) {
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := pairs.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []picker.Item
+	for _, p := range all {
+		label := fmt.Sprintf("%-6s %s <%s>", p.Initials, p.Name, p.Email)
+		if p.Team != "" {
+			// lets the team be searched for with the picker's filter
+			label += fmt.Sprintf(" [%s]", p.Team)
+		}
+		items = append(items, picker.Item{Key: p.Initials, Label: label})
+	}
+
+	return picker.New().Pick("Select authors in order (first selected is the author):", items)
+}
+
+// randomInitials fills up the given initials (at most one) to a pair with
+// randomly selected authors, printed on stderr unless quiet, asking for
+// confirmation unless skipConfirm is set. Returns nil initials if the user
+// declined.
+func randomInitials(configuration *duet.Configuration, initials []string, skipConfirm, quiet bool) ([]string, error) {
+	if len(initials) > 1 {
+		return nil, fmt.Errorf("--random accepts at most one set of initials")
+	}
+
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	chosen, err := pairs.Random(rand.New(rand.NewSource(configuration.RandomSeed)), 2-len(initials), initials...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range chosen {
+		initials = append(initials, p.Initials)
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "random pair: %s\n", strings.Join(initials, " "))
+	}
+	if skipConfirm || confirm() {
+		return initials, nil
+	}
+
+	return nil, nil
+}
+
+// suggestInitials pairs the given initials (or the configured author if none
+// are given) with the person they paired with least recently, printed on
+// stderr unless quiet, asking for confirmation unless skipConfirm is set.
+// Returns nil initials if the user declined.
+func suggestInitials(configuration *duet.Configuration, gitConfig *duet.GitConfig, initials []string, skipConfirm, quiet bool) ([]string, error) {
+	if len(initials) > 1 {
+		return nil, fmt.Errorf("--suggest accepts at most one set of initials")
+	}
+	if len(initials) == 0 {
+		author, err := gitConfig.GetAuthor()
+		if err != nil {
+			return nil, err
+		}
+		if author == nil {
+			return nil, fmt.Errorf("--suggest needs initials when no author is set")
+		}
+		initials = []string{author.Initials}
+	}
+
+	pairs, err := configuration.LoadPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := pairs.PairingStatsFromHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	partner, err := pairs.SuggestPartner(initials[0], stats)
+	if err != nil {
+		return nil, err
+	}
+
+	initials = append(initials, partner.Initials)
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "suggested partner: %s (%s)\n", partner.Initials, partner.Name)
+	}
+	if skipConfirm || confirm() {
+		return initials, nil
+	}
+
+	return nil, nil
+}
+
+func confirm() bool {
+	fmt.Fprint(os.Stderr, "apply (y/N)? ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
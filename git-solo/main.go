@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/git-duet/git-duet"
+	"github.com/git-duet/git-duet/internal/cmd"
 	"github.com/pborman/getopt"
 )
 
@@ -17,13 +19,28 @@ var (
 
 func main() {
 	var (
-		quiet   = getopt.BoolLong("quiet", 'q', "Silence output")
-		global  = getopt.BoolLong("global", 'g', "Change global config")
-		help    = getopt.BoolLong("help", 'h', "Help")
-		version = getopt.BoolLong("version", 'v', "Version")
+		quiet      = getopt.BoolLong("quiet", 'q', "Silence output")
+		global     = getopt.BoolLong("global", 'g', "Change global config")
+		local      = getopt.BoolLong("local", 'l', "Change repository config, even if GIT_DUET_GLOBAL is set")
+		format     = getopt.StringLong("format", 'f', "", "Print the author using a Go template or one of: email, short, full, json, prompt")
+		jsonFormat = getopt.BoolLong("json", 0, "Same as --format json")
+		porcelain  = getopt.BoolLong("porcelain", 0, "Print stable key value output for scripts")
+		shell      = getopt.StringLong("shell", 0, duet.ShellPOSIX, "Print variables for this shell: posix or fish")
+		null       = getopt.BoolLong("null", 'z', "Terminate porcelain records with NUL")
+		dryRun     = getopt.BoolLong("dry-run", 'n', "Print the changes instead of making them (as JSON with --format json)")
+		jsonErrs   = getopt.BoolLong("json-errors", 0, "Print errors as JSON on stderr")
+		help       = getopt.BoolLong("help", 'h', "Help")
+		version    = getopt.BoolLong("version", 'v', "Version")
 	)
 
 	getopt.Parse()
+	cmd.JSONErrors = *jsonErrs
+	if *jsonFormat {
+		if *format != "" && *format != duet.FormatJSON {
+			cmd.Fail(errors.New("--json and --format are mutually exclusive"), 1)
+		}
+		*format = duet.FormatJSON
+	}
 
 	if *help {
 		getopt.Usage()
@@ -35,60 +52,132 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *global && *local {
+		cmd.Fail(errors.New("--global and --local are mutually exclusive"), 1)
+	}
+
+	if *format != "" && *porcelain {
+		cmd.Fail(errors.New("--format and --porcelain are mutually exclusive"), 1)
+	}
+
+	if *format != "" && *quiet {
+		cmd.Fail(errors.New("--format and --quiet are mutually exclusive"), 1)
+	}
+
+	if *format != "" {
+		if _, err := duet.ParseFormat(*format); err != nil {
+			cmd.Fail(err, 1)
+		}
+	}
+
+	if err := duet.ValidateShell(*shell); err != nil {
+		cmd.Fail(err, 1)
+	}
+
 	configuration, err := duet.NewConfiguration()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
+	}
+	if !*dryRun {
+		duet.NudgeOutdatedHooks(os.Stderr)
 	}
 
-	gitConfig := &duet.GitConfig{Namespace: configuration.Namespace, SetUserConfig: configuration.SetGitUserConfig}
-	if *global || configuration.Global {
+	gitConfig := &duet.GitConfig{
+		Namespace:     configuration.Namespace,
+		SetUserConfig: configuration.SetGitUserConfig,
+		CoAuthoredBy:  configuration.CoAuthoredBy,
+		ExpireAfter:   configuration.ExpireAfter,
+
+		AllowedSignersFile: configuration.AllowedSignersFile,
+	}
+	// flags take precedence over $GIT_DUET_GLOBAL, which takes precedence
+	// over duet.global in git config
+	if *local {
+		gitConfig.Scope = duet.Local
+	} else if *global || configuration.Global {
 		gitConfig.Scope = duet.Global
 	}
+	if *dryRun {
+		gitConfig.DryRun = &duet.Plan{}
+	}
 
 	if getopt.NArgs() == 0 {
 		author, err := gitConfig.GetAuthor()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			cmd.Fail(err, 1)
 		}
 
-		printAuthor(author)
+		if *dryRun {
+			// there are no changes to print
+		} else if *porcelain {
+			err = cmd.PrintPorcelain(gitConfig, *null, author)
+		} else if *format == duet.FormatJSON {
+			err = cmd.PrintJSON(configuration, gitConfig)
+		} else if *format == duet.FormatPrompt {
+			err = cmd.PrintPrompt(gitConfig)
+		} else if *format != "" {
+			err = cmd.PrintFormatted(*format, author)
+		} else {
+			printAuthor(*shell, author)
+		}
+		if err != nil {
+			cmd.Fail(err, 1)
+		}
+		if err = cmd.WarnShadowed(configuration, gitConfig, false); err != nil {
+			cmd.Fail(err, 1)
+		}
 		os.Exit(0)
 	}
 
-	pairs, err := duet.NewPairsFromFile(configuration.PairsFile, configuration.EmailLookup)
+	pairs, err := configuration.LoadPairs()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(0)
+		cmd.Fail(err, 1)
 	}
 
 	author, err := pairs.ByInitials(getopt.Arg(0))
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(86)
+		cmd.Fail(err, 86)
 	}
 
 	if err = gitConfig.SetAuthor(author); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
 	}
 
 	if err = gitConfig.ClearCommitter(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		cmd.Fail(err, 1)
 	}
 
-	if !*quiet {
-		printAuthor(author)
+	if err = configuration.SyncCommitTemplate(gitConfig); err != nil {
+		cmd.Fail(err, 1)
 	}
-}
 
-func printAuthor(author *duet.Pair) {
-	if author == nil {
-		return
+	if *dryRun {
+		if err = duet.WritePlan(os.Stdout, gitConfig.DryRun, *format == duet.FormatJSON); err != nil {
+			cmd.Fail(err, 1)
+		}
+	} else if *porcelain {
+		err = cmd.PrintPorcelain(gitConfig, *null, author)
+	} else if *format == duet.FormatJSON {
+		err = cmd.PrintJSON(configuration, gitConfig)
+	} else if *format == duet.FormatPrompt {
+		err = cmd.PrintPrompt(gitConfig)
+	} else if *format != "" {
+		err = cmd.PrintFormatted(*format, author)
+	} else if !*quiet {
+		printAuthor(*shell, author)
+	}
+	if err != nil {
+		cmd.Fail(err, 1)
 	}
+	if gitConfig.Scope != duet.Default {
+		if err = cmd.WarnShadowed(configuration, gitConfig, *quiet); err != nil {
+			cmd.Fail(err, 1)
+		}
+	}
+}
 
-	fmt.Printf("GIT_AUTHOR_NAME='%s'\n", author.Name)
-	fmt.Printf("GIT_AUTHOR_EMAIL='%s'\n", author.Email)
+func printAuthor(shell string, author *duet.Pair) {
+	if err := duet.WriteExports(os.Stdout, shell, author, nil); err != nil {
+		cmd.Fail(err, 1)
+	}
 }
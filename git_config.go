@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -34,11 +35,26 @@ const (
 // Namespace determines the section under which configuration will be stored
 // SetUserConfig determines whether user.name and user.email are set in
 // addition to the git-duet namespaced configuration for the author
+// CoAuthoredBy records whether co-authored-by mode is active (see GetConfig)
+// ExpireAfter makes the configuration expire that long after it was last set
+// (zero never expires)
+// DuplicatePeople lets SetCommitters configure someone twice
+// DryRun records the changes to the configuration instead of making them
+// AllowedSignersFile is set as gpg.ssh.allowedSignersFile along with the SSH
+// signing key of an author (see IsSSHSigningKey), left alone if empty
+// Dir is the repository whose config is used, the working directory if empty
 type GitConfig struct {
 	Namespace string
 	Scope     scope
+	Dir       string
 
-	SetUserConfig bool
+	SetUserConfig   bool
+	CoAuthoredBy    bool
+	ExpireAfter     time.Duration
+	DuplicatePeople bool
+	DryRun          *Plan
+
+	AllowedSignersFile string
 }
 
 // GetAuthorConfig returns the config source for git author information.
@@ -58,7 +74,7 @@ func GetAuthorConfig(namespace string, setUserConfig bool) (config *GitConfig, e
 		}
 	}
 
-	return nil, errors.New("git-author not set")
+	return nil, &AuthorNotSetError{}
 }
 
 // ClearCommitter removes committer name/email from config
@@ -74,10 +90,13 @@ func (gc *GitConfig) ClearCommitter() (err error) {
 	if err = gc.setKey("git-committer-email", ""); err != nil {
 		return err
 	}
+	if err = gc.unsetKey("git-committer-signingkey"); err != nil {
+		return err
+	}
 	if err = gc.updateMtime(); err != nil {
 		return err
 	}
-	return nil
+	return gc.updateSession()
 }
 
 // SetAuthor sets the configuration for author name and email
@@ -92,14 +111,30 @@ func (gc *GitConfig) SetAuthor(author *Pair) (err error) {
 }
 
 // SetCommitters sets the configuration for committers names and emails
+// Unless DuplicatePeople is set, returns a *DuplicatePersonError if a committer
+// is the configured author or another committer (see CheckDistinctPeople).
 func (gc *GitConfig) SetCommitters(committers ...*Pair) (err error) {
+	if !gc.DuplicatePeople {
+		author, err := gc.GetAuthor()
+		if err != nil {
+			return err
+		}
+		people := committers
+		if author != nil {
+			people = append([]*Pair{author}, committers...)
+		}
+		if err = CheckDistinctPeople(people); err != nil {
+			return err
+		}
+	}
+
 	if err = gc.setCommitters(committers); err != nil {
 		return err
 	}
 	if err = gc.updateMtime(); err != nil {
 		return err
 	}
-	return nil
+	return gc.updateSession()
 }
 
 // RotateAuthor flips the committer and author if committer is set
@@ -110,6 +145,8 @@ func (gc *GitConfig) RotateAuthor() (err error) {
 		if gitConfig, err = GetAuthorConfig(gc.Namespace, gc.SetUserConfig); err != nil {
 			return err
 		}
+		gitConfig.DryRun = gc.DryRun
+		gitConfig.AllowedSignersFile = gc.AllowedSignersFile
 	}
 
 	var author *Pair
@@ -136,8 +173,154 @@ func (gc *GitConfig) RotateAuthor() (err error) {
 	return nil
 }
 
+// SwapRoles makes the first committer the author and the author the last
+// committer (rotating a mob by one), refreshing the mtime. Everyone's email is
+// re-resolved from pairs rather than copied from the stored configuration.
+// Returns the new author and committers, or an error if working solo.
+func (gc *GitConfig) SwapRoles(pairs *Pairs) (author *Pair, committers []*Pair, err error) {
+	target := *gc
+	if gc.Scope == Default {
+		// write back where the configuration was read from
+		found, err := GetAuthorConfig(gc.Namespace, gc.SetUserConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		target.Scope = found.Scope
+	}
+
+	current, err := target.GetAuthor()
+	if err != nil {
+		return nil, nil, err
+	}
+	if current == nil {
+		return nil, nil, &NotConfiguredError{}
+	}
+	currentCommitters, err := target.GetCommitters()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(currentCommitters) == 0 {
+		return nil, nil, errors.New("cannot swap roles when working solo, pair up with `git duet` first")
+	}
+
+	var initials []string
+	for _, committer := range currentCommitters {
+		initials = append(initials, committer.Initials)
+	}
+	resolved, err := pairs.ByInitialsMany(append(initials, current.Initials)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	author, committers = resolved[0], resolved[1:]
+
+	if err = target.setAuthor(author); err != nil {
+		return nil, nil, err
+	}
+	if err = target.setCommitters(committers); err != nil {
+		return nil, nil, err
+	}
+	if err = target.updateMtime(); err != nil {
+		return nil, nil, err
+	}
+	if err = target.updateSession(); err != nil {
+		return nil, nil, err
+	}
+
+	return author, committers, nil
+}
+
+// ClearConfig removes every key in the namespace (author, committers, mtime,
+// session)
+// and restores user.name and user.email if SetUserConfig replaced them, and
+// the signing configuration if the author had a signing key
+// Default clears the repo config. Clearing when nothing is set is a no-op.
+func (gc *GitConfig) ClearConfig() (err error) {
+	target := gc
+	if gc.Scope == Default {
+		target = &GitConfig{Namespace: gc.Namespace, Scope: Local, DryRun: gc.DryRun}
+	}
+
+	for _, key := range []string{"name", "email"} {
+		saved, err := target.hasFullKey(target.Namespace + ".original-user-" + key)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			continue
+		}
+		original, err := target.getKey("original-user-" + key)
+		if err != nil {
+			return err
+		}
+		if original == "" {
+			err = target.unsetFullKey("user." + key)
+		} else {
+			err = target.setUnnamespacedKey("user."+key, original)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err = target.restoreSigningConfig(); err != nil {
+		return err
+	}
+
+	output := new(bytes.Buffer)
+	cmd := target.configCommand("--get-regexp", "^"+regexp.QuoteMeta(target.Namespace)+`\.`)
+	cmd.Stdout = output
+	if err = newIgnorableCommand(cmd, 1).Run(); err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		key := strings.SplitN(line, " ", 2)[0]
+		if err = target.unsetFullKey(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backupUserConfig saves user.name and user.email before SetUserConfig
+// replaces them for the first time, so that ClearConfig can restore them.
+// An empty backup records that the key was not set in the target config, so
+// that ClearConfig unsets it rather than leaving the author behind
+func (gc *GitConfig) backupUserConfig() (err error) {
+	target := gc
+	if gc.Scope == Default {
+		target = &GitConfig{Namespace: gc.Namespace, Scope: Local, DryRun: gc.DryRun}
+	}
+
+	for _, key := range []string{"name", "email"} {
+		saved, err := target.hasFullKey(target.Namespace + ".original-user-" + key)
+		if err != nil {
+			return err
+		}
+		if saved {
+			continue
+		}
+
+		current, err := target.getUnnamespacedKey("user." + key)
+		if err != nil {
+			return err
+		}
+		if err = target.setKey("original-user-"+key, current); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (gc *GitConfig) setAuthor(author *Pair) (err error) {
 	if gc.SetUserConfig {
+		if err = gc.backupUserConfig(); err != nil {
+			return err
+		}
 		if err = gc.setUnnamespacedKey("user.name", author.Name); err != nil {
 			return err
 		}
@@ -148,24 +331,24 @@ func (gc *GitConfig) setAuthor(author *Pair) (err error) {
 	if err = gc.setKey("git-author-initials", author.Initials); err != nil {
 		return err
 	}
-	if err = gc.setKey("git-author-initials", author.Initials); err != nil {
-		return err
-	}
 	if err = gc.setKey("git-author-name", author.Name); err != nil {
 		return err
 	}
 	if err = gc.setKey("git-author-email", author.Email); err != nil {
 		return err
 	}
-	return nil
+	return gc.setSigningKey(author.SigningKey)
 }
 
 func (gc *GitConfig) setCommitters(committers []*Pair) (err error) {
-	var listOfInitials, listOfNames, listOfEmails []string
+	var listOfInitials, listOfNames, listOfEmails, listOfSigningKeys []string
+	signed := false
 	for _, p := range committers {
 		listOfInitials = append(listOfInitials, p.Initials)
 		listOfNames = append(listOfNames, p.Name)
 		listOfEmails = append(listOfEmails, p.Email)
+		listOfSigningKeys = append(listOfSigningKeys, p.SigningKey)
+		signed = signed || p.SigningKey != ""
 	}
 
 	if err = gc.setKey("git-committer-initials", strings.Join(listOfInitials, delim)); err != nil {
@@ -180,7 +363,11 @@ func (gc *GitConfig) setCommitters(committers []*Pair) (err error) {
 		return err
 	}
 
-	return nil
+	// kept for the committers to sign once they become the author
+	if !signed {
+		return gc.unsetKey("git-committer-signingkey")
+	}
+	return gc.setKey("git-committer-signingkey", strings.Join(listOfSigningKeys, delim))
 }
 
 // GetAuthor returns the currently configured author (nil if none)
@@ -204,10 +391,16 @@ func (gc *GitConfig) GetAuthor() (pair *Pair, err error) {
 		return nil, nil
 	}
 
+	signingKey, err := gc.getKey("git-author-signingkey")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Pair{
-		Initials: initials,
-		Name:     name,
-		Email:    email,
+		Initials:   initials,
+		Name:       name,
+		Email:      email,
+		SigningKey: signingKey,
 	}, nil
 }
 
@@ -231,15 +424,24 @@ func (gc *GitConfig) GetCommitters() (pairs []*Pair, err error) {
 		return nil, nil
 	}
 
+	signingKeys, err := gc.getKey("git-committer-signingkey")
+	if err != nil {
+		return nil, err
+	}
+
 	listOfInitials := strings.Split(initials, delim)
 	listOfNames := strings.Split(names, delim)
 	listOfEmails := strings.Split(emails, delim)
+	listOfSigningKeys := strings.Split(signingKeys, delim)
 	for i, n := range listOfInitials {
 		p := &Pair{
 			Initials: n,
 			Name:     listOfNames[i],
 			Email:    listOfEmails[i],
 		}
+		if len(listOfSigningKeys) == len(listOfInitials) {
+			p.SigningKey = listOfSigningKeys[i]
+		}
 		pairs = append(pairs, p)
 	}
 
@@ -266,6 +468,50 @@ func (gc *GitConfig) GetMtime() (mtime time.Time, err error) {
 	return time.Unix(mtimeUnix, 0), nil
 }
 
+// GetExpiry returns when the configuration expires (see ExpireAfter)
+// Returns zero Time if it never expires
+func (gc *GitConfig) GetExpiry() (expires time.Time, err error) {
+	expiresString, err := gc.getKey("expires")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if expiresString == "" {
+		return time.Time{}, nil
+	}
+
+	expiresUnix, err := strconv.ParseInt(expiresString, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(expiresUnix, 0), nil
+}
+
+// CheckExpiry returns a *PairExpiredError if the configuration has expired
+func (gc *GitConfig) CheckExpiry() (err error) {
+	expires, err := gc.GetExpiry()
+	if err != nil {
+		return err
+	}
+
+	if !expires.IsZero() && !time.Now().Before(expires) {
+		return &PairExpiredError{Expired: expires}
+	}
+	return nil
+}
+
+// PairExpiredError is returned when the configured author and committers
+// have expired (as opposed to never having been configured)
+type PairExpiredError struct {
+	Expired time.Time
+}
+
+func (e *PairExpiredError) Error() string {
+	return fmt.Sprintf("the pair expired at %s, set it again with `git duet` or `git solo`",
+		e.Expired.Format(time.RFC3339))
+}
+
 func (gc *GitConfig) GetInitTemplateDir() (templateDir string, err error) {
 	templateDir, err = gc.getUnnamespacedKey("init.templatedir")
 	if err != nil {
@@ -282,18 +528,52 @@ func (gc *GitConfig) SetInitTemplateDir(path string) (err error) {
 }
 
 func (gc *GitConfig) getKey(key string) (value string, err error) {
-	output := new(bytes.Buffer)
-	cmd := gc.configCommand(fmt.Sprintf("%s.%s", gc.Namespace, key))
-	cmd.Stdout = output
+	return gc.getFullKey(fmt.Sprintf("%s.%s", gc.Namespace, key))
+}
 
-	err = newIgnorableCommand(cmd, 1).Run()
-	if err != nil {
-		return "", err
+func (gc *GitConfig) getUnnamespacedKey(key string) (value string, err error) {
+	return gc.getFullKey(key)
+}
+
+func (gc *GitConfig) unsetKey(key string) (err error) {
+	return gc.unsetFullKey(fmt.Sprintf("%s.%s", gc.Namespace, key))
+}
+
+func (gc *GitConfig) setUnnamespacedKey(key, value string) (err error) {
+	return gc.setFullKey(key, value)
+}
+
+func (gc *GitConfig) setKey(key, value string) (err error) {
+	return gc.setFullKey(fmt.Sprintf("%s.%s", gc.Namespace, key), value)
+}
+
+func (gc *GitConfig) updateMtime() (err error) {
+	now := time.Now()
+	if err = gc.setKey("mtime", strconv.FormatInt(now.Unix(), 10)); err != nil {
+		return err
 	}
-	return strings.TrimSpace(output.String()), nil
+
+	if gc.ExpireAfter <= 0 {
+		return gc.unsetKey("expires")
+	}
+	return gc.setKey("expires", strconv.FormatInt(now.Add(gc.ExpireAfter).Unix(), 10))
 }
 
-func (gc *GitConfig) getUnnamespacedKey(key string) (value string, err error) {
+// getFullKey returns the value of key, as planned if DryRun changed it
+func (gc *GitConfig) getFullKey(key string) (value string, err error) {
+	if planned, ok := gc.DryRun.plannedConfig(gc.configTarget(key)); ok {
+		if planned != nil {
+			return *planned, nil
+		}
+		if gc.Scope != Default {
+			return "", nil
+		}
+		// unset in the repository config, the global one shows through
+		global := *gc
+		global.Scope = Global
+		return global.getFullKey(key)
+	}
+
 	output := new(bytes.Buffer)
 	cmd := gc.configCommand(key)
 	cmd.Stdout = output
@@ -305,39 +585,70 @@ func (gc *GitConfig) getUnnamespacedKey(key string) (value string, err error) {
 	return strings.TrimSpace(output.String()), nil
 }
 
-func (gc *GitConfig) unsetKey(key string) (err error) {
-	if err = newIgnorableCommand(
-		gc.configCommand("--unset-all", fmt.Sprintf("%s.%s", gc.Namespace, key)),
-		5).Run(); err != nil {
-		return err
+func (gc *GitConfig) setFullKey(key, value string) (err error) {
+	if gc.DryRun != nil {
+		old, err := gc.writtenConfig().getFullKey(key)
+		if err != nil {
+			return err
+		}
+		gc.DryRun.recordConfig(gc.configTarget(key), old, &value)
+		return nil
 	}
 
-	return nil
+	return gc.configCommand(key, value).Run()
 }
 
-func (gc *GitConfig) setUnnamespacedKey(key, value string) (err error) {
-	if err = gc.configCommand(key, value).Run(); err != nil {
-		return err
+func (gc *GitConfig) unsetFullKey(key string) (err error) {
+	if gc.DryRun != nil {
+		written := gc.writtenConfig()
+		if exists, err := written.hasFullKey(key); err != nil || !exists {
+			return err
+		}
+		old, err := written.getFullKey(key)
+		if err != nil {
+			return err
+		}
+		gc.DryRun.recordConfig(gc.configTarget(key), old, nil)
+		return nil
 	}
 
-	return nil
+	return newIgnorableCommand(gc.configCommand("--unset-all", key), 5).Run()
 }
 
-func (gc *GitConfig) setKey(key, value string) (err error) {
-	if err = gc.configCommand(fmt.Sprintf("%s.%s", gc.Namespace, key), value).Run(); err != nil {
-		return err
+// hasFullKey returns whether key is set (even if empty), as planned if DryRun
+// changed it
+func (gc *GitConfig) hasFullKey(key string) (exists bool, err error) {
+	if planned, ok := gc.DryRun.plannedConfig(gc.configTarget(key)); ok {
+		return planned != nil, nil
 	}
 
-	return nil
+	cmd := gc.configCommand("--get-all", key)
+	cmd.Stdout = nil
+	if err = cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
 }
 
-func (gc *GitConfig) updateMtime() (err error) {
-	if err = gc.configCommand(
-		fmt.Sprintf("%s.%s", gc.Namespace, "mtime"),
-		strconv.FormatInt(time.Now().Unix(), 10)).Run(); err != nil {
-		return err
+// writtenConfig returns gc reading from the config it writes to
+func (gc *GitConfig) writtenConfig() *GitConfig {
+	if gc.Scope != Default {
+		return gc
 	}
-	return nil
+	written := *gc
+	written.Scope = Local
+	return &written
+}
+
+// configTarget names key in the config gc writes to (see PlannedChange)
+func (gc *GitConfig) configTarget(key string) string {
+	if gc.Scope == Global {
+		return "global:" + key
+	}
+	return "local:" + key
 }
 
 func (gc *GitConfig) configCommand(args ...string) *exec.Cmd {
@@ -350,6 +661,7 @@ func (gc *GitConfig) configCommand(args ...string) *exec.Cmd {
 	}
 	config = append(config, args...)
 	cmd := exec.Command("git", config...)
+	cmd.Dir = gc.Dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd
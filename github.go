@@ -0,0 +1,152 @@
+package duet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultGitHubAPIURL is the API used for `github_noreply` emails unless
+// configured otherwise (e.g. https://ghe.example.com/api/v3 for GitHub
+// Enterprise Server)
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// githubConfig is the `github_noreply` section of the authors file, which
+// makes authors with a username use their GitHub noreply address
+// (ID+username@users.noreply.github.com)
+type githubConfig struct {
+	enabled bool
+	APIURL  string `yaml:"api_url,omitempty"`
+	Domain  string `yaml:"domain,omitempty"`
+}
+
+// UnmarshalYAML also accepts `github_noreply: true` to use github.com
+func (c *githubConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.enabled); err == nil {
+		return nil
+	}
+
+	type plain githubConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	c.enabled = true
+	return nil
+}
+
+func (c githubConfig) MarshalYAML() (interface{}, error) {
+	if !c.enabled {
+		return nil, nil
+	}
+	if c.APIURL == "" && c.Domain == "" {
+		return true, nil
+	}
+	type plain githubConfig
+	return plain(c), nil
+}
+
+// WithGitHubNoreply overrides the API URL and noreply domain of
+// `github_noreply` in the authors file, empty values keep the file's
+func WithGitHubNoreply(apiURL, domain string) Option {
+	return func(a *Pairs) {
+		if apiURL != "" {
+			a.file.GitHubNoreply.APIURL = apiURL
+		}
+		if domain != "" {
+			a.file.GitHubNoreply.Domain = domain
+		}
+	}
+}
+
+// githubAPIURL returns the configured GitHub API without a trailing slash
+func (a *Pairs) githubAPIURL() string {
+	if a.file.GitHubNoreply.APIURL == "" {
+		return DefaultGitHubAPIURL
+	}
+	return strings.TrimRight(a.file.GitHubNoreply.APIURL, "/")
+}
+
+// githubNoreplyDomain returns the configured noreply domain, by default derived
+// from the API host (users.noreply.<host>, github.com for api.github.com)
+func (a *Pairs) githubNoreplyDomain() (domain string, err error) {
+	if a.file.GitHubNoreply.Domain != "" {
+		return a.file.GitHubNoreply.Domain, nil
+	}
+
+	api, err := url.Parse(a.githubAPIURL())
+	if err != nil {
+		return "", fmt.Errorf("invalid github_noreply api_url: %v", err)
+	}
+	host := api.Hostname()
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+	return "users.noreply." + host, nil
+}
+
+// githubToken returns the token to authenticate with: $GITHUB_TOKEN for
+// github.com, $GHE_TOKEN (then $GITHUB_TOKEN) for GitHub Enterprise Server
+func (a *Pairs) githubToken() string {
+	if a.githubAPIURL() != DefaultGitHubAPIURL {
+		if token := os.Getenv("GHE_TOKEN"); token != "" {
+			return token
+		}
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// githubNoreplyEmail returns the noreply address of the GitHub user username,
+// looking up their ID through the API (cached with the email lookups)
+func (a *Pairs) githubNoreplyEmail(initials, username string) (email string, err error) {
+	domain, err := a.githubNoreplyDomain()
+	if err != nil {
+		return "", err
+	}
+
+	key := lookupCacheKey("github_noreply\x00"+a.githubAPIURL()+"\x00"+domain, initials, "", username)
+	if a.lookupCache != nil {
+		if entry, ok := a.lookupCache.get(key); ok && entry.Error == "" {
+			return entry.Email, nil
+		}
+	}
+
+	endpoint := fmt.Sprintf("%s/users/%s", a.githubAPIURL(), url.PathEscape(username))
+	a.debugf("looking up the GitHub ID of %s for %s at %s\n", username, initials, endpoint)
+
+	headers := map[string]string{"Accept": "application/vnd.github+json"}
+	if token := a.githubToken(); token != "" {
+		headers["Authorization"] = "token " + token
+	}
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err = a.getJSON(endpoint, headers, &user); err != nil {
+		var status *statusError
+		var network *NetworkError
+		if errors.As(err, &status) && status.Code == http.StatusNotFound {
+			err = &UserNotFoundError{Host: "GitHub", Username: username}
+		} else if cached, ok := a.staleLookup(key); ok && errors.As(err, &network) {
+			a.debugf("%v, using the GitHub noreply address cached for %s\n", err, initials)
+			return cached, nil
+		}
+		return "", fmt.Errorf("github lookup for %s failed: %w", initials, err)
+	}
+	if user.ID == 0 {
+		return "", fmt.Errorf("github lookup for %s failed: %s did not return a user", initials, endpoint)
+	}
+	if user.Login == "" {
+		user.Login = username
+	}
+
+	email = fmt.Sprintf("%d+%s@%s", user.ID, user.Login, domain)
+	if a.lookupCache != nil && a.lookupCache.ttl > 0 {
+		a.cacheLookup(key, lookupCacheEntry{Email: email})
+	}
+
+	return email, nil
+}
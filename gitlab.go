@@ -0,0 +1,154 @@
+package duet
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultGitLabURL is the GitLab instance used for `gitlab` emails unless
+// configured otherwise
+const DefaultGitLabURL = "https://gitlab.com"
+
+// gitlabConfig is the `gitlab` section of the authors file, which makes
+// authors with a username use their public GitLab email, or their noreply
+// address (ID-username@users.noreply.gitlab.com) if they have none or Noreply
+// is set
+type gitlabConfig struct {
+	enabled bool
+	URL     string `yaml:"url,omitempty"`
+	Domain  string `yaml:"domain,omitempty"`
+	Noreply bool   `yaml:"noreply,omitempty"`
+}
+
+// UnmarshalYAML also accepts `gitlab: true` to use gitlab.com
+func (c *gitlabConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.enabled); err == nil {
+		return nil
+	}
+
+	type plain gitlabConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	c.enabled = true
+	return nil
+}
+
+func (c gitlabConfig) MarshalYAML() (interface{}, error) {
+	if !c.enabled {
+		return nil, nil
+	}
+	if c == (gitlabConfig{enabled: true}) {
+		return true, nil
+	}
+	type plain gitlabConfig
+	return plain(c), nil
+}
+
+// WithGitLab overrides the URL and noreply domain of `gitlab` in the authors
+// file, empty values keep the file's
+func WithGitLab(baseURL, domain string) Option {
+	return func(a *Pairs) {
+		if baseURL != "" {
+			a.file.GitLab.URL = baseURL
+		}
+		if domain != "" {
+			a.file.GitLab.Domain = domain
+		}
+	}
+}
+
+// gitlabURL returns the configured GitLab instance without a trailing slash
+func (a *Pairs) gitlabURL() string {
+	if a.file.GitLab.URL == "" {
+		return DefaultGitLabURL
+	}
+	return strings.TrimRight(a.file.GitLab.URL, "/")
+}
+
+// gitlabNoreplyDomain returns the configured noreply domain, by default
+// users.noreply.<host>
+func (a *Pairs) gitlabNoreplyDomain() (domain string, err error) {
+	if a.file.GitLab.Domain != "" {
+		return a.file.GitLab.Domain, nil
+	}
+
+	base, err := url.Parse(a.gitlabURL())
+	if err != nil {
+		return "", fmt.Errorf("invalid gitlab url: %v", err)
+	}
+	return "users.noreply." + base.Hostname(), nil
+}
+
+// gitlabEmail returns the public email of the GitLab user username, or their
+// noreply address if they have none or `noreply` is set
+func (a *Pairs) gitlabEmail(initials, username string) (email string, err error) {
+	return a.gitlabAddress(initials, username, a.file.GitLab.Noreply)
+}
+
+// gitlabNoreplyEmail returns the noreply address of the GitLab user username
+func (a *Pairs) gitlabNoreplyEmail(initials, username string) (email string, err error) {
+	return a.gitlabAddress(initials, username, true)
+}
+
+// gitlabAddress looks up the GitLab user username through the API (cached with
+// the email lookups) and returns their public email, or their noreply address
+// if they have none or noreply is set. The user search matches loosely so only
+// an exact username counts.
+func (a *Pairs) gitlabAddress(initials, username string, noreply bool) (email string, err error) {
+	domain, err := a.gitlabNoreplyDomain()
+	if err != nil {
+		return "", err
+	}
+
+	key := lookupCacheKey(fmt.Sprintf("gitlab\x00%s\x00%s\x00%t", a.gitlabURL(), domain, noreply),
+		initials, "", username)
+	if a.lookupCache != nil {
+		if entry, ok := a.lookupCache.get(key); ok && entry.Error == "" {
+			return entry.Email, nil
+		}
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v4/users?username=%s", a.gitlabURL(), url.QueryEscape(username))
+	a.debugf("looking up the GitLab user %s for %s at %s\n", username, initials, endpoint)
+
+	headers := map[string]string{}
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		headers["PRIVATE-TOKEN"] = token
+	}
+
+	var users []struct {
+		ID          int64  `json:"id"`
+		Username    string `json:"username"`
+		PublicEmail string `json:"public_email"`
+	}
+	if err = a.getJSON(endpoint, headers, &users); err != nil {
+		var network *NetworkError
+		if cached, ok := a.staleLookup(key); ok && errors.As(err, &network) {
+			a.debugf("%v, using the GitLab address cached for %s\n", err, initials)
+			return cached, nil
+		}
+		return "", fmt.Errorf("gitlab lookup for %s failed: %w", initials, err)
+	}
+
+	for _, user := range users {
+		if user.Username != username {
+			continue
+		}
+		if user.PublicEmail != "" && !noreply {
+			email = user.PublicEmail
+		} else {
+			email = fmt.Sprintf("%d-%s@%s", user.ID, user.Username, domain)
+		}
+
+		if a.lookupCache != nil && a.lookupCache.ttl > 0 {
+			a.cacheLookup(key, lookupCacheEntry{Email: email})
+		}
+		return email, nil
+	}
+
+	return "", fmt.Errorf("gitlab lookup for %s failed: %w", initials, &UserNotFoundError{Host: "GitLab", Username: username})
+}
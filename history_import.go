@@ -0,0 +1,237 @@
+package duet
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HistoryImportReport lists what ImportHistory had to guess, and the people
+// it skipped because no initials could be made up for them
+type HistoryImportReport struct {
+	Duplicates []HistoryDuplicate
+	Skipped    []error
+}
+
+// HistoryDuplicate is someone who still committed under several addresses
+// after applying the mailmap. They get a single author using Email (the one
+// with the most commits), Others are the remaining addresses.
+type HistoryDuplicate struct {
+	Initials string
+	Name     string
+	Email    string
+	Others   []string
+}
+
+func (d HistoryDuplicate) String() string {
+	return fmt.Sprintf("%s (%s) committed as %s and %s, using %s: map them in .mailmap if they are the same person",
+		d.Initials, d.Name, d.Email, strings.Join(d.Others, ", "), d.Email)
+}
+
+// historyIdentity is an author of the history after applying the mailmap
+type historyIdentity struct {
+	name    string
+	email   string
+	commits int
+}
+
+var mailmapEmailRegexp = regexp.MustCompile(`<([^>]*)>`)
+
+// ImportHistory builds authors from the commit authors of the current
+// repository, applying the mailmap (.mailmap and mailmap.file) so that people
+// who committed under several addresses are imported once. The addresses the
+// mailmap maps onto an author are recorded as `aliases` in their meta. People
+// with the same name but addresses the mailmap does not tie together are
+// imported once and listed in the report. Initials are made up from the names
+// (see SuggestInitials).
+// The result can be written out as an authors file with yaml.Marshal.
+func ImportHistory() (a *Pairs, report *HistoryImportReport, err error) {
+	output := new(bytes.Buffer)
+	cmd := exec.Command("git", "log", "--use-mailmap", "--format=%aN%x1f%aE")
+	cmd.Stdout = output
+	if err = cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("could not read history: %v", err)
+	}
+
+	aliases, err := readMailmapAliases()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// people are grouped by name, their addresses by the number of commits
+	byName := map[string]map[string]*historyIdentity{}
+	for _, line := range strings.Split(output.String(), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\x1f", 2)
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			continue
+		}
+		name, email := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+
+		key := strings.ToLower(name)
+		if byName[key] == nil {
+			byName[key] = map[string]*historyIdentity{}
+		}
+		identity, ok := byName[key][strings.ToLower(email)]
+		if !ok {
+			identity = &historyIdentity{name: name, email: email}
+			byName[key][strings.ToLower(email)] = identity
+		}
+		identity.commits++
+	}
+
+	type person struct {
+		identities []*historyIdentity
+		commits    int
+	}
+	var people []person
+	for _, identities := range byName {
+		var p person
+		for _, identity := range identities {
+			p.identities = append(p.identities, identity)
+			p.commits += identity.commits
+		}
+		sort.Slice(p.identities, func(i, j int) bool {
+			if p.identities[i].commits != p.identities[j].commits {
+				return p.identities[i].commits > p.identities[j].commits
+			}
+			return p.identities[i].email < p.identities[j].email
+		})
+		people = append(people, p)
+	}
+	// the most active people get the shortest initials
+	sort.Slice(people, func(i, j int) bool {
+		if people[i].commits != people[j].commits {
+			return people[i].commits > people[j].commits
+		}
+		return people[i].identities[0].name < people[j].identities[0].name
+	})
+
+	af := &pairsFile{
+		Version:        AuthorsFileVersion,
+		Authors:        authorGroups{},
+		Pairs:          map[string]string{},
+		EmailAddresses: map[string]emailAddresses{},
+	}
+	a = &Pairs{file: af}
+	report = &HistoryImportReport{}
+
+	for _, p := range people {
+		primary := p.identities[0]
+		initials, err := a.SuggestInitials(primary.name)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Errorf("skipped %s <%s>, add them by hand: %v",
+				primary.name, primary.email, err))
+			continue
+		}
+
+		spec := &authorSpec{Name: strings.Replace(primary.name, ";", ",", -1)}
+		if alternates := aliases[strings.ToLower(primary.email)]; len(alternates) > 0 {
+			spec.Meta = map[string]string{"aliases": strings.Join(alternates, ", ")}
+		}
+		af.Authors[initials] = authorEntry{author: authorValue{spec: spec}}
+		af.Pairs[initials] = spec.Name
+		af.EmailAddresses[initials] = emailAddresses{address: primary.email}
+
+		if len(p.identities) > 1 {
+			duplicate := HistoryDuplicate{Initials: initials, Name: primary.name, Email: primary.email}
+			for _, other := range p.identities[1:] {
+				duplicate.Others = append(duplicate.Others, other.email)
+			}
+			report.Duplicates = append(report.Duplicates, duplicate)
+		}
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		return CompareInitials(report.Duplicates[i].Initials, report.Duplicates[j].Initials) < 0
+	})
+
+	if af.Pairs, af.Teams, err = af.Authors.flatten(); err != nil {
+		return nil, nil, fmt.Errorf("could not import history: %v", err)
+	}
+	af.Meta, af.Emails, af.Keys, af.NameFormats = af.Authors.structured()
+	if err = af.normalizeKeys(); err != nil {
+		return nil, nil, fmt.Errorf("could not import history: %v", err)
+	}
+
+	return a, report, nil
+}
+
+// readMailmapAliases returns the commit addresses the mailmap files of the
+// current repository map onto each proper address (lower-cased)
+func readMailmapAliases() (aliases map[string][]string, err error) {
+	var files []string
+	if toplevel, err := repoToplevel(); err == nil {
+		files = append(files, filepath.Join(toplevel, ".mailmap"))
+	}
+
+	output := new(bytes.Buffer)
+	cmd := exec.Command("git", "config", "--path", "mailmap.file")
+	cmd.Stdout = output
+	if err = newIgnorableCommand(cmd, 1).Run(); err != nil {
+		return nil, err
+	}
+	if file := strings.TrimSpace(output.String()); file != "" {
+		files = append(files, file)
+	}
+
+	aliases = map[string][]string{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read mailmap: %v", err)
+		}
+		err = parseMailmap(f, aliases)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read mailmap %s: %v", file, err)
+		}
+	}
+
+	for proper, emails := range aliases {
+		sort.Strings(emails)
+		aliases[proper] = emails
+	}
+	return aliases, nil
+}
+
+// parseMailmap adds the lines of r mapping a commit address onto a proper one
+// (`[Name] <proper> [Name] <commit>`) to aliases, lines only fixing up a name
+// do not add an address
+func parseMailmap(r io.Reader, aliases map[string][]string) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		emails := mailmapEmailRegexp.FindAllStringSubmatch(line, -1)
+		if len(emails) < 2 {
+			continue
+		}
+		proper, commit := strings.ToLower(emails[0][1]), emails[1][1]
+		if proper == "" || strings.EqualFold(proper, commit) || containsFold(aliases[proper], commit) {
+			continue
+		}
+		aliases[proper] = append(aliases[proper], commit)
+	}
+	return scanner.Err()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
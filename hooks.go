@@ -0,0 +1,280 @@
+package duet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HookVersion is the version of the hooks written by InstallHook, bump it
+// whenever their contents change so installed hooks are reported as outdated
+const HookVersion = 1
+
+// Hooks are the git hooks git-duet can install
+var Hooks = []string{"pre-commit", "prepare-commit-msg", "commit-msg", "post-commit"}
+
+const hookShebang = "#!/usr/bin/env bash\n"
+
+// hookMarker starts the lines InstallHook manages in a hook file
+const hookMarker = "# git-duet hook version "
+
+// hookChainSuffix is appended to the name of a foreign hook replaced by
+// InstallHook with force, which then runs it first
+const hookChainSuffix = ".pre-git-duet"
+
+// hookNudgeInterval is how often NudgeOutdatedHooks checks the hooks
+const hookNudgeInterval = 24 * time.Hour
+
+// HookStatus is the state of an installed hook (see CheckHooks)
+type HookStatus int
+
+// HookCurrent is a hook written by this version of InstallHook
+// HookOutdated is a hook written by an older version, upgrade it with force
+// HookForeign is a hook without a version marker, it is never modified
+const (
+	HookCurrent HookStatus = iota
+	HookOutdated
+	HookForeign
+)
+
+// String returns the name of the status (current, outdated or foreign)
+func (s HookStatus) String() string {
+	switch s {
+	case HookCurrent:
+		return "current"
+	case HookOutdated:
+		return "outdated"
+	default:
+		return "foreign"
+	}
+}
+
+// HookReport describes an installed hook
+// Version is the version in its marker (0 for hooks written before there were
+// markers, -1 for foreign hooks).
+type HookReport struct {
+	Hook    string
+	Path    string
+	Status  HookStatus
+	Version int
+}
+
+// ExistingHookError is returned by InstallHook without force when a foreign
+// hook is in the way
+type ExistingHookError struct {
+	Hook string
+	Path string
+}
+
+func (e *ExistingHookError) Error() string {
+	return fmt.Sprintf(`It seems you already have a "%s" hook.
+To enable the git-duet hook, please append:
+
+  %s
+
+to your %s file.`, e.Hook, hookCommand(e.Hook), e.Path)
+}
+
+// hookCommand is the line of a hook running the git-duet command for it
+func hookCommand(hook string) string {
+	return fmt.Sprintf(`exec git duet-%s "$@"`, hook)
+}
+
+// hookBlock returns the lines InstallHook manages, running the chained
+// original hook first if there is one
+func hookBlock(hook string, chained bool) string {
+	block := hookMarker + strconv.Itoa(HookVersion) + "\n"
+	if chained {
+		block += fmt.Sprintf(`"$(dirname "$0")/%s%s" "$@" || exit $?`, hook, hookChainSuffix) + "\n"
+	}
+	return block + hookCommand(hook) + "\n"
+}
+
+// legacyHook is the hook written before hooks had a version marker
+func legacyHook(hook string) string {
+	return hookShebang + hookCommand(hook)
+}
+
+// inspectHook returns the status and version of the hook contents
+func inspectHook(hook, contents string) (status HookStatus, version int) {
+	if strings.TrimSpace(contents) == legacyHook(hook) {
+		return HookOutdated, 0
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		if !strings.HasPrefix(line, hookMarker) {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, hookMarker)))
+		if err != nil {
+			break
+		}
+		if version < HookVersion {
+			return HookOutdated, version
+		}
+		return HookCurrent, version
+	}
+
+	return HookForeign, -1
+}
+
+// InstallHook writes the git-duet hook (one of Hooks) to hooksDir and returns
+// its path and whether it was written. An existing git-duet hook is left alone
+// unless force is set, in which case an outdated one is upgraded in place
+// (keeping any other lines). A foreign hook is an *ExistingHookError unless it
+// already runs git-duet or force is set, in which case it is kept next to the
+// hook and run first.
+func InstallHook(hooksDir, hook string, force bool) (path string, written bool, err error) {
+	return PlanInstallHook(nil, hooksDir, hook, force)
+}
+
+// PlanInstallHook is InstallHook recording the changes in plan instead of
+// making them (making them if plan is nil)
+func PlanInstallHook(plan *Plan, hooksDir, hook string, force bool) (path string, written bool, err error) {
+	path = filepath.Join(hooksDir, hook)
+
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, err
+	}
+	contents := string(existing)
+
+	if strings.TrimSpace(contents) == "" {
+		contents = hookShebang + hookBlock(hook, false)
+	} else {
+		switch status, _ := inspectHook(hook, contents); {
+		case status == HookCurrent:
+			return path, false, nil
+		case status == HookOutdated && force:
+			contents = upgradeHook(hook, contents, fileExists(path+hookChainSuffix))
+		case status == HookOutdated, strings.Contains(contents, hookCommand(hook)):
+			return path, false, nil
+		case !force:
+			return "", false, &ExistingHookError{Hook: hook, Path: path}
+		default:
+			if err = plan.rename(path, path+hookChainSuffix); err != nil {
+				return "", false, err
+			}
+			contents = hookShebang + hookBlock(hook, true)
+		}
+	}
+
+	if err = plan.writeFile(path, []byte(contents), 0755); err != nil {
+		return "", false, err
+	}
+	return path, true, nil
+}
+
+// upgradeHook replaces the managed lines of an outdated hook, from the marker
+// up to the git-duet command, keeping everything else
+func upgradeHook(hook, contents string, chained bool) string {
+	if strings.TrimSpace(contents) == legacyHook(hook) {
+		return hookShebang + hookBlock(hook, chained)
+	}
+
+	lines := strings.SplitAfter(contents, "\n")
+	start, end := -1, -1
+	for i, line := range lines {
+		if start < 0 && strings.HasPrefix(line, hookMarker) {
+			start = i
+		}
+		if start >= 0 && strings.TrimSpace(line) == hookCommand(hook) {
+			end = i
+			break
+		}
+	}
+	if start < 0 || end < 0 {
+		return contents
+	}
+
+	return strings.Join(lines[:start], "") + hookBlock(hook, chained) + strings.Join(lines[end+1:], "")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// CheckHooks reports the state of the git-duet hooks installed in the
+// repository at repoPath (hooks that are not installed are left out)
+func CheckHooks(repoPath string) (reports []HookReport, err error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not find the hooks of %s: %v", repoPath, err)
+	}
+	hooksDir := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(repoPath, hooksDir)
+	}
+
+	for _, hook := range Hooks {
+		path := filepath.Join(hooksDir, hook)
+		contents, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		status, version := inspectHook(hook, string(contents))
+		reports = append(reports, HookReport{Hook: hook, Path: path, Status: status, Version: version})
+	}
+
+	return reports, nil
+}
+
+// HookCheckStateFile returns the file recording when NudgeOutdatedHooks last
+// checked the hooks of the repository whose git directory is gitDir
+func HookCheckStateFile(gitDir string) (file string, err error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(gitDir))
+	return filepath.Join(dir, "git-duet", "hook-checks", hex.EncodeToString(sum[:8])), nil
+}
+
+// NudgeOutdatedHooks writes a line to w for every outdated hook of the current
+// repository, at most once per day and repository. Failing to check is not
+// worth bothering anyone about, so it is silent, and checked again next time.
+func NudgeOutdatedHooks(w io.Writer) {
+	output, err := exec.Command("git", "rev-parse", "--absolute-git-dir").Output()
+	if err != nil {
+		return
+	}
+	file, err := HookCheckStateFile(strings.TrimSpace(string(output)))
+	if err != nil {
+		return
+	}
+	if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) < hookNudgeInterval {
+		return
+	}
+
+	reports, err := CheckHooks(".")
+	if err != nil {
+		return
+	}
+	for _, report := range reports {
+		if report.Status == HookOutdated {
+			fmt.Fprintf(w, "git-duet: the %s hook is outdated, upgrade it with `git duet-install-hook --force %s`\n",
+				report.Hook, report.Hook)
+		}
+	}
+
+	// recorded once the nudge is out, so that it is not lost if checking fails
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return
+	}
+	ioutil.WriteFile(file, []byte(time.Now().Format(time.RFC3339)+"\n"), 0600)
+}
@@ -0,0 +1,121 @@
+package duet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvColumns are the columns understood by ImportCSV, initials and name are required
+var csvColumns = []string{"initials", "name", "username", "email"}
+
+// ImportCSV builds authors from a CSV roster with a header row naming the
+// columns (initials, name, username and email, in any order; username and
+// email are optional). Errors name the offending row, counting the header as
+// row 1. The result can be written out as an authors file with yaml.Marshal.
+func ImportCSV(r io.Reader) (a *Pairs, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("could not import CSV: missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not import CSV: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !isCSVColumn(column) {
+			return nil, fmt.Errorf("could not import CSV: unknown column %q (expected %s)",
+				column, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("could not import CSV: duplicate column %q", column)
+		}
+		columns[column] = i
+	}
+	for _, required := range csvColumns[:2] {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("could not import CSV: missing column %q", required)
+		}
+	}
+
+	af := &pairsFile{
+		Version:        AuthorsFileVersion,
+		Authors:        authorGroups{},
+		EmailAddresses: map[string]emailAddresses{},
+	}
+	rowOf := map[string]int{}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not import CSV: row %d: %v", row, err)
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("could not import CSV: row %d: expected %d fields but got %d",
+				row, len(header), len(record))
+		}
+
+		field := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		initials, name, username, email := field("initials"), field("name"), field("username"), field("email")
+
+		switch {
+		case initials == "":
+			return nil, fmt.Errorf("could not import CSV: row %d: missing initials", row)
+		case name == "":
+			return nil, fmt.Errorf("could not import CSV: row %d: missing name for %s", row, initials)
+		case strings.Contains(name, ";"):
+			return nil, fmt.Errorf("could not import CSV: row %d: name %q must not contain ;", row, name)
+		}
+		if first, ok := rowOf[initials]; ok {
+			return nil, fmt.Errorf("could not import CSV: rows %d and %d both use initials %s", first, row, initials)
+		}
+		rowOf[initials] = row
+
+		author := name
+		if username != "" {
+			author = fmt.Sprintf("%s; %s", name, username)
+		}
+		af.Authors[initials] = authorEntry{author: authorValue{author: author}}
+		if email != "" {
+			af.EmailAddresses[initials] = emailAddresses{address: email}
+		}
+	}
+
+	if af.Pairs, af.Teams, err = af.Authors.flatten(); err != nil {
+		return nil, fmt.Errorf("could not import CSV: %v", err)
+	}
+	if err = af.normalizeKeys(); err != nil {
+		return nil, fmt.Errorf("could not import CSV: %v", err)
+	}
+
+	return &Pairs{file: af}, nil
+}
+
+// MarshalYAML writes the authors back out in the authors file format
+func (a *Pairs) MarshalYAML() (interface{}, error) {
+	return a.file, nil
+}
+
+func isCSVColumn(column string) bool {
+	for _, c := range csvColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package duet
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DuplicateAuthorError is returned when the same initials are in two of the
+// files making up an authors file through `include` (Files)
+type DuplicateAuthorError struct {
+	Initials string
+	Files    []string
+}
+
+func (e *DuplicateAuthorError) Error() string {
+	return fmt.Sprintf("%s is in both %s and %s, an author can only be in one of the files included together",
+		e.Initials, e.Files[0], e.Files[1])
+}
+
+// includedFile is one of the files making up an authors file through
+// `include`, described as in errors (see describeAuthorsFile), included
+// unless it is the authors file itself
+type includedFile struct {
+	af        *pairsFile
+	described string
+	included  bool
+}
+
+// readAuthorsFileWithIncludes reads the authors file name in fsys like
+// readAuthorsFile, along with the files its `include` patterns (paths or
+// globs, relative to its directory) match, recursively. Returns every file,
+// the ones included before the file including them, and fails if two of them
+// have an author with the same initials (see DuplicateAuthorError). A file
+// included twice is only read once.
+func readAuthorsFileWithIncludes(fsys fs.FS, name string) (files []includedFile, resolved, described string, err error) {
+	seen := map[string]bool{}
+	var read func(name string, chain []string) error
+	read = func(name string, chain []string) error {
+		af, fileResolved, fileDescribed, err := readAuthorsFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		for _, including := range chain {
+			if including == fileResolved {
+				return fmt.Errorf("could not parse %s: it includes itself (%s -> %s)",
+					fileDescribed, strings.Join(chain, " -> "), fileResolved)
+			}
+		}
+		if seen[fileResolved] {
+			return nil
+		}
+		seen[fileResolved] = true
+		if len(chain) == 0 {
+			resolved, described = fileResolved, fileDescribed
+		}
+
+		for _, pattern := range af.Include {
+			matches, err := globIncluded(fsys, fileResolved, pattern)
+			if err != nil {
+				return fmt.Errorf("could not parse %s: include %q: %v", fileDescribed, pattern, err)
+			}
+			for _, match := range matches {
+				if err = read(match, append(chain, fileResolved)); err != nil {
+					return err
+				}
+			}
+		}
+		files = append(files, includedFile{af: af, described: fileDescribed, included: len(chain) > 0})
+		return nil
+	}
+	if err = read(name, nil); err != nil {
+		return nil, "", "", err
+	}
+
+	if len(files) == 1 {
+		return files, resolved, described, nil
+	}
+	origins := map[string]string{}
+	for _, file := range files {
+		for initials := range file.af.Pairs {
+			if origin, ok := origins[initials]; ok {
+				return nil, "", "", &DuplicateAuthorError{Initials: initials, Files: []string{origin, file.described}}
+			}
+			origins[initials] = file.described
+		}
+	}
+	return files, resolved, described, nil
+}
+
+// globIncluded returns the files in fsys matching pattern, an `include` of
+// the authors file including, sorted. A pattern without wildcards must match
+// a file, a glob may match none.
+func globIncluded(fsys fs.FS, including, pattern string) (matches []string, err error) {
+	if _, ok := fsys.(osFS); ok {
+		pattern = ExpandPath(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(including), pattern)
+		}
+	} else {
+		pattern = path.Join(path.Dir(including), pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err = fs.Stat(fsys, pattern); err != nil {
+			return nil, err
+		}
+		return []string{pattern}, nil
+	}
+	return fs.Glob(fsys, pattern)
+}
@@ -0,0 +1,501 @@
+package duet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultInitialsHintLimit is the largest roster listed in full when initials
+// are unknown (see WithInitialsHintLimit)
+const DefaultInitialsHintLimit = 25
+
+// maxInitialsSuggestions caps the closest matches suggested on larger rosters
+const maxInitialsSuggestions = 5
+
+// unsplitInitialsHint is added to errors about initials that look like
+// several people's initials written together
+const unsplitInitialsHint = "separate initials with spaces, commas or plus signs"
+
+// UnknownInitialsError is returned when initials are not in the authors file
+// Known holds every author's initials if the roster is small enough to be
+// listed, otherwise the closest matches (Suggestion is set); it is empty if
+// hints are disabled. Names maps the initials in Known to the author's name.
+// Unsplit is set if the initials look like several people's initials written
+// together (see SplitInitials).
+type UnknownInitialsError struct {
+	Initials   string
+	Known      []string
+	Names      map[string]string
+	Suggestion bool
+	Unsplit    bool
+}
+
+func (e *UnknownInitialsError) Error() string {
+	message := fmt.Sprintf("unknown initials %s", e.Initials)
+	if len(e.Known) > 0 {
+		known := make([]string, 0, len(e.Known))
+		for _, initials := range e.Known {
+			known = append(known, fmt.Sprintf("%s (%s)", initials, e.Names[initials]))
+		}
+
+		hint := "known initials are"
+		if e.Suggestion {
+			hint = "did you mean"
+		}
+		message = fmt.Sprintf("%s, %s: %s", message, hint, strings.Join(known, ", "))
+	}
+
+	if e.Unsplit {
+		message = fmt.Sprintf("%s (%s)", message, unsplitInitialsHint)
+	}
+	return message
+}
+
+// EmptyInitialsError is returned by SplitInitials for an argument with
+// nothing between two separators (e.g. `jd,,fb`) or at either end
+type EmptyInitialsError struct {
+	Arg string
+}
+
+func (e *EmptyInitialsError) Error() string {
+	return fmt.Sprintf("empty initials in %q, %s", e.Arg, unsplitInitialsHint)
+}
+
+// SplitInitials splits each argument on commas, plus signs and whitespace so
+// that `jd,fb`, `jd+fb` and `"jd fb"` give the same initials as `jd fb`,
+// keeping the order. Forms can be mixed (`jd fb,gh`). Returns an
+// *EmptyInitialsError if an argument has empty initials (e.g. `jd,,fb`).
+func SplitInitials(args []string) (initials []string, err error) {
+	for _, arg := range args {
+		for _, piece := range strings.Split(strings.Replace(arg, "+", ",", -1), ",") {
+			fields := strings.Fields(piece)
+			if len(fields) == 0 {
+				return nil, &EmptyInitialsError{Arg: arg}
+			}
+			initials = append(initials, fields...)
+		}
+	}
+	return initials, nil
+}
+
+// looksUnsplit reports whether initials contain whitespace or a character
+// commonly used to list initials, i.e. they are probably several people's
+func looksUnsplit(initials string) bool {
+	return strings.ContainsAny(initials, ",+;/&| \t")
+}
+
+// AmbiguousInitialsError is returned when prefix matching is enabled (see
+// WithPrefixMatching) and initials are the prefix of several authors' initials
+type AmbiguousInitialsError struct {
+	Initials   string
+	Candidates []string
+}
+
+func (e *AmbiguousInitialsError) Error() string {
+	return fmt.Sprintf("ambiguous initials %s, could be any of: %s", e.Initials, strings.Join(e.Candidates, ", "))
+}
+
+// Initials returns the initials of every author in the authors file, sorted
+// Unlike All, no emails are resolved.
+func (a *Pairs) Initials() (initials []string) {
+	initials = make([]string, 0, len(a.file.Pairs))
+	for i := range a.file.Pairs {
+		initials = append(initials, i)
+	}
+	sortInitials(initials)
+
+	return initials
+}
+
+// Len returns the number of authors in the authors file
+func (a *Pairs) Len() int {
+	return len(a.file.Pairs)
+}
+
+// HasInitials returns whether initials would be resolved to an author by
+// ByInitials (honoring WithPrefixMatching) without resolving their email
+func (a *Pairs) HasInitials(initials string) bool {
+	_, err := a.resolveInitials(initials)
+	return err == nil
+}
+
+// SuggestInitials returns initials for a new author called name that no author
+// or team uses yet (ignoring case). The candidates are the first letters of the
+// words of name (or its first two letters if it is a single word), then the
+// first two letters of the first name and the first of the last name (or the
+// first three letters), then the first candidate followed by 2, 3 and so on.
+// Hyphenated words count as several words for the first candidate. The name is
+// transliterated to lower-case ASCII first, an error is returned if no letter
+// is left.
+func (a *Pairs) SuggestInitials(name string) (initials string, err error) {
+	isSeparator := func(r rune) bool { return unicode.IsSpace(r) || r == '-' }
+	keepLetters := func(word string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' {
+				return r
+			}
+			return -1
+		}, word)
+	}
+
+	var parts, words []string
+	for _, part := range strings.FieldsFunc(transliterate(name), isSeparator) {
+		if part = keepLetters(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	for _, word := range strings.Fields(transliterate(name)) {
+		if word = keepLetters(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("cannot suggest initials for %q: it has no letters that can be spelled in ASCII", name)
+	}
+
+	var first string
+	for _, part := range parts {
+		first += part[:1]
+	}
+	if len(parts) == 1 {
+		first = prefix(parts[0], 2)
+	}
+
+	second := prefix(words[0], 3)
+	if len(words) > 1 {
+		second = prefix(words[0], 2) + words[len(words)-1][:1]
+	}
+
+	taken := map[string]bool{}
+	for known := range a.file.Pairs {
+		taken[strings.ToLower(known)] = true
+	}
+	for known := range a.file.Authors {
+		taken[strings.ToLower(known)] = true
+	}
+
+	for _, candidate := range []string{first, second} {
+		if !taken[candidate] {
+			return candidate, nil
+		}
+	}
+	for n := 2; ; n++ {
+		if candidate := first + strconv.Itoa(n); !taken[candidate] {
+			return candidate, nil
+		}
+	}
+}
+
+// prefix returns the first n bytes of s, or s if it is shorter
+func prefix(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+	return s[:n]
+}
+
+// resolveInitials returns the initials as normalized in the authors file
+// Exact matches win, otherwise (if enabled) a unique prefix of the initials.
+func (a *Pairs) resolveInitials(initials string) (canonical string, err error) {
+	normalized := a.file.normalizeInitials(initials)
+	if _, ok := a.file.Pairs[normalized]; ok {
+		return normalized, nil
+	}
+	if !a.prefixMatching || normalized == "" {
+		return "", a.unknownInitials(initials)
+	}
+
+	var candidates []string
+	for known := range a.file.Pairs {
+		if strings.HasPrefix(known, normalized) {
+			candidates = append(candidates, known)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", a.unknownInitials(initials)
+	case 1:
+		return candidates[0], nil
+	default:
+		sortInitials(candidates)
+		return "", &AmbiguousInitialsError{Initials: initials, Candidates: candidates}
+	}
+}
+
+// unknownInitials builds the error for initials that are not in the authors
+// file, suggesting the authors they look like the name of (e.g. `jane` for
+// Jane Doe), otherwise listing the roster or the closest matches depending on
+// its size
+func (a *Pairs) unknownInitials(initials string) error {
+	e := &UnknownInitialsError{Initials: initials, Names: map[string]string{}, Unsplit: looksUnsplit(initials)}
+	if a.hintLimit == 0 {
+		return e
+	}
+
+	if e.Known = a.file.initialsByName(initials); len(e.Known) > 0 {
+		e.Suggestion = true
+	} else if len(a.file.Pairs) <= a.hintLimit {
+		e.Known = a.Initials()
+	} else {
+		e.Known = closestInitials(initials, a.file.Pairs)
+		e.Suggestion = true
+	}
+	sortInitials(e.Known)
+
+	for _, known := range e.Known {
+		e.Names[known], _, _ = a.file.author(known)
+	}
+
+	return e
+}
+
+// closestInitials returns the initials with the smallest edit distance to
+// initials, unless even those are too different to be a typo
+func closestInitials(initials string, pairs map[string]string) (closest []string) {
+	best := len(initials)/2 + 1
+	for known := range pairs {
+		d := editDistance(strings.ToLower(initials), strings.ToLower(known))
+		switch {
+		case d < best:
+			best = d
+			closest = []string{known}
+		case d == best:
+			closest = append(closest, known)
+		}
+	}
+
+	sortInitials(closest)
+	if len(closest) > maxInitialsSuggestions {
+		closest = closest[:maxInitialsSuggestions]
+	}
+	return closest
+}
+
+// initialsByName returns the initials of the authors whose username is query
+// or one of whose names starts with it (ignoring case and accents), for
+// someone typing a name instead of initials. Queries shorter than two letters
+// match nothing.
+func (af *pairsFile) initialsByName(query string) (matches []string) {
+	query = transliterate(strings.TrimSpace(query))
+	if len(query) < 2 {
+		return nil
+	}
+
+	isSeparator := func(r rune) bool { return unicode.IsSpace(r) || r == '-' }
+	for initials := range af.Pairs {
+		name, username, _ := af.author(initials)
+		matched := strings.EqualFold(username, query)
+		for _, word := range strings.FieldsFunc(transliterate(name), isSeparator) {
+			matched = matched || strings.HasPrefix(word, query)
+		}
+		if matched {
+			matches = append(matches, initials)
+		}
+	}
+
+	sortInitials(matches)
+	if len(matches) > maxInitialsSuggestions {
+		matches = matches[:maxInitialsSuggestions]
+	}
+	return matches
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// normalizeInitials returns initials in the canonical form of the authors
+// file: without surrounding whitespace and, unless the file sets
+// `case_sensitive_initials`, case-folded to lower case
+func (af *pairsFile) normalizeInitials(initials string) string {
+	initials = strings.TrimSpace(initials)
+	if af.CaseSensitiveInitials {
+		return initials
+	}
+	// going through upper case first folds runes like "ſ" (long s) that
+	// have no lower case of their own into their plain letter
+	return strings.Map(func(r rune) rune {
+		return unicode.ToLower(unicode.ToUpper(r))
+	}, initials)
+}
+
+// normalizeKeys rewrites the maps keyed by initials, the `exclude` list and
+// the squads (names and members) to use normalized initials (see
+// normalizeInitials). Returns an error naming both originals if two distinct
+// initials are the same once normalized.
+func (af *pairsFile) normalizeKeys() error {
+	authors := make([]string, 0, len(af.Pairs))
+	for initials := range af.Pairs {
+		authors = append(authors, initials)
+	}
+	canonical, err := af.canonicalInitials(authors)
+	if err != nil {
+		return err
+	}
+
+	pairs, teams := make(map[string]string, len(af.Pairs)), make(map[string]string, len(af.Teams))
+	meta, emails := make(map[string]map[string]string, len(af.Meta)), make(map[string]string, len(af.Emails))
+	keys, nameFormats := make(map[string]string, len(af.Keys)), make(map[string]string, len(af.NameFormats))
+	for initials, author := range af.Pairs {
+		pairs[canonical[initials]] = author
+	}
+	for initials, team := range af.Teams {
+		teams[canonical[initials]] = team
+	}
+	for initials, fields := range af.Meta {
+		meta[canonical[initials]] = fields
+	}
+	for initials, email := range af.Emails {
+		emails[canonical[initials]] = email
+	}
+	for initials, key := range af.Keys {
+		keys[canonical[initials]] = key
+	}
+	for initials, format := range af.NameFormats {
+		nameFormats[canonical[initials]] = format
+	}
+	af.Pairs, af.Teams, af.Meta, af.Emails, af.Keys, af.NameFormats = pairs, teams, meta, emails, keys, nameFormats
+
+	for i, initials := range af.Exclude {
+		af.Exclude[i] = af.normalizeInitials(initials)
+	}
+
+	if af.Squads != nil {
+		names := make([]string, 0, len(af.Squads))
+		for name := range af.Squads {
+			names = append(names, name)
+		}
+		if canonical, err = af.canonicalInitials(names); err != nil {
+			return fmt.Errorf("squads: %v", err)
+		}
+		squads := make(map[string][]string, len(af.Squads))
+		for name, members := range af.Squads {
+			normalized := make([]string, len(members))
+			for i, member := range members {
+				normalized[i] = af.normalizeInitials(member)
+			}
+			squads[canonical[name]] = normalized
+		}
+		af.Squads = squads
+	}
+
+	if af.EmailAddresses != nil {
+		addresses := make([]string, 0, len(af.EmailAddresses))
+		for initials := range af.EmailAddresses {
+			addresses = append(addresses, initials)
+		}
+		if canonical, err = af.canonicalInitials(addresses); err != nil {
+			return fmt.Errorf("email_addresses: %v", err)
+		}
+		emailAddresses := make(map[string]emailAddresses, len(af.EmailAddresses))
+		for initials, entry := range af.EmailAddresses {
+			emailAddresses[canonical[initials]] = entry
+		}
+		af.EmailAddresses = emailAddresses
+	}
+
+	if af.SigningKeys != nil {
+		signed := make([]string, 0, len(af.SigningKeys))
+		for initials := range af.SigningKeys {
+			signed = append(signed, initials)
+		}
+		if canonical, err = af.canonicalInitials(signed); err != nil {
+			return fmt.Errorf("signing_keys: %v", err)
+		}
+		signingKeys := make(map[string]string, len(af.SigningKeys))
+		for initials, key := range af.SigningKeys {
+			signingKeys[canonical[initials]] = key
+		}
+		af.SigningKeys = signingKeys
+	}
+
+	if af.LookupOverrides != nil {
+		overridden := make([]string, 0, len(af.LookupOverrides))
+		for initials := range af.LookupOverrides {
+			overridden = append(overridden, initials)
+		}
+		if canonical, err = af.canonicalInitials(overridden); err != nil {
+			return fmt.Errorf("lookup_overrides: %v", err)
+		}
+		overrides := make(map[string]string, len(af.LookupOverrides))
+		for initials, command := range af.LookupOverrides {
+			overrides[canonical[initials]] = command
+		}
+		af.LookupOverrides = overrides
+	}
+
+	return nil
+}
+
+// canonicalInitials maps each of the given initials to its normalized form
+// Returns an error naming both originals if two of them are the same once
+// normalized.
+func (af *pairsFile) canonicalInitials(initials []string) (canonical map[string]string, err error) {
+	canonical = make(map[string]string, len(initials))
+	original := make(map[string]string, len(initials))
+	for _, i := range initials {
+		normalized := af.normalizeInitials(i)
+		if _, ok := original[normalized]; ok {
+			// sorted only now, so that the error names the same pair every
+			// time without sorting every roster
+			sort.Strings(initials)
+			return af.sortedCanonicalInitials(initials)
+		}
+		original[normalized] = i
+		canonical[i] = normalized
+	}
+	return canonical, nil
+}
+
+// sortedCanonicalInitials is canonicalInitials for sorted initials, reporting
+// the first two that collide
+func (af *pairsFile) sortedCanonicalInitials(initials []string) (canonical map[string]string, err error) {
+	canonical = make(map[string]string, len(initials))
+	original := make(map[string]string, len(initials))
+	for _, i := range initials {
+		normalized := af.normalizeInitials(i)
+		if first, ok := original[normalized]; ok {
+			if strings.TrimSpace(first) != strings.TrimSpace(i) {
+				return nil, fmt.Errorf("initials %q and %q are the same once normalized, set case_sensitive_initials to tell them apart", first, i)
+			}
+			return nil, fmt.Errorf("initials %q and %q are the same once normalized", first, i)
+		}
+		original[normalized] = i
+		canonical[i] = normalized
+	}
+	return canonical, nil
+}
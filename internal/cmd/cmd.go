@@ -3,18 +3,26 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/git-duet/git-duet"
 )
 
+// WrappedEnv is set for git when run by a git-duet command, which rotates the
+// author itself (so the post-commit hook must not)
+const WrappedEnv = "GIT_DUET_WRAPPED"
+
+// Command runs a git subcommand as the configured pair. CommitterOnly leaves
+// the author of the commits alone (for commits made from patches, see
+// NewCommitterOnly).
 type Command struct {
-	Signoff    bool
-	Subcommand string
-	Args       []string
+	Signoff       bool
+	CommitterOnly bool
+	Subcommand    string
+	Args          []string
 }
 
 func New(subcommand string, args ...string) Command {
@@ -24,7 +32,7 @@ func New(subcommand string, args ...string) Command {
 	// If we're explicitly providing args, use them.
 	// Otherwise, we're forwarding from user input.
 	if len(args) == 0 {
-		cmd.Args = os.Args[1:]
+		cmd.Args = TakeJSONErrors(os.Args[1:])
 	} else {
 		cmd.Args = args
 	}
@@ -39,6 +47,16 @@ func NewWithSignoff(subcommand string, args ...string) Command {
 	return cmd
 }
 
+// NewCommitterOnly makes the pair the committer of the commits subcommand makes
+// (every one of them, e.g. for each patch `git am` applies), leaving their
+// authors as they are
+func NewCommitterOnly(subcommand string, args ...string) Command {
+	cmd := New(subcommand, args...)
+	cmd.CommitterOnly = true
+
+	return cmd
+}
+
 func (duetcmd Command) Execute() error {
 	configuration, err := duet.NewConfiguration()
 	if err != nil {
@@ -70,7 +88,16 @@ func (duetcmd Command) Execute() error {
 	}
 
 	if author == nil {
-		return errors.New("git-author not set")
+		return &duet.AuthorNotSetError{}
+	}
+
+	if err = gitConfig.CheckExpiry(); err != nil {
+		if _, expired := err.(*duet.PairExpiredError); !expired || !hasUserIdentity() {
+			return err
+		}
+		// an expired pair is not credited, commit as the user's own identity
+		fmt.Fprintf(os.Stderr, "git-duet: %v\ncommitting with user.name and user.email instead\n", err)
+		return duetcmd.run(os.Environ())
 	}
 
 	committers, err := gitConfig.GetCommitters()
@@ -78,28 +105,206 @@ func (duetcmd Command) Execute() error {
 		return err
 	}
 
-	var committer *duet.Pair
-	if committers != nil && len(committers) > 0 && duetcmd.Signoff {
-		duetcmd.Args = append([]string{"--signoff"}, duetcmd.Args...)
-		committer = committers[0]
-	} else {
-		committer = author
+	if duetcmd.CommitterOnly {
+		committer := author
+		if len(committers) > 0 {
+			committer = committers[0]
+		}
+		return duetcmd.run(append(os.Environ(),
+			fmt.Sprintf("GIT_COMMITTER_NAME=%s", committer.Name),
+			fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", committer.Email),
+		))
 	}
 
-	cmd := exec.Command("git", append([]string{duetcmd.Subcommand}, duetcmd.Args...)...)
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	cmd.Env = append(os.Environ(),
+	if configuration.CoAuthoredBy && len(committers) > 0 && duetcmd.NoVerify() {
+		// the prepare-commit-msg hook leaves trailers given on the command
+		// line alone, and they credit the co-authors even if it does not run
+		trailerKey, err := configuration.CoAuthorTrailerKey()
+		if err != nil {
+			return err
+		}
+		var trailers []string
+		for _, trailer := range duet.CoAuthorTrailers(trailerKey, duet.OrderCoAuthors(configuration.TrailerOrder, committers)) {
+			trailers = append(trailers, "--trailer", trailer)
+		}
+		duetcmd.Args = append(trailers, duetcmd.Args...)
+	}
+
+	signed := false
+	if author.SigningKey != "" && duetcmd.Subcommand == "commit" {
+		chosen, sign := chooseSigning(duetcmd.Args)
+		if !chosen {
+			duetcmd.Args = append([]string{"--gpg-sign=" + duet.GitSigningKey(author.SigningKey)}, duetcmd.Args...)
+		}
+		signed = !chosen || sign
+	}
+
+	committer := author
+	if len(committers) > 0 && duetcmd.Signoff {
+		if signed {
+			// the author's key signs, so the author commits as well and the
+			// committer only signs off
+			duetcmd.Args = append([]string{"--trailer", duet.Trailer("Signed-off-by", committers[0])}, duetcmd.Args...)
+		} else {
+			duetcmd.Args = append([]string{"--signoff"}, duetcmd.Args...)
+			committer = committers[0]
+		}
+	}
+
+	return duetcmd.run(append(os.Environ(),
 		fmt.Sprintf("GIT_AUTHOR_NAME=%s", author.Name),
 		fmt.Sprintf("GIT_AUTHOR_EMAIL=%s", author.Email),
 		fmt.Sprintf("GIT_COMMITTER_NAME=%s", committer.Name),
 		fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", committer.Email),
-	)
-	err = cmd.Run()
+	))
+}
+
+func (duetcmd Command) run(env []string) error {
+	cmd := exec.Command("git", append([]string{duetcmd.Subcommand}, duetcmd.Args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Env = append(env, WrappedEnv+"=1")
+	err := cmd.Run()
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// NoVerify returns whether the command is a commit bypassing the pre-commit
+// and commit-msg hooks (`--no-verify` or `-n`), which bypasses git-duet's own
+// checks and author rotation as well
+func (duetcmd Command) NoVerify() bool {
+	return duetcmd.Subcommand == "commit" && noVerify(duetcmd.Args)
+}
+
+// commitValueOptions are the options of `git commit` taking a value as the
+// next argument, which is not an option however it looks
+var commitValueOptions = map[string]bool{
+	"-m": true, "--message": true,
+	"-F": true, "--file": true,
+	"-c": true, "--reedit-message": true,
+	"-C": true, "--reuse-message": true,
+	"-t": true, "--template": true,
+	"--author": true, "--date": true, "--fixup": true, "--squash": true,
+	"--trailer": true, "--cleanup": true, "--pathspec-from-file": true,
+}
+
+// noVerify returns whether the last of `--no-verify`, `-n` (on its own or
+// among other short options, e.g. `-an`) and `--verify` in the arguments of
+// `git commit` is one of the former
+func noVerify(args []string) (bypass bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return bypass
+		case arg == "--no-verify":
+			bypass = true
+		case arg == "--verify":
+			bypass = false
+		case commitValueOptions[arg]:
+			i++
+		case len(arg) > 1 && arg[0] == '-' && arg[1] != '-':
+			for j, option := range arg[1:] {
+				if option == 'n' {
+					bypass = true
+				}
+				if strings.ContainsRune("mFcCtuS", option) {
+					// the rest of the argument, or the next one, is its value
+					if j == len(arg)-2 && commitValueOptions["-"+string(option)] {
+						i++
+					}
+					break
+				}
+			}
+		}
+	}
+	return bypass
+}
+
+// chooseSigning returns whether the arguments of `git commit` already say
+// whether to sign the commit (`-S`, `--gpg-sign` or `--no-gpg-sign`), and
+// whether the last of them signs it
+func chooseSigning(args []string) (chosen, sign bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return chosen, sign
+		case commitValueOptions[arg]:
+			i++
+		case strings.HasPrefix(arg, "-S"), strings.HasPrefix(arg, "--gpg-sign"):
+			chosen, sign = true, true
+		case arg == "--no-gpg-sign":
+			chosen, sign = true, false
+		}
+	}
+	return chosen, sign
+}
+
+// Committer returns the committer of the configured pair (the author when
+// soloing), or an error if no pair is configured or it expired
+func Committer() (*duet.Pair, error) {
+	author, committers, err := Pair()
+	if err != nil {
+		return nil, err
+	}
+	if len(committers) > 0 {
+		return committers[0], nil
+	}
+	return author, nil
+}
+
+// Pair returns the author and committers of the configured pair, or an error
+// if no pair is configured or it expired
+func Pair() (author *duet.Pair, committers []*duet.Pair, err error) {
+	configuration, err := duet.NewConfiguration()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var gitConfig *duet.GitConfig
+	if configuration.Global {
+		gitConfig = &duet.GitConfig{
+			Namespace:     configuration.Namespace,
+			Scope:         duet.Global,
+			SetUserConfig: configuration.SetGitUserConfig,
+		}
+	} else {
+		gitConfig, err = duet.GetAuthorConfig(configuration.Namespace, configuration.SetGitUserConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	author, err = gitConfig.GetAuthor()
+	if err != nil {
+		return nil, nil, err
+	}
+	if author == nil {
+		return nil, nil, &duet.AuthorNotSetError{}
+	}
+	if err = gitConfig.CheckExpiry(); err != nil {
+		return nil, nil, err
+	}
+
+	committers, err = gitConfig.GetCommitters()
+	if err != nil {
+		return nil, nil, err
+	}
+	return author, committers, nil
+}
+
+// hasUserIdentity returns whether user.name and user.email are configured
+func hasUserIdentity() bool {
+	for _, key := range []string{"user.name", "user.email"} {
+		output, err := exec.Command("git", "config", key).Output()
+		if err != nil || strings.TrimSpace(string(output)) == "" {
+			return false
+		}
+	}
+	return true
+}
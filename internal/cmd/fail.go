@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/git-duet/git-duet"
+)
+
+// JSONErrorsOption makes the commands print errors as JSON on stderr (see
+// Fail)
+const JSONErrorsOption = "--json-errors"
+
+// JSONErrors is set by --json-errors (see Fail)
+var JSONErrors bool
+
+// Fail prints err (as JSON on stderr with --json-errors, see
+// duet.WriteErrorReport) and exits with code
+func Fail(err error, code int) {
+	if JSONErrors {
+		duet.WriteErrorReport(os.Stderr, err)
+	} else {
+		fmt.Println(err)
+	}
+	os.Exit(code)
+}
+
+// TakeJSONErrors removes --json-errors from the arguments of a command passing
+// them on to git (those before `--`, git having no such option), setting
+// JSONErrors if it was given
+func TakeJSONErrors(args []string) []string {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(rest, args[i:]...)
+		}
+		if arg == JSONErrorsOption {
+			JSONErrors = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest
+}
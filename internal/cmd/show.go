@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/git-duet/git-duet"
+)
+
+// PrintPorcelain prints the author and committers for scripts (see
+// duet.WritePorcelain), along with when they were set and expire
+func PrintPorcelain(gitConfig *duet.GitConfig, nulTerminated bool, author *duet.Pair, committers ...*duet.Pair) error {
+	mtime, err := gitConfig.GetMtime()
+	if err != nil {
+		return err
+	}
+
+	expires, err := gitConfig.GetExpiry()
+	if err != nil {
+		return err
+	}
+
+	return duet.WritePorcelain(os.Stdout, author, committers, mtime, expires, nulTerminated)
+}
+
+// PrintJSON prints the whole configuration along with the authors file, or
+// null if nothing is configured
+func PrintJSON(configuration *duet.Configuration, gitConfig *duet.GitConfig) error {
+	config, err := gitConfig.GetConfig()
+	if _, ok := err.(*duet.NotConfiguredError); ok {
+		config, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		config.AuthorsFile = configuration.PairsFile
+	}
+
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+// PrintPrompt prints the configuration as a shell prompt segment, or nothing
+// if nothing is configured
+func PrintPrompt(gitConfig *duet.GitConfig) error {
+	config, err := gitConfig.GetConfig()
+	if _, ok := err.(*duet.NotConfiguredError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if segment := duet.PromptSegment(config); segment != "" {
+		fmt.Println(segment)
+	}
+	return nil
+}
+
+// PrintFormatted prints the author and committers with a `--format` template
+// or preset (see duet.FormatPair), one per line
+func PrintFormatted(format string, author *duet.Pair, committers ...*duet.Pair) error {
+	for _, p := range append([]*duet.Pair{author}, committers...) {
+		if p == nil {
+			continue
+		}
+
+		output, err := duet.FormatPair(p, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(output)
+	}
+	return nil
+}
+
+// WarnShadowed warns when the pair commits use is not the one in the config
+// being shown or changed: a pair in the repository config shadows the global
+// one unless GIT_DUET_GLOBAL (or duet.global) is set, in which case the global
+// one always wins
+func WarnShadowed(configuration *duet.Configuration, gitConfig *duet.GitConfig, quiet bool) error {
+	if quiet {
+		return nil
+	}
+
+	if configuration.Global {
+		if gitConfig.Scope == duet.Local {
+			fmt.Fprintf(os.Stderr, "git-duet: warning: commits use the global pair as GIT_DUET_GLOBAL or %s is set\n", duet.GlobalConfigKey)
+		}
+		return nil
+	}
+	if gitConfig.Scope == duet.Local {
+		return nil
+	}
+
+	local, global, err := duet.ShadowedGlobalAuthor(configuration.Namespace)
+	if err != nil {
+		return err
+	}
+	if local != nil {
+		fmt.Fprintf(os.Stderr, "git-duet: warning: the pair in the repository config (%s) shadows the global one (%s), `git duet --local --clear` removes it\n",
+			local.Initials, global.Initials)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package cmdrunner
 
 import (
+	"os"
+
 	"github.com/git-duet/git-duet"
 	"github.com/git-duet/git-duet/internal/cmd"
 )
@@ -10,6 +12,9 @@ func Execute(commands ...cmd.Command) error {
 	if err != nil {
 		return err
 	}
+	if len(commands) > 0 {
+		duet.NudgeOutdatedHooks(os.Stderr)
+	}
 
 	var gitConfig *duet.GitConfig
 	if configuration.Global {
@@ -24,15 +29,25 @@ func Execute(commands ...cmd.Command) error {
 			return err
 		}
 	}
+	gitConfig.AllowedSignersFile = configuration.AllowedSignersFile
 
+	rotate := configuration.RotateAuthor
 	for _, command := range commands {
 		if err := command.Execute(); err != nil {
 			return err
 		}
+		if command.NoVerify() {
+			rotate = false
+		}
 	}
 
-	if configuration.RotateAuthor {
-		if err := gitConfig.RotateAuthor(); err != nil {
+	// an expired pair is not rotated, it has to be set again anyway
+	if rotate && gitConfig.CheckExpiry() == nil {
+		rotated, err := gitConfig.RotateAuthorByPolicy(configuration.RotatePolicy)
+		if err != nil || !rotated {
+			return err
+		}
+		if err := configuration.SyncCommitTemplate(gitConfig); err != nil {
 			return err
 		}
 	}
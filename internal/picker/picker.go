@@ -0,0 +1,199 @@
+// picker houses a small line-based menu for choosing authors interactively
+
+package picker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Item is a single selectable entry
+// Key is returned when the item is selected, Label is what gets displayed
+type Item struct {
+	Key   string
+	Label string
+}
+
+// Picker presents a numbered menu on Out and reads commands from In
+// Color enables ANSI highlighting of the selected entries
+type Picker struct {
+	In    io.Reader
+	Out   io.Writer
+	Color bool
+}
+
+// IsTerminal returns whether f is attached to a terminal
+// Character devices that are not terminals (e.g. /dev/null) are not.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f.Fd())
+}
+
+// New returns a Picker reading from stdin and writing to stderr that
+// respects NO_COLOR (see https://no-color.org)
+func New() *Picker {
+	return &Picker{
+		In:    os.Stdin,
+		Out:   os.Stderr,
+		Color: os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// Pick lets the user select one or more items in order and returns their keys
+// in the order they were selected. Returns nil if the user cancelled.
+//
+// Commands (one per line):
+// - numbers (e.g. "3 1") select the displayed entries in that order
+// - /text filters the list fuzzily (a lone / clears the filter, see fuzzyScore)
+// - - drops the last selected entry
+// - q cancels
+// - an empty line accepts the current selection
+func (p *Picker) Pick(header string, items []Item) (keys []string, err error) {
+	var filter string
+	var selected []int
+
+	scanner := bufio.NewScanner(p.In)
+	for {
+		visible := p.filter(items, filter)
+		p.render(header, items, visible, selected, filter)
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			for _, i := range selected {
+				keys = append(keys, items[i].Key)
+			}
+			return keys, nil
+		case line == "q":
+			return nil, nil
+		case line == "-":
+			if len(selected) > 0 {
+				selected = selected[:len(selected)-1]
+			}
+		case strings.HasPrefix(line, "/"):
+			filter = strings.TrimSpace(line[1:])
+		default:
+			for _, field := range strings.Fields(line) {
+				n, err := strconv.Atoi(field)
+				if err != nil || n < 1 || n > len(visible) {
+					fmt.Fprintf(p.Out, "invalid choice %q\n", field)
+					break
+				}
+				if !contains(selected, visible[n-1]) {
+					selected = append(selected, visible[n-1])
+				}
+			}
+		}
+	}
+}
+
+// filter returns the items matching filter, best matches first (see
+// fuzzyScore), or all of them in order if filter is empty
+func (p *Picker) filter(items []Item, filter string) (visible []int) {
+	filter = strings.ToLower(filter)
+	scores := map[int]int{}
+	for i, item := range items {
+		if filter == "" {
+			visible = append(visible, i)
+			continue
+		}
+		score, ok := fuzzyScore(strings.ToLower(item.Key), filter)
+		if labelScore, labelOK := fuzzyScore(strings.ToLower(item.Label), filter); labelOK && (!ok || labelScore < score) {
+			score, ok = labelScore, true
+		}
+		if ok {
+			visible = append(visible, i)
+			scores[i] = score
+		}
+	}
+	sort.SliceStable(visible, func(a, b int) bool {
+		return scores[visible[a]] < scores[visible[b]]
+	})
+	return visible
+}
+
+// fuzzyScore returns whether the runes of pattern appear in text in order
+// (e.g. "jdo" in "jane doe"), and how good a match it is: lower is better,
+// 0 being text starting with pattern. Each rune is matched as early as it can
+// be, the score counting the runes skipped before and between them.
+func fuzzyScore(text, pattern string) (score int, ok bool) {
+	if i := strings.Index(text, pattern); i >= 0 {
+		return i, true
+	}
+
+	rest := []rune(pattern)
+	start := -1
+	for i, r := range []rune(text) {
+		if len(rest) == 0 {
+			break
+		}
+		if r != rest[0] {
+			if start >= 0 {
+				score++
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		return 0, false
+	}
+	// anything matching as a substring is better, in the key or the label
+	return subsequenceScore + start + score, true
+}
+
+// subsequenceScore is the lowest score of a match that is not a substring,
+// beyond the score of any substring of a label
+const subsequenceScore = 1 << 20
+
+func (p *Picker) render(header string, items []Item, visible, selected []int, filter string) {
+	if header != "" {
+		fmt.Fprintln(p.Out, header)
+	}
+	for n, i := range visible {
+		marker := "   "
+		for order, s := range selected {
+			if s == i {
+				marker = fmt.Sprintf("[%d]", order+1)
+			}
+		}
+		line := fmt.Sprintf("%s %2d) %s", marker, n+1, items[i].Label)
+		if p.Color && marker != "   " {
+			line = "\x1b[1;32m" + line + "\x1b[0m"
+		}
+		fmt.Fprintln(p.Out, line)
+	}
+	if len(visible) == 0 {
+		fmt.Fprintln(p.Out, "  (no matches)")
+	}
+
+	var chosen []string
+	for _, i := range selected {
+		chosen = append(chosen, items[i].Key)
+	}
+	fmt.Fprintf(p.Out, "selected: [%s] filter: %q\n", strings.Join(chosen, " "), filter)
+	fmt.Fprint(p.Out, "numbers to select, /text to filter, - to undo, q to quit, enter to accept> ")
+}
+
+func contains(list []int, value int) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
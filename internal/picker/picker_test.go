@@ -0,0 +1,115 @@
+package picker
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		text, pattern string
+		want          int
+		wantOK        bool
+	}{
+		{"jane doe", "jane", 0, true},
+		{"jane doe", "doe", 5, true},
+		{"jane doe", "jdo", subsequenceScore + 0 + 4, true},
+		{"jane doe", "ade", subsequenceScore + 1 + 4, true},
+		{"jane doe", "dj", 0, false},
+		{"jane doe", "janes", 0, false},
+	}
+
+	for _, tt := range tests {
+		score, ok := fuzzyScore(tt.text, tt.pattern)
+		if ok != tt.wantOK || (ok && score != tt.want) {
+			t.Errorf("fuzzyScore(%q, %q) = %d, %t, want %d, %t", tt.text, tt.pattern, score, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	items := []Item{
+		{Key: "zp", Label: "zp  Zoe Pat <zoe.pat@hamster.info.local>"},
+		{Key: "jxd", Label: "jxd Jax Dill"},
+		{Key: "al", Label: "al  Abraham Lincoln <jdoe-fan@hamster.info.local>"},
+		{Key: "jd", Label: "jd  Jane Doe <jane@hamsters.biz.local>"},
+		{Key: "fb", Label: "fb  Frances Bar <f.bar@hamster.info.local>"},
+	}
+
+	tests := []struct {
+		name, filter string
+		want         []string
+	}{
+		{"no filter keeps the order", "", []string{"zp", "jxd", "al", "jd", "fb"}},
+		{"prefix before substring before subsequence", "jd", []string{"jd", "al", "jxd"}},
+		{"key or label, whichever matches best", "frances", []string{"fb"}},
+		{"substrings by position", "doe", []string{"jd", "al"}},
+		{"ignores case", "FRANCES", []string{"fb"}},
+		{"equal scores keep the order", "j", []string{"jxd", "jd", "al"}},
+		{"no match", "qq", nil},
+	}
+
+	p := &Picker{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, i := range p.filter(items, tt.filter) {
+				got = append(got, items[i].Key)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("filter(%q) = %q, want %q", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPick(t *testing.T) {
+	items := []Item{
+		{Key: "jd", Label: "jd  Jane Doe"},
+		{Key: "fb", Label: "fb  Frances Bar"},
+		{Key: "al", Label: "al  Abraham Lincoln"},
+	}
+
+	tests := []struct {
+		name, input string
+		want        []string
+		wantOut     string
+	}{
+		{"in the order selected", "2 1\n\n", []string{"fb", "jd"}, "selected: [fb jd]"},
+		{"across lines, once each", "3\n1 3\n\n", []string{"al", "jd"}, "selected: [al jd]"},
+		{"among the filtered entries", "/abr\n1\n/\n2\n\n", []string{"al", "fb"}, `filter: "abr"`},
+		{"undoing the last one", "1 2\n-\n\n", []string{"jd"}, "selected: [jd]"},
+		{"up to an invalid choice", "2 4 1\n\n", []string{"fb"}, `invalid choice "4"`},
+		{"nothing", "\n", nil, "selected: []"},
+		{"cancelled", "1\nq\n", nil, "selected: [jd]"},
+		{"at the end of the input", "1\n", nil, "selected: [jd]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &Picker{In: strings.NewReader(tt.input), Out: &out}
+			keys, err := p.Pick("pick a pair", items)
+			if err != nil {
+				t.Fatalf("Pick: %v", err)
+			}
+			if strings.Join(keys, " ") != strings.Join(tt.want, " ") || (keys == nil) != (tt.want == nil) {
+				t.Errorf("Pick = %q, want %q", keys, tt.want)
+			}
+			if !strings.HasPrefix(out.String(), "pick a pair\n") || !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("Pick wrote %q, want the header and %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestPickReadError(t *testing.T) {
+	failure := errors.New("read failure")
+	p := &Picker{In: iotest.ErrReader(failure), Out: &bytes.Buffer{}}
+	if keys, err := p.Pick("", []Item{{Key: "jd", Label: "jd"}}); !errors.Is(err, failure) || keys != nil {
+		t.Errorf("Pick = %q, %v, want %v", keys, err, failure)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package picker
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
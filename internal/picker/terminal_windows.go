@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package picker
+
+import "syscall"
+
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
@@ -0,0 +1,144 @@
+package duet
+
+// SystemDefaultsFile is the organization defaults file layered under every
+// authors file if it exists (see NewConfigurationFS), unless
+// $GIT_DUET_DEFAULTS_FILE names another one
+const SystemDefaultsFile = "/etc/git-duet/authors.yml"
+
+// LayerError is a problem found in the merged view of a stack of authors files
+// (see NewPairsFromLayers), attributed to the file it comes from
+type LayerError struct {
+	File string
+	Err  error
+}
+
+func (e *LayerError) Error() string {
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e *LayerError) Unwrap() error {
+	return e.Err
+}
+
+// brokenEntry is a broken author in one of a stack of authors files
+type brokenEntry struct {
+	file string
+	err  *AuthorEntryError
+}
+
+// commandsFile is a file of a stack with `lookup_overrides`: layer is the
+// file of the stack it is, or is included by
+type commandsFile struct {
+	layer     string
+	included  bool
+	described string
+}
+
+// Layers returns the authors files read, lowest first (just the one for
+// NewPairsFromFS)
+func (a *Pairs) Layers() []string {
+	return a.layers
+}
+
+// pinNameFormat gives every author without a `name_format` of their own the
+// one of the file, so that it still applies once layered under a file with
+// another one
+func (af *pairsFile) pinNameFormat() {
+	if af.NameFormat == "" {
+		return
+	}
+	for initials := range af.Pairs {
+		if _, ok := af.NameFormats[initials]; !ok {
+			af.NameFormats[initials] = af.NameFormat
+		}
+	}
+}
+
+// overlay merges upper, a file layered on top of af, into af. Authors of upper
+// replace those with the same initials entirely, `email_addresses`,
+// `lookup_overrides` and `signing_keys` are merged per author and the other
+// settings of upper replace those of af if set. `github_noreply` and `gitlab`
+// count as one setting, as only one of them can be set.
+func (af *pairsFile) overlay(upper *pairsFile) {
+	if af.Authors == nil {
+		af.Authors = authorGroups{}
+	}
+	for key, entry := range upper.Authors {
+		af.Authors[key] = entry
+	}
+	for initials, author := range upper.Pairs {
+		delete(af.Teams, initials)
+		delete(af.Meta, initials)
+		delete(af.Emails, initials)
+		delete(af.Keys, initials)
+		delete(af.NameFormats, initials)
+		af.Pairs[initials] = author
+	}
+	for initials, team := range upper.Teams {
+		af.Teams[initials] = team
+	}
+	for initials, fields := range upper.Meta {
+		af.Meta[initials] = fields
+	}
+	for initials, email := range upper.Emails {
+		af.Emails[initials] = email
+	}
+	for initials, key := range upper.Keys {
+		af.Keys[initials] = key
+	}
+	for initials, format := range upper.NameFormats {
+		af.NameFormats[initials] = format
+	}
+
+	if af.EmailAddresses == nil {
+		af.EmailAddresses = map[string]emailAddresses{}
+	}
+	for initials, entry := range upper.EmailAddresses {
+		af.EmailAddresses[initials] = entry
+	}
+	if af.LookupOverrides == nil {
+		af.LookupOverrides = map[string]string{}
+	}
+	for initials, command := range upper.LookupOverrides {
+		af.LookupOverrides[initials] = command
+	}
+
+	if af.SigningKeys == nil {
+		af.SigningKeys = map[string]string{}
+	}
+	for initials, key := range upper.SigningKeys {
+		af.SigningKeys[initials] = key
+	}
+
+	if upper.NameFormat != "" {
+		af.NameFormat = upper.NameFormat
+	}
+	af.CaseSensitiveInitials = af.CaseSensitiveInitials || upper.CaseSensitiveInitials
+	if upper.Email.Prefix != "" || upper.Email.Domain != "" {
+		af.Email = upper.Email
+	}
+	if upper.EmailTemplate != "" {
+		af.EmailTemplate, af.EmailTemplateStrict = upper.EmailTemplate, upper.EmailTemplateStrict
+	}
+	if upper.Exclude != nil {
+		af.Exclude = upper.Exclude
+	}
+	if af.Squads == nil {
+		af.Squads = map[string][]string{}
+	}
+	for name, members := range upper.Squads {
+		af.Squads[name] = members
+	}
+	if upper.TrailerKey != "" {
+		af.TrailerKey = upper.TrailerKey
+	}
+	if upper.AllowedDomains != nil {
+		af.AllowedDomains = upper.AllowedDomains
+	}
+	if upper.GitHubNoreply.enabled || upper.GitLab.enabled {
+		af.GitHubNoreply, af.GitLab = upper.GitHubNoreply, upper.GitLab
+	}
+	if upper.PrivateEmail.enabled {
+		af.PrivateEmail = upper.PrivateEmail
+	}
+}
@@ -0,0 +1,203 @@
+package duet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Lint checks the authors file (the configured stack of files, or only file if
+// it is not empty) harder than loading it does: every author has to resolve
+// to an email address, no key may be given twice (YAML silently keeps the
+// last one), squads may only list known initials and no two authors should
+// share an email. Broken authors, which git-duet otherwise leaves out with a
+// warning, are errors.
+func (config *Configuration) Lint(file string) (diagnostics []Diagnostic) {
+	names := config.pairsFiles()
+	if file != "" {
+		names = []string{file}
+	}
+
+	fsys := config.fs()
+	for _, name := range names {
+		diagnostics = append(diagnostics, lintDuplicateKeys(fsys, name)...)
+	}
+
+	opts, err := config.pairsOptions()
+	if err != nil {
+		return append(diagnostics, Diagnostic{"configuration", SeverityError, DiagnosticConfigurationInvalid, err.Error()})
+	}
+	pairs, err := NewPairsFromLayers(fsys, names, config.EmailLookup, opts...)
+	if errors.Is(err, fs.ErrNotExist) {
+		return append(diagnostics, Diagnostic{"authors file", SeverityError, DiagnosticAuthorsFileMissing, err.Error()})
+	}
+	if err != nil {
+		return append(diagnostics, Diagnostic{"authors file", SeverityError, DiagnosticAuthorsFileInvalid, err.Error()})
+	}
+
+	message := fmt.Sprintf("%s lists %d authors", names[len(names)-1], pairs.Len())
+	if len(names) > 1 {
+		message += ", layered on " + strings.Join(names[:len(names)-1], ", ")
+	}
+	diagnostics = append(diagnostics, Diagnostic{"authors file", SeverityOK, DiagnosticAuthorsFile, message})
+
+	warnings := pairs.Warnings()
+	for _, warning := range warnings {
+		diagnostics = append(diagnostics, Diagnostic{"authors", SeverityError, DiagnosticBrokenAuthor, warning.Error()})
+	}
+	for _, squad := range pairs.Squads() {
+		if pairs.HasInitials(squad) {
+			diagnostics = append(diagnostics, Diagnostic{"squads", SeverityWarning, DiagnosticSquadShadowed,
+				fmt.Sprintf("squad %s is never used, %s are the initials of an author", squad, squad)})
+		} else if _, err := pairs.ExpandSquads([]string{squad}); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{"squads", SeverityError, DiagnosticSquadInvalid, err.Error()})
+		}
+	}
+	// Validate repeats the warnings first
+	problems := pairs.Validate()[len(warnings):]
+	for _, problem := range problems {
+		diagnostics = append(diagnostics, Diagnostic{"authors", SeverityError, DiagnosticAuthorInvalid, problem.Error()})
+	}
+	if len(problems) > 0 {
+		return diagnostics
+	}
+
+	all, err := pairs.All()
+	if err != nil {
+		return append(diagnostics, Diagnostic{"authors", SeverityError, DiagnosticAuthorInvalid, err.Error()})
+	}
+	for i, p := range all {
+		for _, other := range all[:i] {
+			if email := sameEmail(other, p); email != "" {
+				diagnostics = append(diagnostics, Diagnostic{"authors", SeverityWarning, DiagnosticSharedEmail,
+					fmt.Sprintf("%s and %s share the email %s, they cannot pair with each other", other.Initials, p.Initials, email)})
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// lintDuplicateKeys reports the keys of the YAML authors file name that are
+// given more than once in the same mapping. Files that cannot be read or are
+// not YAML are left to loading them.
+func lintDuplicateKeys(fsys fs.FS, name string) (diagnostics []Diagnostic) {
+	resolved, err := resolveAuthorsFile(fsys, name)
+	if err != nil {
+		return nil
+	}
+	if format, err := authorsFileFormat(name, resolved); err != nil || format != AuthorsFormatYAML {
+		return nil
+	}
+	contents, err := fs.ReadFile(fsys, resolved)
+	if err != nil {
+		return nil
+	}
+
+	for _, duplicate := range duplicateKeys(contents) {
+		diagnostics = append(diagnostics, Diagnostic{"authors file", SeverityError, DiagnosticDuplicateKey,
+			fmt.Sprintf("%s: line %d: %s is already given on line %d", describeAuthorsFile(name, resolved),
+				duplicate.line, duplicate.key, duplicate.first)})
+	}
+	return diagnostics
+}
+
+// duplicateKey is a key given again on line after first
+type duplicateKey struct {
+	key         string
+	line, first int
+}
+
+var (
+	// yamlKeyRegexp matches a block mapping key, quoted or plain, and the
+	// value after it
+	yamlKeyRegexp = regexp.MustCompile(`^(?:"((?:[^"\\]|\\.)*)"|'((?:[^']|'')*)'|([^\s"'#{\[|>!&*-][^#]*?|-\S[^#]*?))\s*:(?:\s+(.*))?$`)
+	// yamlBlockScalarRegexp matches the indicator of a literal or folded value
+	yamlBlockScalarRegexp = regexp.MustCompile(`^[|>][-+0-9]*\s*(?:#.*)?$`)
+)
+
+// duplicateKeys scans YAML contents line by line for keys given twice in the
+// same block mapping, which the YAML parser does not complain about. Flow
+// mappings (`{...}`) and keys spanning lines are not looked into.
+func duplicateKeys(contents []byte) (duplicates []duplicateKey) {
+	type mapping struct {
+		indent int
+		keys   map[string]int
+	}
+	var (
+		mappings []mapping
+		// lines indented deeper than this belong to a block scalar
+		blockScalar = -1
+	)
+	// enter returns the mapping whose keys are at indent, starting a new one
+	// unless it is the innermost one
+	enter := func(indent int) map[string]int {
+		for len(mappings) > 0 && mappings[len(mappings)-1].indent > indent {
+			mappings = mappings[:len(mappings)-1]
+		}
+		if len(mappings) == 0 || mappings[len(mappings)-1].indent < indent {
+			mappings = append(mappings, mapping{indent, map[string]int{}})
+		}
+		return mappings[len(mappings)-1].keys
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		content := strings.TrimLeft(text, " ")
+		indent := len(text) - len(content)
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if blockScalar >= 0 && indent > blockScalar {
+			continue
+		}
+		blockScalar = -1
+		if content == "---" || content == "..." {
+			mappings = nil
+			continue
+		}
+
+		// each item of a sequence starts a mapping of its own
+		for content == "-" || strings.HasPrefix(content, "- ") {
+			item := strings.TrimLeft(content[1:], " ")
+			indent += len(content) - len(item)
+			content = item
+			for len(mappings) > 0 && mappings[len(mappings)-1].indent >= indent {
+				mappings = mappings[:len(mappings)-1]
+			}
+		}
+
+		match := yamlKeyRegexp.FindStringSubmatch(content)
+		if match == nil {
+			continue
+		}
+		key := match[3]
+		if match[1] != "" || strings.HasPrefix(content, `"`) {
+			if unquoted, err := strconv.Unquote(`"` + match[1] + `"`); err == nil {
+				key = unquoted
+			} else {
+				key = match[1]
+			}
+		} else if match[2] != "" || strings.HasPrefix(content, "'") {
+			key = strings.Replace(match[2], "''", "'", -1)
+		}
+
+		keys := enter(indent)
+		if first, ok := keys[key]; ok {
+			duplicates = append(duplicates, duplicateKey{key: key, line: line, first: first})
+		}
+		keys[key] = line
+
+		if yamlBlockScalarRegexp.MatchString(match[4]) {
+			blockScalar = indent
+		}
+	}
+
+	return duplicates
+}
@@ -0,0 +1,143 @@
+package duet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmailLookupCacheFile returns where email lookup results are cached
+// ($XDG_CACHE_HOME/git-duet/email-lookup.json or the platform equivalent)
+func EmailLookupCacheFile() (file string, err error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-duet", "email-lookup.json"), nil
+}
+
+// ClearEmailLookupCache forgets every cached email lookup, failed or not
+func ClearEmailLookupCache() (err error) {
+	file, err := EmailLookupCacheFile()
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// lookupCache remembers email lookup results between invocations
+// Successful lookups are kept for ttl and failed ones for negativeTTL, a zero
+// duration disables caching the respective kind.
+type lookupCache struct {
+	file        string
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]lookupCacheEntry
+}
+
+type lookupCacheEntry struct {
+	Email  string    `json:"email,omitempty"`
+	Key    string    `json:"key,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Stderr string    `json:"stderr,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// newLookupCacheEntry records the result of an email or signing key lookup
+func newLookupCacheEntry(lookup, result string) lookupCacheEntry {
+	if lookup == keyLookupKind {
+		return lookupCacheEntry{Key: result}
+	}
+	return lookupCacheEntry{Email: result}
+}
+
+// result returns the email or signing key recorded (see newLookupCacheEntry)
+func (e lookupCacheEntry) result(lookup string) string {
+	if lookup == keyLookupKind {
+		return e.Key
+	}
+	return e.Email
+}
+
+// lookupCacheKey identifies a lookup by the command and all of its arguments
+func lookupCacheKey(command, initials, name, username string) string {
+	return strings.Join([]string{command, initials, name, username}, "\x00")
+}
+
+// get returns the cached entry for key unless it has expired
+func (c *lookupCache) get(key string) (entry lookupCacheEntry, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.load()
+	}
+
+	entry, ok = c.entries[key]
+	if !ok {
+		return entry, false
+	}
+
+	ttl := c.ttl
+	if entry.Error != "" {
+		ttl = c.negativeTTL
+	}
+	return entry, time.Since(entry.At) < ttl
+}
+
+// getStale returns the cached entry for key, whether it has expired or not
+func (c *lookupCache) getStale(key string) (entry lookupCacheEntry, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.load()
+	}
+
+	entry, ok = c.entries[key]
+	return entry, ok
+}
+
+// put records entry for key and writes the cache back to disk
+func (c *lookupCache) put(key string, entry lookupCacheEntry) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.load()
+	}
+
+	entry.At = time.Now()
+	c.entries[key] = entry
+
+	contents, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.file, contents, 0600)
+}
+
+// load reads the cache from disk, a missing or corrupt cache is treated as empty
+func (c *lookupCache) load() {
+	c.entries = map[string]lookupCacheEntry{}
+
+	contents, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(contents, &c.entries); err != nil {
+		c.entries = map[string]lookupCacheEntry{}
+	}
+}
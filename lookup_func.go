@@ -0,0 +1,85 @@
+package duet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// EmailLookupFunc looks up the email of an author in place of an email lookup
+// command (see WithEmailLookupFunc), following the same contract: an email
+// is used, an empty email without an error falls through and an error fails
+// the lookup. ctx is done once the lookup timeout (see WithLookupTimeout)
+// has passed.
+type EmailLookupFunc func(ctx context.Context, initials, name, username string) (string, error)
+
+// lookupFuncPrefix sets the cache IDs of email lookup functions apart from
+// the commands in the lookup cache
+const lookupFuncPrefix = "\x00func\x00"
+
+// WithEmailLookupFunc looks up emails with lookup before the email lookup
+// command, sharing its cache, timeout and fallback settings. The command is
+// only run if lookup finds no email. A `lookup_overrides` entry of an author
+// takes precedence over both, so lookup is not called for them.
+//
+// cacheID names lookup in the lookup cache, as functions cannot be told apart:
+// functions given the same ID share their cached results. The results of a
+// function without one are not cached.
+func WithEmailLookupFunc(cacheID string, lookup EmailLookupFunc) Option {
+	return func(a *Pairs) {
+		a.emailLookupFunc = lookup
+		a.emailLookupFuncID = cacheID
+	}
+}
+
+// WithLookupTimeout fails email and signing key lookups that take longer than
+// d (0, the default, waits forever), the command being killed
+func WithLookupTimeout(d time.Duration) Option {
+	return func(a *Pairs) {
+		a.lookupTimeout = d
+	}
+}
+
+// lookupWaitDelay is how long a lookup command killed by the lookup timeout
+// may take to close its output
+const lookupWaitDelay = time.Second
+
+// lookupSource is a way of looking up emails or signing keys, id telling them
+// apart in the lookup cache (empty for one that is not cached)
+type lookupSource struct {
+	id     string
+	lookup EmailLookupFunc
+}
+
+// commandLookup runs command (and its arguments) with the initials, name and
+// username of the author as an EmailLookupFunc, LookupNoEmailExitCode being no
+// result and other failures a *LookupFailedError with what it printed on
+// stderr
+func commandLookup(kind string, command []string) lookupSource {
+	return lookupSource{
+		id: strings.Join(command, "\x00"),
+		lookup: func(ctx context.Context, initials, name, username string) (string, error) {
+			var out, stderr bytes.Buffer
+
+			cmd := exec.CommandContext(ctx, command[0], append(command[1:], initials, name, username)...)
+			cmd.Stdout = &out
+			cmd.Stderr = &stderr
+			// children of a command killed by the timeout may keep its output
+			// open, which is not worth waiting for
+			setWaitDelay(cmd, lookupWaitDelay)
+
+			if err := cmd.Run(); err != nil {
+				var exit *exec.ExitError
+				if errors.As(err, &exit) && exit.ExitCode() == LookupNoEmailExitCode {
+					// a definitive answer, cached like any other result
+					return "", nil
+				}
+				return "", &LookupFailedError{Initials: initials, Lookup: kind, Err: err, Stderr: strings.TrimSpace(stderr.String())}
+			}
+			return strings.TrimSpace(string(normalizeNewlines(out.Bytes()))), nil
+		},
+	}
+}
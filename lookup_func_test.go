@@ -0,0 +1,182 @@
+package duet
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// lookupCommandScript writes a lookup command answering initials@command.local
+// and returns its path
+func lookupCommandScript(t *testing.T) string {
+	t.Helper()
+	command := filepath.Join(t.TempDir(), "lookup")
+	if err := os.WriteFile(command, []byte("#!/bin/sh\necho \"$1@command.local\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return command
+}
+
+// countingLookup answers email for every author, counting the lookups in calls
+func countingLookup(email string, calls *int) EmailLookupFunc {
+	return func(ctx context.Context, initials, name, username string) (string, error) {
+		*calls++
+		return email, nil
+	}
+}
+
+func emailOf(t *testing.T, command string, initials string, opts ...Option) (string, error) {
+	t.Helper()
+	files := fstest.MapFS{"authors.yml": {Data: []byte(testAuthorsFile + `lookup_overrides:
+  fb: ""
+`)}}
+	pairs, err := NewPairsFromFS(files, "authors.yml", command, opts...)
+	if err != nil {
+		t.Fatalf("NewPairsFromFS: %v", err)
+	}
+	pair, err := pairs.ByInitials(initials)
+	if err != nil {
+		return "", err
+	}
+	return pair.Email, nil
+}
+
+func TestWithEmailLookupFunc(t *testing.T) {
+	isolate(t)
+	command := lookupCommandScript(t)
+
+	tests := []struct {
+		name     string
+		initials string
+		command  string
+		lookup   EmailLookupFunc
+		want     string
+	}{
+		{
+			name:     "func",
+			initials: "jd",
+			command:  command,
+			lookup: func(ctx context.Context, initials, name, username string) (string, error) {
+				return initials + "+" + username + "@func.local", nil
+			},
+			want: "jd+jane@func.local",
+		},
+		{
+			name:     "falls through to the command",
+			initials: "jd",
+			command:  command,
+			lookup:   countingLookup("", new(int)),
+			want:     "jd@command.local",
+		},
+		{
+			name:     "falls through to the authors file",
+			initials: "jd",
+			lookup:   countingLookup("", new(int)),
+			want:     "jane@hamster.info.local",
+		},
+		{
+			name:     "lookup_overrides win",
+			initials: "fb",
+			command:  command,
+			lookup:   countingLookup("nope@func.local", new(int)),
+			want:     "f.bar@hamster.info.local",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := emailOf(t, tt.command, tt.initials, WithEmailLookupFunc("test", tt.lookup))
+			if err != nil {
+				t.Fatalf("ByInitials: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Email = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithEmailLookupFuncErrors(t *testing.T) {
+	isolate(t)
+
+	failing := func(ctx context.Context, initials, name, username string) (string, error) {
+		return "", errors.New("directory unavailable")
+	}
+	_, err := emailOf(t, "", "jd", WithEmailLookupFunc("test", failing))
+	var failed *LookupFailedError
+	if !errors.As(err, &failed) || failed.Initials != "jd" || !strings.Contains(err.Error(), "directory unavailable") {
+		t.Errorf("ByInitials: got %v, want a *LookupFailedError for jd", err)
+	}
+
+	hanging := func(ctx context.Context, initials, name, username string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	_, err = emailOf(t, "", "jd", WithEmailLookupFunc("test", hanging), WithLookupTimeout(10*time.Millisecond))
+	if !errors.As(err, &failed) || !strings.Contains(err.Error(), "no answer within 10ms") {
+		t.Errorf("ByInitials: got %v, want a timed out *LookupFailedError", err)
+	}
+
+	email, err := emailOf(t, "", "jd", WithEmailLookupFunc("test", failing), WithLookupFailureFallback())
+	if err != nil || email != "jane@hamster.info.local" {
+		t.Errorf("ByInitials: got %q, %v, want the email of the authors file", email, err)
+	}
+}
+
+func TestWithEmailLookupFuncCache(t *testing.T) {
+	isolate(t)
+	cache := WithEmailLookupCache(filepath.Join(t.TempDir(), "email-lookup.json"), time.Hour, 0)
+
+	var first, second, uncached int
+	for i := 0; i < 2; i++ {
+		if email, _ := emailOf(t, "", "jd", WithEmailLookupFunc("first", countingLookup("jane@first.local", &first)), cache); email != "jane@first.local" {
+			t.Errorf("first: Email = %q, want jane@first.local", email)
+		}
+		if email, _ := emailOf(t, "", "jd", WithEmailLookupFunc("second", countingLookup("jane@second.local", &second)), cache); email != "jane@second.local" {
+			t.Errorf("second: Email = %q, want jane@second.local", email)
+		}
+		if email, _ := emailOf(t, "", "jd", WithEmailLookupFunc("", countingLookup("jane@uncached.local", &uncached)), cache); email != "jane@uncached.local" {
+			t.Errorf("uncached: Email = %q, want jane@uncached.local", email)
+		}
+	}
+	if first != 1 || second != 1 || uncached != 2 {
+		t.Errorf("lookups: first %d, second %d, uncached %d, want 1, 1 and 2", first, second, uncached)
+	}
+}
+
+func TestWithEmailLookupFuncNegativeCache(t *testing.T) {
+	isolate(t)
+	cache := WithEmailLookupCache(filepath.Join(t.TempDir(), "email-lookup.json"), time.Hour, time.Minute)
+
+	calls := 0
+	failing := func(ctx context.Context, initials, name, username string) (string, error) {
+		calls++
+		return "", errors.New("directory unavailable")
+	}
+	for i := 0; i < 2; i++ {
+		_, err := emailOf(t, "", "jd", WithEmailLookupFunc("failing", failing), cache)
+		var failed *LookupFailedError
+		if !errors.As(err, &failed) || err.Error() != "email lookup for jd failed: directory unavailable" {
+			t.Errorf("ByInitials #%d: got %v, want the *LookupFailedError of the lookup", i+1, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("lookups = %d, want 1", calls)
+	}
+
+	email, err := emailOf(t, "", "jd", WithEmailLookupFunc("failing", failing), cache, WithLookupFailureFallback())
+	if err != nil || email != "jane@hamster.info.local" || calls != 1 {
+		t.Errorf("ByInitials: got %q, %v after %d lookups, want the email of the authors file without a lookup", email, err, calls)
+	}
+
+	files := fstest.MapFS{"authors.yml": {Data: []byte(testAuthorsFile)}}
+	tooLong := WithEmailLookupCache(filepath.Join(t.TempDir(), "email-lookup.json"), time.Minute, time.Hour)
+	if _, err := NewPairsFromFS(files, "authors.yml", "", tooLong); err == nil {
+		t.Error("NewPairsFromFS: got no error for a negative TTL longer than the TTL")
+	}
+}
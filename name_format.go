@@ -0,0 +1,83 @@
+package duet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Formats of the names in the authors file (`name_format`, globally or per
+// structured author)
+const (
+	// NameFormatFirstLast names are used as they are (the default)
+	NameFormatFirstLast = "first_last"
+	// NameFormatLastFirst names are written "Last, First" and turned into
+	// "First Last", names without a comma are used as they are
+	NameFormatLastFirst = "last_first"
+)
+
+// nameSuffixes are kept after the last name by NameFormatLastFirst and left out
+// when making up an email from the name (lower case, without the dot)
+var nameSuffixes = map[string]bool{
+	"jr": true, "sr": true, "ii": true, "iii": true, "iv": true,
+	"phd": true, "md": true, "esq": true,
+}
+
+// checkNameFormat returns an error unless format is empty or a NameFormat
+func checkNameFormat(format string) error {
+	switch format {
+	case "", NameFormatFirstLast, NameFormatLastFirst:
+		return nil
+	}
+	return fmt.Errorf("unknown name_format %q, must be %s or %s", format, NameFormatFirstLast, NameFormatLastFirst)
+}
+
+// author returns the name, username and extra fields of the author with the
+// given initials, the name in the `name_format` of the author (or the file)
+func (af *pairsFile) author(initials string) (name, username string, extra []string) {
+	name, username, extra = parseAuthor(af.Pairs[initials])
+
+	format := af.NameFormat
+	if entry, ok := af.NameFormats[initials]; ok {
+		format = entry
+	}
+	if format == NameFormatLastFirst {
+		name = lastFirstToFirstLast(name)
+	}
+	return name, username, extra
+}
+
+// lastFirstToFirstLast turns "Doe, Jane" into "Jane Doe", splitting on the
+// first comma only and keeping a suffix after the last name ("Doe, Jane, Jr."
+// is "Jane Doe Jr."). Names without a comma, or with nothing on either side
+// of it, are returned as they are.
+func lastFirstToFirstLast(name string) string {
+	parts := strings.SplitN(name, ",", 2)
+	if len(parts) != 2 {
+		return name
+	}
+	last, first := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if last == "" || first == "" {
+		return name
+	}
+
+	if i := strings.LastIndex(first, ","); i >= 0 && isNameSuffix(first[i+1:]) {
+		return fmt.Sprintf("%s %s %s", strings.TrimSpace(first[:i]), last, strings.TrimSpace(first[i+1:]))
+	}
+	return first + " " + last
+}
+
+// isNameSuffix returns whether word is one of nameSuffixes (e.g. "Jr.")
+func isNameSuffix(word string) bool {
+	return nameSuffixes[strings.ToLower(strings.TrimSuffix(strings.TrimSpace(word), "."))]
+}
+
+// stripNameSuffix returns name without a trailing suffix ("Jane Doe Jr." is
+// "Jane Doe"), for making up an email from it
+func stripNameSuffix(name string) string {
+	words := strings.Fields(name)
+	if len(words) > 1 && isNameSuffix(words[len(words)-1]) {
+		words = words[:len(words)-1]
+		words[len(words)-1] = strings.TrimSuffix(words[len(words)-1], ",")
+	}
+	return strings.Join(words, " ")
+}
@@ -1,75 +1,664 @@
 package duet
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
-	"regexp"
+	"io"
+	"io/fs"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
-
-	"gopkg.in/yaml.v2"
+	"time"
+	"unicode"
 )
 
 // Pairs wraps the git authors file with logic for looking up pairs based on initials
 // and building email addresses
 type Pairs struct {
 	file        *pairsFile
+	path        string
 	emailLookup string
+	// emailLookupFunc is consulted before emailLookup, its results cached
+	// under emailLookupFuncID (see WithEmailLookupFunc)
+	emailLookupFunc   EmailLookupFunc
+	emailLookupFuncID string
+	lookupTimeout     time.Duration
+	// ctx cancels lookups and requests to code hosts (see WithContext)
+	ctx context.Context
+	// resolverTimeout bounds each request to a code host and resolverBudget
+	// all of them for an author (see WithResolverTimeouts)
+	resolverTimeout time.Duration
+	resolverBudget  time.Duration
+	// keyLookup is the signing key lookup command (see WithKeyLookup)
+	keyLookup   string
+	lookupCache *lookupCache
+	// lookupFallback falls through to the authors file when the email lookup
+	// command fails rather than returning the error
+	lookupFallback bool
+	concurrency    int
+	hintLimit      int
+	prefixMatching bool
+	emailLabel     string
+	debug          io.Writer
+	// duplicatePeople lets ByInitialsMany return someone twice
+	duplicatePeople bool
+	// deferLookupCheck skips checking the email lookup commands exist when
+	// loading the file
+	deferLookupCheck bool
+	// untrustedFiles are the authors files whose `lookup_overrides` are
+	// rejected, with why (see WithUntrustedAuthorsFile), unless trustCommands
+	// is set (see WithTrustedAuthorsFileCommands)
+	untrustedFiles map[string]string
+	trustCommands  bool
+	// lenient leaves broken authors out (see Warnings) rather than failing
+	lenient  bool
+	warnings []error
+	// layers are the authors files read, lowest first, and origins the file
+	// (as named in errors) each author comes from, nil for a single file
+	layers  []string
+	origins map[string]string
+}
+
+// LookupNoEmailExitCode is the exit code of an email lookup command that
+// definitively has no email for an author (see NewPairsFromFile)
+const LookupNoEmailExitCode = 2
+
+// DefaultLookupConcurrency is how many authors are resolved at once by default
+const DefaultLookupConcurrency = 4
+
+// Option customizes how Pairs resolves authors (see NewPairsFromFile)
+type Option func(*Pairs)
+
+// WithEmailLookupCache caches the results of the email lookup command in file,
+// successful lookups for ttl and failed ones for negativeTTL (zero disables
+// either). A cached failure is returned again without running the command,
+// negativeTTL must not be longer than ttl (see NewPairsFromLayers).
+func WithEmailLookupCache(file string, ttl, negativeTTL time.Duration) Option {
+	return func(a *Pairs) {
+		a.lookupCache = &lookupCache{file: file, ttl: ttl, negativeTTL: negativeTTL}
+	}
+}
+
+// WithKeyLookup resolves the signing keys of authors (see Pair.SigningKey) with
+// command, which is run and cached just like the email lookup command (see
+// NewPairsFromFile) and prints a key ID. Authors it has no key for fall back
+// to `signing_keys` in the authors file.
+func WithKeyLookup(command string) Option {
+	return func(a *Pairs) {
+		a.keyLookup = command
+	}
+}
+
+// WithLookupFailureFallback makes a failing email lookup command fall through
+// to the authors file instead of being an error
+func WithLookupFailureFallback() Option {
+	return func(a *Pairs) {
+		a.lookupFallback = true
+	}
+}
+
+// WithDeferredLookupCheck skips checking that the email lookup commands exist
+// and are executable in NewPairsFromFile, for environments where they are
+// provisioned later. A missing command then fails the first lookup instead.
+func WithDeferredLookupCheck() Option {
+	return func(a *Pairs) {
+		a.deferLookupCheck = true
+	}
+}
+
+// WithLookupConcurrency sets how many authors ByInitialsMany (and All)
+// resolve at once, 1 runs the email lookup command serially
+func WithLookupConcurrency(n int) Option {
+	return func(a *Pairs) {
+		if n < 1 {
+			n = 1
+		}
+		a.concurrency = n
+	}
+}
+
+// WithInitialsHintLimit lists every author when initials are unknown if there
+// are at most n, otherwise only the closest matches. 0 disables these hints
+// (e.g. if the roster is considered sensitive).
+func WithInitialsHintLimit(n int) Option {
+	return func(a *Pairs) {
+		a.hintLimit = n
+	}
+}
+
+// WithLenientEntries loads authors files with individually broken authors
+// (e.g. without a name), leaving those out and reporting them by Warnings
+// instead of failing NewPairsFromFile
+func WithLenientEntries() Option {
+	return func(a *Pairs) {
+		a.lenient = true
+	}
+}
+
+// WithDuplicatePeople lets ByInitialsMany return the same person more than
+// once, for the rare case where that is intended
+func WithDuplicatePeople() Option {
+	return func(a *Pairs) {
+		a.duplicatePeople = true
+	}
+}
+
+// WithPrefixMatching lets initials be abbreviated to a prefix matching only
+// one author (e.g. `jd` for `jdo`), initials matching exactly always win
+func WithPrefixMatching() Option {
+	return func(a *Pairs) {
+		a.prefixMatching = true
+	}
+}
+
+// WithUntrustedAuthorsFile rejects the `lookup_overrides` of the authors file
+// name (as given to NewPairsFromLayers), as they are commands git-duet would
+// run: why says where it comes from, e.g. "was found in the repository".
+// Included files are always untrusted (see WithTrustedAuthorsFileCommands).
+func WithUntrustedAuthorsFile(name, why string) Option {
+	return func(a *Pairs) {
+		if a.untrustedFiles == nil {
+			a.untrustedFiles = map[string]string{}
+		}
+		a.untrustedFiles[name] = why
+	}
+}
+
+// WithTrustedAuthorsFileCommands accepts the `lookup_overrides` of every
+// authors file, including untrusted and included ones
+func WithTrustedAuthorsFileCommands() Option {
+	return func(a *Pairs) {
+		a.trustCommands = true
+	}
+}
+
+// WithDebug writes diagnostics (e.g. lookup failures that were skipped) to w
+func WithDebug(w io.Writer) Option {
+	return func(a *Pairs) {
+		a.debug = w
+	}
 }
 
 // Pair represents a single pair
+// Extra holds any fields of the author entry after the username and Meta the
+// free-form `meta` of structured authors. EmailLabel is the label of the
+// `email_addresses` entry Email was picked from, if it has labels. RealEmail is
+// the email resolved for the author when private mode replaced it (see
+// WithPrivateEmail).
 type Pair struct {
-	Name     string
-	Email    string
-	Initials string
-	Username string
+	Name       string            `json:"name"`
+	Email      string            `json:"email"`
+	Initials   string            `json:"initials,omitempty"`
+	Username   string            `json:"username,omitempty"`
+	Team       string            `json:"team,omitempty"`
+	Extra      []string          `json:"extra,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+	EmailLabel string            `json:"email_label,omitempty"`
+	SigningKey string            `json:"signing_key,omitempty"`
+	RealEmail  string            `json:"-"`
 }
 
+// pairsFile is the decoded authors file
+// Include lists the other authors files it is made of (see
+// readAuthorsFileWithIncludes).
+// Pairs maps initials to "Name; username", Teams maps initials to their team
+// (if grouped) and Meta to the free-form fields of structured authors; all are
+// flattened from Authors once parsed and keyed by normalized initials (see
+// normalizeInitials). LegacyPairs is the `pairs` key of
+// version 0, moved to Authors by migrateLegacyPairsKey.
 type pairsFile struct {
-	Pairs          map[string]string `yaml:"authors"`
-	Email          emailConfig       `yaml:"email"`
-	EmailAddresses map[string]string `yaml:"email_addresses"`
-	EmailTemplate  string            `yaml:"email_template"`
+	Version               fileVersion                  `yaml:"version"`
+	Include               []string                     `yaml:"include,omitempty"`
+	Authors               authorGroups                 `yaml:"authors"`
+	LegacyPairs           authorGroups                 `yaml:"pairs,omitempty"`
+	Pairs                 map[string]string            `yaml:"-"`
+	Teams                 map[string]string            `yaml:"-"`
+	Meta                  map[string]map[string]string `yaml:"-"`
+	Emails                map[string]string            `yaml:"-"`
+	Keys                  map[string]string            `yaml:"-"`
+	NameFormats           map[string]string            `yaml:"-"`
+	NameFormat            string                       `yaml:"name_format,omitempty"`
+	CaseSensitiveInitials bool                         `yaml:"case_sensitive_initials,omitempty"`
+	Email                 emailConfig                  `yaml:"email,omitempty"`
+	EmailAddresses        map[string]emailAddresses    `yaml:"email_addresses,omitempty"`
+	EmailTemplate         string                       `yaml:"email_template,omitempty"`
+	EmailTemplateStrict   bool                         `yaml:"email_template_strict,omitempty"`
+	Exclude               []string                     `yaml:"exclude,omitempty"`
+	Squads                map[string][]string          `yaml:"squads,omitempty"`
+	TrailerKey            string                       `yaml:"trailer_key,omitempty"`
+	LookupOverrides       map[string]string            `yaml:"lookup_overrides,omitempty"`
+	SigningKeys           map[string]string            `yaml:"signing_keys,omitempty"`
+	AllowedDomains        []string                     `yaml:"allowed_domains,omitempty"`
+	GitHubNoreply         githubConfig                 `yaml:"github_noreply,omitempty"`
+	GitLab                gitlabConfig                 `yaml:"gitlab,omitempty"`
+	PrivateEmail          privateEmailConfig           `yaml:"private_email,omitempty"`
+}
+
+// authorGroups is the `authors` map, where each value is either an author or a
+// team mapping initials to authors
+type authorGroups map[string]authorEntry
+
+// authorEntry is either an author or a team, entries that are neither are
+// kept as is (raw) so they can be reported per author
+type authorEntry struct {
+	author authorValue
+	team   map[string]authorValue
+	raw    interface{}
+}
+
+func (e *authorEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.author); err == nil {
+		return nil
+	}
+	if err := unmarshal(&e.team); err == nil {
+		return nil
+	}
+	e.team = nil
+	return unmarshal(&e.raw)
+}
+
+func (e authorEntry) MarshalYAML() (interface{}, error) {
+	if e.raw != nil {
+		return e.raw, nil
+	}
+	if e.team != nil {
+		return e.team, nil
+	}
+	return e.author.MarshalYAML()
+}
+
+// authorValue is a single author, either "Name; username" or structured (a
+// mapping with a `name`, see authorSpec)
+type authorValue struct {
+	author string
+	spec   *authorSpec
+}
+
+// authorSpec is a structured author, Meta holds free-form fields for templates,
+// Email and Key (the signing key), if set, are used as is (see ByInitials) and
+// NameFormat overrides the `name_format` of the file
+type authorSpec struct {
+	Name       string            `yaml:"name"`
+	Username   string            `yaml:"username,omitempty"`
+	Email      string            `yaml:"email,omitempty"`
+	Key        string            `yaml:"key,omitempty"`
+	NameFormat string            `yaml:"name_format,omitempty"`
+	Meta       map[string]string `yaml:"meta,omitempty"`
+}
+
+func (v *authorValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&v.author); err == nil {
+		return nil
+	}
+
+	// mappings without a name are teams
+	var fields map[string]interface{}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	if _, ok := fields["name"]; !ok {
+		return fmt.Errorf("author has no name")
+	}
+
+	v.spec = &authorSpec{}
+	return unmarshal(v.spec)
+}
+
+func (v authorValue) MarshalYAML() (interface{}, error) {
+	if v.spec != nil {
+		return v.spec, nil
+	}
+	return v.author, nil
+}
+
+// String returns the author as "Name; username"
+func (v authorValue) String() string {
+	if v.spec == nil {
+		return v.author
+	}
+	if v.spec.Username == "" {
+		return v.spec.Name
+	}
+	return fmt.Sprintf("%s; %s", v.spec.Name, v.spec.Username)
+}
+
+// structured returns the free-form fields, the explicit emails and signing
+// keys and the name formats of structured authors by initials
+func (g authorGroups) structured() (meta map[string]map[string]string, emails, keys, nameFormats map[string]string) {
+	meta, emails, keys, nameFormats = map[string]map[string]string{}, map[string]string{}, map[string]string{}, map[string]string{}
+	add := func(initials string, spec *authorSpec) {
+		if spec == nil {
+			return
+		}
+		meta[initials] = spec.Meta
+		if email := strings.TrimSpace(spec.Email); email != "" {
+			emails[initials] = email
+		}
+		if key := strings.TrimSpace(spec.Key); key != "" {
+			keys[initials] = key
+		}
+		if spec.NameFormat != "" {
+			nameFormats[initials] = spec.NameFormat
+		}
+	}
+
+	for key, entry := range g {
+		add(key, entry.author.spec)
+		for initials, author := range entry.team {
+			add(initials, author.spec)
+		}
+	}
+
+	return meta, emails, keys, nameFormats
+}
+
+// AuthorEntryError is a problem with a single author in the authors file
+type AuthorEntryError struct {
+	Initials string
+	Problem  string
+}
+
+func (e *AuthorEntryError) Error() string {
+	return fmt.Sprintf("author %s %s", e.Initials, e.Problem)
+}
+
+// entryErrors returns the problems with individual authors, by initials
+func (af *pairsFile) entryErrors() (errs []*AuthorEntryError) {
+	for key, entry := range af.Authors {
+		if entry.raw != nil {
+			errs = append(errs, &AuthorEntryError{Initials: key, Problem: "is neither a name nor a team of authors"})
+		}
+	}
+	for initials, author := range af.Pairs {
+		if name, _, _ := parseAuthor(author); name == "" {
+			errs = append(errs, &AuthorEntryError{Initials: initials, Problem: "has no name"})
+		} else if hasControlCharacters(author) {
+			errs = append(errs, &AuthorEntryError{Initials: initials, Problem: "contains control characters (e.g. a newline)"})
+		} else if err := checkNameFormat(af.NameFormats[initials]); err != nil {
+			errs = append(errs, &AuthorEntryError{Initials: initials, Problem: "has an " + err.Error()})
+		} else if email, ok := af.Emails[initials]; ok && !isEmailAddress(email) {
+			errs = append(errs, &AuthorEntryError{Initials: initials, Problem: fmt.Sprintf("has an invalid email %q", email)})
+		} else if entry, ok := af.EmailAddresses[initials]; ok && entry.problem() != "" {
+			errs = append(errs, &AuthorEntryError{Initials: initials, Problem: entry.problem()})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return CompareInitials(errs[i].Initials, errs[j].Initials) < 0 })
+
+	return errs
+}
+
+// flatten returns the authors by initials and the team of every grouped author
+// Returns an error if the same initials are used more than once.
+func (g authorGroups) flatten() (pairs, teams map[string]string, err error) {
+	keys := make([]string, 0, len(g))
+	grouped := false
+	for key, entry := range g {
+		keys = append(keys, key)
+		grouped = grouped || entry.team != nil
+	}
+	if grouped {
+		// only teams can clash, sorted so that the error is always the same
+		sort.Strings(keys)
+	}
+
+	pairs = make(map[string]string, len(g))
+	teams = map[string]string{}
+	seenIn := map[string]string{}
+	for _, key := range keys {
+		entry := g[key]
+		if entry.raw != nil {
+			continue
+		}
+		if entry.team == nil {
+			if team, ok := seenIn[key]; ok {
+				return nil, nil, fmt.Errorf("initials %s are used both at the top level and in team %s", key, team)
+			}
+			pairs[key] = entry.author.String()
+			continue
+		}
+
+		for initials, author := range entry.team {
+			if team, ok := seenIn[initials]; ok {
+				return nil, nil, fmt.Errorf("initials %s are used in both team %s and team %s", initials, team, key)
+			}
+			if _, ok := g[initials]; ok && g[initials].team == nil && g[initials].raw == nil {
+				return nil, nil, fmt.Errorf("initials %s are used both at the top level and in team %s", initials, key)
+			}
+			seenIn[initials] = key
+			pairs[initials] = author.String()
+			teams[initials] = key
+		}
+	}
+
+	return pairs, teams, nil
 }
 
 type emailConfig struct {
-	Prefix string
-	Domain string
+	Prefix string `yaml:",omitempty"`
+	Domain string `yaml:",omitempty"`
 }
 
-var pairsKey = regexp.MustCompile(`(?m)^pairs:`)
+// UnmarshalYAML also accepts the `git pair` shorthands for `email`, either
+// just the domain or a full address whose local part is used as the prefix
+// (e.g. `email: pair@example.com`)
+func (e *emailConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var shorthand string
+	if err := unmarshal(&shorthand); err == nil {
+		if at := strings.LastIndex(shorthand, "@"); at >= 0 {
+			e.Prefix, e.Domain = shorthand[:at], shorthand[at+1:]
+		} else {
+			e.Domain = shorthand
+		}
+		return nil
+	}
+
+	type plain emailConfig
+	return unmarshal((*plain)(e))
+}
 
 // NewPairsFromFile parses the given yml authors file (see README.md for file structure)
-// Uses emailLookup as external command to determine pair email address if set
-func NewPairsFromFile(filename string, emailLookup string) (a *Pairs, err error) {
-	af := &pairsFile{}
+// Uses emailLookup as external command to determine pair email address if set.
+// It is run with the initials, name and username of the author and:
+//   - exits 0 and prints an email: the email is used
+//   - exits 0 and prints nothing: falls through to the authors file
+//   - exits LookupNoEmailExitCode: definitively no email, falls through as well
+//   - exits otherwise: an error including its stderr, unless
+//     WithLookupFailureFallback is set (or failures are cached, see
+//     WithEmailLookupCache) in which case it falls through
+//
+// An EmailLookupFunc (see WithEmailLookupFunc) is consulted before it.
+//
+// Broken authors (see AuthorEntryError) fail the whole file unless
+// WithLenientEntries is set.
+func NewPairsFromFile(filename string, emailLookup string, opts ...Option) (a *Pairs, err error) {
+	return NewPairsFromFS(osFS{}, filename, emailLookup, opts...)
+}
+
+// NewPairsFromFS is NewPairsFromFile reading the authors file name (a path as
+// fs.FS expects them) from fsys instead of the OS filesystem. Symlinks are only
+// followed if fsys supports them, with Lstat and ReadLink methods (as does
+// fstest.MapFS in newer Go versions).
+func NewPairsFromFS(fsys fs.FS, name string, emailLookup string, opts ...Option) (a *Pairs, err error) {
+	return NewPairsFromLayers(fsys, []string{name}, emailLookup, opts...)
+}
+
+// NewPairsFromLayers is NewPairsFromFS reading a stack of authors files, lowest
+// first (e.g. the organization defaults, then the user's and the repository's
+// file). The authors and settings of each file override those of the files
+// below it (see pairsFile.overlay). Broken authors are reported against the
+// file they are in, Path is the last file.
+func NewPairsFromLayers(fsys fs.FS, names []string, emailLookup string, opts ...Option) (a *Pairs, err error) {
+	var (
+		af      *pairsFile
+		name    string
+		path    string
+		origins map[string]string
+		broken  []brokenEntry
+		// commands are the files with `lookup_overrides`, checked against
+		// the trusted files once the options are known
+		commands []commandsFile
+	)
+	for _, layerName := range names {
+		files, resolved, described, err := readAuthorsFileWithIncludes(fsys, layerName)
+		if err != nil {
+			return nil, err
+		}
+		// included files are layered under the file including them
+		for _, file := range files {
+			layer := file.af
+			if len(names) > 1 || len(files) > 1 {
+				layer.pinNameFormat()
+				// with a single file, every author comes from it
+				if origins == nil {
+					origins = map[string]string{}
+				}
+				for initials := range layer.Pairs {
+					origins[initials] = file.described
+				}
+			}
+			for _, entryErr := range layer.entryErrors() {
+				broken = append(broken, brokenEntry{file: file.described, err: entryErr})
+			}
+			if len(layer.LookupOverrides) > 0 {
+				commands = append(commands, commandsFile{layer: layerName, included: file.included, described: file.described})
+			}
+
+			if af == nil {
+				af = layer
+			} else {
+				af.overlay(layer)
+			}
+		}
+		name, path = described, resolved
+	}
+
+	a = &Pairs{
+		file:            af,
+		path:            path,
+		layers:          names,
+		origins:         origins,
+		emailLookup:     emailLookup,
+		concurrency:     DefaultLookupConcurrency,
+		hintLimit:       DefaultInitialsHintLimit,
+		ctx:             context.Background(),
+		resolverTimeout: DefaultResolverTimeout,
+		resolverBudget:  DefaultResolverBudget,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if c := a.lookupCache; c != nil && c.negativeTTL > c.ttl {
+		return nil, fmt.Errorf("failed email lookups would be cached for %s, longer than successful ones (%s)", c.negativeTTL, c.ttl)
+	}
+
+	for _, file := range commands {
+		why, untrusted := a.untrustedFiles[file.layer]
+		if file.included {
+			why, untrusted = "is included by another authors file", true
+		}
+		if untrusted && !a.trustCommands {
+			return nil, fmt.Errorf("could not parse %s: lookup_overrides are commands, which are only run from the authors files you set up ($GIT_DUET_AUTHORS_FILE, %s or ~/.git-authors) and this one %s; `git config --global %s true` trusts it",
+				file.described, AuthorsFileConfigKey, why, TrustAuthorsFileCommandsConfigKey)
+		}
+	}
+
+	for _, entry := range broken {
+		if !a.lenient {
+			return nil, fmt.Errorf("could not parse %s: %v", entry.file, entry.err)
+		}
+		// an author overridden by a higher file is not broken for anyone
+		if origins == nil || origins[entry.err.Initials] == entry.file {
+			delete(af.Pairs, entry.err.Initials)
+		}
+		a.warnings = append(a.warnings, fmt.Errorf("%s: %w, ignoring it", entry.file, entry.err))
+	}
+
+	if len(af.Pairs) == 0 {
+		if len(a.warnings) > 0 {
+			return nil, fmt.Errorf("could not parse %s: every author is broken", name)
+		}
+		return nil, &EmptyAuthorsFileError{Path: name}
+	}
 
-	file, err := os.Open(filename)
+	if err = af.checkUsernameResolvers(); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", name, err)
+	}
+
+	if !a.deferLookupCheck {
+		if err = a.checkLookupCommands(); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// readAuthorsFile reads and checks the authors file name in fsys, following
+// symlinks. Returns the file it resolved to and the name to use in errors.
+func readAuthorsFile(fsys fs.FS, name string) (af *pairsFile, resolved, described string, err error) {
+	// symlinks (e.g. into a dotfiles repo) are resolved to the real file
+	if resolved, err = resolveAuthorsFile(fsys, name); err != nil {
+		return nil, "", "", err
+	}
+	described = describeAuthorsFile(name, resolved)
+
+	contents, err := fs.ReadFile(fsys, resolved)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return nil, "", "", fmt.Errorf("could not open %s: %v", described, err)
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", "", fmt.Errorf("could not read %s: %v", described, err)
 	}
-	defer file.Close()
 
-	contents, err := ioutil.ReadAll(file)
+	format, err := authorsFileFormat(name, resolved)
 	if err != nil {
-		return nil, err
+		return nil, "", "", err
+	}
+	if af, err = decodeAuthorsFile(contents, format, described); err != nil {
+		return nil, "", "", err
 	}
+	return af, resolved, described, nil
+}
 
-	// Hack to also support `pairs:` as the key
-	contents = pairsKey.ReplaceAll(contents, []byte("authors:"))
+// decodeAuthorsFile parses and checks the contents of an authors file written
+// in format, naming it described in errors
+func decodeAuthorsFile(contents []byte, format, described string) (af *pairsFile, err error) {
+	if format == AuthorsFormatTOML {
+		if contents, err = tomlToYAML(contents); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", described, err)
+		}
+	}
 
-	err = yaml.Unmarshal(contents, &af)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse %s: %+v", filename, err)
+	// older layouts (e.g. `pairs:` as the key) are migrated to the current version
+	if af, _, err = parsePairsFile(contents); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", described, err)
+	}
+
+	if af.TrailerKey != "" {
+		if err = ValidateTrailerKey(af.TrailerKey); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", described, err)
+		}
+	}
+
+	if err = af.checkUsernameResolvers(); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", described, err)
 	}
 
-	return &Pairs{
-		file:        af,
-		emailLookup: emailLookup,
-	}, nil
+	if af.EmailTemplate != "" {
+		if _, err = parseEmailTemplate(emailTemplateKey, af.EmailTemplate, af.EmailTemplateStrict); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", described, err)
+		}
+	}
+
+	for initials, command := range af.LookupOverrides {
+		if _, err = splitCommand(command); err != nil {
+			return nil, fmt.Errorf("could not parse %s: lookup_overrides for %s: %v", described, initials, err)
+		}
+	}
+
+	return af, nil
 }
 
 var templateFuncs = template.FuncMap{
@@ -79,86 +668,675 @@ var templateFuncs = template.FuncMap{
 	"replace": strings.Replace,
 }
 
-func (a *Pairs) buildEmail(initials, name, username string) (email string, err error) {
-	if a.emailLookup != "" {
-		var out bytes.Buffer
+// buildEmail determines the email of pair (see ByInitials)
+func (a *Pairs) buildEmail(pair *Pair) (email string, err error) {
+	// the most deliberate choice, nothing else is consulted
+	if explicit, ok := a.file.Emails[pair.Initials]; ok {
+		a.debugf("using explicit email from author entry for %s\n", pair.Initials)
+		pair.EmailLabel = ""
+		email = explicit
+	} else if email, err = a.resolveEmail(pair); err != nil {
+		return "", err
+	}
 
-		cmd := exec.Command(a.emailLookup, initials, name, username)
-		cmd.Stdout = &out
+	if err = a.checkAllowedDomain(pair.Initials, email); err != nil {
+		return "", err
+	}
 
-		if err := cmd.Run(); err != nil {
-			return "", err
+	return email, nil
+}
+
+// checkAllowedDomain returns an error if `allowed_domains` is set and email
+// is not in one of them
+func (a *Pairs) checkAllowedDomain(initials, email string) error {
+	if len(a.file.AllowedDomains) == 0 {
+		return nil
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowed := range a.file.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return nil
 		}
+	}
 
-		email = strings.TrimSpace(out.String())
+	return fmt.Errorf("email %s for %s is not in an allowed domain (%s)",
+		email, initials, strings.Join(a.file.AllowedDomains, ", "))
+}
+
+func (a *Pairs) resolveEmail(pair *Pair) (email string, err error) {
+	initials, name, username := pair.Initials, pair.Name, pair.Username
+	// the requested label, replaced by the one picked if any
+	label := pair.EmailLabel
+	pair.EmailLabel = ""
+
+	for _, source := range a.emailLookups(initials) {
+		if email, err = a.runLookup(emailLookupKind, source, initials, name, username); err != nil {
+			return "", err
+		}
 		if email != "" {
 			return email, nil
 		}
 	}
 
 	if e, ok := a.file.EmailAddresses[initials]; ok {
-		email = e
-	} else if a.file.EmailTemplate != "" {
-		var out bytes.Buffer
-
-		t, err := template.New("email").Funcs(templateFuncs).Parse(a.file.EmailTemplate)
-		if err != nil {
+		if email, pair.EmailLabel, err = e.pick(initials, label); err != nil {
 			return "", err
 		}
-
-		if err = t.Execute(&out, Pair{Initials: initials, Name: name, Username: username}); err != nil {
+		if isEmailTemplate(email) {
+			tmpl := email
+			if email, err = a.renderEmailTemplate(emailAddressTemplateKey, tmpl, pair); err != nil {
+				return "", err
+			}
+			if email = strings.TrimSpace(email); !isEmailAddress(email) {
+				return "", fmt.Errorf("email_addresses template %q made up %q for %s, which is not an email address",
+					tmpl, email, initials)
+			}
+		}
+	} else if resolver := a.usernameResolver(); resolver != nil && username != "" && !strings.Contains(username, "@") {
+		if email, err = resolver(initials, username); err != nil {
 			return "", err
 		}
-		email = out.String()
-
+	} else if a.file.EmailTemplate != "" {
+		if email, err = a.renderEmailTemplate(emailTemplateKey, a.file.EmailTemplate, pair); err != nil {
+			return "", err
+		}
+	} else if strings.Contains(username, "@") {
+		email = strings.TrimSpace(username)
+		if !isEmailAddress(email) {
+			return "", fmt.Errorf("username %q for %s is not a valid email address", username, initials)
+		}
+	} else if a.file.Email.Domain == "" {
+		return "", noEmailDomain(initials)
 	} else if username != "" {
 		email = fmt.Sprintf("%s@%s", strings.TrimSpace(username), a.file.Email.Domain)
 	} else {
-		names := strings.SplitN(name, " ", 2)
-		if len(names) == 2 {
-			email = fmt.Sprintf(
-				"%c.%s@%s",
-				strings.ToLower(strings.TrimSpace(names[0]))[0],
-				strings.ToLower(strings.TrimSpace(names[1])),
-				a.file.Email.Domain)
-		} else {
-			email = fmt.Sprintf("%s@%s", strings.ToLower(strings.TrimSpace(names[0])), a.file.Email.Domain)
+		local := nameLocalPart(name)
+		if local == "" {
+			return "", fmt.Errorf("cannot make up an email for %s from %q: it has no letters or digits that can be spelled in ASCII", initials, name)
 		}
+		email = fmt.Sprintf("%s@%s", local, a.file.Email.Domain)
 	}
 
 	return email, nil
 }
 
-// ByInitials returns the pair with the given initials
+// nameLocalPart makes up the local part of an email from name: the first
+// letter of the first name, a dot and the rest of the name (e.g. j.doe), or
+// the name if it is a single word. Letters are spelled in ASCII and anything
+// but letters, digits, dots and hyphens is dropped (see sanitizeLocalPart).
+func nameLocalPart(name string) string {
+	words := strings.SplitN(transliterate(stripNameSuffix(name)), " ", 2)
+	if len(words) == 1 {
+		return sanitizeLocalPart(words[0])
+	}
+
+	rest := sanitizeLocalPart(words[1])
+	if first := sanitizeLocalPart(words[0]); first != "" && rest != "" {
+		return first[:1] + "." + rest
+	} else if rest == "" {
+		return first
+	}
+	return rest
+}
+
+// sanitizeLocalPart keeps the a-z, 0-9, dots and hyphens of s, collapsing
+// runs of dots and hyphens into their first one and trimming them from both
+// ends (so that "o'brien" is "obrien" and "r. ewing" is "r.ewing")
+func sanitizeLocalPart(s string) string {
+	var b strings.Builder
+	separated := true // no separator at the start
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			separated = false
+		case (r == '.' || r == '-') && !separated:
+			b.WriteRune(r)
+			separated = true
+		}
+	}
+	return strings.TrimRight(b.String(), ".-")
+}
+
+// isEmailAddress reports whether email looks like local@domain
+func isEmailAddress(email string) bool {
+	at := strings.Index(email, "@")
+	return at > 0 && at == strings.LastIndex(email, "@") && at < len(email)-1 &&
+		!strings.Contains(email, " ") && !hasControlCharacters(email)
+}
+
+// lookupCommand returns the email lookup command (and its arguments) for the
+// given initials, `lookup_overrides` take precedence over the global one and
+// an empty override skips the lookup. Returns nil if there is none.
+func (a *Pairs) lookupCommand(initials string) (command []string) {
+	if override, ok := a.file.LookupOverrides[initials]; ok {
+		if strings.TrimSpace(override) == "" {
+			a.debugf("skipping email lookup for %s as its lookup_overrides entry is empty\n", initials)
+			return nil
+		}
+		// validated when loading the file
+		command, _ = splitCommand(override)
+		command[0] = expandCommandPath(command[0])
+		a.debugf("using email lookup %q for %s from lookup_overrides\n", override, initials)
+		return command
+	}
+
+	if a.emailLookup == "" {
+		return nil
+	}
+	a.debugf("using email lookup %q for %s\n", a.emailLookup, initials)
+	return []string{a.emailLookup}
+}
+
+// emailLookups returns the ways of looking up the email of the given
+// initials, in order: the email lookup function then the email lookup command
+// (or the `lookup_overrides` command for them alone, see lookupCommand)
+func (a *Pairs) emailLookups(initials string) (sources []lookupSource) {
+	if _, overridden := a.file.LookupOverrides[initials]; !overridden && a.emailLookupFunc != nil {
+		a.debugf("using the email lookup function for %s\n", initials)
+		source := lookupSource{lookup: a.emailLookupFunc}
+		if a.emailLookupFuncID != "" {
+			source.id = lookupFuncPrefix + a.emailLookupFuncID
+		}
+		sources = append(sources, source)
+	}
+	if command := a.lookupCommand(initials); command != nil {
+		sources = append(sources, commandLookup(emailLookupKind, command))
+	}
+	return sources
+}
+
+// checkLookupCommands checks the global email lookup command and the first word
+// of every `lookup_overrides` command can be run (see checkLookupCommand)
+func (a *Pairs) checkLookupCommands() error {
+	if a.emailLookup != "" {
+		if err := checkLookupCommand(a.emailLookup, "", emailLookupKind); err != nil {
+			return err
+		}
+	}
+	if a.keyLookup != "" {
+		if err := checkLookupCommand(a.keyLookup, "", keyLookupKind); err != nil {
+			return err
+		}
+	}
+
+	initials := make([]string, 0, len(a.file.LookupOverrides))
+	for i := range a.file.LookupOverrides {
+		initials = append(initials, i)
+	}
+	sort.Strings(initials)
+	for _, i := range initials {
+		// validated when loading the file, empty ones skip the lookup
+		command, _ := splitCommand(a.file.LookupOverrides[i])
+		if len(command) == 0 {
+			continue
+		}
+		if err := checkLookupCommand(expandCommandPath(command[0]), "lookup_overrides for "+i, emailLookupKind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// What lookup commands look up, in errors and debug output
+const (
+	emailLookupKind = "email"
+	keyLookupKind   = "signing key"
+)
+
+// LookupFailedError is returned when the email (or signing key, see
+// WithKeyLookup) lookup command fails (other than with LookupNoEmailExitCode),
+// Stderr is what it printed there and Lookup what it looks up ("email" if
+// empty)
+type LookupFailedError struct {
+	Initials string
+	Lookup   string
+	Err      error
+	Stderr   string
+}
+
+func (e *LookupFailedError) Error() string {
+	lookup := e.Lookup
+	if lookup == "" {
+		lookup = emailLookupKind
+	}
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s lookup for %s failed: %v", lookup, e.Initials, e.Err)
+	}
+	return fmt.Sprintf("%s lookup for %s failed: %v: %s", lookup, e.Initials, e.Err, e.Stderr)
+}
+
+// runLookup looks up an email or signing key (lookup) with source,
+// consulting the lookup cache first if there is one. Returns an empty result
+// if the lookup should fall through.
+func (a *Pairs) runLookup(lookup string, source lookupSource, initials, name, username string) (result string, err error) {
+	cacheID := source.id
+	if lookup != emailLookupKind {
+		// kept apart from emails even if the same command looks up both
+		cacheID = lookup + "\x00" + cacheID
+	}
+	key := lookupCacheKey(cacheID, initials, name, username)
+	cache := a.lookupCache
+	if source.id == "" {
+		cache = nil
+	}
+	if cache != nil {
+		if entry, ok := cache.get(key); ok {
+			if entry.Error == "" {
+				return entry.result(lookup), nil
+			}
+			err = &LookupFailedError{Initials: initials, Lookup: lookup, Err: errors.New(entry.Error), Stderr: entry.Stderr}
+			a.debugf("skipping %s lookup for %s, it failed recently: %v\n", lookup, initials, err)
+			if !a.lookupFallback {
+				return "", err
+			}
+			return "", nil
+		}
+	}
+
+	ctx := a.ctx
+	if a.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.lookupTimeout)
+		defer cancel()
+	}
+
+	result, err = source.lookup(ctx, initials, name, username)
+	if err == nil && hasControlCharacters(strings.TrimSpace(result)) {
+		err = fmt.Errorf("answered %q, which contains control characters", result)
+	}
+	if err != nil {
+		failed := &LookupFailedError{Initials: initials, Lookup: lookup, Err: err}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			failed.Err = fmt.Errorf("no answer within %s", a.lookupTimeout)
+			err = failed
+		} else if !errors.As(err, &failed) {
+			err = failed
+		}
+		if cache != nil && cache.negativeTTL > 0 {
+			a.cacheLookup(key, lookupCacheEntry{Error: failed.Err.Error(), Stderr: failed.Stderr})
+		}
+		if !a.lookupFallback {
+			return "", err
+		}
+		a.debugf("%v, falling back to the authors file\n", err)
+		return "", nil
+	}
+	result = strings.TrimSpace(result)
+
+	if cache != nil && cache.ttl > 0 {
+		a.cacheLookup(key, newLookupCacheEntry(lookup, result))
+	}
+
+	return result, nil
+}
+
+// cacheLookup stores a lookup result, failing to write the cache only costs a
+// lookup next time so it is merely reported
+func (a *Pairs) cacheLookup(key string, entry lookupCacheEntry) {
+	if err := a.lookupCache.put(key, entry); err != nil {
+		a.debugf("could not write email lookup cache: %v\n", err)
+	}
+}
+
+func (a *Pairs) debugf(format string, args ...interface{}) {
+	if a.debug != nil {
+		fmt.Fprintf(a.debug, format, args...)
+	}
+}
+
+// hasControlCharacters reports whether s contains control characters, which
+// could forge extra lines (e.g. trailers) wherever s is written
+func hasControlCharacters(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
+
+// parseAuthor splits an author entry ("Name; username; extra; ...") into its
+// parts, trailing empty fields (e.g. from "Jane Doe; jdoe;") are ignored
+func parseAuthor(pairString string) (name, username string, extra []string) {
+	pairParts := strings.Split(pairString, ";")
+	for i := range pairParts {
+		pairParts[i] = strings.TrimSpace(pairParts[i])
+	}
+	for len(pairParts) > 1 && pairParts[len(pairParts)-1] == "" {
+		pairParts = pairParts[:len(pairParts)-1]
+	}
+
+	name = pairParts[0]
+	if len(pairParts) > 1 {
+		username = pairParts[1]
+	}
+	if len(pairParts) > 2 {
+		extra = pairParts[2:]
+	}
+	return name, username, extra
+}
+
+// ByInitials returns the pair with the given initials (see WithPrefixMatching)
 // The email is determined from the first non-empty value during the following steps:
+// - Use `email` of a structured author entry as is, nothing else is consulted
 // - Run external lookup if provided during initialization
-// - Pull from `email_addresses` map in config
+// - Pull from `email_addresses` map in config (see WithEmailLabel)
+// - Look up the username on GitHub or GitLab if `github_noreply` or `gitlab` is set
 // - Build using `email_template` if provided
-// - Build using username (if provided) and domain
+// - Use the username (if provided) as is if it contains an @, otherwise build using it and domain
 // - If two names, build using first initial followed by . followed by last name and domain
 // - If one name, build using name followed by domain
+// If `allowed_domains` is set, the email must be in one of them regardless of
+// which step produced it. In private mode, the email is then replaced by a
+// noreply-style address (see WithPrivateEmail) and kept as RealEmail.
 func (a *Pairs) ByInitials(initials string) (pair *Pair, err error) {
-	pairString, ok := a.file.Pairs[initials]
-	if !ok {
-		return nil, fmt.Errorf("unknown initials %s", initials)
+	return a.byInitials(initials, a.emailLabel)
+}
+
+func (a *Pairs) byInitials(initials, label string) (pair *Pair, err error) {
+	if initials, err = a.resolveInitials(initials); err != nil {
+		return nil, err
 	}
 
-	pairParts := strings.SplitN(pairString, ";", 2)
-	name := strings.TrimSpace(pairParts[0])
-	username := ""
-	if len(pairParts) == 2 {
-		username = strings.TrimSpace(pairParts[1])
+	name, username, extra := a.file.author(initials)
+	pair = &Pair{
+		Name:       name,
+		Username:   username,
+		Initials:   initials,
+		Team:       a.file.Teams[initials],
+		Extra:      extra,
+		Meta:       a.file.Meta[initials],
+		EmailLabel: label,
 	}
 
-	email, err := a.buildEmail(initials, name, username)
-	if err != nil {
+	if pair.Email, err = a.buildEmail(pair); err != nil {
+		return nil, err
+	}
+	if a.file.PrivateEmail.enabled {
+		pair.RealEmail = pair.Email
+		if pair.Email, err = a.privateEmail(pair); err != nil {
+			return nil, err
+		}
+	}
+	if pair.SigningKey, err = a.resolveSigningKey(pair); err != nil {
 		return nil, err
 	}
 
-	return &Pair{
-		Name:     name,
-		Email:    email,
-		Username: username,
-		Initials: initials,
-	}, nil
+	return pair, nil
+}
+
+// resolveSigningKey determines the signing key of pair: the `key` of its
+// author entry, otherwise the one the signing key lookup command prints (see
+// WithKeyLookup), otherwise its entry in `signing_keys`. Returns an empty key
+// if none has one.
+func (a *Pairs) resolveSigningKey(pair *Pair) (key string, err error) {
+	// like an explicit email, nothing else is consulted
+	if key, ok := a.file.Keys[pair.Initials]; ok {
+		a.debugf("using explicit signing key from author entry for %s\n", pair.Initials)
+		return key, nil
+	}
+	if a.keyLookup == "" && len(a.file.SigningKeys) == 0 {
+		return "", nil
+	}
+
+	if a.keyLookup != "" {
+		a.debugf("using signing key lookup %q for %s\n", a.keyLookup, pair.Initials)
+		if key, err = a.runLookup(keyLookupKind, commandLookup(keyLookupKind, []string{a.keyLookup}), pair.Initials, pair.Name, pair.Username); err != nil {
+			return "", err
+		}
+		if key != "" {
+			return key, nil
+		}
+		a.debugf("signing key lookup has no key for %s\n", pair.Initials)
+	}
+
+	if key = strings.TrimSpace(a.file.SigningKeys[pair.Initials]); key != "" {
+		a.debugf("using signing key from signing_keys for %s\n", pair.Initials)
+		return key, nil
+	}
+	a.debugf("no signing key for %s\n", pair.Initials)
+	return "", nil
+}
+
+// PairEmail builds the shared email `git pair` uses for a pair from the
+// configured prefix and domain, e.g. pair+eh+js@example.com (initials sorted)
+// Returns an error if the authors file does not set an email prefix or domain.
+func (a *Pairs) PairEmail(pairs ...*Pair) (email string, err error) {
+	if a.file.Email.Prefix == "" {
+		return "", fmt.Errorf("no email prefix configured")
+	}
+	if a.file.Email.Domain == "" {
+		return "", fmt.Errorf("no email domain configured")
+	}
+
+	initials := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		initials = append(initials, p.Initials)
+	}
+	sort.Strings(initials)
+
+	return fmt.Sprintf("%s+%s@%s",
+		a.file.Email.Prefix, strings.Join(initials, "+"), a.file.Email.Domain), nil
+}
+
+// AuthorErrors collects the problems resolving several authors, by initials
+type AuthorErrors struct {
+	Initials []string
+	Errors   map[string]error
+}
+
+func (e *AuthorErrors) Error() string {
+	messages := make([]string, 0, len(e.Initials))
+	for _, initials := range e.Initials {
+		messages = append(messages, e.Errors[initials].Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ByInitialsMany returns the pairs with the given initials in the same order
+// Emails are resolved concurrently (see WithLookupConcurrency). If any fail,
+// returns an *AuthorErrors listing every failure in the order given. Unless
+// WithDuplicatePeople is set, returns a *DuplicatePersonError if someone would
+// be in the pair twice (see CheckDistinctPeople).
+func (a *Pairs) ByInitialsMany(initials ...string) (pairs []*Pair, err error) {
+	if pairs, err = a.resolveMany(initials); err != nil {
+		return nil, err
+	}
+
+	if !a.duplicatePeople {
+		if err = CheckDistinctPeople(pairs); err != nil {
+			return nil, err
+		}
+	}
+
+	return pairs, nil
+}
+
+// InvertRoles returns people in reverse order, so that the last one becomes
+// the author and the first one the last committer. For two people it swaps the
+// author and the committer.
+func InvertRoles(people []*Pair) []*Pair {
+	inverted := make([]*Pair, len(people))
+	for i, person := range people {
+		inverted[len(people)-1-i] = person
+	}
+	return inverted
+}
+
+// resolveMany is ByInitialsMany without the check for duplicate people
+func (a *Pairs) resolveMany(initials []string) (pairs []*Pair, err error) {
+	pairs, errs := a.resolveEach(initials)
+
+	var authorErrs *AuthorErrors
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if authorErrs == nil {
+			authorErrs = &AuthorErrors{Errors: map[string]error{}}
+		}
+		if _, seen := authorErrs.Errors[initials[i]]; !seen {
+			authorErrs.Initials = append(authorErrs.Initials, initials[i])
+			authorErrs.Errors[initials[i]] = err
+		}
+	}
+	if authorErrs != nil {
+		return nil, authorErrs
+	}
+
+	return pairs, nil
+}
+
+// resolveEach resolves the given initials concurrently (see
+// WithLookupConcurrency), errs[i] being the error resolving initials[i] if
+// pairs[i] is nil
+func (a *Pairs) resolveEach(initials []string) (pairs []*Pair, errs []error) {
+	pairs = make([]*Pair, len(initials))
+	errs = make([]error, len(initials))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < a.concurrency && w < len(initials); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				pairs[i], errs[i] = a.ByInitials(initials[i])
+			}
+		}()
+	}
+	for i := range initials {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return pairs, errs
+}
+
+// Validate resolves every author in the authors file and returns the problems
+// found (e.g. emails outside of `allowed_domains`, emails that are not email
+// addresses or usernames holding an email that disagrees with
+// `email_addresses`), in order of initials, after the
+// Warnings. For a stack of files (see NewPairsFromLayers) the problems are
+// those of the merged view, each a *LayerError naming the file the author
+// comes from.
+func (a *Pairs) Validate() (errs []error) {
+	errs = append(errs, a.warnings...)
+	var noDomain []string
+	for _, i := range a.Initials() {
+		if _, username, _ := parseAuthor(a.file.Pairs[i]); strings.Contains(username, "@") {
+			if entry, ok := a.file.EmailAddresses[i]; ok && !containsFold(entry.all(), username) {
+				errs = append(errs, a.attribute(i, fmt.Errorf("username %s for %s conflicts with email_addresses entry %s",
+					username, i, strings.Join(entry.all(), ", "))))
+			}
+		}
+		var domainErr *NoEmailDomainError
+		if pair, err := a.ByInitials(i); errors.As(err, &domainErr) {
+			// reported once for the whole file
+			noDomain = append(noDomain, i)
+		} else if err != nil {
+			errs = append(errs, a.attribute(i, err))
+		} else if !isEmailAddress(pair.Email) {
+			// e.g. an email lookup answering something else
+			errs = append(errs, a.attribute(i, fmt.Errorf("email %q for %s is not a valid email address", pair.Email, i)))
+		}
+	}
+	if len(noDomain) > 0 {
+		errs = append(errs, noEmailDomain(noDomain...))
+	}
+
+	return errs
+}
+
+// attribute wraps err, a problem with the author with the given initials, in
+// a *LayerError if there is more than one authors file
+func (a *Pairs) attribute(initials string, err error) error {
+	if len(a.layers) < 2 {
+		return err
+	}
+	return &LayerError{File: a.origins[initials], Err: err}
+}
+
+// Warnings returns the authors left out when loading WithLenientEntries
+func (a *Pairs) Warnings() []error {
+	return a.warnings
+}
+
+// Teams returns the names of the teams authors are grouped into, sorted
+func (a *Pairs) Teams() (teams []string) {
+	seen := map[string]bool{}
+	for _, team := range a.file.Teams {
+		if !seen[team] {
+			seen[team] = true
+			teams = append(teams, team)
+		}
+	}
+	sortInitials(teams)
+
+	return teams
+}
+
+// Path returns the path the authors file was read from, with symlinks resolved
+// (its name in the fs.FS for NewPairsFromFS)
+func (a *Pairs) Path() string {
+	return a.path
+}
+
+// TrailerKey returns the co-author trailer key configured in the authors file
+// (empty if not set)
+func (a *Pairs) TrailerKey() string {
+	return a.file.TrailerKey
+}
+
+// All returns every author in the authors file sorted by initials
+func (a *Pairs) All() (pairs []*Pair, err error) {
+	return a.AllInTeam("")
+}
+
+// AllInTeam returns the authors of the given team sorted by initials
+// An empty team returns every author.
+func (a *Pairs) AllInTeam(team string) (pairs []*Pair, err error) {
+	initials := make([]string, 0, len(a.file.Pairs))
+	for i := range a.file.Pairs {
+		if team == "" || a.file.Teams[i] == team {
+			initials = append(initials, i)
+		}
+	}
+	sortInitials(initials)
+
+	// aliased authors sharing an address are listed separately
+	return a.resolveMany(initials)
+}
+
+// Search returns the authors whose initials, name, username or team contain
+// query, ignoring case and accents, sorted by initials. An empty query returns
+// every author. Emails are only resolved if resolveEmails is set, which runs
+// the email lookups; otherwise they are left empty.
+func (a *Pairs) Search(query string, resolveEmails bool) (pairs []*Pair, err error) {
+	query = sortKey(strings.TrimSpace(query))
+	var initials []string
+	for i := range a.file.Pairs {
+		name, username, _ := a.file.author(i)
+		for _, field := range []string{i, name, username, a.file.Teams[i]} {
+			if strings.Contains(sortKey(field), query) {
+				initials = append(initials, i)
+				break
+			}
+		}
+	}
+	sortInitials(initials)
+
+	if resolveEmails {
+		return a.resolveMany(initials)
+	}
+	for _, i := range initials {
+		name, username, extra := a.file.author(i)
+		pairs = append(pairs, &Pair{
+			Name:     name,
+			Username: username,
+			Initials: i,
+			Team:     a.file.Teams[i],
+			Extra:    extra,
+			Meta:     a.file.Meta[i],
+		})
+	}
+	return pairs, nil
 }
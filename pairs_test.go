@@ -0,0 +1,140 @@
+package duet
+
+import (
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestNewPairsFromFS(t *testing.T) {
+	files := fstest.MapFS{
+		"authors.yml": {Data: []byte(testAuthorsFile)},
+		"authors.toml": {Data: []byte(`[authors]
+jd = "Jane Doe; jane"
+fb = "Frances Bar"
+
+[email]
+domain = "hamster.info.local"
+`)},
+		"dotfiles/git-authors": {Data: []byte(testAuthorsFile)},
+		"link.yml":             {Data: []byte("dotfiles/git-authors"), Mode: fs.ModeSymlink},
+	}
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"yaml", "authors.yml"},
+		{"toml", "authors.toml"},
+		{"symlink", "link.yml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			if _, links := fs.FS(files).(readLinkFS); !links && tt.name == "symlink" {
+				t.Skip("fstest.MapFS has no symlinks before Go 1.25")
+			}
+
+			pairs, err := NewPairsFromFS(files, tt.file, "")
+			if err != nil {
+				t.Fatalf("NewPairsFromFS: %v", err)
+			}
+			for initials, want := range map[string]string{
+				"jd": "Jane Doe <jane@hamster.info.local>",
+				"fb": "Frances Bar <f.bar@hamster.info.local>",
+			} {
+				pair, err := pairs.ByInitials(initials)
+				if err != nil {
+					t.Fatalf("ByInitials(%s): %v", initials, err)
+				}
+				if got := pair.Name + " <" + pair.Email + ">"; got != want {
+					t.Errorf("ByInitials(%s) = %s, want %s", initials, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPairsFromFSErrors(t *testing.T) {
+	files := fstest.MapFS{
+		"broken.yml": {Data: []byte("authors: [\n")},
+		"empty.yml":  {Data: []byte("email:\n  domain: hamster.info.local\n")},
+	}
+
+	tests := []struct {
+		name, file, want string
+	}{
+		{"missing", "missing.yml", "missing.yml: file does not exist"},
+		{"invalid", "broken.yml", "could not parse broken.yml"},
+		{"no authors", "empty.yml", "empty.yml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+
+			_, err := NewPairsFromFS(files, tt.file, "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("NewPairsFromFS: got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetaRoundTrip(t *testing.T) {
+	isolate(t)
+	files := fstest.MapFS{"authors.yml": {Data: []byte(`authors:
+  jd:
+    name: Jane Doe
+    username: jdoe
+    meta:
+      ghe_login: jane-d
+      motto: "yes: # not a comment"
+      empty: ""
+  platform:
+    fb:
+      name: Frances Bar
+      meta:
+        office: Zürich
+        floor: "3"
+    on: Oscar
+email:
+  domain: hamster.info.local
+`)}}
+	want := map[string]map[string]string{
+		"jd": {"ghe_login": "jane-d", "motto": "yes: # not a comment", "empty": ""},
+		"fb": {"office": "Zürich", "floor": "3"},
+		"on": nil,
+	}
+
+	pairs, err := NewPairsFromFS(files, "authors.yml", "")
+	if err != nil {
+		t.Fatalf("NewPairsFromFS: %v", err)
+	}
+	written, err := yaml.Marshal(pairs)
+	if err != nil {
+		t.Fatalf("yaml.Marshal: %v", err)
+	}
+	reread, err := NewPairsFromFS(fstest.MapFS{"authors.yml": {Data: written}}, "authors.yml", "")
+	if err != nil {
+		t.Fatalf("NewPairsFromFS(written):\n%s\n%v", written, err)
+	}
+
+	for initials, meta := range want {
+		pair, err := reread.ByInitials(initials)
+		if err != nil {
+			t.Fatalf("ByInitials(%s): %v", initials, err)
+		}
+		if !reflect.DeepEqual(pair.Meta, meta) {
+			t.Errorf("ByInitials(%s).Meta = %q, want %q after writing\n%s", initials, pair.Meta, meta, written)
+		}
+	}
+	if rewritten, err := yaml.Marshal(reread); err != nil || string(rewritten) != string(written) {
+		t.Errorf("writing again = %s, %v, want\n%s", rewritten, err, written)
+	}
+}
@@ -0,0 +1,81 @@
+package duet
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var windowsEnvRegexp = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_()]*)%`)
+
+// ExpandPath expands a path given by the user (in the environment, git config
+// or the authors file): a leading `~` or `~user`, where the home directory can
+// be found, and Windows-style `%VAR%` references to variables that are set.
+// The result is cleaned, anything that cannot be expanded is left as is.
+func ExpandPath(file string) string {
+	if file == "" {
+		return ""
+	}
+
+	file = windowsEnvRegexp.ReplaceAllStringFunc(file, func(ref string) string {
+		if value, ok := os.LookupEnv(ref[1 : len(ref)-1]); ok {
+			return value
+		}
+		return ref
+	})
+
+	if strings.HasPrefix(file, "~") {
+		name, rest := file[1:], ""
+		if i := strings.IndexAny(name, `/\`); i >= 0 {
+			name, rest = name[:i], name[i:]
+		}
+		if home := homeDir(name); home != "" {
+			file = home + rest
+		}
+	}
+
+	return filepath.Clean(file)
+}
+
+// expandCommandPath is ExpandPath for commands, left untouched unless something
+// was expanded as cleaning would turn `./lookup` into a command found in $PATH
+func expandCommandPath(command string) string {
+	if isExpanded(command) {
+		return ExpandPath(command)
+	}
+	return command
+}
+
+// isExpanded reports whether ExpandPath does more to file than cleaning it
+func isExpanded(file string) bool {
+	return file != "" && ExpandPath(file) != filepath.Clean(file)
+}
+
+// describeExpandedPath names a path given by the user in errors, expanded, and
+// as given if ExpandPath changed more than cleaning it
+func describeExpandedPath(original, expanded string) string {
+	if !isExpanded(original) {
+		return expanded
+	}
+	return expanded + " (expanded from " + original + ")"
+}
+
+// homeDir returns the home directory of the named user, or the current one if
+// name is empty, and an empty string if it cannot be found
+func homeDir(name string) string {
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		return home
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return ""
+	}
+	return u.HomeDir
+}
@@ -0,0 +1,166 @@
+package duet
+
+import (
+	"strings"
+	"unicode"
+)
+
+// plainSections are the top-level keys of an authors file that grow with the
+// roster, which splitPlainSections reads without the YAML decoder: decoding
+// thousands of authors is the bulk of loading a large roster
+var plainSections = map[string]bool{"authors": true, "pairs": true, "email_addresses": true}
+
+// splitPlainSections takes the plain sections (see plainSections) out of
+// contents, blanking their lines so that errors in the rest keep their line
+// numbers, and returns them as maps of initials to values. A section holding
+// anything but `initials: value` lines at a single indentation (teams,
+// structured authors, labeled addresses, quoted values...) is left in rest
+// for the YAML decoder, and so is any key given twice.
+func splitPlainSections(contents []byte) (rest []byte, sections map[string]map[string]string) {
+	lines := strings.Split(string(contents), "\n")
+	seen := map[string]bool{}
+	var blank []int
+
+	for start := 0; start < len(lines); start++ {
+		if isIndentedOrBlank(lines[start]) {
+			continue
+		}
+		key := strings.SplitN(lines[start], ":", 2)[0]
+		if seen[key] && plainSections[key] {
+			// left to the YAML decoder to make sense of
+			return contents, nil
+		}
+		seen[key] = true
+		section, ok := plainSection(lines[start])
+		if !ok || !plainSections[section] {
+			continue
+		}
+
+		entries := make(map[string]string, (len(lines)-start)/2)
+		indent, end := "", start+1
+		for ; end < len(lines) && isIndentedOrBlank(lines[end]); end++ {
+			if trimmed := strings.TrimSpace(lines[end]); trimmed == "" || trimmed[0] == '#' {
+				continue
+			}
+			entryIndent, initials, value, ok := plainEntry(lines[end])
+			if !ok || (indent != "" && entryIndent != indent) || isYAMLNull(initials) || isYAMLNull(value) {
+				entries = nil
+				break
+			}
+			indent = entryIndent
+			entries[initials] = value
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		if sections == nil {
+			sections = map[string]map[string]string{}
+		}
+		sections[section] = entries
+		for i := start; i < end; i++ {
+			blank = append(blank, i)
+		}
+		start = end - 1
+	}
+
+	if sections == nil {
+		return contents, nil
+	}
+	for _, i := range blank {
+		lines[i] = ""
+	}
+	return []byte(strings.Join(lines, "\n")), sections
+}
+
+// setPlainSections sets the sections splitPlainSections took out of the file
+func (af *pairsFile) setPlainSections(sections map[string]map[string]string) {
+	authorsOf := func(entries map[string]string) authorGroups {
+		authors := make(authorGroups, len(entries))
+		for initials, author := range entries {
+			authors[initials] = authorEntry{author: authorValue{author: author}}
+		}
+		return authors
+	}
+
+	if entries, ok := sections["authors"]; ok {
+		af.Authors = authorsOf(entries)
+	}
+	if entries, ok := sections["pairs"]; ok {
+		af.LegacyPairs = authorsOf(entries)
+	}
+	if entries, ok := sections["email_addresses"]; ok {
+		af.EmailAddresses = make(map[string]emailAddresses, len(entries))
+		for initials, address := range entries {
+			af.EmailAddresses[initials] = emailAddresses{address: address}
+		}
+	}
+}
+
+// plainSection returns the key of a `key:` line starting a section, optionally
+// followed by a comment
+func plainSection(line string) (key string, ok bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return "", false
+	}
+	for _, c := range line[:colon] {
+		if (c < 'a' || c > 'z') && c != '_' {
+			return "", false
+		}
+	}
+	rest := strings.TrimLeft(line[colon+1:], " ")
+	return line[:colon], rest == "" || rest[0] == '#'
+}
+
+// plainEntry splits an `initials: value` line of a plain section, the value
+// being a plain scalar YAML decodes as its text (no quotes, flow collections,
+// anchors, tags or anything taken for a comment or a key), optionally
+// followed by a comment
+func plainEntry(line string) (indent, initials, value string, ok bool) {
+	rest := strings.TrimLeft(line, " ")
+	indent = line[:len(line)-len(rest)]
+	colon := strings.IndexByte(rest, ':')
+	if indent == "" || colon <= 0 || !strings.HasPrefix(rest[colon+1:], " ") {
+		return "", "", "", false
+	}
+	initials, value = rest[:colon], rest[colon+1:]
+	for _, c := range initials {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return "", "", "", false
+		}
+	}
+	if comment := strings.Index(value, " #"); comment >= 0 {
+		value = value[:comment]
+	}
+	value = strings.Trim(value, " ")
+	if value == "" {
+		return "", "", "", false
+	}
+	for i, c := range value {
+		if c < 0x80 && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			continue
+		}
+		if i > 0 && c < 0x80 && strings.ContainsRune(" ;.@+'(),/-", c) {
+			continue
+		}
+		if c >= 0x80 && (unicode.IsLetter(c) || unicode.IsNumber(c) || (i > 0 && unicode.IsMark(c))) {
+			continue
+		}
+		return "", "", "", false
+	}
+	return indent, initials, value, true
+}
+
+func isIndentedOrBlank(line string) bool {
+	return line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#'
+}
+
+// isYAMLNull reports whether YAML decodes the plain scalar s as null
+func isYAMLNull(s string) bool {
+	switch s {
+	case "null", "Null", "NULL":
+		return true
+	}
+	return false
+}
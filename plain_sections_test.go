@@ -0,0 +1,74 @@
+package duet
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSplitPlainSections(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  string
+		wantPlain bool
+	}{
+		{
+			name:      "plain authors and addresses",
+			contents:  "authors:\n  jd: Jane Doe; jane\n  # a comment\n\n  fb: Frances Bar # her\n  a-b: O'Brien, Pat (contractor)\n  y: Zoë Ñúñez\nemail:\n  domain: example.com\nemail_addresses:\n  jd: jane@example.com\n",
+			wantPlain: true,
+		},
+		{
+			name:      "legacy pairs",
+			contents:  "pairs:\n  jd: Jane Doe; jane\n  no: 1st Person\n  on: 0x1F\nemail: pair@example.com\n",
+			wantPlain: true,
+		},
+		{
+			name:      "combining marks",
+			contents:  "authors:\n  zd: Zoë Doe\n",
+			wantPlain: true,
+		},
+		{
+			name:      "empty section",
+			contents:  "authors: # none yet\n  # jd: Jane Doe\nemail_addresses:\n  jd: jane@example.com\n",
+			wantPlain: true,
+		},
+		{name: "quoted value", contents: "authors:\n  jd: \"Jane Doe\"\n"},
+		{name: "value with a colon", contents: "authors:\n  jd: Jane:Doe\n"},
+		{name: "value with a key", contents: "authors:\n  jd: Jane: Doe\n"},
+		{name: "value with a hash", contents: "authors:\n  jd: Jane#1\n"},
+		{name: "null value", contents: "authors:\n  jd: null\n  fb: Frances Bar\n"},
+		{name: "team", contents: "authors:\n  api:\n    jd: Jane Doe\n"},
+		{name: "structured author", contents: "authors:\n  jd: {name: Jane Doe}\n"},
+		{name: "labeled addresses", contents: "email_addresses:\n  jd:\n    work: jane@example.com\n"},
+		{name: "mixed indentation", contents: "authors:\n  jd: Jane Doe\n   fb: Frances Bar\n"},
+		{name: "emoji", contents: "authors:\n  jd: Jane 🙂\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, sections := splitPlainSections([]byte(tt.contents))
+			if plain := sections != nil; plain != tt.wantPlain {
+				t.Fatalf("splitPlainSections took plain sections: %t, want %t", plain, tt.wantPlain)
+			}
+
+			split, decoded := &pairsFile{}, &pairsFile{}
+			splitErr, decodedErr := yaml.Unmarshal(rest, split), yaml.Unmarshal([]byte(tt.contents), decoded)
+			if !reflect.DeepEqual(splitErr, decodedErr) {
+				t.Fatalf("decoding the rest: %v, want %v", splitErr, decodedErr)
+			}
+			split.setPlainSections(sections)
+			if decodedErr == nil && !reflect.DeepEqual(split, decoded) {
+				t.Errorf("split file = %#v, want %#v", split, decoded)
+			}
+		})
+	}
+}
+
+func TestSplitPlainSectionsKeepsDuplicates(t *testing.T) {
+	contents := "authors:\n  jd: Jane Doe\nauthors:\n  fb: Frances Bar\n"
+	rest, sections := splitPlainSections([]byte(contents))
+	if sections != nil || string(rest) != contents {
+		t.Errorf("splitPlainSections took %v, want the file left to the YAML decoder", sections)
+	}
+}
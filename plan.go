@@ -0,0 +1,158 @@
+package duet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Kinds of PlannedChange
+const (
+	// ChangeSetConfig sets the git config key Target (`scope:key`) to NewValue
+	ChangeSetConfig = "set-config"
+	// ChangeUnsetConfig removes every value of the git config key Target
+	ChangeUnsetConfig = "unset-config"
+	// ChangeWriteFile replaces the contents of the file Target by NewValue
+	ChangeWriteFile = "write-file"
+	// ChangeRenameFile renames the file Target to NewValue
+	ChangeRenameFile = "rename-file"
+	// ChangeCreateDirectory creates the directory Target and its parents
+	ChangeCreateDirectory = "create-directory"
+)
+
+// PlannedChange is a change a dry run would have made (see Plan). OldValue is
+// what is replaced: the previous value of a config key or contents of a file.
+type PlannedChange struct {
+	Kind     string `json:"kind"`
+	Target   string `json:"target"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// String describes the change as the command that would make it
+func (c PlannedChange) String() string {
+	switch c.Kind {
+	case ChangeSetConfig, ChangeUnsetConfig:
+		parts := strings.SplitN(c.Target, ":", 2)
+		command := fmt.Sprintf("git config --%s", parts[0])
+		if c.Kind == ChangeUnsetConfig {
+			return fmt.Sprintf("%s --unset-all %s", command, parts[1])
+		}
+		return fmt.Sprintf("%s %s %s", command, parts[1], QuotePOSIX(c.NewValue))
+	case ChangeRenameFile:
+		return fmt.Sprintf("mv %s %s", QuotePOSIX(c.Target), QuotePOSIX(c.NewValue))
+	case ChangeCreateDirectory:
+		return fmt.Sprintf("mkdir -p %s", QuotePOSIX(c.Target))
+	}
+	return fmt.Sprintf("write %s (%d bytes)", QuotePOSIX(c.Target), len(c.NewValue))
+}
+
+// Plan records the changes of a dry run instead of making them, in the order
+// they would have been made. Git config values read through a GitConfig with
+// a Plan (see GitConfig.DryRun) include the planned changes, so that later
+// steps see what earlier ones would have written. A nil *Plan makes the
+// changes.
+type Plan struct {
+	Changes []PlannedChange
+
+	config map[string]*string
+}
+
+func (p *Plan) record(kind, target, oldValue, newValue string) {
+	p.Changes = append(p.Changes, PlannedChange{
+		Kind:     kind,
+		Target:   target,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+}
+
+// recordConfig records setting (or unsetting, if value is nil) the git config
+// key target, which plannedConfig then returns
+func (p *Plan) recordConfig(target, oldValue string, value *string) {
+	if p.config == nil {
+		p.config = map[string]*string{}
+	}
+	p.config[target] = value
+
+	if value == nil {
+		p.record(ChangeUnsetConfig, target, oldValue, "")
+	} else {
+		p.record(ChangeSetConfig, target, oldValue, *value)
+	}
+}
+
+// plannedConfig returns the planned value of the git config key target, nil
+// if it would be unset, and whether there is one
+func (p *Plan) plannedConfig(target string) (value *string, planned bool) {
+	if p == nil {
+		return nil, false
+	}
+	value, planned = p.config[target]
+	return value, planned
+}
+
+// writeFile writes contents to file with perm, also for an existing file
+func (p *Plan) writeFile(file string, contents []byte, perm os.FileMode) error {
+	if p != nil {
+		existing, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, change := range p.Changes {
+			if change.Kind == ChangeRenameFile && change.Target == file {
+				// moved away first, the file is created
+				existing = nil
+			}
+		}
+		p.record(ChangeWriteFile, file, string(existing), string(contents))
+		return nil
+	}
+
+	if err := ioutil.WriteFile(file, contents, perm); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of existing files
+	return os.Chmod(file, perm)
+}
+
+func (p *Plan) rename(oldPath, newPath string) error {
+	if p != nil {
+		p.record(ChangeRenameFile, oldPath, "", newPath)
+		return nil
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// MkdirAll is os.MkdirAll, recorded if the directory does not exist yet
+func (p *Plan) MkdirAll(dir string, perm os.FileMode) error {
+	if p != nil {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			p.record(ChangeCreateDirectory, dir, "", "")
+		}
+		return nil
+	}
+	return os.MkdirAll(dir, perm)
+}
+
+// WritePlan writes the changes of plan to w, one per line: as the commands
+// making them (see PlannedChange.String) or, if asJSON is set, as JSON objects
+func WritePlan(w io.Writer, plan *Plan, asJSON bool) error {
+	for _, change := range plan.Changes {
+		line := change.String()
+		if asJSON {
+			output, err := json.Marshal(change)
+			if err != nil {
+				return err
+			}
+			line = string(output)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package duet
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PorcelainVersion is the version of the key set written by WritePorcelain
+// Keys are only ever added within a version, never renamed or removed.
+const PorcelainVersion = 1
+
+// WritePorcelain writes the configuration as stable `key value` records for
+// scripts. The keys (version 1) are:
+//
+//	version             always the first record
+//	author.initials     author.name    author.email
+//	committer.initials  committer.name committer.email   (next committer)
+//	coauthor.N.initials coauthor.N.name coauthor.N.email (every committer, N from 1)
+//	mtime               unix time the configuration was last written
+//	expires             unix time the configuration expires (if it does)
+//	expired             true once the configuration has expired
+//
+// Records for unset values are omitted. Records are terminated by a newline,
+// or by NUL when nulTerminated is set; values containing newlines can only
+// be written NUL-terminated.
+func WritePorcelain(w io.Writer, author *Pair, committers []*Pair, mtime, expires time.Time, nulTerminated bool) error {
+	terminator := "\n"
+	if nulTerminated {
+		terminator = "\x00"
+	}
+
+	var records [][2]string
+	add := func(prefix string, p *Pair) {
+		records = append(records,
+			[2]string{prefix + ".initials", p.Initials},
+			[2]string{prefix + ".name", p.Name},
+			[2]string{prefix + ".email", p.Email},
+		)
+	}
+
+	records = append(records, [2]string{"version", strconv.Itoa(PorcelainVersion)})
+	if author != nil {
+		add("author", author)
+	}
+	if len(committers) > 0 {
+		add("committer", committers[0])
+	}
+	for i, c := range committers {
+		add(fmt.Sprintf("coauthor.%d", i+1), c)
+	}
+	if !mtime.IsZero() {
+		records = append(records, [2]string{"mtime", strconv.FormatInt(mtime.Unix(), 10)})
+	}
+	if !expires.IsZero() {
+		records = append(records, [2]string{"expires", strconv.FormatInt(expires.Unix(), 10)})
+		if !time.Now().Before(expires) {
+			records = append(records, [2]string{"expired", "true"})
+		}
+	}
+
+	for _, record := range records {
+		if record[1] == "" {
+			continue
+		}
+		if !nulTerminated && strings.ContainsAny(record[1], "\r\n") {
+			return fmt.Errorf("%s contains a newline, use NUL-terminated output", record[0])
+		}
+		if _, err := fmt.Fprintf(w, "%s %s%s", record[0], record[1], terminator); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
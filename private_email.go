@@ -0,0 +1,115 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// PrivateEmailConfigKey is the git config key that turns private mode on or off
+// (or sets its pattern) for a repository, overriding `private_email` in the
+// authors file
+const PrivateEmailConfigKey = "duet.privateEmail"
+
+// DefaultPrivateEmailPattern is the address of authors without a username in
+// private mode unless a pattern is configured
+const DefaultPrivateEmailPattern = "{{.Initials}}@users.noreply.{{.Domain}}"
+
+// privateEmailConfig is the `private_email` setting of the authors file, either
+// a bool or the pattern of the private addresses (which turns it on)
+type privateEmailConfig struct {
+	enabled bool
+	pattern string
+}
+
+func (c *privateEmailConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.enabled); err == nil {
+		return nil
+	}
+	if err := unmarshal(&c.pattern); err != nil {
+		return err
+	}
+	c.enabled = c.pattern != ""
+	return nil
+}
+
+func (c privateEmailConfig) MarshalYAML() (interface{}, error) {
+	if !c.enabled {
+		return nil, nil
+	}
+	if c.pattern == "" {
+		return true, nil
+	}
+	return c.pattern, nil
+}
+
+// WithPrivateEmail turns private mode on or off regardless of the authors
+// file, pattern (if not empty) replaces its pattern. In private mode the email
+// of every author is replaced by a noreply-style address, the one it replaced
+// being kept in RealEmail. The address is made up from the pattern if one is
+// configured, otherwise authors with a username get their noreply address on
+// GitHub or GitLab if `github_noreply` or `gitlab` is set, and everyone else
+// DefaultPrivateEmailPattern.
+// Patterns are templates executed with the author and the email domain
+// (.Domain).
+func WithPrivateEmail(enabled bool, pattern string) Option {
+	return func(a *Pairs) {
+		a.file.PrivateEmail.enabled = enabled
+		if pattern != "" {
+			a.file.PrivateEmail.pattern = pattern
+		}
+	}
+}
+
+// ParsePrivateEmailConfig turns the value of PrivateEmailConfigKey into the
+// arguments of WithPrivateEmail: a bool, or a pattern which turns it on
+func ParsePrivateEmailConfig(value string) (enabled bool, pattern string) {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		return enabled, ""
+	}
+	return true, value
+}
+
+// privateEmail returns the noreply-style address of pair in private mode
+func (a *Pairs) privateEmail(pair *Pair) (email string, err error) {
+	pattern := a.file.PrivateEmail.pattern
+	if pattern == "" && pair.Username != "" && !strings.Contains(pair.Username, "@") {
+		switch {
+		case a.file.GitHubNoreply.enabled:
+			return a.githubNoreplyEmail(pair.Initials, pair.Username)
+		case a.file.GitLab.enabled:
+			return a.gitlabNoreplyEmail(pair.Initials, pair.Username)
+		}
+	}
+
+	if pattern == "" {
+		if a.file.Email.Domain == "" {
+			return "", fmt.Errorf("private_email needs a pattern or an email domain to make up an address for %s",
+				pair.Initials)
+		}
+		pattern = DefaultPrivateEmailPattern
+	}
+
+	t, err := template.New("private_email").Funcs(templateFuncs).Option("missingkey=zero").Parse(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid private_email pattern: %v", err)
+	}
+
+	var out bytes.Buffer
+	data := struct {
+		*Pair
+		Domain string
+	}{pair, a.file.Email.Domain}
+	if err = t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("invalid private_email pattern: %v", err)
+	}
+
+	email = strings.TrimSpace(out.String())
+	if !isEmailAddress(email) {
+		return "", fmt.Errorf("private_email pattern made up %q for %s, which is not an email address",
+			email, pair.Initials)
+	}
+	return email, nil
+}
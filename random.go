@@ -0,0 +1,50 @@
+package duet
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Random picks count authors uniformly at random using rng
+// Anyone whose initials are in skip or in the `exclude` list of the authors
+// file is never chosen. Pass a seeded rng for reproducible selections.
+func (a *Pairs) Random(rng *rand.Rand, count int, skip ...string) (pairs []*Pair, err error) {
+	excluded := map[string]bool{}
+	for _, initials := range a.file.Exclude {
+		excluded[initials] = true
+	}
+	for _, initials := range skip {
+		if canonical, err := a.resolveInitials(initials); err == nil {
+			initials = canonical
+		}
+		excluded[initials] = true
+	}
+
+	var candidates []string
+	for initials := range a.file.Pairs {
+		if !excluded[initials] {
+			candidates = append(candidates, initials)
+		}
+	}
+	// map iteration order is random, sort so that the rng alone decides
+	sort.Strings(candidates)
+
+	if len(candidates) < count {
+		return nil, fmt.Errorf("not enough authors to choose %d at random (%d available)", count, len(candidates))
+	}
+
+	rng.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	for _, initials := range candidates[:count] {
+		pair, err := a.ByInitials(initials)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, nil
+}
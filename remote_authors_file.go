@@ -0,0 +1,234 @@
+package duet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultAuthorsURLTimeout bounds fetching an authors file given as a URL
+// (see $GIT_DUET_AUTHORS_URL_TIMEOUT), after which the cached copy is used
+const DefaultAuthorsURLTimeout = 3 * time.Second
+
+// DefaultAuthorsURLTTL is how long the cached copy of an authors file given as
+// a URL is used before fetching it again (see $GIT_DUET_AUTHORS_URL_TTL)
+const DefaultAuthorsURLTTL = time.Hour
+
+// maxAuthorsFileSize is the most fetched for an authors file given as a URL
+const maxAuthorsFileSize = 10 << 20
+
+// AuthorsFileCacheDir returns where authors files given as URLs are cached
+// ($XDG_CACHE_HOME/git-duet/authors or the platform equivalent)
+func AuthorsFileCacheDir() (dir string, err error) {
+	dir, err = os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-duet", "authors"), nil
+}
+
+// isAuthorsURL reports whether file is a URL rather than a path
+func isAuthorsURL(file string) bool {
+	lower := strings.ToLower(file)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// splitAuthorsFileList splits $GIT_DUET_AUTHORS_FILE like filepath.SplitList,
+// keeping URLs (and their port) in one piece on systems separating paths with
+// colons
+func splitAuthorsFileList(list string) (files []string) {
+	for _, file := range filepath.SplitList(list) {
+		if n := len(files); n > 0 && joinsURL(files[n-1], file) {
+			files[n-1] += ":" + file
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// joinsURL reports whether next is the rest of the URL cut short at a colon
+// as prefix: after its scheme, or after its host for the port
+func joinsURL(prefix, next string) bool {
+	if strings.HasPrefix(next, "//") {
+		return isAuthorsURL(prefix + ":" + next)
+	}
+	if !isAuthorsURL(prefix) || next == "" || next[0] < '0' || next[0] > '9' {
+		return false
+	}
+	host := prefix[strings.Index(prefix, "//")+2:]
+	return !strings.ContainsAny(host, "/:")
+}
+
+// RefreshAuthorsFiles fetches the authors files given as URLs into the cache
+// however fresh the cached copies are, failing instead of falling back to them
+func RefreshAuthorsFiles() (err error) {
+	config := &Configuration{}
+	if config.PairsFile, config.PairsFileLayers, config.PairsFileSource, _, err = getPairsFile(config.fs()); err != nil {
+		return err
+	}
+	return config.fetchRemotePairsFiles(true)
+}
+
+// fetchRemotePairsFiles replaces the authors files given as URLs with the
+// copy of them in the cache, fetched again if it is older than
+// $GIT_DUET_AUTHORS_URL_TTL or refresh is set (see fetchAuthorsURL)
+func (config *Configuration) fetchRemotePairsFiles(refresh bool) (err error) {
+	timeout := DefaultAuthorsURLTimeout
+	if seconds := os.Getenv("GIT_DUET_AUTHORS_URL_TIMEOUT"); seconds != "" {
+		if timeout, err = time.ParseDuration(seconds + "s"); err != nil || timeout <= 0 {
+			return fmt.Errorf("GIT_DUET_AUTHORS_URL_TIMEOUT is %q, it should be a number of seconds", seconds)
+		}
+	}
+	ttl := DefaultAuthorsURLTTL
+	if seconds := os.Getenv("GIT_DUET_AUTHORS_URL_TTL"); seconds != "" {
+		if ttl, err = time.ParseDuration(seconds + "s"); err != nil || ttl < 0 {
+			return fmt.Errorf("GIT_DUET_AUTHORS_URL_TTL is %q, it should be a number of seconds", seconds)
+		}
+	}
+	if refresh {
+		ttl = 0
+	}
+
+	fetch := func(file string) (string, error) {
+		if !isAuthorsURL(file) {
+			return file, nil
+		}
+		if _, ok := config.fs().(osFS); !ok {
+			return "", fmt.Errorf("%s: authors files can only be fetched from a URL onto the OS filesystem", file)
+		}
+		cached, warning, err := fetchAuthorsURL(file, timeout, ttl, !refresh)
+		if warning != nil {
+			config.PairsFileWarnings = append(config.PairsFileWarnings, warning)
+		}
+		config.untrust(cached, "was fetched from "+file)
+		return cached, err
+	}
+
+	for i, layer := range config.PairsFileLayers {
+		if config.PairsFileLayers[i], err = fetch(layer); err != nil {
+			return err
+		}
+	}
+	if isAuthorsURL(config.PairsFile) {
+		config.PairsFileSource = fmt.Sprintf("%s, cached from %s", config.PairsFileSource, config.PairsFile)
+	}
+	config.PairsFile, err = fetch(config.PairsFile)
+	return err
+}
+
+// fetchAuthorsURL returns the copy of the authors file at rawURL in the cache
+// (see AuthorsFileCacheDir), downloading it first unless it was cached less
+// than ttl ago. If it cannot be fetched within timeout (e.g. when offline),
+// the copy cached last time is returned along with a warning saying so, if
+// fallback is set. Only HTTPS URLs are fetched, or HTTP ones on the loopback
+// interface: the authors file decides which commands the email lookups run.
+func fetchAuthorsURL(rawURL string, timeout, ttl time.Duration, fallback bool) (file string, warning, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "https") && !isLoopback(u.Hostname()) {
+		return "", nil, fmt.Errorf("%s: authors files are only fetched over https", rawURL)
+	}
+
+	dir, err := AuthorsFileCacheDir()
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	// the extension tells the format (see authorsFileFormat)
+	file = filepath.Join(dir, hex.EncodeToString(sum[:8])+path.Ext(u.Path))
+
+	info, statErr := os.Stat(file)
+	if statErr == nil && time.Since(info.ModTime()) < ttl {
+		return file, nil, nil
+	}
+
+	fetchErr := downloadAuthorsFile(rawURL, file, timeout)
+	if fetchErr == nil {
+		return file, nil, nil
+	}
+	if !fallback {
+		return "", nil, fmt.Errorf("could not fetch %s: %v", rawURL, fetchErr)
+	}
+	if statErr != nil {
+		return "", nil, fmt.Errorf("could not fetch %s, and it was never cached: %v", rawURL, fetchErr)
+	}
+	return file, fmt.Errorf("could not fetch %s (%v), using the copy cached %s ago",
+		rawURL, fetchErr, time.Since(info.ModTime()).Round(time.Second)), nil
+}
+
+// downloadAuthorsFile writes the response to a GET of rawURL to file, leaving
+// file as it was if the request fails or the response is not an authors file
+func downloadAuthorsFile(rawURL, file string, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := resolverClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{Endpoint: rawURL, Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	contents, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAuthorsFileSize+1))
+	if err != nil {
+		return err
+	}
+	if len(contents) > maxAuthorsFileSize {
+		return fmt.Errorf("%s is larger than %d bytes", rawURL, maxAuthorsFileSize)
+	}
+	format, err := authorsFileFormat(rawURL, file)
+	if err != nil {
+		return err
+	}
+	if _, err = decodeAuthorsFile(contents, format, "it"); err != nil {
+		return err
+	}
+
+	// written next to it and renamed, so that the cached copy is never
+	// left half written
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// isLoopback reports whether host is localhost or a loopback address
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,240 @@
+package duet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RepoStatus is the outcome of setting the pair in a repository (see
+// SetPairInRepos)
+type RepoStatus int
+
+// RepoSet is a repository the pair was set in
+// RepoUnknownInitials is a repository whose own authors file does not know
+// some of the initials, left alone
+// RepoFailed is a repository the pair could not be set in (e.g. not a git
+// repository)
+const (
+	RepoSet RepoStatus = iota
+	RepoUnknownInitials
+	RepoFailed
+)
+
+// String returns the name of the status (set, unknown_initials or failed)
+func (s RepoStatus) String() string {
+	switch s {
+	case RepoSet:
+		return "set"
+	case RepoUnknownInitials:
+		return "unknown_initials"
+	default:
+		return "failed"
+	}
+}
+
+// MarshalText makes the status its name in JSON
+func (s RepoStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// RepoResult is what happened in the repository at Path, Err explaining why
+// the pair was not set
+type RepoResult struct {
+	Path   string
+	Status RepoStatus
+	Err    error
+}
+
+// RepoInitialsError is returned for a repository whose own authors file
+// (File) does not know Initials
+type RepoInitialsError struct {
+	File     string
+	Initials []string
+}
+
+func (e *RepoInitialsError) Error() string {
+	return fmt.Sprintf("%s does not know %s", e.File, strings.Join(e.Initials, ", "))
+}
+
+// SetPairInRepos resolves initials once (the first being the author) and sets
+// the pair in the local config of every repository in repoPaths, carrying on
+// past repositories it cannot be set in. Repositories with a .git-authors of
+// their own not knowing all of the initials are left alone, as git-duet would
+// not know the pair there. Only an error resolving the pair is returned, the
+// outcome in each repository is in its RepoResult.
+func (config *Configuration) SetPairInRepos(repoPaths []string, initials []string) (results []RepoResult, err error) {
+	pairs, err := config.LoadPairs()
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := pairs.ByInitialsMany(initials...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repoPaths {
+		result := RepoResult{Path: repo, Status: RepoFailed}
+		toplevel, err := workTreeRoot(repo)
+		if err != nil {
+			result.Err = err
+		} else if result.Err = checkRepoInitials(toplevel, pairs, initials); result.Err != nil {
+			if _, ok := result.Err.(*RepoInitialsError); ok {
+				result.Status = RepoUnknownInitials
+			}
+		} else if result.Err = config.setPairInRepo(toplevel, resolved[0], resolved[1:]); result.Err == nil {
+			result.Status = RepoSet
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// checkRepoInitials returns a *RepoInitialsError if the repository at
+// toplevel has a .git-authors (other than the authors file of pairs) not
+// knowing all of initials. Does nothing if $GIT_DUET_AUTHORS_FILE is set, which
+// is used in every repository.
+func checkRepoInitials(toplevel string, pairs *Pairs, initials []string) error {
+	if os.Getenv("GIT_DUET_AUTHORS_FILE") != "" {
+		return nil
+	}
+
+	file := filepath.Join(toplevel, ".git-authors")
+	if _, err := os.Stat(file); err != nil || sameFile(file, pairs.Path()) {
+		return nil
+	}
+	repoPairs, err := NewPairsFromFile(file, "", WithLenientEntries())
+	if err != nil {
+		return err
+	}
+
+	var unknown []string
+	for _, i := range initials {
+		if _, ok := repoPairs.file.Pairs[i]; !ok {
+			unknown = append(unknown, i)
+		}
+	}
+	if len(unknown) > 0 {
+		return &RepoInitialsError{File: file, Initials: unknown}
+	}
+	return nil
+}
+
+// setPairInRepo sets author and committers in the local config of the
+// repository at toplevel
+func (config *Configuration) setPairInRepo(toplevel string, author *Pair, committers []*Pair) (err error) {
+	gitConfig := &GitConfig{
+		Namespace:       config.Namespace,
+		Scope:           Local,
+		Dir:             toplevel,
+		SetUserConfig:   config.SetGitUserConfig,
+		CoAuthoredBy:    config.CoAuthoredBy,
+		ExpireAfter:     config.ExpireAfter,
+		DuplicatePeople: config.DuplicatePeople,
+
+		AllowedSignersFile: config.AllowedSignersFile,
+	}
+
+	if err = gitConfig.SetAuthor(author); err != nil {
+		return err
+	}
+	if len(committers) == 0 {
+		return gitConfig.ClearCommitter()
+	}
+	return gitConfig.SetCommitters(committers...)
+}
+
+// workTreeRoot returns the root of the working tree repo is in
+func workTreeRoot(repo string) (toplevel string, err error) {
+	output, err := exec.Command("git", "-C", repo, "rev-parse", "--show-toplevel").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// sameFile reports whether a and b are the same file
+func sameFile(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// FindRepos returns the git repositories directly in workspace (those with a
+// .git directory or file), sorted by name
+func FindRepos(workspace string) (repos []string, err error) {
+	entries, err := os.ReadDir(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(workspace, entry.Name())
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			repos = append(repos, dir)
+		}
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// repoResultJSON is a RepoResult as WriteRepoResults prints it in JSON, with
+// the error as text and as an ErrorReport
+type repoResultJSON struct {
+	Path   string       `json:"path"`
+	Status RepoStatus   `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Report *ErrorReport `json:"report,omitempty"`
+}
+
+// WriteRepoResults writes one line per repository to w, as a JSON array if
+// asJSON is set
+func WriteRepoResults(w io.Writer, results []RepoResult, asJSON bool) error {
+	if asJSON {
+		out := make([]repoResultJSON, 0, len(results))
+		for _, r := range results {
+			j := repoResultJSON{Path: r.Path, Status: r.Status}
+			if r.Err != nil {
+				j.Error = r.Err.Error()
+				j.Report = NewErrorReport(r.Err)
+			}
+			out = append(out, j)
+		}
+		output, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(output))
+		return err
+	}
+
+	for _, r := range results {
+		var err error
+		switch r.Status {
+		case RepoSet:
+			_, err = fmt.Fprintf(w, "%s: set\n", r.Path)
+		case RepoUnknownInitials:
+			_, err = fmt.Fprintf(w, "%s: unknown initials, %v\n", r.Path, r.Err)
+		default:
+			_, err = fmt.Fprintf(w, "%s: failed, %v\n", r.Path, r.Err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package duet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultResolverTimeout bounds each request to a code host's API and
+// DefaultResolverBudget all the requests (retries included) for an author, so
+// that a flaky network cannot hold up a commit hook for long
+const (
+	DefaultResolverTimeout = 2 * time.Second
+	DefaultResolverBudget  = 3 * time.Second
+)
+
+// resolverBackoff is how long to wait before retrying a request to a code
+// host the first time, doubled for every retry after that
+const resolverBackoff = 100 * time.Millisecond
+
+// resolverClient makes the requests to code hosts with the default transport,
+// which takes proxies from the standard environment variables (HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY) and CAs from SSL_CERT_FILE and SSL_CERT_DIR
+var resolverClient = &http.Client{}
+
+// NetworkError is a request to a code host that failed (e.g. timed out, was
+// reset or answered 429 or 5xx) even after Attempts tries
+type NetworkError struct {
+	Endpoint string
+	Attempts int
+	Err      error
+}
+
+func (e *NetworkError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%v (gave up after %d attempts)", e.Err, e.Attempts)
+	}
+	return e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// UserNotFoundError is returned when a code host (Host, e.g. GitHub) has no
+// user named Username
+type UserNotFoundError struct {
+	Host     string
+	Username string
+}
+
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("no %s user is named %s", e.Host, e.Username)
+}
+
+// statusError is a code host answering a request with another status than
+// 200 OK
+type statusError struct {
+	Endpoint string
+	Code     int
+	Status   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.Endpoint, e.Status)
+}
+
+// WithResolverTimeouts bounds each request to the code host of
+// `github_noreply` or `gitlab` to timeout and all the requests for an author,
+// retries included, to budget. Zero keeps the default (DefaultResolverTimeout
+// and DefaultResolverBudget).
+func WithResolverTimeouts(timeout, budget time.Duration) Option {
+	return func(a *Pairs) {
+		if timeout > 0 {
+			a.resolverTimeout = timeout
+		}
+		if budget > 0 {
+			a.resolverBudget = budget
+		}
+	}
+}
+
+// WithContext cancels email and signing key lookups and requests to code
+// hosts once ctx is done
+func WithContext(ctx context.Context) Option {
+	return func(a *Pairs) {
+		a.ctx = ctx
+	}
+}
+
+// usernameResolver looks up the email of an author by their username on a
+// code host (see `github_noreply` and `gitlab`)
+type usernameResolver func(initials, username string) (email string, err error)
+
+// usernameResolver returns the resolver enabled in the authors file, or nil
+func (a *Pairs) usernameResolver() usernameResolver {
+	switch {
+	case a.file.GitHubNoreply.enabled:
+		return a.githubNoreplyEmail
+	case a.file.GitLab.enabled:
+		return a.gitlabEmail
+	}
+	return nil
+}
+
+// checkUsernameResolvers returns an error if more than one resolver is enabled
+func (af *pairsFile) checkUsernameResolvers() error {
+	if af.GitHubNoreply.enabled && af.GitLab.enabled {
+		return fmt.Errorf("github_noreply and gitlab are both set, only one can resolve usernames")
+	}
+	return nil
+}
+
+// staleLookup returns the email last cached for key however old it is, for
+// when the code host cannot be reached
+func (a *Pairs) staleLookup(key string) (email string, ok bool) {
+	if a.lookupCache == nil {
+		return "", false
+	}
+	entry, ok := a.lookupCache.getStale(key)
+	return entry.Email, ok && entry.Email != ""
+}
+
+// getJSON decodes the response to a GET of endpoint into v, retrying with
+// backoff (or as long as the Retry-After header says) on network errors, 429
+// and 5xx for as long as the resolver budget allows. Gives up with a
+// *NetworkError once it does not.
+func (a *Pairs) getJSON(endpoint string, headers map[string]string, v interface{}) (err error) {
+	ctx, cancel := context.WithTimeout(a.ctx, a.resolverBudget)
+	defer cancel()
+
+	backoff := resolverBackoff
+	for attempt := 1; ; attempt++ {
+		retry, wait, err := a.getJSONOnce(ctx, endpoint, headers, v)
+		if err == nil || !retry {
+			return err
+		}
+		if a.ctx.Err() != nil {
+			return &NetworkError{Endpoint: endpoint, Attempts: attempt, Err: err}
+		}
+
+		if wait < backoff {
+			wait = backoff
+		}
+		backoff *= 2
+		if deadline, _ := ctx.Deadline(); time.Until(deadline) < wait {
+			return &NetworkError{Endpoint: endpoint, Attempts: attempt, Err: err}
+		}
+		a.debugf("%v, retrying in %s\n", err, wait)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return &NetworkError{Endpoint: endpoint, Attempts: attempt, Err: err}
+		}
+	}
+}
+
+// getJSONOnce makes a single request for getJSON, telling whether it is worth
+// retrying and how long the code host asked to wait before doing so
+func (a *Pairs) getJSONOnce(ctx context.Context, endpoint string, headers map[string]string, v interface{}) (retry bool, wait time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, a.resolverTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := resolverClient.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return true, wait, &statusError{Endpoint: endpoint, Code: resp.StatusCode, Status: resp.Status}
+	case resp.StatusCode != http.StatusOK:
+		return false, 0, &statusError{Endpoint: endpoint, Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			return false, 0, fmt.Errorf("%s returned invalid JSON: %v", endpoint, err)
+		}
+		// cut short, e.g. by a reset connection
+		return true, 0, fmt.Errorf("%s: %v", endpoint, err)
+	}
+
+	return false, 0, nil
+}
@@ -0,0 +1,93 @@
+package duet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// roster is the JSON written by ExportJSON
+// Settings are those of the authors file that apply to every author, Authors
+// are sorted by initials and Errors lists the broken authors left out (see
+// WithLenientEntries) followed by the authors whose email could not be
+// resolved, in order of initials. Empty fields are left out, but the three
+// keys are always there.
+type roster struct {
+	Settings rosterSettings `json:"settings"`
+	Authors  []rosterAuthor `json:"authors"`
+	Errors   []*ErrorReport `json:"errors"`
+}
+
+// rosterSettings tells whether emails are built from a template (rather than
+// from the domain) without giving the template away
+type rosterSettings struct {
+	Domain        string `json:"domain,omitempty"`
+	Prefix        string `json:"prefix,omitempty"`
+	EmailTemplate bool   `json:"email_template"`
+}
+
+type rosterAuthor struct {
+	Initials string            `json:"initials"`
+	Name     string            `json:"name"`
+	Username string            `json:"username,omitempty"`
+	Email    string            `json:"email,omitempty"`
+	Team     string            `json:"team,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+// ExportJSON writes every author of the authors file to w as JSON, with the
+// settings of the file (see roster). Emails are only resolved if
+// resolveEmails is set, which runs the email lookups; an author whose email
+// cannot be resolved is exported without it and reported in `errors` rather
+// than failing the export.
+func (a *Pairs) ExportJSON(w io.Writer, resolveEmails bool) error {
+	export := roster{
+		Settings: rosterSettings{
+			Domain:        a.file.Email.Domain,
+			Prefix:        a.file.Email.Prefix,
+			EmailTemplate: a.file.EmailTemplate != "",
+		},
+		Authors: []rosterAuthor{},
+		Errors:  []*ErrorReport{},
+	}
+	for _, warning := range a.warnings {
+		export.Errors = append(export.Errors, NewErrorReport(warning))
+	}
+
+	initials := a.Initials()
+	var pairs []*Pair
+	var errs []error
+	if resolveEmails {
+		pairs, errs = a.resolveEach(initials)
+	}
+
+	for i, initials := range initials {
+		name, username, _ := a.file.author(initials)
+		author := rosterAuthor{
+			Initials: initials,
+			Name:     name,
+			Username: username,
+			Team:     a.file.Teams[initials],
+			Meta:     a.file.Meta[initials],
+		}
+		if resolveEmails {
+			if errs[i] != nil {
+				report := NewErrorReport(errs[i])
+				if report.Initials == "" {
+					report.Initials = initials
+				}
+				export.Errors = append(export.Errors, report)
+			} else {
+				author.Email = pairs[i].Email
+			}
+		}
+		export.Authors = append(export.Authors, author)
+	}
+
+	output, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(output))
+	return err
+}
@@ -0,0 +1,65 @@
+package duet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// generatedRoster returns an authors file of size authors, half of them with
+// an email address, like a file generated from an employee directory
+func generatedRoster(size int) fstest.MapFS {
+	var b strings.Builder
+	b.WriteString("authors:\n")
+	for i := 0; i < size; i++ {
+		fmt.Fprintf(&b, "  a%d: Person Number%d; user%d\n", i, i, i)
+	}
+	b.WriteString("email:\n  domain: example.com\nemail_addresses:\n")
+	for i := 0; i < size; i += 2 {
+		fmt.Fprintf(&b, "  a%d: person%d@example.com\n", i, i)
+	}
+	return fstest.MapFS{"authors.yml": {Data: []byte(b.String())}}
+}
+
+func BenchmarkNewPairsFromFS(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		files := generatedRoster(size)
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				pairs, err := NewPairsFromFS(files, "authors.yml", "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err = pairs.ByInitialsMany("a0", "a1"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// largeRosterBudget is how long loading a 4k-author file may take, about
+// twice what it takes on a laptop
+const largeRosterBudget = 8 * time.Millisecond
+
+// TestLargeRosterLoadTime only runs with GIT_DUET_TIMING_TESTS set, as timings
+// depend on the machine and on flags such as -race
+func TestLargeRosterLoadTime(t *testing.T) {
+	if os.Getenv("GIT_DUET_TIMING_TESTS") == "" {
+		t.Skip("timing test, set GIT_DUET_TIMING_TESTS to run it")
+	}
+	files := generatedRoster(4000)
+	result := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewPairsFromFS(files, "authors.yml", ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	if perLoad := time.Duration(result.NsPerOp()); perLoad > largeRosterBudget {
+		t.Errorf("loading 4000 authors took %v, want under %v", perLoad, largeRosterBudget)
+	}
+}
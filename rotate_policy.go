@@ -0,0 +1,135 @@
+package duet
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RotatePolicyConfigKey is the git config key deciding when the author is
+// rotated (see ParseRotatePolicy). Setting it turns rotating on, like
+// $GIT_DUET_ROTATE_AUTHOR does for the default policy of every commit.
+const RotatePolicyConfigKey = "duet.rotatePolicy"
+
+// Kinds of RotatePolicy
+const (
+	// RotateEveryCommit rotates after every commit
+	RotateEveryCommit = "commit"
+	// RotatePerBranch rotates after the first commit on another branch than
+	// the one of the previous commit
+	RotatePerBranch = "branch"
+	// RotateOnInterval rotates after a commit once Interval has passed since
+	// the author took over
+	RotateOnInterval = "interval"
+)
+
+// RotatePolicy decides when RotateAuthorByPolicy rotates the author
+type RotatePolicy struct {
+	Kind     string
+	Interval time.Duration
+}
+
+// ParseRotatePolicy parses the value of RotatePolicyConfigKey: `commit`,
+// `branch` or `interval:<duration>` (e.g. `interval:25m`)
+func ParseRotatePolicy(value string) (policy RotatePolicy, err error) {
+	kind, interval := value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		kind, interval = value[:i], value[i+1:]
+	}
+
+	switch kind {
+	case RotateEveryCommit, RotatePerBranch:
+		if kind == value {
+			return RotatePolicy{Kind: kind}, nil
+		}
+	case RotateOnInterval:
+		d, err := time.ParseDuration(interval)
+		if err == nil && d > 0 {
+			return RotatePolicy{Kind: kind, Interval: d}, nil
+		}
+		return RotatePolicy{}, fmt.Errorf("%s: invalid interval %q, use e.g. interval:25m", RotatePolicyConfigKey, interval)
+	}
+	return RotatePolicy{}, fmt.Errorf("%s: unknown policy %q, use commit, branch or interval:<duration>", RotatePolicyConfigKey, value)
+}
+
+// RotateAuthorByPolicy rotates the author like RotateAuthor if policy says it
+// is time to after a commit. What the policy goes by (the branch of the last
+// commit, the time of the last rotation) is kept next to the author, and
+// forgotten when another session starts (see updateSession). Returns whether
+// the author was rotated.
+func (gc *GitConfig) RotateAuthorByPolicy(policy RotatePolicy) (rotated bool, err error) {
+	target := gc
+	if gc.Scope == Default {
+		if target, err = GetAuthorConfig(gc.Namespace, gc.SetUserConfig); err != nil {
+			return false, err
+		}
+		target.DryRun = gc.DryRun
+	}
+
+	switch policy.Kind {
+	case RotatePerBranch:
+		branch, err := currentBranch()
+		if err != nil || branch == "" {
+			return false, err
+		}
+		last, err := target.getKey("rotation-branch")
+		if err != nil {
+			return false, err
+		}
+		if branch == last {
+			return false, nil
+		}
+		if err = target.setKey("rotation-branch", branch); err != nil {
+			return false, err
+		}
+		// the first commit of the session only tells the branch
+		if last == "" {
+			return false, nil
+		}
+	case RotateOnInterval:
+		since, err := target.lastRotation()
+		if err != nil {
+			return false, err
+		}
+		now := time.Now()
+		if now.Sub(since) < policy.Interval {
+			return false, nil
+		}
+		if err = target.setKey("rotation-time", strconv.FormatInt(now.Unix(), 10)); err != nil {
+			return false, err
+		}
+	}
+
+	return true, gc.RotateAuthor()
+}
+
+// lastRotation returns when the author was last rotated, or when the session
+// started if it was not since
+func (gc *GitConfig) lastRotation() (at time.Time, err error) {
+	rotatedAt, err := gc.getKey("rotation-time")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rotatedAt == "" {
+		return gc.GetSessionStart()
+	}
+
+	unix, err := strconv.ParseInt(rotatedAt, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(unix, 0), nil
+}
+
+// currentBranch returns the branch checked out, empty if HEAD is detached
+func currentBranch() (branch string, err error) {
+	output, err := exec.Command("git", "symbolic-ref", "-q", "--short", "HEAD").Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
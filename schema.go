@@ -0,0 +1,527 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AuthorsFileVersion is the newest authors file version this package understands
+// Files without a `version` key use the legacy layout (version 0).
+const AuthorsFileVersion = 1
+
+// migration upgrades an authors file from one version to the next
+type migration struct {
+	// migrate upgrades af as decoded, the keys of older versions being decoded
+	// along with the current ones (see pairsFile) so that the file is only
+	// parsed once
+	migrate func(af *pairsFile) error
+	// rewrite makes the same change to the lines of the file, for MigrateFile
+	rewrite func(lines []string) []string
+}
+
+// migrations[i] upgrades a file in version i to version i+1
+var migrations = []migration{
+	{migrate: migrateLegacyPairsKey, rewrite: rewriteLegacyPairsKey},
+}
+
+// migrateLegacyPairsKey accepts `pairs` (as used by `git pair`) in place of `authors`
+func migrateLegacyPairsKey(af *pairsFile) error {
+	if af.LegacyPairs == nil {
+		return nil
+	}
+	if af.Authors != nil {
+		return fmt.Errorf("both `authors` and `pairs` are set, please only use `authors`")
+	}
+	af.Authors = af.LegacyPairs
+
+	return nil
+}
+
+// legacyPairsKeyRegexp matches the line starting the top-level `pairs` mapping
+var legacyPairsKeyRegexp = regexp.MustCompile(`^pairs(\s*:\s*(?:#.*)?)$`)
+
+// rewriteLegacyPairsKey renames the `pairs` key to `authors`
+func rewriteLegacyPairsKey(lines []string) []string {
+	for i, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		if legacyPairsKeyRegexp.MatchString(content) {
+			lines[i] = "authors" + strings.TrimPrefix(line, "pairs")
+		}
+	}
+	return lines
+}
+
+// fileVersion is the `version` of an authors file, a non-negative integer
+type fileVersion int
+
+func (v *fileVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*v = 0
+		return nil
+	}
+	version, ok := raw.(int)
+	if !ok || version < 0 {
+		return fmt.Errorf("invalid version %v", raw)
+	}
+	*v = fileVersion(version)
+	return nil
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// stripBOM removes a leading UTF-8 byte order mark (as written by some Windows
+// editors) and rejects UTF-16 encoded files
+func stripBOM(contents []byte) ([]byte, error) {
+	if bytes.HasPrefix(contents, utf16LEBOM) || bytes.HasPrefix(contents, utf16BEBOM) {
+		return nil, fmt.Errorf("file is encoded as UTF-16, please re-save it as UTF-8")
+	}
+	return bytes.TrimPrefix(contents, utf8BOM), nil
+}
+
+// normalizeNewlines converts CRLF and lone CR line endings to LF
+func normalizeNewlines(contents []byte) []byte {
+	contents = bytes.Replace(contents, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(contents, []byte("\r"), []byte("\n"), -1)
+}
+
+// MultipleDocumentsError is returned for an authors file made of several YAML
+// documents (e.g. concatenated files), only the first of which would be read.
+// Line is the line of the `---` separator starting the second document.
+type MultipleDocumentsError struct {
+	Documents int
+	Line      int
+}
+
+func (e *MultipleDocumentsError) Error() string {
+	return fmt.Sprintf("file contains %d YAML documents, remove the `---` separator on line %d so none are ignored",
+		e.Documents, e.Line)
+}
+
+// checkSingleDocument returns a *MultipleDocumentsError if contents has more
+// than one YAML document with something in it. A separator before the only
+// document or after it (with nothing but comments following) is fine.
+func checkSingleDocument(contents []byte) error {
+	// documents counts those with content, separator is the line of the last
+	// `---` and second that of the one starting the second document
+	documents, separator, second := 0, 0, 0
+	content := false
+
+	for i, text := range bytes.Split(contents, []byte("\n")) {
+		if bytes.Equal(text, []byte("---")) || bytes.HasPrefix(text, []byte("--- ")) || bytes.HasPrefix(text, []byte("---\t")) {
+			content = false
+			separator = i + 1
+			text = text[3:]
+		}
+
+		trimmed := bytes.TrimSpace(text)
+		if content || len(trimmed) == 0 || trimmed[0] == '#' || trimmed[0] == '%' {
+			continue
+		}
+		content = true
+		documents++
+		if documents == 2 {
+			second = separator
+		}
+	}
+
+	if documents > 1 {
+		return &MultipleDocumentsError{Documents: documents, Line: second}
+	}
+	return nil
+}
+
+// parsePairsFile decodes an authors file of any supported version into the
+// current representation. Returns the version the file was in.
+func parsePairsFile(contents []byte) (af *pairsFile, version int, err error) {
+	if contents, err = stripBOM(contents); err != nil {
+		return nil, 0, err
+	}
+	contents = normalizeNewlines(contents)
+	if err = checkSingleDocument(contents); err != nil {
+		return nil, 0, err
+	}
+
+	// large rosters make parsing the bulk of loading, so the file is parsed
+	// once, the plain sections without the YAML decoder, and only parsed
+	// again for the version if that fails
+	rest, sections := splitPlainSections(contents)
+	af = &pairsFile{}
+	if err = yaml.Unmarshal(rest, af); err != nil {
+		header := struct {
+			Version fileVersion `yaml:"version"`
+		}{}
+		if headerErr := yaml.Unmarshal(contents, &header); headerErr != nil {
+			return nil, 0, headerErr
+		}
+		if versionErr := checkVersion(int(header.Version)); versionErr != nil {
+			return nil, 0, versionErr
+		}
+		return nil, 0, err
+	}
+	af.setPlainSections(sections)
+
+	version = int(af.Version)
+	if err = checkVersion(version); err != nil {
+		return nil, 0, err
+	}
+
+	for v := version; v < AuthorsFileVersion; v++ {
+		if err = migrations[v].migrate(af); err != nil {
+			return nil, 0, fmt.Errorf("could not migrate from version %d: %v", v, err)
+		}
+	}
+	af.Version = AuthorsFileVersion
+	af.LegacyPairs = nil
+
+	if af.Pairs, af.Teams, err = af.Authors.flatten(); err != nil {
+		return nil, 0, err
+	}
+	af.Meta, af.Emails, af.Keys, af.NameFormats = af.Authors.structured()
+	if err = af.normalizeKeys(); err != nil {
+		return nil, 0, err
+	}
+	if err = checkNameFormat(af.NameFormat); err != nil {
+		return nil, 0, err
+	}
+
+	return af, version, nil
+}
+
+// checkVersion returns an error if version is newer than AuthorsFileVersion
+func checkVersion(version int) error {
+	if version > AuthorsFileVersion {
+		return fmt.Errorf(
+			"file is version %d but this git-duet only understands up to version %d, please upgrade git-duet",
+			version, AuthorsFileVersion)
+	}
+	return nil
+}
+
+// checkMigratable returns an error if filename cannot be rewritten: only YAML
+// files can, and the cached copies of files fetched from a URL would only be
+// overwritten by the next fetch
+func checkMigratable(filename string) error {
+	if format, err := authorsFileFormat(filename, filename); err != nil {
+		return err
+	} else if format != AuthorsFormatYAML {
+		return fmt.Errorf("%s is a TOML file, only YAML authors files can be migrated", filename)
+	}
+	if cache, err := AuthorsFileCacheDir(); err == nil && filepath.Dir(filename) == cache {
+		return fmt.Errorf("%s is the cached copy of an authors file fetched from a URL, migrate the file at the URL instead", filename)
+	}
+	return nil
+}
+
+// versionKeyRegexp matches the top-level `version` line
+var versionKeyRegexp = regexp.MustCompile(`^version\s*:`)
+
+// MigrateFile rewrites the authors file filename in the newest version, in
+// place, keeping the original with a `.bak` suffix. The file is edited line by
+// line by the rewrite of each migration, keeping its comments and the order of
+// its keys, and `version` is set. Files already in the newest version are left
+// untouched. Unlike reading (see NewPairsFromFS), migrating always works on
+// the OS filesystem, and only on YAML files.
+func MigrateFile(filename string) error {
+	if err := checkMigratable(filename); err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	af, version, err := parsePairsFile(contents)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %v", filename, err)
+	}
+	if version == AuthorsFileVersion {
+		return nil
+	}
+
+	stripped, _ := stripBOM(contents)
+	lines := strings.SplitAfter(string(stripped), "\n")
+	for v := version; v < AuthorsFileVersion; v++ {
+		lines = migrations[v].rewrite(lines)
+	}
+	migrated := []byte(strings.Join(setVersion(lines, AuthorsFileVersion), ""))
+
+	// the file is edited line by line, make sure it still says what was meant
+	want, err := yaml.Marshal(af)
+	if err != nil {
+		return err
+	}
+	if edited, _, err := parsePairsFile(migrated); err != nil {
+		return fmt.Errorf("could not migrate %s, migrate it by hand: %v", filename, err)
+	} else if got, err := yaml.Marshal(edited); err != nil || !bytes.Equal(got, want) {
+		return fmt.Errorf("could not migrate %s, migrate it by hand", filename)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filename+".bak", contents, info.Mode()); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, migrated, info.Mode())
+}
+
+// setVersion sets the top-level `version` of the lines of an authors file,
+// adding it before the first key (after the comments heading the file) if the
+// file has none
+func setVersion(lines []string, version int) []string {
+	newline := "\n"
+	if len(lines) > 0 && strings.HasSuffix(lines[0], "\r\n") {
+		newline = "\r\n"
+	}
+	line := fmt.Sprintf("version: %d", version)
+
+	for i, existing := range lines {
+		if versionKeyRegexp.MatchString(existing) {
+			lines[i] = line + existing[len(strings.TrimRight(existing, "\r\n")):]
+			return lines
+		}
+	}
+	for i, existing := range lines {
+		content := strings.TrimSpace(existing)
+		if content == "" || strings.HasPrefix(content, "#") || strings.HasPrefix(content, "%") || content == "---" {
+			continue
+		}
+		return append(lines[:i], append([]string{line + newline}, lines[i:]...)...)
+	}
+	return append(lines, line+newline)
+}
+
+// StructureAuthorsFile rewrites the authors given as "Name; username" strings
+// in the authors file filename as structured entries (see authorSpec), with
+// the email pairs resolves for them now as their `email`, so that the file
+// resolves the same once migrated. Authors with labeled `email_addresses` keep
+// picking from them, and those with fields past the username are left as they
+// are and reported in skipped. The file is edited line by line, keeping its
+// comments and the order of its keys. Returns the file migrated, nil if it has
+// no authors to migrate, and writes it over filename (keeping the original
+// with a `.bak` suffix like MigrateFile) unless dryRun.
+func StructureAuthorsFile(filename string, pairs *Pairs, dryRun bool) (migrated []byte, skipped []error, err error) {
+	if err = checkMigratable(filename); err != nil {
+		return nil, nil, err
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	af, _, err := parsePairsFile(contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse %s: %v", filename, err)
+	}
+
+	specs := map[string]*authorSpec{}
+	moved := map[string]bool{}
+	structure := func(initials string, value authorValue) (authorValue, error) {
+		if value.spec != nil {
+			return value, nil
+		}
+		name, username, extra := parseAuthor(value.author)
+		if name == "" {
+			return value, nil
+		}
+		if len(extra) > 0 {
+			skipped = append(skipped, fmt.Errorf("author %s has fields after the username (%s), leaving it as it is",
+				initials, strings.Join(extra, "; ")))
+			return value, nil
+		}
+
+		pair, err := pairs.ByInitials(initials)
+		if err != nil {
+			return value, err
+		}
+		spec := &authorSpec{Name: name, Username: username}
+		if addresses, ok := af.EmailAddresses[pair.Initials]; !ok || addresses.labeled == nil {
+			spec.Email = pair.Email
+			if pair.RealEmail != "" {
+				spec.Email = pair.RealEmail
+			}
+			// the explicit email takes precedence over it from now on
+			delete(af.EmailAddresses, pair.Initials)
+			moved[pair.Initials] = true
+		}
+		specs[initials] = spec
+		return authorValue{spec: spec}, nil
+	}
+
+	for key, entry := range af.Authors {
+		if entry.raw != nil {
+			continue
+		}
+		if entry.team == nil {
+			if entry.author, err = structure(key, entry.author); err != nil {
+				return nil, nil, err
+			}
+		}
+		for initials, author := range entry.team {
+			if entry.team[initials], err = structure(initials, author); err != nil {
+				return nil, nil, err
+			}
+		}
+		af.Authors[key] = entry
+	}
+	if len(specs) == 0 {
+		return nil, skipped, nil
+	}
+
+	migrated, err = restructureAuthors(contents, specs, func(key string) bool {
+		return moved[af.normalizeInitials(key)]
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// the file is edited line by line, make sure it still says what was meant
+	want, err := yaml.Marshal(af)
+	if err != nil {
+		return nil, nil, err
+	}
+	if edited, _, err := parsePairsFile(migrated); err != nil {
+		return nil, nil, fmt.Errorf("could not migrate %s, migrate it by hand: %v", filename, err)
+	} else if got, err := yaml.Marshal(edited); err != nil || !bytes.Equal(got, want) {
+		return nil, nil, fmt.Errorf("could not migrate %s, migrate it by hand", filename)
+	}
+	if dryRun {
+		return migrated, skipped, nil
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = ioutil.WriteFile(filename+".bak", contents, info.Mode()); err != nil {
+		return nil, nil, err
+	}
+	return migrated, skipped, ioutil.WriteFile(filename, migrated, info.Mode())
+}
+
+// emailAddressesKeyRegexp matches the line starting the top-level
+// `email_addresses` mapping
+var emailAddressesKeyRegexp = regexp.MustCompile(`^email_addresses\s*:\s*(?:#.*)?$`)
+
+// restructureAuthors edits contents line by line, replacing the lines of the
+// authors in specs (keyed as in the file) with their structured entries and
+// removing the `email_addresses` of the keys moved reports, along with the
+// mapping if none are left. Comments, trailing ones included, are kept.
+func restructureAuthors(contents []byte, specs map[string]*authorSpec, moved func(key string) bool) (edited []byte, err error) {
+	newline := "\n"
+	if strings.Contains(string(contents), "\r\n") {
+		newline = "\r\n"
+	}
+
+	var b strings.Builder
+	// the `email_addresses:` line is held back until an address is kept,
+	// along with the blank and comment lines after it
+	var held []string
+	flush := func(header bool) {
+		for i, line := range held {
+			if i > 0 || header {
+				b.WriteString(line)
+			}
+		}
+		held = nil
+	}
+
+	section, indent := "", 0
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		trimmed := strings.TrimRight(line, " \t\r\n")
+		content := strings.TrimLeft(trimmed, " ")
+		if content != "" && !strings.HasPrefix(content, "#") && len(content) == len(trimmed) {
+			flush(false)
+			section, indent = "", 0
+			switch {
+			case authorsKeyRegexp.MatchString(trimmed):
+				section = "authors"
+			case emailAddressesKeyRegexp.MatchString(trimmed):
+				section = "email_addresses"
+				held = append(held, line)
+				continue
+			}
+		}
+
+		// the entries of the section are indented like its first line
+		if indent == 0 && content != "" && !strings.HasPrefix(content, "#") {
+			indent = len(trimmed) - len(content)
+		}
+		key, comment, scalar := yamlEntry(content)
+		switch {
+		case section == "authors" && scalar && specs[key] != nil:
+			entry, err := yaml.Marshal(map[string]*authorSpec{key: specs[key]})
+			if err != nil {
+				return nil, err
+			}
+			for i, entryLine := range strings.Split(strings.TrimRight(string(entry), "\n"), "\n") {
+				if i == 0 && comment != "" {
+					entryLine += " " + comment
+				}
+				b.WriteString(strings.Repeat(" ", len(trimmed)-len(content)) + entryLine + newline)
+			}
+		case section == "email_addresses" && scalar && len(trimmed)-len(content) == indent && moved(key):
+		case held != nil && (content == "" || strings.HasPrefix(content, "#")):
+			held = append(held, line)
+		default:
+			flush(true)
+			b.WriteString(line)
+		}
+	}
+	flush(false)
+
+	return []byte(b.String()), nil
+}
+
+// yamlEntry returns the key of content, a line of a YAML mapping without its
+// indentation, and its trailing comment if it sets the key to a string on the
+// same line (scalar), e.g. `jd: Jane Doe # on leave`
+func yamlEntry(content string) (key, comment string, scalar bool) {
+	if content == "" || strings.HasPrefix(content, "#") {
+		return "", "", false
+	}
+	// the comment starts at the first " #" that leaves an entry before it,
+	// rather than one inside a quoted value
+	for i := strings.Index(content, " #"); i >= 0; {
+		if key, ok := yamlScalarKey(content[:i]); ok {
+			return key, strings.TrimSpace(content[i:]), true
+		}
+		next := strings.Index(content[i+2:], " #")
+		if next < 0 {
+			break
+		}
+		i += next + 2
+	}
+	key, scalar = yamlScalarKey(content)
+	return key, "", scalar
+}
+
+// yamlScalarKey returns the key entry, a YAML mapping of a single key, sets
+// if it sets it to a string
+func yamlScalarKey(entry string) (key string, ok bool) {
+	// decoded like the authors file, keys such as `on` staying strings
+	var mapping map[string]interface{}
+	if err := yaml.Unmarshal([]byte(entry), &mapping); err != nil || len(mapping) != 1 {
+		return "", false
+	}
+	for key, value := range mapping {
+		_, ok = value.(string)
+		return key, ok
+	}
+	return "", false
+}
@@ -0,0 +1,97 @@
+package duet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMigrations runs MigrateFile on the fixtures of each migration step in
+// testdata/migrations/<version>, each file.yml in that version migrated to
+// file.golden, or failing with the error in file.err
+func TestMigrations(t *testing.T) {
+	for version := range migrations {
+		fixtures, err := filepath.Glob(filepath.Join("testdata", "migrations", fmt.Sprint(version), "*.yml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fixtures) == 0 {
+			t.Errorf("the migration from version %d has no fixtures", version)
+		}
+
+		for _, fixture := range fixtures {
+			name := strings.TrimSuffix(fixture, ".yml")
+			t.Run(fmt.Sprintf("%d/%s", version, filepath.Base(name)), func(t *testing.T) {
+				original, err := ioutil.ReadFile(fixture)
+				if err != nil {
+					t.Fatal(err)
+				}
+				filename := filepath.Join(t.TempDir(), "authors.yml")
+				if err = ioutil.WriteFile(filename, original, 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				err = MigrateFile(filename)
+				if want, readErr := ioutil.ReadFile(name + ".err"); readErr == nil {
+					wantErr := fmt.Sprintf("could not parse %s: %s", filename, strings.TrimSpace(string(want)))
+					if err == nil || err.Error() != wantErr {
+						t.Fatalf("MigrateFile() = %v, want %s", err, wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("MigrateFile() = %v", err)
+				}
+
+				want, err := ioutil.ReadFile(name + ".golden")
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadFile(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("migrated file =\n%s\nwant\n%s", got, want)
+				}
+				if backup, err := ioutil.ReadFile(filename + ".bak"); err != nil || string(backup) != string(original) {
+					t.Errorf("backup = %q (%v), want the original file", backup, err)
+				}
+
+				// the migrated file decodes as the original did
+				decoded, from, err := parsePairsFile(original)
+				if err != nil {
+					t.Fatal(err)
+				}
+				migrated, to, err := parsePairsFile(got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if from != version || to != AuthorsFileVersion {
+					t.Errorf("migrated from version %d to %d, want %d to %d", from, to, version, AuthorsFileVersion)
+				}
+				if !reflect.DeepEqual(migrated, decoded) {
+					t.Errorf("migrated file decodes as %#v, want %#v", migrated, decoded)
+				}
+			})
+		}
+	}
+}
+
+func TestMigrateFileLeavesNewestVersion(t *testing.T) {
+	contents := "version: 1\nauthors:\n  jd: Jane Doe\n"
+	filename := filepath.Join(t.TempDir(), "authors.yml")
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateFile(filename); err != nil {
+		t.Fatalf("MigrateFile() = %v", err)
+	}
+	if _, err := ioutil.ReadFile(filename + ".bak"); err == nil {
+		t.Error("MigrateFile() backed up a file in the newest version")
+	}
+}
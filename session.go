@@ -0,0 +1,106 @@
+package duet
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SessionDuration returns how long the configured people have been pairing:
+// since the pair was last set with different people, as setting the same
+// people again (in whatever roles) keeps the session going. Configurations
+// written before sessions were recorded count from when they were last set.
+// Returns false if nothing is configured, and zero rather than a negative
+// duration if the clock went back.
+func (gc *GitConfig) SessionDuration() (d time.Duration, ok bool, err error) {
+	start, err := gc.GetSessionStart()
+	if err != nil || start.IsZero() {
+		return 0, false, err
+	}
+	return sessionDuration(start, time.Now()), true, nil
+}
+
+// GetSessionStart returns when the configured people started pairing (see
+// SessionDuration), zero Time if nothing is configured
+func (gc *GitConfig) GetSessionStart() (start time.Time, err error) {
+	startString, err := gc.getKey("session-start")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if startString == "" {
+		return gc.GetMtime()
+	}
+
+	startUnix, err := strconv.ParseInt(startString, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(startUnix, 0), nil
+}
+
+// sessionDuration is the time from start to now, clamped to zero
+func sessionDuration(start, now time.Time) time.Duration {
+	if d := now.Sub(start); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// FormatSessionDuration renders d in hours and minutes (e.g. 2h13m, 45m)
+func FormatSessionDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "0m"
+	}
+	return strings.TrimSuffix(d.Truncate(time.Minute).String(), "0s")
+}
+
+// updateSession starts a new session unless the people configured are those of
+// the current one. Called once the committers are set, as the author alone is
+// only half of a change of pair.
+func (gc *GitConfig) updateSession() (err error) {
+	author, err := gc.GetAuthor()
+	if err != nil {
+		return err
+	}
+	committers, err := gc.GetCommitters()
+	if err != nil {
+		return err
+	}
+	members := sessionMembers(author, committers)
+
+	current, err := gc.getKey("session-members")
+	if err != nil {
+		return err
+	}
+	start, err := gc.getKey("session-start")
+	if err != nil {
+		return err
+	}
+	if current == members && start != "" {
+		return nil
+	}
+
+	if err = gc.setKey("session-members", members); err != nil {
+		return err
+	}
+	// a new session rotates from scratch (see RotateAuthorByPolicy)
+	for _, key := range []string{"rotation-branch", "rotation-time"} {
+		if err = gc.unsetKey(key); err != nil {
+			return err
+		}
+	}
+	return gc.setKey("session-start", strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// sessionMembers identifies the people of a session by their sorted initials
+func sessionMembers(author *Pair, committers []*Pair) string {
+	var initials []string
+	for _, p := range append([]*Pair{author}, committers...) {
+		if p != nil {
+			initials = append(initials, p.Initials)
+		}
+	}
+	sort.Strings(initials)
+	return strings.Join(initials, ",")
+}
@@ -0,0 +1,126 @@
+package duet
+
+import (
+	"strings"
+)
+
+// signingConfigKeys are the git config keys setSigningKey sets, each saved
+// under original-<key> (with dashes for dots) before it is first replaced
+var signingConfigKeys = []string{"user.signingkey", "gpg.format", "gpg.ssh.allowedsignersfile"}
+
+// sshKeyPrefixes start the SSH public keys git takes as user.signingkey
+var sshKeyPrefixes = []string{"key::", "ssh-", "sk-ssh-", "ecdsa-sha2-", "sk-ecdsa-sha2-"}
+
+// IsSSHSigningKey returns whether the signing key of an author is an SSH key
+// (a public key, or the path of a key file) rather than the ID of a GPG key
+func IsSSHSigningKey(key string) bool {
+	for _, prefix := range sshKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(key, ".pub") || strings.ContainsAny(key, `/\`)
+}
+
+// GitSigningKey returns the signing key of an author as git takes it, the
+// paths of SSH key files expanded (see ExpandPath) since git does not
+func GitSigningKey(key string) string {
+	if !IsSSHSigningKey(key) || strings.HasPrefix(key, "key::") || strings.Contains(key, " ") {
+		return key
+	}
+	return ExpandPath(key)
+}
+
+// signingConfig returns the git config making git sign commits with key:
+// user.signingkey and gpg.format, and gpg.ssh.allowedSignersFile for SSH keys
+// if AllowedSignersFile is set
+func (gc *GitConfig) signingConfig(key string) map[string]string {
+	if !IsSSHSigningKey(key) {
+		return map[string]string{"user.signingkey": key, "gpg.format": "openpgp"}
+	}
+	config := map[string]string{"user.signingkey": GitSigningKey(key), "gpg.format": "ssh"}
+	if gc.AllowedSignersFile != "" {
+		config["gpg.ssh.allowedsignersfile"] = gc.AllowedSignersFile
+	}
+	return config
+}
+
+// setSigningKey configures git to sign commits with key, the signing key of
+// the author, saving the user's own configuration to restore the first time
+// (see restoreSigningConfig). An author without a key restores it.
+func (gc *GitConfig) setSigningKey(key string) (err error) {
+	target := gc.writtenConfig()
+	if key == "" {
+		previous, err := target.getKey("git-author-signingkey")
+		if err != nil || previous == "" {
+			return err
+		}
+		if err = target.restoreSigningConfig(); err != nil {
+			return err
+		}
+		return target.unsetKey("git-author-signingkey")
+	}
+
+	config := gc.signingConfig(key)
+	for _, configKey := range signingConfigKeys {
+		value, ok := config[configKey]
+		if !ok {
+			continue
+		}
+		backup := signingConfigBackupKey(configKey)
+		saved, err := target.hasFullKey(target.Namespace + "." + backup)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			original, err := target.getUnnamespacedKey(configKey)
+			if err != nil {
+				return err
+			}
+			if err = target.setKey(backup, original); err != nil {
+				return err
+			}
+		}
+		if err = target.setUnnamespacedKey(configKey, value); err != nil {
+			return err
+		}
+	}
+	return target.setKey("git-author-signingkey", key)
+}
+
+// restoreSigningConfig puts back the git config setSigningKey replaced,
+// unsetting the keys that were not set before
+func (gc *GitConfig) restoreSigningConfig() (err error) {
+	for _, configKey := range signingConfigKeys {
+		backup := signingConfigBackupKey(configKey)
+		saved, err := gc.hasFullKey(gc.Namespace + "." + backup)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			continue
+		}
+		original, err := gc.getKey(backup)
+		if err != nil {
+			return err
+		}
+		if original == "" {
+			err = gc.unsetFullKey(configKey)
+		} else {
+			err = gc.setUnnamespacedKey(configKey, original)
+		}
+		if err != nil {
+			return err
+		}
+		if err = gc.unsetKey(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signingConfigBackupKey is the key in the namespace saving the value of the
+// git config key configKey (see setSigningKey)
+func signingConfigBackupKey(configKey string) string {
+	return "original-" + strings.Replace(configKey, ".", "-", -1)
+}
@@ -0,0 +1,55 @@
+package duet
+
+import "fmt"
+
+// SquadError is returned by ExpandSquads for a squad listing initials that
+// are not in the authors file
+type SquadError struct {
+	Squad string
+	Err   error
+}
+
+func (e *SquadError) Error() string {
+	return fmt.Sprintf("squad %s: %v", e.Squad, e.Err)
+}
+
+func (e *SquadError) Unwrap() error {
+	return e.Err
+}
+
+// Squads returns the names of the `squads` of the authors file, sorted like
+// initials (see CompareInitials)
+func (a *Pairs) Squads() (names []string) {
+	for name := range a.file.Squads {
+		names = append(names, name)
+	}
+	sortInitials(names)
+	return names
+}
+
+// SquadMembers returns the initials of the members of the squad name, nil if
+// there is no such squad
+func (a *Pairs) SquadMembers(name string) []string {
+	return a.file.Squads[a.file.normalizeInitials(name)]
+}
+
+// ExpandSquads replaces the names of squads in initials by the initials of
+// their members, keeping the order (`git duet backend zp` is `git duet jd fb
+// zp` if backend is jd and fb). Initials of an author win over a squad of the
+// same name. Returns a *SquadError if a squad lists unknown initials.
+func (a *Pairs) ExpandSquads(initials []string) (expanded []string, err error) {
+	for _, i := range initials {
+		members := a.SquadMembers(i)
+		if members == nil || a.HasInitials(i) {
+			expanded = append(expanded, i)
+			continue
+		}
+		for _, member := range members {
+			if !a.HasInitials(member) {
+				return nil, &SquadError{Squad: i, Err: a.unknownInitials(member)}
+			}
+		}
+		expanded = append(expanded, members...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,157 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PairingRecord summarizes how often and how recently two people paired
+type PairingRecord struct {
+	Count int
+	Last  time.Time
+}
+
+// PairingStats holds pairing records keyed by initials and then by the
+// initials of the partner
+type PairingStats map[string]map[string]PairingRecord
+
+// Add records that a and b paired at the given time (in both directions)
+func (s PairingStats) Add(a, b string, at time.Time) {
+	if a == b {
+		return
+	}
+	s.add(a, b, at)
+	s.add(b, a, at)
+}
+
+func (s PairingStats) add(a, b string, at time.Time) {
+	if s[a] == nil {
+		s[a] = map[string]PairingRecord{}
+	}
+	record := s[a][b]
+	record.Count++
+	if at.After(record.Last) {
+		record.Last = at
+	}
+	s[a][b] = record
+}
+
+// PairingStatsFromHistory builds pairing stats from the commits reachable from
+// HEAD in the current repository. Authors, committers and co-author trailers
+// (see TrailerKey) are matched to initials by email; unknown emails are ignored.
+func (a *Pairs) PairingStatsFromHistory() (stats PairingStats, err error) {
+	all, err := a.All()
+	if err != nil {
+		return nil, err
+	}
+	byEmail := map[string]string{}
+	for _, p := range all {
+		byEmail[strings.ToLower(p.Email)] = p.Initials
+	}
+
+	trailers := "key=" + DefaultTrailerKey
+	if key := a.TrailerKey(); key != "" {
+		trailers += ",key=" + key
+	}
+
+	// a repository without commits has no history yet
+	if err = exec.Command("git", "rev-parse", "-q", "--verify", "HEAD").Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return PairingStats{}, nil
+		}
+		return nil, fmt.Errorf("could not read history: %v", err)
+	}
+
+	// commits are NUL-terminated and their fields one per line, as neither can
+	// be part of a commit message (and so of a trailer), whatever the names
+	output := new(bytes.Buffer)
+	cmd := exec.Command("git", "log", "-z",
+		"--format=%at%n%ae%n%ce%n%(trailers:"+trailers+",valueonly,unfold)")
+	cmd.Stdout = output
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("could not read history: %v", err)
+	}
+
+	stats = PairingStats{}
+	for _, record := range strings.Split(output.String(), "\x00") {
+		fields := strings.Split(strings.TrimSpace(record), "\n")
+		if len(fields) < 3 {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		var people []string
+		for _, email := range fields[1:] {
+			email = strings.TrimSpace(email)
+			if start := strings.LastIndex(email, "<"); start != -1 {
+				email = strings.TrimSuffix(email[start+1:], ">")
+			}
+			if initials, ok := byEmail[strings.ToLower(email)]; ok {
+				people = append(people, initials)
+			}
+		}
+
+		for i := range people {
+			for j := i + 1; j < len(people); j++ {
+				stats.Add(people[i], people[j], time.Unix(timestamp, 0))
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// SuggestPartner recommends the author forInitials has paired with least
+// recently according to history, preferring people they never paired with.
+// Recency is compared by day; ties break on fewest sessions and then
+// alphabetically by initials so the suggestion is stable within a day.
+// Initials in the `exclude` list of the authors file are never suggested.
+func (a *Pairs) SuggestPartner(forInitials string, history PairingStats) (pair *Pair, err error) {
+	if forInitials, err = a.resolveInitials(forInitials); err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{forInitials: true}
+	for _, initials := range a.file.Exclude {
+		excluded[initials] = true
+	}
+
+	var candidates []string
+	for initials := range a.file.Pairs {
+		if !excluded[initials] {
+			candidates = append(candidates, initials)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no partner available for %s", forInitials)
+	}
+
+	records := history[forInitials]
+	day := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return t
+		}
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ri, rj := records[candidates[i]], records[candidates[j]]
+		if di, dj := day(ri.Last), day(rj.Last); !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		if ri.Count != rj.Count {
+			return ri.Count < rj.Count
+		}
+		return CompareInitials(candidates[i], candidates[j]) < 0
+	})
+
+	return a.ByInitials(candidates[0])
+}
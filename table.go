@@ -0,0 +1,167 @@
+package duet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// TableColumn is a column RenderTable can print
+type TableColumn string
+
+// The columns of RenderTable, named as they are given to --columns
+const (
+	ColumnInitials TableColumn = "initials"
+	ColumnName     TableColumn = "name"
+	ColumnUsername TableColumn = "username"
+	ColumnEmail    TableColumn = "email"
+	ColumnTeam     TableColumn = "team"
+)
+
+// DefaultTableColumns are the columns RenderTable prints unless told otherwise
+var DefaultTableColumns = []TableColumn{ColumnInitials, ColumnName, ColumnUsername, ColumnEmail, ColumnTeam}
+
+// minTruncatedWidth is the narrowest a column is truncated to, however
+// narrow the table has to be
+const minTruncatedWidth = 8
+
+// tableColumnPadding is the number of spaces between two columns
+const tableColumnPadding = 2
+
+// TableOptions tells RenderTable which Columns to print (DefaultTableColumns
+// if empty), whether to leave out the header line (for scripts) and the Width
+// to fit the table in, truncating long cells with … (0 never truncates).
+// Initials are never truncated.
+type TableOptions struct {
+	Columns  []TableColumn
+	NoHeader bool
+	Width    int
+}
+
+// ParseTableColumns parses a comma-separated list of column names (e.g.
+// "initials,email")
+func ParseTableColumns(s string) (columns []TableColumn, err error) {
+	for _, name := range strings.Split(s, ",") {
+		column := TableColumn(strings.ToLower(strings.TrimSpace(name)))
+		known := false
+		for _, c := range DefaultTableColumns {
+			known = known || c == column
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, the columns are initials, name, username, email and team", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// cell returns the value of column for p
+func (c TableColumn) cell(p *Pair) string {
+	switch c {
+	case ColumnInitials:
+		return p.Initials
+	case ColumnName:
+		return p.Name
+	case ColumnUsername:
+		return p.Username
+	case ColumnEmail:
+		return p.Email
+	default:
+		return p.Team
+	}
+}
+
+// RenderTable writes pairs to w as a table aligned with text/tabwriter, one
+// row per person (see TableOptions)
+func RenderTable(w io.Writer, pairs []*Pair, opts TableOptions) error {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = DefaultTableColumns
+	}
+
+	var rows [][]string
+	if !opts.NoHeader {
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = strings.ToUpper(string(c))
+		}
+		rows = append(rows, header)
+	}
+	for _, p := range pairs {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			// a tab would start a new column
+			row[i] = strings.ReplaceAll(c.cell(p), "\t", " ")
+		}
+		rows = append(rows, row)
+	}
+
+	widths := fitColumns(columns, rows, opts.Width)
+	var table bytes.Buffer
+	tw := tabwriter.NewWriter(&table, 0, 0, tableColumnPadding, ' ', 0)
+	for _, row := range rows {
+		for i := range row {
+			row[i] = truncate(row[i], widths[i])
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+
+	// rows ending in empty cells are padded up to the last column
+	for _, line := range strings.SplitAfter(table.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " \n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fitColumns returns the width of each column of rows, narrowing the widest
+// truncatable column one character at a time until the table fits in width
+// or every truncatable column is down to minTruncatedWidth
+func fitColumns(columns []TableColumn, rows [][]string, width int) (widths []int) {
+	widths = make([]int, len(columns))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	if width <= 0 {
+		return widths
+	}
+
+	total := tableColumnPadding * (len(columns) - 1)
+	for _, n := range widths {
+		total += n
+	}
+	for total > width {
+		widest := -1
+		for i, c := range columns {
+			if c != ColumnInitials && widths[i] > minTruncatedWidth && (widest < 0 || widths[i] > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		widths[widest]--
+		total--
+	}
+	return widths
+}
+
+// truncate shortens s to width characters, ending it with … if cut
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
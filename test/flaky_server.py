@@ -0,0 +1,59 @@
+#!/usr/bin/env python3
+"""Serves the files below a directory over HTTP like `python3 -m http.server`,
+misbehaving as told by a plan file first.
+
+Usage: flaky_server.py DIRECTORY PORT PLAN
+
+Every request takes the first line off PLAN (if there is one) and:
+  status CODE [RETRY-AFTER]  answers with that status (and Retry-After header)
+  sleep SECONDS              waits that long, then serves the file
+  reset                      resets the connection without answering
+An empty PLAN serves the files. Each request is appended to PLAN.log.
+"""
+
+import functools
+import http.server
+import socket
+import struct
+import sys
+import time
+
+
+class FlakyHandler(http.server.SimpleHTTPRequestHandler):
+    plan = None
+
+    def next_step(self):
+        with open(self.plan) as f:
+            lines = f.read().splitlines()
+        with open(self.plan, 'w') as f:
+            f.write(''.join(line + '\n' for line in lines[1:]))
+        with open(self.plan + '.log', 'a') as f:
+            f.write(self.path + '\n')
+        return lines[0].split() if lines else []
+
+    def do_GET(self):
+        step = self.next_step()
+        if step and step[0] == 'status':
+            self.send_response(int(step[1]))
+            if len(step) > 2:
+                self.send_header('Retry-After', step[2])
+            self.send_header('Content-Length', '0')
+            self.end_headers()
+            return
+        if step and step[0] == 'reset':
+            self.connection.setsockopt(socket.SOL_SOCKET, socket.SO_LINGER, struct.pack('ii', 1, 0))
+            self.connection.close()
+            return
+        if step and step[0] == 'sleep':
+            time.sleep(float(step[1]))
+        super().do_GET()
+
+    def log_message(self, format, *args):
+        pass
+
+
+if __name__ == '__main__':
+    directory, port, plan = sys.argv[1], int(sys.argv[2]), sys.argv[3]
+    FlakyHandler.plan = plan
+    handler = functools.partial(FlakyHandler, directory=directory)
+    http.server.ThreadingHTTPServer(('127.0.0.1', port), handler).serve_forever()
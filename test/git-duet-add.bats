@@ -0,0 +1,57 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+@test "adds an author to the authors file" {
+  run git duet-add ks "Kim Sun" --username ksun
+  assert_success "git-duet-add: Added ks to $GIT_DUET_AUTHORS_FILE"
+  run git duet --format '{{.Name}} {{.Email}}' ks jd
+  assert_success
+  assert_line 0 'Kim Sun ksun@hamster.info.local'
+}
+
+@test "adds an author with an email as a structured entry" {
+  git duet-add -q ks "Kim Sun" --email kim@sun.local
+  run git duet --format '{{.Name}} {{.Email}}' ks jd
+  assert_success
+  assert_line 0 'Kim Sun kim@sun.local'
+  run grep -A1 '  ks:' "$GIT_DUET_AUTHORS_FILE"
+  assert_success
+  assert_line 1 '    name: Kim Sun'
+}
+
+@test "keeps the rest of the authors file as it is" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+# our team
+authors:
+    jd: Jane Doe
+    # the new one
+    fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  git duet-add -q ks "Kim Sun"
+  run cat "$GIT_DUET_AUTHORS_FILE"
+  assert_success
+  assert_line 0 '# our team'
+  assert_line 3 '    # the new one'
+  assert_line 5 '    ks: Kim Sun'
+  assert_line 6 'email:'
+}
+
+@test "refuses initials that are taken" {
+  cp "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/original"
+  run git duet-add JD "Jane Dunn"
+  assert_failure 'initials JD are already taken by Jane Doe'
+  cmp "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/original"
+}
+
+@test "refuses emails that are not email addresses" {
+  run git duet-add ks "Kim Sun" --email 'kim at sun'
+  assert_failure 'email "kim at sun" for ks is not a valid email address'
+}
+
+@test "refuses the initials of several people" {
+  run git duet-add 'ks,jd' "Kim Sun"
+  assert_failure "initials \"ks,jd\" cannot be typed as one person's, leave out whitespace and any of ,+;/&|"
+}
@@ -0,0 +1,103 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# workspace makes git repositories api and web (and a plain directory docs)
+# in $WORKSPACE
+workspace() {
+  export WORKSPACE="$GIT_DUET_TEST_DIR/workspace"
+  mkdir -p "$WORKSPACE/docs"
+  git init -q "$WORKSPACE/api"
+  git init -q "$WORKSPACE/web"
+}
+
+repo_config() {
+  git -C "$WORKSPACE/$1" config --local "$GIT_DUET_CONFIG_NAMESPACE.$2"
+}
+
+@test "sets the pair in every repository of a workspace" {
+  workspace
+  run git duet --all-repos "$WORKSPACE" jd fb
+  assert_success
+  assert_equal "${lines[0]}" "$WORKSPACE/api: set"
+  assert_equal "${lines[1]}" "$WORKSPACE/web: set"
+  assert_equal "$(repo_config api git-author-initials) $(repo_config api git-committer-initials)" 'jd fb'
+  assert_equal "$(repo_config web git-author-email)" 'jane@hamsters.biz.local'
+}
+
+@test "configures SSH signing in every repository of a workspace" {
+  workspace
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+signing_keys:
+  jd: ~/.ssh/id_jane.pub
+EOF
+  export GIT_DUET_ALLOWED_SIGNERS_FILE="$GIT_DUET_TEST_DIR/allowed_signers"
+  git duet -q --all-repos "$WORKSPACE" jd fb
+  run git -C "$WORKSPACE/web" config --local gpg.format
+  assert_success 'ssh'
+  run git -C "$WORKSPACE/web" config --local gpg.ssh.allowedSignersFile
+  assert_success "$GIT_DUET_TEST_DIR/allowed_signers"
+}
+
+@test "leaves the current repository alone with --all-repos" {
+  workspace
+  git duet -q al on
+  git duet -q --all-repos "$WORKSPACE" jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'al'
+}
+
+@test "reports repositories whose authors file does not know the initials" {
+  workspace
+  unset GIT_DUET_AUTHORS_FILE
+  cp "$GIT_DUET_TEST_DIR/.git-authors" "$GIT_DUET_TEST_REPO/.git-authors"
+  cat > "$WORKSPACE/web/.git-authors" <<'EOF'
+authors:
+  jd: Jane Doe
+email:
+  domain: web.local
+EOF
+  run git duet --all-repos "$WORKSPACE" jd fb
+  assert_failure
+  assert_line "$WORKSPACE/api: set"
+  assert_line "$WORKSPACE/web: unknown initials, $WORKSPACE/web/.git-authors does not know fb"
+  run repo_config web git-author-initials
+  assert_failure
+}
+
+@test "carries on past repositories the pair cannot be set in" {
+  workspace
+  mkdir -p "$WORKSPACE/broken/.git"
+  run git duet --all-repos "$WORKSPACE" jd fb
+  assert_failure
+  assert_line "$WORKSPACE/api: set"
+  [[ "$output" == *"$WORKSPACE/broken: failed, not a git repository: "* ]]
+  assert_line "$WORKSPACE/web: set"
+}
+
+@test "prints the outcome in every repository as JSON with --format json" {
+  workspace
+  run bash -c "git duet --all-repos '$WORKSPACE' --format json jd fb | jq -c '[.[] | [(.path | split(\"/\") | last), .status]]'"
+  assert_success '[["api","set"],["web","set"]]'
+}
+
+@test "fails without changing anything for unknown initials with --all-repos" {
+  workspace
+  run git duet --all-repos "$WORKSPACE" jd xx
+  assert_failure
+  [[ "$output" == "unknown initials xx"* ]]
+  run repo_config api git-author-initials
+  assert_failure
+}
+
+@test "rejects --all-repos with --global" {
+  workspace
+  run git duet --all-repos "$WORKSPACE" --global jd fb
+  assert_failure '--all-repos sets the pair in the config of each repository, it does not go with --global or --dry-run'
+}
+
+@test "fails for a workspace without repositories" {
+  mkdir -p "$GIT_DUET_TEST_DIR/empty"
+  run git duet --all-repos "$GIT_DUET_TEST_DIR/empty" jd fb
+  assert_failure "there are no git repositories in $GIT_DUET_TEST_DIR/empty"
+}
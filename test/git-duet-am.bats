@@ -0,0 +1,121 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# make_patches writes two patches by Patch Author changing file ($1, a new file
+# by default) to $GIT_DUET_TEST_DIR/patches.mbox
+make_patches() {
+  local file="${1:-patched.txt}"
+  git checkout -q -b patches
+  for n in 1 2; do
+    echo "patch $n" > "$file"
+    git add "$file"
+    GIT_AUTHOR_NAME='Patch Author' GIT_AUTHOR_EMAIL='patch@author.local' git commit -q -m "patch $n"
+  done
+  git format-patch -q --stdout master > "$GIT_DUET_TEST_DIR/patches.mbox"
+  git checkout -q master
+  git branch -q -D patches
+}
+
+@test "keeps the author of every patch" {
+  make_patches
+  git duet -q jd fb
+  git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  run git log -2 --format='%an <%ae>'
+  assert_success
+  assert_line 0 'Patch Author <patch@author.local>'
+  assert_line 1 'Patch Author <patch@author.local>'
+}
+
+@test "lists the omega of the duet as committer of every patch" {
+  make_patches
+  git duet -q jd fb
+  git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  run git log -2 --format='%cn <%ce>'
+  assert_success
+  assert_line 0 'Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "lists the soloist as committer of every patch" {
+  make_patches
+  git solo -q jd
+  git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  run git log -2 --format='%an <%ae> / %cn <%ce>'
+  assert_success
+  assert_line 0 'Patch Author <patch@author.local> / Jane Doe <jane@hamsters.biz.local>'
+  assert_line 1 'Patch Author <patch@author.local> / Jane Doe <jane@hamsters.biz.local>'
+}
+
+@test "does not add a signoff or co-author trailers to the patches" {
+  make_patches
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  run git log -1 --format=%B
+  assert_success 'patch 2'
+}
+
+@test "passes conflicts through and continues with the pair as committer" {
+  make_patches foo
+  echo 'conflicting' > foo
+  git commit -q -am 'conflicting change'
+  git duet -q jd fb
+
+  run git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  assert_failure
+  [ -d .git/rebase-apply ]
+
+  echo 'patch 1' > foo
+  git add foo
+  git duet-am --continue
+  [ ! -d .git/rebase-apply ]
+  run git log -2 --format='%an <%ae> / %cn <%ce>'
+  assert_success
+  assert_line 0 'Patch Author <patch@author.local> / Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'Patch Author <patch@author.local> / Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "passes --abort through" {
+  make_patches foo
+  echo 'conflicting' > foo
+  git commit -q -am 'conflicting change'
+  local head="$(git rev-parse HEAD)"
+  git duet -q jd fb
+
+  run git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  assert_failure
+  run git duet-am --abort
+  assert_success
+  [ ! -d .git/rebase-apply ]
+  assert_equal "$head" "$(git rev-parse HEAD)"
+}
+
+@test "credits the pair in every patch with --co-authored-by" {
+  make_patches
+  git duet -q jd fb
+  local base="$(git rev-parse HEAD)"
+  git duet-am -q --co-authored-by "$GIT_DUET_TEST_DIR/patches.mbox"
+  run git log -2 --format='%s / %an / %cn / %(trailers:key=Co-authored-by,valueonly,separator=%x2C )'
+  assert_success
+  assert_line 0 'patch 2 / Patch Author / Frances Bar / Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'patch 1 / Patch Author / Frances Bar / Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+  assert_equal "$base" "$(git rev-parse HEAD~2)"
+}
+
+@test "credits the pair once the patches are applied after conflicts" {
+  make_patches foo
+  echo 'conflicting' > foo
+  git commit -q -am 'conflicting change'
+  git duet -q jd fb
+
+  run git duet-am -q "$GIT_DUET_TEST_DIR/patches.mbox"
+  assert_failure
+  echo 'patch 1' > foo
+  git add foo
+  git duet-am --co-authored-by --continue
+  run git log -3 --format='%s: %(trailers:key=Co-authored-by,valueonly,separator=%x2C )'
+  assert_success
+  assert_line 0 'patch 2: Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'patch 1: Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+  assert_line 2 'conflicting change: '
+}
@@ -0,0 +1,164 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# commit_as_other commits file ($1) with contents ($2) as Other Person (both
+# author and committer) on the branch other
+commit_as_other() {
+  git checkout -q -B other
+  echo "$2" > "$1"
+  git add "$1"
+  GIT_AUTHOR_NAME='Other Person' GIT_AUTHOR_EMAIL='other@person.local' \
+    GIT_COMMITTER_NAME='Other Person' GIT_COMMITTER_EMAIL='other@person.local' \
+    git commit -q -m "change $1"
+  git checkout -q master
+}
+
+setup_branches() {
+  add_file base.txt
+  git commit -q -m 'base'
+  commit_as_other one.txt 1
+}
+
+@test "keeps the author, makes the pair the committer and credits the pair" {
+  setup_branches
+  git duet -q jd fb
+
+  run git duet-cherry-pick other
+  assert_success
+  run git log -1 --format='%an <%ae> / %cn <%ce>'
+  assert_success 'Other Person <other@person.local> / Frances Bar <f.bar@hamster.info.local>'
+  run git log -1 --format='%B'
+  assert_success 'change one.txt
+
+Co-authored-by: Jane Doe <jane@hamsters.biz.local>
+Co-authored-by: Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "credits the pair in every picked commit but not their own author" {
+  setup_branches
+  git checkout -q other
+  add_file two.txt
+  GIT_AUTHOR_NAME='Jane Doe' GIT_AUTHOR_EMAIL='jane@hamsters.biz.local' git commit -q -m 'change two.txt'
+  git checkout -q master
+  git duet -q jd fb
+
+  run git duet-cherry-pick master..other
+  assert_success
+  run git log -2 --format='%an: %(trailers:key=Co-authored-by,valueonly,separator=%x2C )'
+  assert_success
+  assert_line 0 'Jane Doe: Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'Other Person: Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "does not credit anyone twice" {
+  add_file base.txt
+  git commit -q -m 'base'
+  git checkout -q -b other
+  add_file one.txt
+  git commit -q -m 'change one.txt' -m 'Co-authored-by: Frances Bar <f.bar@hamster.info.local>'
+  git checkout -q master
+  git duet -q jd fb
+
+  git duet-cherry-pick other
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Frances Bar <f.bar@hamster.info.local>
+Jane Doe <jane@hamsters.biz.local>'
+}
+
+@test "credits nobody when soloing" {
+  setup_branches
+  git solo -q jd
+
+  git duet-cherry-pick other
+  run git log -1 --format='%B / %cn'
+  assert_success 'change one.txt
+ / Jane Doe'
+}
+
+@test "credits the pair after resolving conflicts with --continue" {
+  add_file base.txt
+  git commit -q -m 'base'
+  commit_as_other foo 'other'
+  echo master > foo
+  git add foo
+  git commit -q -m 'master foo'
+  git duet -q jd fb
+
+  run git duet-cherry-pick other
+  assert_failure
+  echo resolved > foo
+  git add foo
+  git duet-cherry-pick --continue
+  run git log -1 --format='%an / %cn / %(trailers:key=Co-authored-by,valueonly,separator=%x2C )'
+  assert_success 'Other Person / Frances Bar / Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+  run git log -1 --format='%B'
+  assert_success 'change foo
+
+Co-authored-by: Jane Doe <jane@hamsters.biz.local>
+Co-authored-by: Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "does not start cherry-picking without a pair" {
+  setup_branches
+  local head="$(git rev-parse HEAD)"
+
+  run git duet-cherry-pick other
+  assert_failure 'git-author not set'
+  assert_equal "$head" "$(git rev-parse HEAD)"
+}
+
+# fake_editor makes GIT_EDITOR append the message it edits to
+# $GIT_DUET_TEST_DIR/edited
+fake_editor() {
+  export GIT_EDITOR="cat >> '$GIT_DUET_TEST_DIR/edited' <"
+}
+
+@test "opens the editor after crediting the pair with --edit" {
+  setup_branches
+  git duet -q jd fb
+  fake_editor
+
+  run git duet-cherry-pick -e other
+  assert_success
+  run grep -c '^Co-authored-by: ' "$GIT_DUET_TEST_DIR/edited"
+  assert_success '2'
+}
+
+@test "does not open the editor without --edit" {
+  setup_branches
+  git duet -q jd fb
+  fake_editor
+
+  run git duet-cherry-pick other
+  assert_success
+  [ ! -e "$GIT_DUET_TEST_DIR/edited" ]
+}
+
+@test "keeps opening the editor with --edit after resolving conflicts" {
+  add_file base.txt
+  git commit -q -m 'base'
+  commit_as_other foo 'other'
+  git checkout -q other
+  add_file two.txt
+  git commit -q -m 'change two.txt'
+  git checkout -q master
+  echo master > foo
+  git add foo
+  git commit -q -m 'master foo'
+  git duet -q jd fb
+  fake_editor
+
+  run git duet-cherry-pick -e master..other
+  assert_failure
+  echo resolved > foo
+  git add foo
+  run git duet-cherry-pick --continue
+  assert_success
+  run grep -c '^change ' "$GIT_DUET_TEST_DIR/edited"
+  assert_success '2'
+  run git log -2 --format='%s: %cn / %(trailers:key=Co-authored-by,valueonly,separator=%x2C )'
+  assert_success
+  assert_line 0 'change two.txt: Frances Bar / Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'change foo: Frances Bar / Jane Doe <jane@hamsters.biz.local>, Frances Bar <f.bar@hamster.info.local>'
+}
@@ -0,0 +1,102 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# commit_with_message commits with the message given (the hook installed)
+commit_with_message() {
+  git duet-install-hook -q commit-msg
+  git commit -q --allow-empty -m "$1"
+}
+
+@test "accepts co-author trailers crediting people in the authors file" {
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar <f.bar@hamster.info.local>')"
+  assert_success
+}
+
+@test "accepts messages without trailers when not pairing" {
+  run commit_with_message 'Add feature'
+  assert_success
+}
+
+@test "rejects a co-author trailer without email, suggesting the correct one" {
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar')"
+  assert_failure
+  assert_line 'git-duet: the co-author trailers of the commit message are wrong:'
+  assert_line '  line 3: "Co-authored-by: Frances Bar" has no email, use "Co-authored-by: Frances Bar <f.bar@hamster.info.local>"'
+}
+
+@test "rejects a co-author trailer without angle brackets" {
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar f.bar@hamster.info.local')"
+  assert_failure
+  assert_line '  line 3: "Co-authored-by: Frances Bar f.bar@hamster.info.local" has no email in angle brackets, use "Co-authored-by: Frances Bar <f.bar@hamster.info.local>"'
+}
+
+@test "rejects a co-author trailer crediting someone not in the authors file" {
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Someone Else <someone@else.local>')"
+  assert_failure
+  assert_line '  line 3: "Co-authored-by: Someone Else <someone@else.local>" credits someone who is not in the authors file'
+}
+
+@test "rejects a co-author trailer with an email not in the authors file" {
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar <frances@else.local>')"
+  assert_failure
+  assert_line '  line 3: "Co-authored-by: Frances Bar <frances@else.local>" credits fb with an email that is not in the authors file, use "Co-authored-by: Frances Bar <f.bar@hamster.info.local>"'
+}
+
+@test "rejects messages without co-author trailers when pairing in co-authored-by mode" {
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  rm .git/hooks/prepare-commit-msg
+  export GIT_DUET_CO_AUTHORED_BY=1
+  run commit_with_message 'Add feature'
+  assert_failure
+  assert_line '  there is no Co-authored-by trailer although pairing with fb, add "Co-authored-by: Frances Bar <f.bar@hamster.info.local>"'
+}
+
+@test "accepts the trailers added by the prepare-commit-msg hook" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb zs
+  run commit_with_message 'Add feature'
+  assert_success
+}
+
+@test "does not check fixup! and squash! commits" {
+  run commit_with_message "$(printf 'fixup! Add feature\n\nCo-authored-by: Frances Bar')"
+  assert_success
+  run commit_with_message "$(printf 'squash! Add feature\n\nCo-authored-by: Frances Bar')"
+  assert_success
+}
+
+@test "does not check merge commits" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb
+  create_branch_commit
+  rm .git/hooks/prepare-commit-msg
+  git duet-install-hook -q commit-msg
+  run git merge -q --no-ff -m 'Merge branch new_branch' new_branch
+  assert_success
+}
+
+@test "accepts the trailers of the pair when an unrelated author cannot be resolved" {
+  echo "allowed_domains: [hamsters.biz.local, hamster.info.local]" >> "$GIT_DUET_AUTHORS_FILE"
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar <f.bar@hamster.info.local>')"
+  assert_success
+
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar <f.bar@hamster.info.local>\nCo-authored-by: Zubaz Pants <z.pants@hamster.info.local>')"
+  assert_success
+
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar <f.bar@hamster.info.local>\nCo-authored-by: Zubaz Shirts <z.shirts@pika.info.local>')"
+  assert_failure
+  assert_line '  line 4: "Co-authored-by: Zubaz Shirts <z.shirts@pika.info.local>" credits someone who is not in the authors file'
+}
+
+@test "only looks up the emails of the authors a wrong trailer may credit" {
+  printf '#!/usr/bin/env bash\necho "$1" >> "%s/looked-up"\necho "$1@lookie.me.local"\n' "$GIT_DUET_TEST_DIR" > "$GIT_DUET_TEST_LOOKUP"
+  export GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP
+  run commit_with_message "$(printf 'Add feature\n\nCo-authored-by: Frances Bar <frances@else.local>')"
+  assert_failure
+  assert_line '  line 3: "Co-authored-by: Frances Bar <frances@else.local>" credits fb with an email that is not in the authors file, use "Co-authored-by: Frances Bar <fb@lookie.me.local>"'
+  run cat "$GIT_DUET_TEST_DIR/looked-up"
+  assert_success 'fb'
+}
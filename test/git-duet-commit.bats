@@ -79,6 +79,21 @@ load test_helper
   assert_success 'Jane Doe <jane@hamsters.biz.local>'
 }
 
+@test "GIT_DUET_ROTATE_AUTHOR cycles through the whole mob" {
+  git duet -q jd fb zs al
+
+  for file in first second third fourth fifth; do
+    add_file "$file.txt"
+    GIT_DUET_ROTATE_AUTHOR=1 git duet-commit -q -m "$file"
+  done
+  run git log -5 --reverse --format='%an / %cn'
+  assert_success 'Jane Doe / Frances Bar
+Frances Bar / Zubaz Shirts
+Zubaz Shirts / Abraham Lincoln
+Abraham Lincoln / Jane Doe
+Jane Doe / Frances Bar'
+}
+
 @test "GIT_DUET_ROTATE_AUTHOR updates the correct config" {
   git duet -q -g jd fb
   run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
@@ -210,3 +225,283 @@ load test_helper
   assert_failure
   assert_line "your git duet settings are stale"
 }
+
+@test "commits as user.name and user.email once the pair has expired" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.expires" 1
+  add_file
+  run git duet-commit -q -m 'Testing expired pair'
+  assert_success
+  [[ $output = "git-duet: the pair expired at "*", set it again with \`git duet\` or \`git solo\`"* ]]
+  run git log -1 --format='%an <%ae> %cn <%ce>'
+  assert_success 'Test User <test@example.com> Test User <test@example.com>'
+}
+
+@test "fails once the pair has expired without user.name" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.expires" 1
+  git config user.name ""
+  add_file
+  run git duet-commit -q -m 'Testing expired pair'
+  assert_failure
+  [[ $output = "the pair expired at "* ]]
+}
+
+@test "commits as the pair until it expires" {
+  GIT_DUET_EXPIRE_AFTER=3600 git duet -q jd fb
+  add_file
+  git duet-commit -q -m 'Testing pair that has not expired'
+  run git log -1 --format='%an <%ae>'
+  assert_success 'Jane Doe <jane@hamsters.biz.local>'
+}
+
+@test "skips the stale check with --no-verify" {
+  if [ -n "$CI" ] ; then
+    skip "cannot test commit hook on CI without sudo"
+  fi
+
+  git duet -q jd fb
+  git duet-install-hook -q pre-commit
+  git config "$GIT_DUET_CONFIG_NAMESPACE.mtime" "$(( $(date +%s) - 10))"
+  add_file
+  export GIT_DUET_SECONDS_AGO_STALE=9
+  run git duet-commit -q --no-verify -m 'Testing bypassed stale hook'
+  assert_success
+}
+
+@test "does not rotate the author of commits made with --no-verify or -n" {
+  git duet -q jd fb
+  export GIT_DUET_ROTATE_AUTHOR=1
+
+  add_file first.txt
+  git duet-commit -q --no-verify -m 'Testing jd as author'
+  add_file second.txt
+  git duet-commit -qnm 'Testing jd as author again'
+  run git log -1 --format='%an'
+  assert_success 'Jane Doe'
+
+  add_file third.txt
+  git duet-commit -q -m '-n is the message, not an option'
+  add_file fourth.txt
+  git duet-commit -q -m 'Testing fb as author'
+  run git log -1 --format='%an'
+  assert_success 'Frances Bar'
+}
+
+@test "rotates the author when --verify follows --no-verify" {
+  git duet -q jd fb
+  export GIT_DUET_ROTATE_AUTHOR=1
+  add_file
+  git duet-commit -q --no-verify --verify -m 'Testing jd as author'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'fb'
+}
+
+@test "credits a mob of six with Co-authored-by trailers" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb al on zp zs
+  add_file
+  git duet-commit -q -m 'Add feature'
+  run git log -1 --format='%an%n%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Jane Doe
+Frances Bar <f.bar@hamster.info.local>
+Abraham Lincoln <abe@hamster.info.local>
+Oscar <oscar@hamster.info.local>
+Zubaz Pants <z.pants@hamster.info.local>
+Zubaz Shirts <z.shirts@pika.info.local>'
+}
+
+@test "adds the co-author trailers itself with --no-verify" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb zs
+  rm .git/hooks/prepare-commit-msg
+  add_file
+  git duet-commit -q -n -m 'Add feature'
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Frances Bar <f.bar@hamster.info.local>
+Zubaz Shirts <z.shirts@pika.info.local>'
+}
+
+@test "adds the co-author trailers once with --no-verify and the hook installed" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb
+  add_file
+  git duet-commit -q --no-verify -m 'Add feature'
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "adds the co-author trailers above the diff of commit.verbose with --no-verify" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb
+  rm .git/hooks/prepare-commit-msg
+  git config commit.verbose true
+  add_file
+  GIT_EDITOR="sed -i.bak 1s/^/Add\ feature/" git duet-commit -q --no-verify
+  run git log -1 --format='%s%n%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Add feature
+Frances Bar <f.bar@hamster.info.local>'
+  [[ "$(git log -1 --format='%B')" != *'diff --git'* ]]
+}
+
+@test "keeps hand-written co-authors and credits the pair once" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb zs
+  add_file
+  git duet-commit -q -m 'Add feature
+
+Co-authored-by: Oscar <oscar@hamster.info.local>
+Co-authored-by: Zubaz Shirts <Z.Shirts@pika.info.local>
+Co-authored-by: Oscar <OSCAR@hamster.info.local>'
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Oscar <oscar@hamster.info.local>
+Zubaz Shirts <Z.Shirts@pika.info.local>
+Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "orders the co-author trailers alphabetically with duet.trailerOrder" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git config duet.trailerOrder alphabetical
+  git duet -q jd zs on fb
+  add_file
+  git duet-commit -q -m 'Add feature'
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Frances Bar <f.bar@hamster.info.local>
+Oscar <oscar@hamster.info.local>
+Zubaz Shirts <z.shirts@pika.info.local>'
+
+  add_file second.txt
+  GIT_DUET_TRAILER_ORDER=duet git duet-commit -q -n -m 'Add more'
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_success 'Zubaz Shirts <z.shirts@pika.info.local>
+Oscar <oscar@hamster.info.local>
+Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "fails for an unknown trailer order" {
+  git duet -q jd fb
+  add_file
+  run env GIT_DUET_TRAILER_ORDER=random git duet-commit -q -m 'Add feature'
+  assert_failure 'invalid trailer order "random": must be duet or alphabetical'
+}
+
+# fake_gpg makes git sign commits with a stand-in for gpg, which logs the key
+# it is asked to sign with
+fake_gpg() {
+  cat > "$GIT_DUET_TEST_DIR/fake-gpg" <<'SCRIPT'
+#!/usr/bin/env bash
+cat > /dev/null
+echo "${@: -1}" >> "$(dirname "$0")/signed-with"
+echo '[GNUPG:] SIG_CREATED D 1 8 00 0 0' >&2
+printf -- '-----BEGIN PGP SIGNATURE-----\n\nZmFrZQ==\n-----END PGP SIGNATURE-----\n'
+SCRIPT
+  chmod +x "$GIT_DUET_TEST_DIR/fake-gpg"
+  git config gpg.program "$GIT_DUET_TEST_DIR/fake-gpg"
+}
+
+@test "signs commits with the signing key of the author" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+signing_keys:
+  jd: KEY-JD
+EOF2
+  fake_gpg
+  git duet -q jd fb
+  run git config user.signingkey
+  assert_success 'KEY-JD'
+
+  add_file
+  git duet-commit -q -m 'Signed'
+  run cat "$GIT_DUET_TEST_DIR/signed-with"
+  assert_success 'KEY-JD'
+  run git log -1 --format='%an / %cn / %(trailers:key=Signed-off-by,valueonly)'
+  assert_success 'Jane Doe / Jane Doe / Frances Bar <f.bar@hamster.info.local>'
+
+  add_file second.txt
+  git duet-commit -q --no-gpg-sign -m 'Not signed'
+  run cat "$GIT_DUET_TEST_DIR/signed-with"
+  assert_success 'KEY-JD'
+  run git log -1 --format='%an / %cn / %(trailers:key=Signed-off-by,valueonly)'
+  assert_success 'Jane Doe / Frances Bar / Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "makes the author the committer when signing with -S" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+signing_keys:
+  jd: KEY-JD
+EOF2
+  fake_gpg
+  git duet -q jd fb
+
+  add_file
+  git duet-commit -q --no-gpg-sign -S -m 'Signed'
+  run cat "$GIT_DUET_TEST_DIR/signed-with"
+  assert_success 'KEY-JD'
+  run git log -1 --format='%cn'
+  assert_success 'Jane Doe'
+}
+
+@test "switches user.signingkey with the author and restores the original one" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+signing_keys:
+  jd: KEY-JD
+  fb: KEY-FB
+EOF2
+  git config user.signingkey MINE
+  git duet -q jd fb
+
+  add_file
+  GIT_DUET_ROTATE_AUTHOR=1 git duet-commit -q --no-gpg-sign -m 'Rotating'
+  run git config user.signingkey
+  assert_success 'KEY-FB'
+
+  git solo -q zp
+  run git config user.signingkey
+  assert_success 'MINE'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.original-user-signingkey"
+  assert_failure
+}
+
+@test "signs commits with the SSH key of the author" {
+  ssh-keygen -q -t ed25519 -N '' -C jane -f "$GIT_DUET_TEST_DIR/id_jane"
+  echo "jane@hamsters.biz.local $(cat "$GIT_DUET_TEST_DIR/id_jane.pub")" > "$GIT_DUET_TEST_DIR/allowed_signers"
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF2
+signing_keys:
+  jd: $GIT_DUET_TEST_DIR/id_jane
+  fb: KEY-FB
+EOF2
+  export GIT_DUET_ALLOWED_SIGNERS_FILE="$GIT_DUET_TEST_DIR/allowed_signers"
+  git duet -q jd fb
+  run git config gpg.format
+  assert_success 'ssh'
+  run git config gpg.ssh.allowedSignersFile
+  assert_success "$GIT_DUET_TEST_DIR/allowed_signers"
+
+  add_file
+  git duet-commit -q -m 'Signed with SSH'
+  run git log -1 --format='%G? %GS %ce'
+  assert_success 'G jane@hamsters.biz.local jane@hamsters.biz.local'
+}
+
+@test "restores gpg.format once the author has no SSH key" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+signing_keys:
+  jd: ~/.ssh/id_jane.pub
+  fb: KEY-FB
+EOF2
+  git config gpg.format x509
+  git duet -q jd fb
+  run git config user.signingkey
+  assert_success "$HOME/.ssh/id_jane.pub"
+
+  git duet -q fb jd
+  run git config gpg.format
+  assert_success 'openpgp'
+  run git config user.signingkey
+  assert_success 'KEY-FB'
+
+  git solo -q zp
+  run git config gpg.format
+  assert_success 'x509'
+  run git config user.signingkey
+  assert_failure
+}
@@ -0,0 +1,51 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+@test "lists the initials to complete with their names" {
+  run git duet completion initials
+  assert_success
+  assert_line 0 "al	Abraham Lincoln"
+  assert_line 1 "fb	Frances Bar"
+  assert_line 2 "jd	Jane Doe"
+}
+
+@test "does not run the email lookups to list the initials" {
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=false run git duet completion initials
+  assert_success
+  assert_line "zs	Zubaz Shirts"
+}
+
+@test "completes initials for git-duet in bash" {
+  run bash -c 'source <(git duet completion bash)
+COMP_WORDS=(git-duet fb z) COMP_CWORD=2
+__git_duet_complete
+echo "${COMPREPLY[*]}"'
+  assert_success 'zp zs'
+}
+
+@test "completes initials for git duet through the completion of git in bash" {
+  run bash -c 'source <(git duet completion bash)
+cur=j _git_solo
+echo "${COMPREPLY[*]}"'
+  assert_success 'jd'
+}
+
+@test "prints completion scripts for zsh and fish" {
+  run git duet completion zsh
+  assert_success
+  assert_line 0 '#compdef git-duet git-solo'
+  run git duet completion fish
+  assert_success
+  assert_line 0 '# fish completion for git duet and git solo, load it with'
+}
+
+@test "rejects shells it has no completion for" {
+  run git duet completion tcsh
+  assert_failure 'unknown shell "tcsh", must be one of: bash, zsh, fish'
+}
+
+@test "asks for the shell to complete for" {
+  run git duet completion
+  assert_failure 'completion takes the shell to complete for: bash, zsh or fish'
+}
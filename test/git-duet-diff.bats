@@ -0,0 +1,51 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+fixtures="$BATS_TEST_DIRNAME/fixtures/diff"
+
+@test "prints the authors added, removed and changed" {
+  run git duet --diff "$fixtures/old.yml" "$fixtures/new.yml"
+  assert_success
+  assert_golden diff/changes.txt
+}
+
+@test "prints the changes as JSON with --format json" {
+  run git duet --diff --format json "$fixtures/old.yml" "$fixtures/new.yml"
+  assert_success
+  assert_golden diff/changes.json
+}
+
+@test "ignores authors only moved around in the file" {
+  cat > "$GIT_DUET_TEST_DIR/reordered.yml" <<'EOF'
+email_addresses:
+  jd: jane@hamsters.biz.local
+authors:
+  on: Oscar
+  al: Abraham Lincoln
+  fb: Frances Bar
+  jd: Jane Doe
+signing_keys:
+  jd: 3AA5C34371567BD2
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --diff "$fixtures/old.yml" "$GIT_DUET_TEST_DIR/reordered.yml"
+  assert_success 'no changes'
+}
+
+@test "works outside of a git repository without an authors file" {
+  cd "$GIT_DUET_TEST_DIR"
+  run env -u GIT_DUET_AUTHORS_FILE git duet --diff "$fixtures/old.yml" "$fixtures/old.yml"
+  assert_success 'no changes'
+}
+
+@test "needs two authors files" {
+  run git duet --diff "$fixtures/old.yml"
+  assert_failure '--diff needs the old and the new authors file'
+}
+
+@test "fails if an authors file cannot be read" {
+  run git duet --diff "$fixtures/old.yml" "$GIT_DUET_TEST_DIR/missing.yml"
+  assert_failure "lstat $GIT_DUET_TEST_DIR/missing.yml: no such file or directory"
+}
@@ -0,0 +1,75 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+@test "passes when the pair and the hooks are set up" {
+  git duet -q jd fb
+  git duet-install-hook -q pre-commit
+
+  run git duet --doctor
+  assert_success
+  assert_line "ok       authors file: $GIT_DUET_AUTHORS_FILE (found via \$GIT_DUET_AUTHORS_FILE) lists 6 authors"
+  assert_line 'ok       email lookup: no email lookup command configured'
+  assert_line 'ok       pre-commit hook: .git/hooks/pre-commit'
+  assert_line 'passed (0 errors, 0 warnings)'
+}
+
+@test "warns about a missing pair without failing" {
+  run git duet --doctor
+  assert_success
+  assert_line 'warning  pair: no pair configured, set one with `git duet` or `git solo`'
+  assert_line 'ok       hooks: no hooks installed, install them with `git duet-install-hook`'
+  assert_line 'passed (0 errors, 1 warning)'
+}
+
+@test "warns about a stale pair" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.mtime" "$(( $(date +%s) - 3600 ))"
+
+  run git duet --doctor --format json
+  assert_success
+  assert_equal "$(echo "$output" | jq -r '.diagnostics[] | select(.check == "pair") | .code')" 'pair_stale'
+}
+
+@test "warns about outdated hooks" {
+  cat > .git/hooks/pre-commit <<EOF
+#!/usr/bin/env bash
+# git-duet hook version 0
+exec git duet-pre-commit "\$@"
+EOF
+
+  run git duet --doctor
+  assert_success
+  assert_line 'warning  pre-commit hook: .git/hooks/pre-commit is version 0 of 1, upgrade it with `git duet-install-hook --force pre-commit`'
+}
+
+@test "runs the email lookup command for the first author" {
+  export GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_LOOKUP"
+  run git duet --doctor --format json
+  assert_success
+  assert_equal "$(echo "$output" | jq -r '.diagnostics[] | select(.check == "email lookup") | .code')" 'lookup'
+}
+
+@test "fails when the email lookup command fails" {
+  export GIT_DUET_EMAIL_LOOKUP_COMMAND=false
+  run git duet --doctor
+  assert_failure
+  assert_line 'error    email lookup: email lookup for al failed: exit status 1'
+  assert_line 'failed (1 error, 1 warning)'
+}
+
+@test "fails when there is no authors file" {
+  export GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/nowhere"
+  run git duet --doctor --format json
+  assert_failure
+  assert_equal "$(echo "$output" | jq -r '.passed')" 'false'
+  assert_equal "$(echo "$output" | jq -r '.diagnostics[] | select(.check == "authors file") | .code')" 'authors_file_missing'
+}
+
+@test "checks what it can outside of a git repository" {
+  cd "$GIT_DUET_TEST_DIR"
+  run git duet --doctor
+  assert_success
+  assert_line 'ok       hooks: not in a git repository, hooks not checked'
+  assert_line "ok       authors file: $GIT_DUET_AUTHORS_FILE (found via \$GIT_DUET_AUTHORS_FILE) lists 6 authors"
+}
@@ -0,0 +1,150 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# local_config lists the repository config but for the timestamps, which
+# differ between a dry run and the real one
+local_config() {
+  git config --local --list | grep -v -e '\.mtime=' -e '\.expires='
+}
+
+# assert_plan_matches runs the git config commands printed by a dry run of the
+# given git command (`git duet jd fb`) on a copy of the repository config and
+# checks that they leave it as the real command does
+assert_plan_matches() {
+  cp .git/config "$GIT_DUET_TEST_DIR/config.before"
+  "${@:1:2}" --dry-run "${@:3}" > "$GIT_DUET_TEST_DIR/plan"
+  "$@" > /dev/null
+  local real="$(local_config)"
+
+  cp "$GIT_DUET_TEST_DIR/config.before" .git/config
+  source "$GIT_DUET_TEST_DIR/plan"
+  assert_equal "$real" "$(local_config)"
+}
+
+@test "does not change the config with --dry-run" {
+  local before="$(local_config)"
+  run git duet --dry-run jd fb
+  assert_success
+  assert_equal "$before" "$(local_config)"
+}
+
+@test "prints the config changes with --dry-run" {
+  run git duet --dry-run jd fb
+  assert_success
+  assert_line 0 "git config --local $GIT_DUET_CONFIG_NAMESPACE.git-author-initials 'jd'"
+  assert_line 1 "git config --local $GIT_DUET_CONFIG_NAMESPACE.git-author-name 'Jane Doe'"
+  assert_line "git config --local $GIT_DUET_CONFIG_NAMESPACE.git-committer-email 'f.bar@hamster.info.local'"
+}
+
+@test "prints the config changes as JSON with --dry-run --format json" {
+  git duet -q al on
+  run git duet --dry-run --format json jd fb
+  assert_success
+  assert_line 0 "{\"kind\":\"set-config\",\"target\":\"local:$GIT_DUET_CONFIG_NAMESPACE.git-author-initials\",\"old_value\":\"al\",\"new_value\":\"jd\"}"
+}
+
+@test "plans what git duet does with --dry-run" {
+  assert_plan_matches git duet jd fb
+}
+
+@test "plans what git duet does for a mob with --dry-run" {
+  git duet -q al on
+  assert_plan_matches git duet jd fb zs
+}
+
+@test "plans replacing user.name and user.email with --dry-run" {
+  export GIT_DUET_SET_GIT_USER_CONFIG=1
+  assert_plan_matches git duet jd fb
+}
+
+@test "plans what git duet --global does with --dry-run" {
+  run git duet --global --dry-run jd fb
+  assert_success
+  assert_line 0 "git config --global $GIT_DUET_CONFIG_NAMESPACE.git-author-initials 'jd'"
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+}
+
+@test "plans what git duet --swap does with --dry-run" {
+  git duet -q jd fb
+  assert_plan_matches git duet --swap
+}
+
+@test "plans what git duet --clear does with --dry-run" {
+  export GIT_DUET_SET_GIT_USER_CONFIG=1
+  git duet -q jd fb
+  assert_plan_matches git duet --clear
+}
+
+@test "plans nothing when clearing an empty config with --dry-run" {
+  run git duet --clear --dry-run
+  assert_success ''
+}
+
+@test "plans what git solo does with --dry-run" {
+  git duet -q jd fb
+  assert_plan_matches git solo jd
+}
+
+@test "plans installing the hook without writing it with --dry-run" {
+  run git duet-install-hook --dry-run pre-commit
+  assert_success
+  [ ! -f .git/hooks/pre-commit ]
+  local plan="$output"
+
+  git duet-install-hook -q pre-commit
+  assert_equal "$plan" "write '$GIT_DUET_TEST_REPO/.git/hooks/pre-commit' ($(wc -c < .git/hooks/pre-commit | tr -d ' ') bytes)"
+}
+
+@test "plans the contents of the hook as JSON with --dry-run --format json" {
+  run git duet-install-hook --dry-run --format json pre-commit
+  assert_success
+  local planned="$(echo "$output" | jq -r .new_value)"
+
+  git duet-install-hook -q pre-commit
+  assert_equal "$(cat .git/hooks/pre-commit)" "$planned"
+}
+
+@test "plans keeping an existing hook with --dry-run --force" {
+  printf '#!/bin/sh\necho mine\n' > .git/hooks/pre-commit
+  run git duet-install-hook --dry-run --force pre-commit
+  assert_success
+  assert_line 0 "mv '$GIT_DUET_TEST_REPO/.git/hooks/pre-commit' '$GIT_DUET_TEST_REPO/.git/hooks/pre-commit.pre-git-duet'"
+  [ ! -f .git/hooks/pre-commit.pre-git-duet ]
+  assert_equal "$(printf '#!/bin/sh\necho mine')" "$(cat .git/hooks/pre-commit)"
+}
+
+@test "plans the global hook and template directory with --dry-run" {
+  run env GIT_DUET_GLOBAL=1 git duet-install-hook --dry-run pre-commit
+  assert_success
+  [[ "${lines[0]}" == "git config --global init.templatedir '"*"/.git-template'" ]]
+  run git config --global init.templatedir
+  assert_failure
+}
+
+@test "plans installing the co-authored-by hook with --dry-run" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  run git duet --dry-run jd fb
+  assert_success
+  [[ "$output" == *"write '$GIT_DUET_TEST_REPO/.git/hooks/prepare-commit-msg' ("* ]]
+  [ ! -f .git/hooks/prepare-commit-msg ]
+}
+
+@test "plans updating the commit template with --dry-run" {
+  export GIT_DUET_CO_AUTHORED_BY=1 GIT_DUET_COMMIT_TEMPLATE=1
+  write_commit_template .git/commit-template
+  run git duet --dry-run --format json jd fb
+  assert_success
+  local planned="$(echo "$output" | jq -r 'select(.target | endswith("commit-template")) | .new_value')"
+  assert_equal "$(cat .git/commit-template.orig)" "$(cat .git/commit-template)"
+
+  git duet -q jd fb
+  assert_equal "$(cat .git/commit-template)" "$planned"
+}
+
+@test "does not show the pair with --dry-run" {
+  git solo -q jd
+  run git solo --dry-run
+  assert_success ''
+}
@@ -0,0 +1,56 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+fixtures="$BATS_TEST_DIRNAME/fixtures/export"
+
+@test "exports the authors and settings as JSON" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --export-authors
+  assert_success
+  assert_golden export/authors.json
+}
+
+@test "exports the authors without resolving emails with --without-emails" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --export-authors --without-emails
+  assert_success
+  assert_golden export/authors_without_emails.json
+}
+
+@test "reports failed lookups in the errors instead of failing" {
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=false git duet --export-authors
+  assert_success
+  assert_equal "$(echo "$output" | jq -r '.authors | map(.initials) | join(" ")')" 'al fb jd on zp zs'
+  assert_equal "$(echo "$output" | jq -r '.authors | map(select(.email)) | length')" '0'
+  assert_equal "$(echo "$output" | jq -r '.errors | map(.code) | unique | join(" ")')" 'lookup_failed'
+  assert_equal "$(echo "$output" | jq -r '.errors | map(.initials) | join(" ")')" 'al fb jd on zp zs'
+}
+
+@test "tells whether emails are built from a template" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+email_template: '{{.Initials}}@hamster.info.local'
+EOF
+  run git duet --export-authors --without-emails
+  assert_success
+  assert_equal "$(echo "$output" | jq -r '.settings.email_template')" 'true'
+}
+
+@test "only takes --without-emails with --export-authors or --list" {
+  run git duet --without-emails jd fb
+  assert_failure '--without-emails only goes with --export-authors or --list'
+}
+
+@test "orders authors ignoring case and accents" {
+  cp "$BATS_TEST_DIRNAME/fixtures/ordering/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --export-authors --without-emails
+  assert_success
+  assert_golden ordering/export.json
+}
+
+@test "lists known initials ignoring case and accents" {
+  cp "$BATS_TEST_DIRNAME/fixtures/ordering/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --json-errors xyz ab
+  assert_failure
+  assert_golden ordering/unknown_initials.json
+}
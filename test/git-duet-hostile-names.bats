@@ -0,0 +1,123 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# hostile_authors writes an authors file whose names and usernames would run
+# commands creating $GIT_DUET_TEST_DIR/pwned if anything interpreted them
+hostile_authors() {
+  export PWNED="$GIT_DUET_TEST_DIR/pwned"
+  export JD_NAME="\$(touch $PWNED) \`touch $PWNED\`"
+  export FB_NAME="O'Brien \"Frances\" && touch $PWNED"
+  export FB_USERNAME="x' || touch $PWNED #"
+
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd:
+    name: '$(echo "$JD_NAME" | sed "s/'/''/g")'
+    email: jane@hamsters.biz.local
+  fb:
+    name: '$(echo "$FB_NAME" | sed "s/'/''/g")'
+    username: '$(echo "$FB_USERNAME" | sed "s/'/''/g")'
+    email: f.bar@hamster.info.local
+EOF
+}
+
+assert_not_pwned() {
+  [ ! -e "$PWNED" ]
+}
+
+@test "prints hostile names as exports that eval keeps intact" {
+  hostile_authors
+  eval "$(git duet jd fb)"
+  assert_not_pwned
+  assert_equal "$GIT_AUTHOR_NAME" "$JD_NAME"
+  assert_equal "$GIT_COMMITTER_NAME" "$FB_NAME"
+}
+
+@test "prints hostile names as dry-run commands that can be run as they are" {
+  hostile_authors
+  eval "$(git duet --dry-run jd fb)"
+  assert_not_pwned
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-name"
+  assert_success "$FB_NAME"
+}
+
+@test "writes hostile names into commits and trailers without running them" {
+  hostile_authors
+  export GIT_DUET_CO_AUTHORED_BY=1
+  git duet -q jd fb
+  add_file
+  git duet-commit -q -m 'Add feature'
+  assert_not_pwned
+  run git log -1 --format='%an'
+  assert_success "$JD_NAME"
+  run git log -1 --format='%(trailers:key=Co-authored-by,valueonly)'
+  assert_line "$FB_NAME <f.bar@hamster.info.local>"
+}
+
+@test "passes hostile names and usernames to the lookup command as single arguments" {
+  hostile_authors
+  cat > "$GIT_DUET_TEST_DIR/args-lookup" <<'EOF'
+#!/usr/bin/env bash
+printf '%s\n' "$#" "$@" > "$(dirname "$0")/lookup-args-$1"
+echo "$1@lookie.me.local"
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/args-lookup"
+  sed -i.bak '/email: /d' "$GIT_DUET_AUTHORS_FILE"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/args-lookup" git duet -q jd fb
+  assert_not_pwned
+  run cat "$GIT_DUET_TEST_DIR/lookup-args-jd"
+  assert_success "3
+jd
+$JD_NAME"
+  run cat "$GIT_DUET_TEST_DIR/lookup-args-fb"
+  assert_success "3
+fb
+$FB_NAME
+$FB_USERNAME"
+}
+
+@test "ignores authors whose name contains a newline" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: "Jane Doe\nSigned-off-by: Mallory <mallory@evil.local>"
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author jd contains control characters (e.g. a newline), ignoring it"
+}
+
+@test "rejects lookup answers containing a newline" {
+  cat > "$GIT_DUET_TEST_DIR/forging-lookup" <<'EOF'
+#!/usr/bin/env bash
+printf 'jane@hamsters.biz.local\nSigned-off-by: Mallory <mallory@evil.local>\n'
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/forging-lookup"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/forging-lookup" git duet jd fb
+  assert_failure
+  assert_line 'email lookup for jd failed: answered "jane@hamsters.biz.local\nSigned-off-by: Mallory <mallory@evil.local>", which contains control characters'
+}
+
+@test "completes hostile initials in bash without running them" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+authors:
+  '$(touch>pwned)': Dollar Paren
+  '`touch>pwned`': Back Tick
+  jd: Jane Doe
+email:
+  domain: hamster.info.local
+EOF2
+  run bash -c 'source <(git duet completion bash)
+COMP_WORDS=(git-duet "") COMP_CWORD=1
+__git_duet_complete
+printf "%s\n" "${COMPREPLY[@]}"
+cur= _git_duet
+printf "%s\n" "${COMPREPLY[@]}"'
+  assert_success
+  [ ! -e pwned ]
+  assert_line 0 '$(touch>pwned)'
+  assert_line 1 '`touch>pwned`'
+}
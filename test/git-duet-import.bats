@@ -0,0 +1,38 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+fixtures="$BATS_TEST_DIRNAME/fixtures/import"
+
+@test "prints an authors file made from a CSV roster" {
+  run git duet --import-csv "$fixtures/roster.csv"
+  assert_success
+  assert_golden import/roster.yml
+}
+
+@test "reads the CSV roster from stdin with -" {
+  run bash -c "git duet --import-csv - < '$fixtures/roster.csv'"
+  assert_success
+  assert_golden import/roster.yml
+}
+
+@test "makes an authors file the commands can use from a CSV roster" {
+  git duet --import-csv "$fixtures/roster.csv" > "$GIT_DUET_AUTHORS_FILE"
+  printf 'email:\n  domain: hamster.info.local\n' >> "$GIT_DUET_AUTHORS_FILE"
+  git duet -q pob jd
+  run git duet
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='O'\\''Brien, Pat'"
+  assert_line "GIT_COMMITTER_EMAIL='jane@hamsters.biz.local'"
+}
+
+@test "names the row of invalid CSV rosters" {
+  printf 'initials,name\njd,Jane Doe\njd,Janet Doe\n' > "$GIT_DUET_TEST_DIR/roster.csv"
+  run git duet --import-csv "$GIT_DUET_TEST_DIR/roster.csv"
+  assert_failure 'could not import CSV: rows 2 and 3 both use initials jd'
+}
+
+@test "fails for a missing CSV roster" {
+  run git duet --import-csv "$GIT_DUET_TEST_DIR/missing.csv"
+  assert_failure "open $GIT_DUET_TEST_DIR/missing.csv: no such file or directory"
+}
@@ -0,0 +1,101 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# roster writes an authors file including the team files of $GIT_DUET_TEST_DIR/teams
+roster() {
+  mkdir -p "$GIT_DUET_TEST_DIR/teams"
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+include:
+  - teams/*.yml
+authors:
+  jd: Jane Doe
+email:
+  domain: hamster.info.local
+EOF
+  cat > "$GIT_DUET_TEST_DIR/teams/platform.yml" <<'EOF'
+authors:
+  platform:
+    fb: Frances Bar
+    al: Abraham Lincoln; abe
+EOF
+  cat > "$GIT_DUET_TEST_DIR/teams/web.yml" <<'EOF'
+authors:
+  zp: Zubaz Pants
+email_addresses:
+  zp: zubaz@web.local
+EOF
+}
+
+@test "resolves initials from the files included" {
+  roster
+  run git duet --format '{{.Initials}} {{.Name}} <{{.Email}}> {{.Team}}' jd fb zp
+  assert_success
+  assert_line 0 'jd Jane Doe <j.doe@hamster.info.local> '
+  assert_line 1 'fb Frances Bar <f.bar@hamster.info.local> platform'
+  assert_line 2 'zp Zubaz Pants <zubaz@web.local> '
+}
+
+@test "includes files included by included files" {
+  roster
+  echo 'include: [../more.yml]' >> "$GIT_DUET_TEST_DIR/teams/web.yml"
+  cat > "$GIT_DUET_TEST_DIR/more.yml" <<'EOF'
+authors:
+  xy: Xavier Yates
+EOF
+  run git duet --format '{{.Email}}' jd xy
+  assert_success
+  assert_line 1 'x.yates@hamster.info.local'
+}
+
+@test "fails for initials in two files included together" {
+  roster
+  cat > "$GIT_DUET_TEST_DIR/teams/web.yml" <<'EOF'
+authors:
+  fb: Fiona Bar
+EOF
+  run git duet jd fb
+  assert_failure "fb is in both $GIT_DUET_TEST_DIR/teams/platform.yml and $GIT_DUET_TEST_DIR/teams/web.yml, an author can only be in one of the files included together"
+}
+
+@test "reports initials in two files included together as JSON" {
+  roster
+  printf 'authors:\n  jd: Janet Doe\n' > "$GIT_DUET_TEST_DIR/teams/web.yml"
+  run bash -c "git duet --json-errors jd fb 2>&1 >/dev/null | jq -c '[.code, .initials, (.files | map(split(\"/\") | last))]'"
+  assert_success '["duplicate_author","jd",["web.yml",".git-authors"]]'
+}
+
+@test "fails if a file included does not exist" {
+  roster
+  echo '  - teams/missing.yml' > "$GIT_DUET_TEST_DIR/include"
+  sed -i.bak "/teams\/\*.yml/r $GIT_DUET_TEST_DIR/include" "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: include \"teams/missing.yml\": stat $GIT_DUET_TEST_DIR/teams/missing.yml: no such file or directory"
+}
+
+@test "fails for files including themselves" {
+  roster
+  echo 'include: [../.git-authors]' >> "$GIT_DUET_TEST_DIR/teams/web.yml"
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: it includes itself ($GIT_DUET_AUTHORS_FILE -> $GIT_DUET_TEST_DIR/teams/web.yml -> $GIT_DUET_AUTHORS_FILE)"
+}
+
+@test "names the included file of broken authors" {
+  roster
+  printf "authors:\n  bb: ''\n" > "$GIT_DUET_TEST_DIR/teams/web.yml"
+  run git duet jd fb
+  assert_success
+  assert_line "git-duet: warning: $GIT_DUET_TEST_DIR/teams/web.yml: author bb has no name, ignoring it"
+}
+
+@test "refuses to run lookup_overrides from included files" {
+  roster
+  cat >> "$GIT_DUET_TEST_DIR/teams/web.yml" <<EOF
+lookup_overrides:
+  fb: "touch '$GIT_DUET_TEST_DIR/ran'"
+EOF
+  run git duet jd fb
+  assert_failure
+  [[ $output == "could not parse $GIT_DUET_TEST_DIR/teams/web.yml: lookup_overrides are commands, "*"this one is included by another authors file; "* ]]
+  [ ! -e "$GIT_DUET_TEST_DIR/ran" ]
+}
@@ -14,6 +14,12 @@ load test_helper
   [ -f .git/hooks/prepare-commit-msg ]
 }
 
+@test "writes the commit-msg hook to the commit-msg hook file" {
+  run git duet-install-hook -q commit-msg
+  assert_success
+  [ -x .git/hooks/commit-msg ]
+}
+
 @test "writes the post-commit hook to the post-commit hook file" {
   git duet-install-hook -q post-commit
   [ -f .git/hooks/post-commit ]
@@ -120,10 +126,63 @@ exec git duet-post-commit "$@"' > .git/hooks/post-commit
   assert_success
 }
 
+@test "stamps hooks with the hook version" {
+  git duet-install-hook -q pre-commit
+  run cat .git/hooks/pre-commit
+  assert_line '# git-duet hook version 1'
+  assert_line 'exec git duet-pre-commit "$@"'
+}
+
+@test "upgrades hooks without a version in place with --force" {
+  printf '#!/usr/bin/env bash\nexec git duet-pre-commit "$@"' > .git/hooks/pre-commit
+  run git duet-install-hook -q pre-commit
+  assert_success
+  run grep -c 'git-duet hook version' .git/hooks/pre-commit
+  assert_output '0'
+
+  run git duet-install-hook --force pre-commit
+  assert_success "git-duet-install-hook: Installed hook to $PWD/.git/hooks/pre-commit"
+  run cat .git/hooks/pre-commit
+  assert_line '# git-duet hook version 1'
+}
+
+@test "keeps the other lines of outdated hooks when upgrading" {
+  cat > .git/hooks/pre-commit <<EOF
+#!/usr/bin/env bash
+echo before
+# git-duet hook version 0
+exec git duet-pre-commit "\$@"
+EOF
+  git duet-install-hook -q --force pre-commit
+  run cat .git/hooks/pre-commit
+  assert_line 0 '#!/usr/bin/env bash'
+  assert_line 1 'echo before'
+  assert_line 2 '# git-duet hook version 1'
+  assert_line 3 'exec git duet-pre-commit "$@"'
+}
+
+@test "runs an existing hook before the git-duet hook with --force" {
+  printf '#!/usr/bin/env bash\ntouch "%s/original-ran"\n' "$GIT_DUET_TEST_DIR" > .git/hooks/pre-commit
+  chmod +x .git/hooks/pre-commit
+  git duet-install-hook -q --force pre-commit
+  [ -x .git/hooks/pre-commit.pre-git-duet ]
+
+  git duet -q jd fb
+  add_file
+  git commit -q -m 'runs both hooks'
+  [ -f "$GIT_DUET_TEST_DIR/original-ran" ]
+
+  # upgrading keeps the original hook chained
+  sed -i.bak 's/version 1/version 0/' .git/hooks/pre-commit
+  git duet-install-hook -q --force pre-commit
+  run cat .git/hooks/pre-commit
+  assert_line '"$(dirname "$0")/pre-commit.pre-git-duet" "$@" || exit $?'
+}
+
 @test "requires hook file as argument" {
   run git duet-install-hook -q notAHookFile
   assert_failure
-  assert_line "Usage: git-duet-install-hook [-hq] { pre-commit | prepare-commit-msg | post-commit }"
+  assert_line "Usage: git-duet-install-hook [-fhnq] [--format value] [--json-errors] { pre-commit | prepare-commit-msg | commit-msg | post-commit }"
 }
 
 @test "writes global prepare-commit-msg hook file if GIT_DUET_GLOBAL is set" {
@@ -0,0 +1,225 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+@test "reports unknown initials as JSON with --json-errors" {
+  run git duet --json-errors jd xx
+  assert_failure
+  assert_golden errors/unknown_initials.json
+}
+
+@test "reports several unknown initials as JSON with --json-errors" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet --json-errors xx yy
+  assert_failure
+  assert_golden errors/authors.json
+}
+
+@test "reports ambiguous initials as JSON with --json-errors" {
+  run env GIT_DUET_PREFIX_INITIALS=1 git duet --json-errors jd z
+  assert_failure
+  assert_golden errors/ambiguous_initials.json
+}
+
+@test "reports empty initials as JSON with --json-errors" {
+  run git duet --json-errors jd,,fb
+  assert_failure
+  assert_golden errors/empty_initials.json
+}
+
+@test "reports someone given twice as JSON with --json-errors" {
+  run git duet --json-errors jd jd
+  assert_failure
+  assert_golden errors/duplicate_person.json
+}
+
+@test "reports unknown email labels as JSON with --json-errors" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+email_addresses:
+  jd:
+    work: jane@hamsters.biz.local
+    oss: jane@oss.example
+EOF
+  git config duet.emailLabel home
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/unknown_email_label.json
+}
+
+@test "reports failed lookups as JSON with --json-errors" {
+  printf '#!/usr/bin/env bash\nif [ "$1" = jd ]; then echo "directory unavailable" >&2; exit 3; fi\necho "$1@lookie.me.local"\n' > "$GIT_DUET_TEST_LOOKUP"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_LOOKUP" git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/lookup_failed.json
+}
+
+@test "reports a missing authors file as JSON with --json-errors" {
+  run env GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/missing" git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/authors_file_missing.json
+}
+
+@test "reports a missing duet.authorsfile as JSON with --json-errors" {
+  unset GIT_DUET_AUTHORS_FILE
+  git config duet.authorsfile "$GIT_DUET_TEST_DIR/missing"
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/authors_file_not_found.json
+}
+
+@test "reports an empty authors file as JSON with --json-errors" {
+  : > "$GIT_DUET_AUTHORS_FILE"
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/authors_file_empty.json
+}
+
+@test "reports missing symlink targets as JSON with --json-errors" {
+  rm "$GIT_DUET_AUTHORS_FILE"
+  ln -s "$GIT_DUET_TEST_DIR/missing" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/symlink_target_missing.json
+}
+
+@test "reports an expired pair as JSON with --json-errors" {
+  GIT_DUET_EXPIRE_AFTER=3600 git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.expires" 1
+  run env TZ=UTC git duet --json-errors --show --format json
+  assert_failure
+  assert_golden errors/pair_expired.json
+}
+
+@test "reports an existing hook as JSON with --json-errors" {
+  printf '#!/bin/sh\necho mine\n' > .git/hooks/pre-commit
+  run git duet-install-hook --json-errors pre-commit
+  assert_failure
+  assert_golden errors/existing_hook.json
+}
+
+@test "reports a commit template outside home and the repository as JSON with --json-errors" {
+  template="$BATS_TMPDIR/outside-commit-template"
+  : > "$template"
+  git config commit.template "$template"
+  run env GIT_DUET_COMMIT_TEMPLATE=1 HOME="$GIT_DUET_TEST_DIR" git duet --json-errors jd fb
+  rm -f "$template"
+  assert_failure
+  output="${output//$BATS_TMPDIR/\$TMPDIR}"
+  assert_golden errors/commit_template_location.json
+}
+
+@test "reports values that cannot be printed safely as JSON with --json-errors" {
+  git duet -q jd fb
+  # authors files cannot contain such names, but git config can
+  git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-name" "$(printf 'New\nLine')"
+  run git duet --json-errors
+  assert_failure
+  assert_golden errors/unsafe_export.json
+}
+
+@test "reports a missing email domain as JSON with --json-errors" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar; f.bar@hamster.info.local
+EOF
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_equal "$(echo "$output" | jq -c '{code, people}')" '{"code":"no_email_domain","people":["jd"]}'
+}
+
+@test "reports broken email templates as JSON with --json-errors" {
+  echo "email_template: '{{.Initials}@hamster.info.local'" >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/email_template.json
+}
+
+@test "reports authors files with several documents as JSON with --json-errors" {
+  printf -- '---\nauthors:\n  zz: Zed Zed\n' >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/multiple_documents.json
+}
+
+@test "reports missing lookup commands as JSON with --json-errors" {
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/missing-lookup" git duet --json-errors jd fb
+  assert_failure
+  assert_golden errors/lookup_command.json
+}
+
+@test "reports squads listing unknown initials as JSON with --json-errors" {
+  printf 'squads:\n  platform: [fb, kg]\n' >> "$GIT_DUET_AUTHORS_FILE"
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet --json-errors platform
+  assert_failure
+  assert_golden errors/squad.json
+}
+
+@test "reports repositories whose authors file does not know the initials as JSON" {
+  unset GIT_DUET_AUTHORS_FILE
+  cp "$GIT_DUET_TEST_DIR/.git-authors" "$GIT_DUET_TEST_REPO/.git-authors"
+  mkdir -p "$GIT_DUET_TEST_DIR/workspace"
+  git init -q "$GIT_DUET_TEST_DIR/workspace/web"
+  printf 'authors:\n  jd: Jane Doe\nemail:\n  domain: web.local\n' > "$GIT_DUET_TEST_DIR/workspace/web/.git-authors"
+  run bash -o pipefail -c "git duet --all-repos '$GIT_DUET_TEST_DIR/workspace' --format json jd fb | jq -c '.[].report'"
+  assert_failure
+  assert_golden errors/repo_initials.json
+}
+
+@test "reports other errors with the generic code with --json-errors" {
+  run git duet --json-errors jd
+  assert_failure
+  assert_golden errors/error.json
+}
+
+@test "reports unknown initials as JSON from git solo with --json-errors" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git solo --json-errors xx
+  assert_failure
+  assert_golden errors/solo_unknown_initials.json
+}
+
+@test "reports a pair that is not set as JSON with --json-errors" {
+  add_file
+  run git duet-commit --json-errors -q -m 'first'
+  assert_failure
+  assert_golden errors/not_configured.json
+}
+
+@test "takes --json-errors on the commands wrapping git" {
+  add_file first.txt
+  git -c user.name='Jane Doe' -c user.email=jane@hamsters.biz.local commit -q -m 'first'
+  for command in revert merge am rebase cherry-pick; do
+    run git duet-$command --json-errors HEAD
+    assert_failure
+    assert_equal "$(echo "$output" | jq -r .code)" 'not_configured'
+  done
+}
+
+@test "takes --json-errors on git duet-lint and git duet-add" {
+  run git duet-lint --json-errors --format yaml
+  assert_failure
+  assert_equal "$(echo "$output" | jq -r .code)" 'error'
+  rm "$GIT_DUET_AUTHORS_FILE"
+  run git duet-add --json-errors ks 'Kim Sun'
+  assert_failure
+  assert_equal "$(echo "$output" | jq -r .code)" 'authors_file_missing'
+}
+
+@test "reports code hosts that cannot be reached as JSON with --json-errors" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+github_noreply:
+  api_url: http://127.0.0.1:1/api/v3
+  domain: users.noreply.ghe.hamster.local
+EOF
+  run bash -c 'GIT_DUET_RESOLVER_BUDGET=1 git duet --json-errors al fb 2>&1 | sed -E "s/after [0-9]+ attempts/after N attempts/"'
+  assert_golden errors/network.json
+}
+
+@test "prints errors as text without --json-errors" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet jd xx
+  assert_failure 'unknown initials xx'
+}
@@ -0,0 +1,189 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# layered runs the command with the organization defaults file and the home
+# directory of the test, finding the authors file by discovery
+layered() {
+  mkdir -p "$GIT_DUET_TEST_DIR/home"
+  env -u GIT_DUET_AUTHORS_FILE HOME="$GIT_DUET_TEST_DIR/home" \
+    GIT_DUET_DEFAULTS_FILE="$GIT_DUET_TEST_DIR/defaults.yml" "$@"
+}
+
+# write_defaults writes the organization defaults file, with the extra authors
+# given on stdin
+write_defaults() {
+  {
+    echo 'authors:'
+    echo '  jd: Janet Doe'
+    echo '  fb: Frances Bar'
+    cat
+    echo 'email:'
+    echo '  domain: org.local'
+    echo 'email_addresses:'
+    echo '  fb: frances@org.local'
+  } > "$GIT_DUET_TEST_DIR/defaults.yml"
+}
+
+@test "layers the repo and home authors files over the organization defaults" {
+  write_defaults < /dev/null
+  mkdir -p "$GIT_DUET_TEST_DIR/home"
+  cat > "$GIT_DUET_TEST_DIR/home/.git-authors" <<'EOF'
+authors:
+  zp: Zubaz Pants
+email_addresses:
+  fb: fb@home.local
+EOF
+  cat > .git-authors <<'EOF'
+authors:
+  jd: Jane Doe
+email:
+  domain: repo.local
+EOF
+
+  run layered git duet --format '{{.Initials}} {{.Name}} <{{.Email}}>' jd fb zp
+  assert_success
+  assert_line 0 'jd Jane Doe <j.doe@repo.local>'
+  assert_line 1 'fb Frances Bar <fb@home.local>'
+  assert_line 2 'zp Zubaz Pants <z.pants@repo.local>'
+}
+
+@test "layers the .git-authors of the directories from the repository root down to the working directory" {
+  mkdir -p "$GIT_DUET_TEST_DIR/home" services/api/src
+  cat > .git-authors <<'EOF'
+authors:
+  jd: Jane Doe
+  zp: Zubaz Pants
+email:
+  domain: repo.local
+EOF
+  cat > services/api/.git-authors <<'EOF'
+authors:
+  zp: Zoe Pants
+email:
+  domain: api.local
+EOF
+  cd services/api/src
+
+  run env -u GIT_DUET_AUTHORS_FILE HOME="$GIT_DUET_TEST_DIR/home" git duet --format '{{.Initials}} {{.Name}} <{{.Email}}>' jd zp
+  assert_success
+  assert_line 0 'jd Jane Doe <j.doe@api.local>'
+  assert_line 1 'zp Zoe Pants <z.pants@api.local>'
+
+  run env -u GIT_DUET_AUTHORS_FILE HOME="$GIT_DUET_TEST_DIR/home" git duet --doctor
+  assert_line "ok       authors file: $GIT_DUET_TEST_REPO/services/api/.git-authors (found via .git-authors in services/api) lists 2 authors, layered on $GIT_DUET_TEST_REPO/.git-authors"
+}
+
+@test "inherits settings the upper files do not set" {
+  write_defaults < /dev/null
+  cat > .git-authors <<'EOF'
+authors:
+  zp: Zubaz Pants
+EOF
+
+  layered git duet -q jd zp
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-name"
+  assert_success 'Janet Doe'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
+  assert_success 'z.pants@org.local'
+}
+
+@test "uses the organization defaults on their own without other authors files" {
+  write_defaults < /dev/null
+  run layered git duet --format '{{.Initials}} <{{.Email}}>' jd fb
+  assert_success
+  assert_line 0 'jd <j.doe@org.local>'
+  assert_line 1 'fb <frances@org.local>'
+}
+
+@test "layers the authors file given over the organization defaults" {
+  write_defaults <<'EOF'
+  xy: Xavier Yates
+EOF
+  run env GIT_DUET_DEFAULTS_FILE="$GIT_DUET_TEST_DIR/defaults.yml" \
+    git duet --format '{{.Initials}} {{.Name}} <{{.Email}}>' jd xy
+  assert_success
+  assert_line 0 'jd Jane Doe <jane@hamsters.biz.local>'
+  assert_line 1 'xy Xavier Yates <x.yates@hamster.info.local>'
+}
+
+@test "names the file of broken authors" {
+  write_defaults <<'EOF'
+  bb: ''
+EOF
+  cat > .git-authors <<'EOF'
+authors:
+  zp: Zubaz Pants
+EOF
+
+  run layered git duet jd zp
+  assert_success
+  assert_line "git-duet: warning: $GIT_DUET_TEST_DIR/defaults.yml: author bb has no name, ignoring it"
+}
+
+@test "fails if the organization defaults file given does not exist" {
+  run layered git duet jd fb
+  assert_failure
+  assert_line "  \$GIT_DUET_DEFAULTS_FILE ($GIT_DUET_TEST_DIR/defaults.yml does not exist)"
+}
+
+@test "layers the authors files listed in GIT_DUET_AUTHORS_FILE, the first winning" {
+  cat > "$GIT_DUET_TEST_DIR/team.yml" <<'EOF2'
+authors:
+  jd: Jane Doe
+  ab: Alice Bee
+email:
+  domain: team.local
+EOF2
+  cat > "$GIT_DUET_TEST_DIR/personal.yml" <<'EOF2'
+authors:
+  jd: Janet Doe
+  xy: Xavier Yates
+email:
+  domain: personal.local
+email_addresses:
+  xy: xavier@elsewhere.local
+EOF2
+
+  run env GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/team.yml:$GIT_DUET_TEST_DIR/personal.yml" \
+    git duet --format '{{.Initials}} {{.Name}} <{{.Email}}>' jd ab xy
+  assert_success
+  assert_line 0 'jd Jane Doe <j.doe@team.local>'
+  assert_line 1 'ab Alice Bee <a.bee@team.local>'
+  assert_line 2 'xy Xavier Yates <xavier@elsewhere.local>'
+}
+
+@test "fails if a file listed in GIT_DUET_AUTHORS_FILE does not exist" {
+  run env GIT_DUET_AUTHORS_FILE="$GIT_DUET_AUTHORS_FILE:$GIT_DUET_TEST_DIR/missing.yml" git duet jd fb
+  assert_failure "lstat $GIT_DUET_TEST_DIR/missing.yml: no such file or directory"
+}
+
+@test "refuses to run lookup_overrides from the authors file found in the repository" {
+  write_defaults < /dev/null
+  cat > .git-authors <<EOF
+authors:
+  jd: Jane Doe
+lookup_overrides:
+  jd: "touch '$GIT_DUET_TEST_DIR/ran'"
+EOF
+  run layered git duet jd fb
+  assert_failure
+  [[ $output == "could not parse "*".git-authors: lookup_overrides are commands, "*"this one was found in the repository; "* ]]
+  [ ! -e "$GIT_DUET_TEST_DIR/ran" ]
+}
+
+@test "runs lookup_overrides from the repository once duet.trustAuthorsFileCommands is set" {
+  write_defaults < /dev/null
+  printf '#!/usr/bin/env bash\necho "jane@$1"\n' > "$GIT_DUET_TEST_DIR/repo-lookup"
+  chmod +x "$GIT_DUET_TEST_DIR/repo-lookup"
+  cat > .git-authors <<EOF
+authors:
+  jd: Jane Doe
+lookup_overrides:
+  jd: "'$GIT_DUET_TEST_DIR/repo-lookup' repo.local"
+EOF
+  git config duet.trustAuthorsFileCommands true
+  run layered git duet --format '{{.Initials}} {{.Email}}' jd fb
+  assert_success
+  assert_line 0 'jd jane@repo.local'
+}
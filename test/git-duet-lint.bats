@@ -0,0 +1,127 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+@test "passes for the authors file" {
+  run git duet-lint
+  assert_success
+  assert_line "ok       authors file: $GIT_DUET_AUTHORS_FILE lists 6 authors"
+  assert_line 'passed (0 errors, 0 warnings)'
+}
+
+@test "lints the authors file given" {
+  cat > "$GIT_DUET_TEST_DIR/other.yml" <<'EOF'
+authors:
+  jd: Jane Doe
+EOF
+  run git duet-lint "$GIT_DUET_TEST_DIR/other.yml"
+  assert_failure
+  assert_line "ok       authors file: $GIT_DUET_TEST_DIR/other.yml lists 1 authors"
+  assert_line 'failed (1 error, 0 warnings)'
+}
+
+@test "reports initials given twice with their lines" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+  # the new Jane
+  jd: Jane Dunn
+email:
+  domain: hamster.info.local
+EOF
+  run git duet-lint
+  assert_failure
+  assert_line "error    authors file: $GIT_DUET_AUTHORS_FILE: line 5: jd is already given on line 2"
+  assert_line 'failed (1 error, 0 warnings)'
+}
+
+@test "reports keys given twice in structured authors and teams" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Jane Doe
+    email: jane@hamsters.biz.local
+    email: jd@hamsters.biz.local
+  fb: Frances Bar
+  hamsters:
+    al: Abraham Lincoln
+    'al': Al Lincoln
+description: |
+  jd: is not a key
+  jd: is not a key either
+email:
+  domain: hamster.info.local
+EOF
+  run git duet-lint
+  assert_failure
+  assert_line "error    authors file: $GIT_DUET_AUTHORS_FILE: line 5: email is already given on line 4"
+  assert_line "error    authors file: $GIT_DUET_AUTHORS_FILE: line 9: al is already given on line 8"
+  assert_line 'failed (2 errors, 0 warnings)'
+}
+
+@test "reports YAML problems with their line" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+   fb: Frances Bar
+EOF
+  run git duet-lint
+  assert_failure
+  assert_line "error    authors file: could not parse $GIT_DUET_AUTHORS_FILE: yaml: line 2: mapping values are not allowed in this context"
+}
+
+@test "fails for authors whose email is not an email address" {
+  cat > "$GIT_DUET_TEST_DIR/lookup" <<'EOF'
+#!/usr/bin/env bash
+[ "$1" = fb ] && echo 'frances at home'
+true
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/lookup"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/lookup" run git duet-lint
+  assert_failure
+  assert_line 'error    authors: email "frances at home" for fb is not a valid email address'
+}
+
+@test "fails for usernames holding an email that disagrees with email_addresses" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jane@hamsters.biz.local
+  fb: Frances Bar; f.bar@hamster.info.local
+email:
+  domain: hamster.info.local
+email_addresses:
+  jd: jane.doe@hamsters.biz.local
+  fb: F.Bar@hamster.info.local
+EOF
+  run git duet-lint
+  assert_failure
+  assert_line 'error    authors: username jane@hamsters.biz.local for jd conflicts with email_addresses entry jane.doe@hamsters.biz.local'
+  assert_line 'failed (1 error, 0 warnings)'
+}
+
+@test "fails for broken authors" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb:
+email:
+  domain: hamster.info.local
+EOF
+  run git duet-lint --format json
+  assert_failure
+  assert_equal "$(echo "$output" | jq -r '.diagnostics[] | select(.severity == "error") | .code')" 'broken_author'
+}
+
+@test "warns about authors sharing an email" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jane
+  jane: Jane Doe; jane
+email:
+  domain: hamster.info.local
+EOF
+  run git duet-lint
+  assert_success
+  assert_line 'warning  authors: jane and jd share the email jane@hamster.info.local, they cannot pair with each other'
+}
@@ -0,0 +1,82 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+fixtures="$BATS_TEST_DIRNAME/fixtures/list"
+
+@test "lists every author as a table" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list
+  assert_success
+  assert_golden list/default.txt
+}
+
+@test "lists the authors matching the argument" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list jane
+  assert_success
+  assert_golden list/filtered.txt
+}
+
+@test "matches names ignoring case and accents" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list --no-header --columns initials RAMIREZ
+  assert_success 'jr'
+}
+
+@test "matches teams" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list --no-header --columns initials platform
+  assert_success 'jd
+zp'
+}
+
+@test "leaves the header out with --no-header" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list --no-header --columns initials,email
+  assert_success
+  assert_golden list/no_header.txt
+}
+
+@test "lists without resolving emails with --without-emails" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=false git duet --list --without-emails
+  assert_success
+  assert_golden list/without_emails.txt
+}
+
+@test "truncates long cells to fit in \$COLUMNS" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run env COLUMNS=60 git duet --list
+  assert_success
+  assert_golden list/narrow.txt
+}
+
+@test "does not truncate with COLUMNS=0" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run env COLUMNS=0 git duet --list --no-header --columns name mw
+  assert_success 'Maximilian Wolfgang Theodor von Hohenberg-Lichtenstein'
+}
+
+@test "prints nothing but the header when nobody matches" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list nobody
+  assert_success 'INITIALS  NAME  USERNAME  EMAIL  TEAM'
+}
+
+@test "rejects unknown columns" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list --columns initials,phone
+  assert_failure 'unknown column "phone", the columns are initials, name, username, email and team'
+}
+
+@test "rejects the email column with --without-emails" {
+  cp "$fixtures/authors.yml" "$GIT_DUET_AUTHORS_FILE"
+  run git duet --list --without-emails --columns initials,email
+  assert_failure '--without-emails leaves out the email column'
+}
+
+@test "only takes --columns and --no-header with --list" {
+  run git duet --no-header jd fb
+  assert_failure '--columns and --no-header only go with --list'
+}
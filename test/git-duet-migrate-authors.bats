@@ -0,0 +1,132 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# resolved prints the initials, name, username and email of every author
+resolved() {
+  git duet --format '{{.Initials}} {{.Name}} {{.Username}} {{.Email}}' jd fb al on zp zs
+}
+
+@test "rewrites the authors as structured entries" {
+  git duet migrate-authors
+  run cat "$GIT_DUET_AUTHORS_FILE"
+  assert_success
+  assert_line '  al:'
+  assert_line '    name: Abraham Lincoln'
+  assert_line '    username: abe'
+  assert_line '    email: abe@hamster.info.local'
+  assert_line '    email: jane@hamsters.biz.local'
+  refute_line 'email_addresses:'
+}
+
+@test "resolves the same after migrating" {
+  before="$(resolved)"
+  git duet migrate-authors
+  run resolved
+  assert_success "$before"
+}
+
+@test "keeps the original with a .bak suffix" {
+  cp "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/original"
+  git duet migrate-authors
+  cmp "$GIT_DUET_AUTHORS_FILE.bak" "$GIT_DUET_TEST_DIR/original"
+}
+
+@test "freezes the emails of the email lookup" {
+  cat > "$GIT_DUET_TEST_DIR/lookup" <<'EOF'
+#!/usr/bin/env bash
+[ "$1" = jd ] && echo jane_doe@lookie.me.local
+[ "$1" = fb ] && echo fb9000@dalek.info.local
+true
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/lookup"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/lookup" git duet migrate-authors
+  run git duet --format '{{.Email}}' jd fb
+  assert_success
+  assert_line 0 'jane_doe@lookie.me.local'
+  assert_line 1 'fb9000@dalek.info.local'
+}
+
+@test "prints the file migrated with --dry-run" {
+  cp "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/original"
+  run git duet migrate-authors --dry-run
+  assert_success
+  assert_line '    email: f.bar@hamster.info.local'
+  cmp "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/original"
+}
+
+@test "leaves labeled email addresses to be picked from" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+email_addresses:
+  jd:
+    work: jane@work.local
+    oss: jane@oss.local
+EOF
+  git duet migrate-authors
+  run git -c duet.emailLabel=oss duet --format '{{.Email}}' jd fb
+  assert_success
+  assert_line 0 'jane@oss.local'
+  assert_line 1 'f.bar@hamster.info.local'
+}
+
+@test "leaves authors with fields after the username as they are" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jane; extra
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet migrate-authors
+  assert_success
+  assert_line 'git-duet: warning: author jd has fields after the username (extra), leaving it as it is'
+  run grep 'jd:' "$GIT_DUET_AUTHORS_FILE"
+  assert_success '  jd: Jane Doe; jane; extra'
+}
+
+@test "says so when there is nothing to migrate" {
+  git duet migrate-authors
+  run git duet migrate-authors
+  assert_success "$GIT_DUET_AUTHORS_FILE has no authors to migrate"
+}
+
+@test "keeps comments and the order of keys" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+# the team roster
+email:
+  domain: hamster.info.local
+authors:
+  # founders
+  zp: Zubaz Pants # part time
+  jd: Jane Doe; jane
+  platform:
+    on: Oscar
+email_addresses:
+  # personal addresses
+  jd: jane@hamsters.biz.local
+EOF
+  git duet migrate-authors
+  run cat "$GIT_DUET_AUTHORS_FILE"
+  assert_success '# the team roster
+email:
+  domain: hamster.info.local
+authors:
+  # founders
+  zp: # part time
+    name: Zubaz Pants
+    email: z.pants@hamster.info.local
+  jd:
+    name: Jane Doe
+    username: jane
+    email: jane@hamsters.biz.local
+  platform:
+    "on":
+      name: Oscar
+      email: oscar@hamster.info.local
+  # personal addresses'
+}
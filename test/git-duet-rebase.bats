@@ -0,0 +1,185 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# commit_as_other commits file ($1) with contents ($2) as Other Person (both
+# author and committer)
+commit_as_other() {
+  echo "$2" > "$1"
+  git add "$1"
+  GIT_AUTHOR_NAME='Other Person' GIT_AUTHOR_EMAIL='other@person.local' \
+    GIT_COMMITTER_NAME='Other Person' GIT_COMMITTER_EMAIL='other@person.local' \
+    git commit -q -m "change $1"
+}
+
+@test "makes the omega of the duet the committer of every rebased commit" {
+  commit_as_other one.txt 1
+  commit_as_other two.txt 2
+  git duet -q jd fb
+
+  run git duet-rebase -q --force-rebase HEAD~2
+  assert_success
+  run git log -2 --format='%an <%ae> / %cn <%ce>'
+  assert_success
+  assert_line 0 'Other Person <other@person.local> / Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'Other Person <other@person.local> / Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "keeps the message and author date of rebased commits" {
+  commit_as_other one.txt 1
+  local before="$(git log -1 --format='%B%n%ad')"
+  git duet -q jd fb
+
+  git duet-rebase -q --force-rebase HEAD~1
+  assert_equal "$before" "$(git log -1 --format='%B%n%ad')"
+}
+
+@test "makes the soloist the committer of every rebased commit" {
+  commit_as_other one.txt 1
+  git solo -q jd
+
+  git duet-rebase -q --force-rebase HEAD~1
+  run git log -1 --format='%cn <%ce>'
+  assert_success 'Jane Doe <jane@hamsters.biz.local>'
+}
+
+@test "does not rewrite commits the pair committed already" {
+  git duet -q jd fb
+  add_file one.txt
+  git duet-commit -q -m 'one'
+  add_file two.txt
+  git duet-commit -q -m 'two'
+  local head="$(git rev-parse HEAD)"
+
+  run git duet-rebase -q HEAD~2
+  assert_success
+  assert_equal "$head" "$(git rev-parse HEAD)"
+
+  run git duet-fix-committer
+  assert_success
+  assert_equal "$head" "$(git rev-parse HEAD)"
+}
+
+@test "fixes the committer of HEAD with git duet-fix-committer" {
+  commit_as_other one.txt 1
+  local tree="$(git rev-parse HEAD^{tree})"
+  git duet -q jd fb
+
+  run git duet-fix-committer
+  assert_success
+  run git log -1 --format='%an <%ae> / %cn <%ce>'
+  assert_success 'Other Person <other@person.local> / Frances Bar <f.bar@hamster.info.local>'
+  assert_equal "$tree" "$(git rev-parse HEAD^{tree})"
+}
+
+# ssh_signing makes git sign with a new SSH key, which it trusts to sign for
+# Frances Bar
+ssh_signing() {
+  ssh-keygen -q -t ed25519 -N '' -C me -f "$GIT_DUET_TEST_DIR/id_me"
+  echo "f.bar@hamster.info.local $(cat "$GIT_DUET_TEST_DIR/id_me.pub")" > "$GIT_DUET_TEST_DIR/allowed_signers"
+  git config gpg.format ssh
+  git config user.signingkey "$GIT_DUET_TEST_DIR/id_me.pub"
+  git config gpg.ssh.allowedSignersFile "$GIT_DUET_TEST_DIR/allowed_signers"
+}
+
+@test "signs the commit again when fixing the committer of a signed commit" {
+  ssh_signing
+  git config commit.gpgsign true
+  commit_as_other one.txt 1
+  git config commit.gpgsign false
+  git duet -q jd fb
+
+  run git duet-fix-committer
+  assert_success
+  run git log -1 --format='%cn %G?'
+  assert_success 'Frances Bar G'
+}
+
+@test "refuses to fix the committer of a commit merging a signed tag" {
+  ssh_signing
+  git checkout -q -b side
+  add_file side.txt
+  git commit -q -m 'side'
+  git tag -s -m 'release' v1
+  git checkout -q master
+  add_file main.txt
+  git commit -q -m 'main'
+  GIT_COMMITTER_NAME='Other Person' GIT_COMMITTER_EMAIL='other@person.local' git merge -q --no-ff -m 'merge v1' v1
+  local head="$(git rev-parse HEAD)"
+  git duet -q jd fb
+
+  run git duet-fix-committer
+  assert_failure "could not rewrite commit $head: it merges a signed tag, which would be dropped"
+  assert_equal "$head" "$(git rev-parse HEAD)"
+}
+
+@test "stops on conflicts and fixes the committer after --continue" {
+  git checkout -q -b topic
+  commit_as_other foo 'topic'
+  commit_as_other two.txt 2
+  git checkout -q master
+  commit_as_other foo 'master'
+  git checkout -q topic
+  git duet -q jd fb
+
+  run git duet-rebase -q master
+  assert_failure
+  [ -d .git/rebase-merge ]
+
+  echo resolved > foo
+  git add foo
+  GIT_EDITOR=true git duet-rebase --continue
+  [ ! -d .git/rebase-merge ]
+  run git log -2 --format='%cn <%ce>'
+  assert_success
+  assert_line 0 'Frances Bar <f.bar@hamster.info.local>'
+  assert_line 1 'Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "passes --abort through after a conflict" {
+  git checkout -q -b topic
+  commit_as_other foo 'topic'
+  git checkout -q master
+  commit_as_other foo 'master'
+  git checkout -q topic
+  local head="$(git rev-parse HEAD)"
+  git duet -q jd fb
+
+  run git duet-rebase -q master
+  assert_failure
+  run git duet-rebase --abort
+  assert_success
+  [ ! -d .git/rebase-merge ]
+  assert_equal "$head" "$(git rev-parse HEAD)"
+}
+
+@test "does not start rebasing without a pair" {
+  commit_as_other one.txt 1
+  local head="$(git rev-parse HEAD)"
+
+  run git duet-rebase --force-rebase HEAD~1
+  assert_failure 'git-author not set'
+  [ ! -d .git/rebase-merge ]
+  assert_equal "$head" "$(git rev-parse HEAD)"
+}
+
+@test "exports the committer to the commands the rebase runs" {
+  commit_as_other one.txt 1
+  git duet -q jd fb
+
+  run git duet-rebase -q --force-rebase --exec "echo \"\$GIT_COMMITTER_NAME <\$GIT_COMMITTER_EMAIL>\" > '$GIT_DUET_TEST_DIR/committer'" HEAD~1
+  assert_success
+  run cat "$GIT_DUET_TEST_DIR/committer"
+  assert_success 'Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "does not rotate the author for the rebased commits" {
+  commit_as_other one.txt 1
+  commit_as_other two.txt 2
+  git duet-install-hook -q post-commit
+  git duet -q jd fb
+
+  GIT_DUET_ROTATE_AUTHOR=1 git duet-rebase -q --force-rebase HEAD~2
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
@@ -0,0 +1,136 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# authors_server serves the authors file of the test as authors.yml,
+# misbehaving as the plan file $GIT_DUET_TEST_DIR/plan says (see
+# flaky_server.py), and points GIT_DUET_AUTHORS_FILE at it
+authors_server() {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  mkdir -p "$GIT_DUET_TEST_DIR/www"
+  cp "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/www/authors.yml"
+  touch "$GIT_DUET_TEST_DIR/plan"
+  start_test_server "$GIT_DUET_TEST_DIR/www" "$GIT_DUET_TEST_DIR/plan"
+  export GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_SERVER_URL/authors.yml"
+}
+
+@test "fetches the authors file from a URL" {
+  authors_server
+  run git duet --format '{{.Initials}} {{.Email}}' jd fb
+  assert_success
+  assert_line 0 'jd jane@hamsters.biz.local'
+  assert_line 1 'fb f.bar@hamster.info.local'
+}
+
+@test "uses the cached copy without fetching while it is fresh" {
+  authors_server
+  git duet -q jd fb
+  echo 'status 503' > "$GIT_DUET_TEST_DIR/plan"
+  run git duet --format '{{.Initials}}' al on
+  assert_success
+  [[ "$output" != *warning* ]]
+  assert_line 'al'
+}
+
+@test "fetches again once the cached copy is older than GIT_DUET_AUTHORS_URL_TTL" {
+  authors_server
+  git duet -q jd fb
+  sed -i '/^pairs:/a\  xy: Xavier Yates' "$GIT_DUET_TEST_DIR/www/authors.yml"
+  run git duet --format '{{.Initials}}' xy jd
+  assert_failure
+  [[ "$output" == 'unknown initials xy,'* ]]
+  touch -d '-2 hours' "$XDG_CACHE_HOME"/git-duet/authors/*
+  GIT_DUET_AUTHORS_URL_TTL=10800 run git duet --format '{{.Initials}}' xy jd
+  assert_failure
+  run git duet --format '{{.Initials}}' xy jd
+  assert_success
+  assert_line 0 'xy'
+}
+
+@test "fetches again with --refresh-authors" {
+  authors_server
+  git duet -q jd fb
+  sed -i '/^pairs:/a\  xy: Xavier Yates' "$GIT_DUET_TEST_DIR/www/authors.yml"
+  run git duet --refresh-authors
+  assert_success ''
+  run git duet --format '{{.Initials}}' xy jd
+  assert_success
+  assert_line 0 'xy'
+}
+
+@test "fails to refresh with --refresh-authors if the URL cannot be fetched" {
+  authors_server
+  git duet -q jd fb
+  echo 'status 503' > "$GIT_DUET_TEST_DIR/plan"
+  run git duet --refresh-authors
+  assert_failure "could not fetch $GIT_DUET_AUTHORS_FILE: $GIT_DUET_AUTHORS_FILE returned 503 Service Unavailable"
+}
+
+@test "keeps the cached copy when the URL serves something else than an authors file" {
+  authors_server
+  git duet -q jd fb
+  echo '<html>Sign in</html>' > "$GIT_DUET_TEST_DIR/www/authors.yml"
+  GIT_DUET_AUTHORS_URL_TTL=0 run git duet --format '{{.Initials}}' al on
+  assert_success
+  [[ "$output" == *"git-duet: warning: could not fetch $GIT_DUET_AUTHORS_FILE (could not parse it: "* ]]
+  assert_line 'al'
+}
+
+@test "uses the cached copy when the URL cannot be fetched" {
+  authors_server
+  git duet -q jd fb
+  echo 'status 503' > "$GIT_DUET_TEST_DIR/plan"
+  export GIT_DUET_AUTHORS_URL_TTL=0
+  run git duet --format '{{.Initials}}' al on
+  assert_success
+  assert_line "git-duet: warning: could not fetch $GIT_DUET_AUTHORS_FILE ($GIT_DUET_AUTHORS_FILE returned 503 Service Unavailable), using the copy cached 0s ago"
+  assert_line 'al'
+}
+
+@test "gives up fetching after GIT_DUET_AUTHORS_URL_TIMEOUT seconds" {
+  authors_server
+  git duet -q jd fb
+  echo 'sleep 5' > "$GIT_DUET_TEST_DIR/plan"
+  export GIT_DUET_AUTHORS_URL_TTL=0
+  SECONDS=0
+  GIT_DUET_AUTHORS_URL_TIMEOUT=1 run git duet --format '{{.Initials}}' al on
+  assert_success
+  [ "$SECONDS" -lt 4 ]
+  [[ "$output" == *"using the copy cached"* ]]
+}
+
+@test "fails if the URL cannot be fetched and was never cached" {
+  authors_server
+  echo 'status 404' > "$GIT_DUET_TEST_DIR/plan"
+  run git duet jd fb
+  assert_failure "could not fetch $GIT_DUET_AUTHORS_FILE, and it was never cached: $GIT_DUET_AUTHORS_FILE returned 404 Not Found"
+}
+
+@test "layers a local authors file over one fetched from a URL" {
+  authors_server
+  cat > "$GIT_DUET_TEST_DIR/mine.yml" <<'EOF'
+authors:
+  xy: Xavier Yates
+EOF
+  GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/mine.yml:$GIT_DUET_AUTHORS_FILE" run git duet --format '{{.Initials}} {{.Email}}' xy jd
+  assert_success
+  assert_line 0 'xy x.yates@hamster.info.local'
+  assert_line 1 'jd jane@hamsters.biz.local'
+}
+
+@test "only fetches authors files over https" {
+  GIT_DUET_AUTHORS_FILE='http://authors.example.com/authors.yml' run git duet jd fb
+  assert_failure 'http://authors.example.com/authors.yml: authors files are only fetched over https'
+}
+
+@test "refuses to run lookup_overrides from an authors file fetched from a URL" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+lookup_overrides:
+  fb: "touch '$GIT_DUET_TEST_DIR/ran'"
+EOF
+  authors_server
+  run git duet jd fb
+  assert_failure
+  [[ $output == *"lookup_overrides are commands, "*"this one was fetched from $GIT_DUET_AUTHORS_FILE; "* ]]
+  [ ! -e "$GIT_DUET_TEST_DIR/ran" ]
+}
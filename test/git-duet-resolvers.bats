@@ -0,0 +1,108 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# github_host serves the GitHub user jdoe, misbehaving as the plan file
+# $GIT_DUET_TEST_DIR/plan says (see flaky_server.py), and points the authors
+# file at it
+github_host() {
+  mkdir -p "$GIT_DUET_TEST_DIR/ghe/api/v3/users"
+  echo '{"login": "jdoe", "id": 1234}' > "$GIT_DUET_TEST_DIR/ghe/api/v3/users/jdoe"
+  touch "$GIT_DUET_TEST_DIR/plan"
+  start_test_server "$GIT_DUET_TEST_DIR/ghe" "$GIT_DUET_TEST_DIR/plan"
+
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar
+  xx: Mystery Person; nobody
+email:
+  domain: hamster.info.local
+github_noreply:
+  api_url: $GIT_DUET_TEST_SERVER_URL/api/v3
+  domain: users.noreply.ghe.hamster.local
+EOF
+}
+
+# plan makes the next requests misbehave, one line of stdin each
+plan() {
+  cat > "$GIT_DUET_TEST_DIR/plan"
+}
+
+requests() {
+  wc -l < "$GIT_DUET_TEST_DIR/plan.log" | tr -d ' '
+}
+
+@test "retries requests answered with 429 or 5xx" {
+  github_host
+  plan <<'EOF'
+status 429
+status 503
+EOF
+  run git duet --format '{{.Email}}' jd fb
+  assert_success
+  assert_line 0 '1234+jdoe@users.noreply.ghe.hamster.local'
+  assert_equal "$(requests)" '3'
+}
+
+@test "retries requests whose connection was reset" {
+  github_host
+  echo reset | plan
+  run git duet --format '{{.Email}}' jd fb
+  assert_success
+  assert_line 0 '1234+jdoe@users.noreply.ghe.hamster.local'
+  assert_equal "$(requests)" '2'
+}
+
+@test "waits as long as Retry-After says if the budget allows" {
+  github_host
+  echo 'status 429 1' | plan
+  run env GIT_DUET_DEBUG=1 git duet --format '{{.Email}}' jd fb
+  assert_success
+  assert_line "$GIT_DUET_TEST_SERVER_URL/api/v3/users/jdoe returned 429 Too Many Requests, retrying in 1s"
+  assert_line '1234+jdoe@users.noreply.ghe.hamster.local'
+}
+
+@test "gives up with a network error once the budget is spent" {
+  github_host
+  for i in $(seq 20); do echo 'status 502'; done | plan
+  SECONDS=0
+  run env GIT_DUET_RESOLVER_BUDGET=1 git duet --json-errors jd fb
+  assert_failure
+  [ "$SECONDS" -lt 3 ]
+  assert_equal "$(echo "$output" | jq -r .code)" 'network'
+  assert_equal "$(echo "$output" | jq -r .endpoint)" "$GIT_DUET_TEST_SERVER_URL/api/v3/users/jdoe"
+  [[ "$(echo "$output" | jq -r .message)" == "github lookup for jd failed: $GIT_DUET_TEST_SERVER_URL/api/v3/users/jdoe returned 502 Bad Gateway (gave up after "*" attempts)" ]]
+}
+
+@test "times out slow requests" {
+  github_host
+  for i in $(seq 5); do echo 'sleep 5'; done | plan
+  SECONDS=0
+  run env GIT_DUET_RESOLVER_TIMEOUT=1 GIT_DUET_RESOLVER_BUDGET=2 git duet --json-errors jd fb
+  assert_failure
+  [ "$SECONDS" -lt 4 ]
+  assert_equal "$(echo "$output" | jq -r .code)" 'network'
+}
+
+@test "tells unknown users apart from network errors without retrying" {
+  github_host
+  run git duet --json-errors xx fb
+  assert_failure
+  assert_equal "$(echo "$output" | jq -c '{code, host, username, message}')" \
+    '{"code":"user_not_found","host":"GitHub","username":"nobody","message":"github lookup for xx failed: no GitHub user is named nobody"}'
+  assert_equal "$(requests)" '1'
+}
+
+@test "falls back to the cached email when the code host cannot be reached" {
+  github_host
+  export GIT_DUET_EMAIL_LOOKUP_CACHE_TTL=1
+  git duet -q jd fb
+  sleep 1
+
+  for i in $(seq 20); do echo 'status 503'; done | plan
+  run env GIT_DUET_DEBUG=1 GIT_DUET_RESOLVER_BUDGET=1 git duet --format '{{.Email}}' jd fb
+  assert_success
+  assert_line '1234+jdoe@users.noreply.ghe.hamster.local'
+  [[ "$output" == *"returned 503 Service Unavailable (gave up after "*" attempts), using the GitHub noreply address cached for jd"* ]]
+}
@@ -0,0 +1,91 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+# commit_as_pair makes a commit with git duet-commit and prints its author
+commit_as_pair() {
+  add_file "$1.txt"
+  git duet-commit -q -m "$1"
+  git log -1 --format='%an'
+}
+
+@test "rotates after every commit with duet.rotatePolicy commit" {
+  git config duet.rotatePolicy commit
+  git duet -q jd fb
+
+  run commit_as_pair first
+  assert_success 'Jane Doe'
+  run commit_as_pair second
+  assert_success 'Frances Bar'
+}
+
+@test "rotates once commits move to another branch with duet.rotatePolicy branch" {
+  git config duet.rotatePolicy branch
+  git duet -q jd fb
+
+  run commit_as_pair first
+  assert_success 'Jane Doe'
+  run commit_as_pair second
+  assert_success 'Jane Doe'
+
+  git checkout -q -b feature
+  run commit_as_pair third
+  assert_success 'Jane Doe'
+  run commit_as_pair fourth
+  assert_success 'Frances Bar'
+  run commit_as_pair fifth
+  assert_success 'Frances Bar'
+}
+
+@test "rotates once the interval has passed with duet.rotatePolicy interval" {
+  git config duet.rotatePolicy interval:25m
+  git duet -q jd fb
+
+  run commit_as_pair first
+  assert_success 'Jane Doe'
+  run commit_as_pair second
+  assert_success 'Jane Doe'
+
+  git config "$GIT_DUET_CONFIG_NAMESPACE.rotation-time" "$(( $(date +%s) - 1800 ))"
+  run commit_as_pair third
+  assert_success 'Jane Doe'
+  run commit_as_pair fourth
+  assert_success 'Frances Bar'
+  run commit_as_pair fifth
+  assert_success 'Frances Bar'
+}
+
+@test "starts the interval over with another pair" {
+  git config duet.rotatePolicy interval:25m
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.rotation-time" "$(( $(date +%s) - 1800 ))"
+
+  git duet -q jd zs
+  run commit_as_pair first
+  assert_success 'Jane Doe'
+  run commit_as_pair second
+  assert_success 'Jane Doe'
+}
+
+@test "does not rotate with duet.rotatePolicy when GIT_DUET_ROTATE_AUTHOR is 0" {
+  git config duet.rotatePolicy commit
+  git duet -q jd fb
+
+  export GIT_DUET_ROTATE_AUTHOR=0
+  run commit_as_pair first
+  assert_success 'Jane Doe'
+  run commit_as_pair second
+  assert_success 'Jane Doe'
+}
+
+@test "rejects an unknown duet.rotatePolicy" {
+  git config duet.rotatePolicy hourly
+  run git duet jd fb
+  assert_failure 'duet.rotatePolicy: unknown policy "hourly", use commit, branch or interval:<duration>'
+}
+
+@test "rejects an invalid interval" {
+  git config duet.rotatePolicy interval:soon
+  run git duet jd fb
+  assert_failure 'duet.rotatePolicy: invalid interval "soon", use e.g. interval:25m'
+}
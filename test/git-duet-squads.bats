@@ -0,0 +1,73 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+add_squads() {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+squads:
+  backend: [jd, fb]
+  Platform: [fb, ZP, al]
+EOF
+}
+
+@test "expands a squad to its members" {
+  add_squads
+  git duet -q backend
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb'
+}
+
+@test "expands squads among initials, ignoring case" {
+  add_squads
+  git duet -q zs PLATFORM
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'zs'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb, +zp, +al'
+}
+
+@test "prefers initials over a squad of the same name" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+squads:
+  jd: [fb, zp]
+EOF
+  git duet -q jd al
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "fails for squads listing unknown initials" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+squads:
+  platform: [fb, kg]
+EOF
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet platform
+  assert_failure 'squad platform: unknown initials kg'
+
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet-lint
+  assert_failure
+  assert_line 'error    squads: squad platform: unknown initials kg'
+}
+
+@test "completes squads with their members" {
+  add_squads
+  run git duet completion initials
+  assert_success
+  assert_line 'backend	squad: jd fb'
+  assert_line 'platform	squad: fb zp al'
+}
+
+@test "sorts squads ignoring accents" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+squads:
+  zeta: [jd, fb]
+  équipe: [fb, zp]
+  alpha: [al, on]
+EOF2
+  run bash -c "git duet completion initials | grep squad | cut -f1"
+  assert_success 'alpha
+équipe
+zeta'
+}
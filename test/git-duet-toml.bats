@@ -0,0 +1,71 @@
+#!/usr/bin/env bats
+
+load test_helper
+
+fixtures="$BATS_TEST_DIRNAME/fixtures/toml"
+
+@test "reads an authors file ending in .toml as TOML" {
+  GIT_DUET_AUTHORS_FILE="$BATS_TEST_DIRNAME/fixtures/export/authors.yml" git duet --export-authors 2>/dev/null |
+    jq '.authors' > "$GIT_DUET_TEST_DIR/yaml.json"
+  export GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/authors.toml"
+  cp "$fixtures/authors.toml" "$GIT_DUET_AUTHORS_FILE"
+  run bash -c "git duet --export-authors 2>/dev/null | jq '.authors'"
+  assert_success "$(cat "$GIT_DUET_TEST_DIR/yaml.json")"
+}
+
+@test "reads an authors file as TOML with GIT_DUET_AUTHORS_FORMAT=toml" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+email_template = '{{with split .Name " "}}{{index . 0 | toLower}}{{end}}@hamster.info.local'
+
+[authors]
+jd = "Jane Doe"
+fb = "Frances Bar"
+
+[email_addresses]
+fb = "f.bar@hamster.info.local"
+EOF2
+  GIT_DUET_AUTHORS_FORMAT=toml run git duet --format '{{.Email}}' jd fb
+  assert_success 'jane@hamster.info.local
+f.bar@hamster.info.local'
+}
+
+@test "goes by the extension rather than GIT_DUET_AUTHORS_FORMAT" {
+  export GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/authors.yml"
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF2
+  GIT_DUET_AUTHORS_FORMAT=toml run git duet --format '{{.Email}}' jd fb
+  assert_success 'j.doe@hamster.info.local
+f.bar@hamster.info.local'
+}
+
+@test "reports the line of TOML syntax errors" {
+  export GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/authors.toml"
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+[authors]
+jd = "Jane Doe"
+fb = Frances Bar
+EOF2
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: line 3: invalid value Frances (strings need quotes)"
+}
+
+@test "rejects keys defined twice in TOML" {
+  export GIT_DUET_AUTHORS_FILE="$GIT_DUET_TEST_DIR/authors.toml"
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF2'
+[authors]
+jd = "Jane Doe"
+jd = "John Doe"
+EOF2
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: line 3: jd is defined twice"
+}
+
+@test "rejects an unknown GIT_DUET_AUTHORS_FORMAT" {
+  GIT_DUET_AUTHORS_FORMAT=json run git duet jd fb
+  assert_failure 'GIT_DUET_AUTHORS_FORMAT is "json", it should be yaml or toml'
+}
@@ -68,6 +68,1790 @@ load test_helper
   assert_success 'fb9000@dalek.info.local'
 }
 
+@test "reads authors files declaring the current version" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+version: 1
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='j.doe@hamster.info.local'"
+}
+
+@test "asks to upgrade for authors files newer than supported" {
+  echo "version: 99" >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  [[ $output = *"file is version 99 but this git-duet only understands up to version 1, please upgrade git-duet"* ]]
+}
+
+@test "rejects legacy authors files using both pairs and authors" {
+  echo "authors: {xy: Xavier Yu}" >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  [[ $output = *"both \`authors\` and \`pairs\` are set"* ]]
+}
+
+@test "reads authors files starting with a UTF-8 byte order mark" {
+  printf '\xef\xbb\xbfpairs:\n  jd: Jane Doe\n  fb: Frances Bar\nemail:\n  domain: hamster.info.local\n' > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='j.doe@hamster.info.local'"
+}
+
+@test "rejects UTF-16 encoded authors files" {
+  printf '\xff\xfep\x00a\x00i\x00r\x00s\x00:\x00\n\x00' > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  [[ $output = *"file is encoded as UTF-16, please re-save it as UTF-8"* ]]
+
+  printf '\xfe\xff\x00p\x00a\x00i\x00r\x00s\x00:\x00\n' > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  [[ $output = *"file is encoded as UTF-16, please re-save it as UTF-8"* ]]
+}
+
+@test "reads authors files starting with a document separator" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+# team roster
+---
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+}
+
+@test "reads authors files ending with a document separator" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+---
+# nothing here
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+}
+
+@test "rejects authors files with several YAML documents" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+---
+authors:
+  jd: Jane Doe
+email:
+  domain: hamster.info.local
+---
+
+---
+authors:
+  fb: Frances Bar
+EOF
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: file contains 2 YAML documents, remove the \`---\` separator on line 8 so none are ignored"
+}
+
+@test "rejects authors files with several YAML documents and CRLF line endings" {
+  printf 'authors:\r\n  jd: Jane Doe\r\nemail:\r\n  domain: hamster.info.local\r\n---\r\nauthors:\r\n  fb: Frances Bar\r\n' > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: file contains 2 YAML documents, remove the \`---\` separator on line 5 so none are ignored"
+}
+
+@test "strips carriage returns from looked up emails" {
+  printf '#!/usr/bin/env bash\nprintf "$1@lookie.me.local\\r\\n"\n' > "$GIT_DUET_TEST_LOOKUP"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jd@lookie.me.local'
+}
+
+@test "reads symlinked authors files" {
+  mv "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/real-authors"
+  ln -s "$GIT_DUET_TEST_DIR/real-authors" "$GIT_DUET_TEST_DIR/link-1"
+  ln -s link-1 "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "reports missing symlink targets" {
+  ln -sf "$GIT_DUET_TEST_DIR/missing" "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure "$GIT_DUET_AUTHORS_FILE is a symlink but its target $GIT_DUET_TEST_DIR/missing is missing"
+}
+
+@test "reports missing targets of chained symlinks" {
+  ln -s "$GIT_DUET_TEST_DIR/missing" "$GIT_DUET_TEST_DIR/link-1"
+  ln -sf link-1 "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure "$GIT_DUET_AUTHORS_FILE is a symlink but its target $GIT_DUET_TEST_DIR/missing is missing"
+}
+
+@test "names the symlink and its target in parse errors" {
+  mv "$GIT_DUET_AUTHORS_FILE" "$GIT_DUET_TEST_DIR/real-authors"
+  echo "version: 99" >> "$GIT_DUET_TEST_DIR/real-authors"
+  ln -s "$GIT_DUET_TEST_DIR/real-authors" "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  [[ $output = "could not parse $GIT_DUET_AUTHORS_FILE (-> $GIT_DUET_TEST_DIR/real-authors): "* ]]
+}
+
+@test "reads the authors file configured in git config relative to the repo root" {
+  mkdir -p config
+  mv "$GIT_DUET_AUTHORS_FILE" config/authors.yml
+  git config duet.authorsfile config/authors.yml
+  unset GIT_DUET_AUTHORS_FILE
+  mkdir -p sub && cd sub
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "reads the authors file configured in global git config with ~ expanded" {
+  cp "$GIT_DUET_AUTHORS_FILE" "$HOME/.team-authors"
+  git config --global duet.authorsfile '~/.team-authors'
+  unset GIT_DUET_AUTHORS_FILE
+  run git duet jd fb
+  rm -f "$HOME/.team-authors"
+  assert_success
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+}
+
+@test "sets duet.authorsfile with git duet authors-file" {
+  mkdir -p config
+  mv "$GIT_DUET_AUTHORS_FILE" config/authors.yml
+  unset GIT_DUET_AUTHORS_FILE
+
+  run git duet authors-file config/authors.yml
+  assert_success
+  run git config --local duet.authorsfile
+  assert_success "$PWD/config/authors.yml"
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "sets duet.authorsfile relative to the working directory with git duet authors-file" {
+  mkdir -p config sub
+  mv "$GIT_DUET_AUTHORS_FILE" config/authors.yml
+  unset GIT_DUET_AUTHORS_FILE
+
+  cd sub
+  run git duet authors-file ../config/authors.yml
+  assert_success
+  run git config --local duet.authorsfile
+  assert_success "$(dirname "$PWD")/config/authors.yml"
+  cd ..
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "sets duet.authorsfile in global git config with git duet authors-file --global" {
+  run git duet authors-file --global '~/.team-authors'
+  assert_success
+  run git config --global duet.authorsfile
+  git config --global --unset duet.authorsfile
+  assert_success '~/.team-authors'
+  run git config --local duet.authorsfile
+  assert_failure
+}
+
+@test "takes a single path with git duet authors-file" {
+  run git duet authors-file
+  assert_failure 'authors-file takes the path of the authors file'
+}
+
+@test "prefers GIT_DUET_AUTHORS_FILE over git config" {
+  git config duet.authorsfile missing.yml
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "lists the locations tried when the configured authors file is missing" {
+  git config duet.authorsfile missing.yml
+  unset GIT_DUET_AUTHORS_FILE
+  run git duet jd fb
+  assert_failure
+  assert_line "could not find authors file, tried:"
+  assert_line "  \$GIT_DUET_AUTHORS_FILE (not set)"
+  assert_line "  git config --local duet.authorsfile ($GIT_DUET_TEST_REPO/missing.yml does not exist)"
+}
+
+@test "expands ~ in GIT_DUET_AUTHORS_FILE" {
+  cp "$GIT_DUET_AUTHORS_FILE" "$HOME/.team-authors"
+  run env GIT_DUET_AUTHORS_FILE='~/.team-authors' git duet jd fb
+  rm -f "$HOME/.team-authors"
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "expands Windows-style variables in GIT_DUET_AUTHORS_FILE" {
+  run env TEAM_DIR="$GIT_DUET_TEST_DIR" GIT_DUET_AUTHORS_FILE='%TEAM_DIR%/.git-authors' git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+}
+
+@test "shows the expanded and original path when GIT_DUET_AUTHORS_FILE is missing" {
+  run env TEAM_DIR="$GIT_DUET_TEST_DIR" GIT_DUET_AUTHORS_FILE='%TEAM_DIR%/missing.yml' git duet jd fb
+  assert_failure
+  assert_line "  \$GIT_DUET_AUTHORS_FILE ($GIT_DUET_TEST_DIR/missing.yml (expanded from %TEAM_DIR%/missing.yml) does not exist)"
+}
+
+@test "shows the expanded and original path when the configured authors file is missing" {
+  git config duet.authorsfile '~/missing.yml'
+  unset GIT_DUET_AUTHORS_FILE
+  run git duet jd fb
+  assert_failure
+  assert_line "  git config --local duet.authorsfile ($HOME/missing.yml (expanded from ~/missing.yml) does not exist)"
+}
+
+@test "expands ~ in GIT_DUET_EMAIL_LOOKUP_COMMAND" {
+  cp "$GIT_DUET_TEST_LOOKUP" "$HOME/.team-lookup"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND='~/.team-lookup' git duet jd fb
+  rm -f "$HOME/.team-lookup"
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jane_doe@lookie.me.local'"
+}
+
+@test "shows the expanded and original path when GIT_DUET_EMAIL_LOOKUP_COMMAND is missing" {
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND='~/missing-lookup' git duet jd fb
+  assert_failure "\$GIT_DUET_EMAIL_LOOKUP_COMMAND: $HOME/missing-lookup (expanded from ~/missing-lookup) does not exist"
+}
+
+@test "reads authors grouped into teams" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  platform:
+    jd: Jane Doe; jane
+    on: Oscar
+  mobile:
+    fb: Frances Bar
+  al: Abraham Lincoln; abe
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamster.info.local'"
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+
+  run git duet on al
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Oscar'"
+  assert_line "GIT_COMMITTER_EMAIL='abe@hamster.info.local'"
+}
+
+@test "ignores trailing separators in author entries" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  jd: Jane Doe; jdoe;
+  fb: Frances Bar;
+  on: Oscar; ;
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jdoe@hamster.info.local'"
+  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+
+  run git duet on jd
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='oscar@hamster.info.local'"
+}
+
+@test "ignores extra fields in author entries" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  jd: Jane Doe; jdoe; team-platform
+  fb: Frances Bar; ; team-mobile; contractor
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line "GIT_AUTHOR_EMAIL='jdoe@hamster.info.local'"
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+}
+
+@test "passes extra fields of author entries to the email template" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  jd: Jane Doe; jdoe; platform
+  fb: Frances Bar; fbar; mobile;
+email_template: '{{.Username}}@{{index .Extra 0}}.hamster.local'
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jdoe@platform.hamster.local'"
+  assert_line "GIT_COMMITTER_EMAIL='fbar@mobile.hamster.local'"
+}
+
+@test "warns about broken authors and keeps the others" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  jd: Jane Doe
+  fb: Frances Bar
+  nn: "; nobody"
+  bm: Bad Mail
+  ls: [Listy, Sue]
+email:
+  domain: hamster.info.local
+email_addresses:
+  bm: not-an-email
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author bm has an invalid email address \"not-an-email\" in email_addresses, ignoring it"
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author ls is neither a name nor a team of authors, ignoring it"
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author nn has no name, ignoring it"
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+
+  run git duet jd nn
+  assert_failure
+  assert_line "unknown initials nn, known initials are: fb (Frances Bar), jd (Jane Doe)"
+}
+
+@test "reads structured authors with meta for templates" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd:
+    name: Jane Doe
+    username: jdoe
+    meta:
+      ghe_login: jane-d
+  platform:
+    fb:
+      name: Frances Bar
+      meta:
+        ghe_login: fbar
+    on: Oscar
+email_template: '{{index .Meta "ghe_login"}}{{.Meta.missing}}@ghe.hamster.local'
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line "GIT_AUTHOR_EMAIL='jane-d@ghe.hamster.local'"
+  assert_line "GIT_COMMITTER_EMAIL='fbar@ghe.hamster.local'"
+
+  run git duet --format '{{.Initials}} {{.Username}} {{index .Meta "ghe_login"}} [{{.Meta.cost_center}}]' jd on
+  assert_success
+  assert_line "jd jdoe jane-d []"
+  assert_line "on   []"
+}
+
+@test "uses the explicit email of structured authors over every other source" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Jane Doe
+    username: jdoe
+    email: jane@explicit.local
+  al:
+    name: Abraham Lincoln
+    username: abe
+    email: abe@explicit.local
+  fb: Frances Bar; fbar
+  on:
+    name: Oscar
+    username: oscar
+email:
+  domain: hamster.info.local
+email_addresses:
+  jd: jane@addresses.local
+  fb: frances@addresses.local
+lookup_overrides:
+  al: echo abe@override.local
+EOF
+  # over email_addresses, a lookup_overrides command and the global lookup
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_LOOKUP" git duet --format '{{.Initials}} {{.Email}}' jd al fb
+  assert_success
+  assert_line 'jd jane@explicit.local'
+  assert_line 'al abe@explicit.local'
+  assert_line 'fb fb9000@dalek.info.local'
+
+  # over the username, while email_addresses still applies to other authors
+  run git duet --format '{{.Initials}} {{.Email}}' jd fb on
+  assert_success
+  assert_line 'jd jane@explicit.local'
+  assert_line 'fb frances@addresses.local'
+  assert_line 'on oscar@hamster.info.local'
+
+  run env GIT_DUET_DEBUG=1 git duet -q jd fb
+  assert_success
+  assert_line 'using explicit email from author entry for jd'
+}
+
+@test "uses the explicit email of structured authors over email_template" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Jane Doe
+    email: jane@explicit.local
+  fb: Frances Bar
+email_template: '{{.Initials}}@template.local'
+EOF
+  run git duet --format '{{.Initials}} {{.Email}}' jd fb
+  assert_success
+  assert_line 'jd jane@explicit.local'
+  assert_line 'fb fb@template.local'
+}
+
+@test "rejects invalid explicit emails of structured authors" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Jane Doe
+    email: jane at explicit.local
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author jd has an invalid email \"jane at explicit.local\", ignoring it"
+}
+
+@test "turns \"Last, First\" names around with name_format: last_first" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Doe, Jane
+  fb: Frances Bar
+  jj: Doe, John, Jr.
+  mc: McDoe, Mary, Ann
+name_format: last_first
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --allow-duplicates --format '{{.Initials}} {{.Name}}' jd fb jj mc
+  assert_success
+  assert_line 'jd Jane Doe'
+  assert_line 'fb Frances Bar'
+  assert_line 'jj John Doe Jr.'
+  assert_line 'mc Mary, Ann McDoe'
+}
+
+@test "makes up emails from names turned around by name_format" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Doe, Jane
+  jj: Dough, John, Jr.
+name_format: last_first
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --format '{{.Initials}} {{.Email}}' jd jj
+  assert_success
+  assert_line 'jd j.doe@hamster.info.local'
+  assert_line 'jj j.dough@hamster.info.local'
+}
+
+@test "leaves \"Last, First\" names alone without name_format" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Doe, Jane
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --format '{{.Name}}' jd fb
+  assert_success
+  assert_line 0 'Doe, Jane'
+}
+
+@test "applies the name_format of structured authors" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Doe, Jane
+    name_format: last_first
+  fb:
+    name: Bar, Frances
+  zp:
+    name: Pants, Zubaz
+    name_format: first_last
+name_format: last_first
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --format '{{.Name}}' jd fb zp
+  assert_success
+  assert_line 0 'Jane Doe'
+  assert_line 1 'Frances Bar'
+  assert_line 2 'Pants, Zubaz'
+}
+
+@test "writes Co-authored-by trailers with names turned around by name_format" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Doe, Jane
+  fb: Bar, Frances
+name_format: last_first
+email:
+  domain: hamster.info.local
+EOF
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  add_file first.txt
+  git commit -q -m 'Testing name_format'
+
+  run grep 'Co-authored-by: Frances Bar <f.bar@hamster.info.local>' .git/COMMIT_EDITMSG
+  assert_success
+}
+
+@test "rejects an unknown name_format" {
+  echo 'name_format: surname_first' >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  assert_line "could not parse $GIT_DUET_AUTHORS_FILE: unknown name_format \"surname_first\", must be first_last or last_first"
+}
+
+@test "ignores authors with an unknown name_format" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Doe, Jane
+    name_format: surname_first
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author jd has an unknown name_format \"surname_first\", must be first_last or last_first, ignoring it"
+}
+
+@test "normalizes the initials of the authors file" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  ' JD': Jane Doe
+  'Fb ': Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --format '{{.Initials}} {{.Name}}' jd FB
+  assert_success
+  assert_line 0 'jd Jane Doe'
+  assert_line 1 'fb Frances Bar'
+
+  git duet -q JD fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb'
+}
+
+@test "rejects initials that are the same once normalized" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  ' jd ': John Doe
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line "could not parse $GIT_DUET_AUTHORS_FILE: initials \" jd \" and \"jd\" are the same once normalized"
+}
+
+@test "suggests case_sensitive_initials when initials only differ in case" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  JD: John Doe
+  jd: Jane Doe
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd JD
+  assert_failure
+  assert_line "could not parse $GIT_DUET_AUTHORS_FILE: initials \"JD\" and \"jd\" are the same once normalized, set case_sensitive_initials to tell them apart"
+}
+
+@test "keeps initials that differ in case apart with case_sensitive_initials" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  JD: John Smith
+  ' jd': Jane Doe
+case_sensitive_initials: true
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --format '{{.Initials}} {{.Name}}' jd JD
+  assert_success
+  assert_line 0 'jd Jane Doe'
+  assert_line 1 'JD John Smith'
+}
+
+@test "reports email_template parse errors with the template and position" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email_template: "{{.Username}@hamster.local"
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_output "could not parse $GIT_DUET_AUTHORS_FILE: invalid email_template \"{{.Username}@hamster.local\" at line 1: bad character U+007D '}'"
+}
+
+@test "reports email_template execution errors with the author being rendered" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd:
+    name: Jane Doe
+    username: jdoe
+    meta:
+      ghe_login: jane-d
+  fb: Frances Bar
+email_template: '{{.Meta.ghe_login}}@ghe.hamster.local'
+email_template_strict: true
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_output 'email_template "{{.Meta.ghe_login}}@ghe.hamster.local" failed for fb at line 1, column 7: executing "email" at <.Meta.ghe_login>: map has no entry for key "ghe_login" (name "Frances Bar", username "", team "", extra [], meta map[])'
+}
+
+@test "leaves missing map keys in email_template empty unless strict" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+email_template: '{{.Meta.ghe_login}}{{.Initials}}@ghe.hamster.local'
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_COMMITTER_EMAIL='fb@ghe.hamster.local'"
+}
+
+@test "rejects initials used in two teams" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  platform:
+    jd: Jane Doe
+  mobile:
+    jd: John Doe
+EOF
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: initials jd are used in both team mobile and team platform"
+}
+
+@test "rejects initials used both in a team and at the top level" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  platform:
+    jd: Jane Doe
+  jd: John Doe
+EOF
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: initials jd are used both at the top level and in team platform"
+}
+
+@test "reads .pairs files from git pair" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+# .pairs - configuration for 'git pair'
+pairs:
+  # <initials>: <Firstname> <Lastname>[; <email-id>]
+  eh: Edwin Hubble; ehubble
+  js: Josh Susser
+  sf: Serguei Filimonov; serguei
+email:
+  prefix: pair
+  domain: pivotallabs.com
+  # no_solo_prefix: true
+#global: true
+EOF
+  run git duet eh js
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='ehubble@pivotallabs.com'"
+  assert_line "GIT_COMMITTER_EMAIL='j.susser@pivotallabs.com'"
+}
+
+@test "reads .pairs files from git pair with a shorthand email and email_addresses" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  eh: Edwin Hubble; ehubble
+  js: Josh Susser
+email: pair@pivotallabs.com
+email_addresses:
+  js: jsusser@gmail.com
+global: true
+EOF
+  run git duet eh js
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='ehubble@pivotallabs.com'"
+  assert_line "GIT_COMMITTER_EMAIL='jsusser@gmail.com'"
+}
+
+@test "reads .pairs files from git pair with only the email domain" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  eh: Edwin Hubble; ehubble
+  js: Josh Susser
+email: pivotallabs.com
+EOF
+  run git duet eh js
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='ehubble@pivotallabs.com'"
+}
+
+@test "prints the shared email of git pair with git duet pair-email" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  eh: Edwin Hubble; ehubble
+  js: Josh Susser
+  sf: Serguei Filimonov; serguei
+email: pair@pivotallabs.com
+EOF
+  run git duet pair-email js eh
+  assert_success 'pair+eh+js@pivotallabs.com'
+  run git duet pair-email sf,js,eh
+  assert_success 'pair+eh+js+sf@pivotallabs.com'
+}
+
+@test "needs an email prefix and two people for git duet pair-email" {
+  run git duet pair-email jd fb
+  assert_failure 'no email prefix configured'
+  run git duet pair-email jd
+  assert_failure 'pair-email takes the initials of at least two people'
+}
+
+@test "explains that an empty authors file has no authors" {
+  : > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  assert_line "$GIT_DUET_AUTHORS_FILE does not contain any authors, list them under \"authors:\", e.g."
+}
+
+@test "explains that an authors file with only comments has no authors" {
+  printf '# TODO: add the team\n---\n' > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  assert_line "$GIT_DUET_AUTHORS_FILE does not contain any authors, list them under \"authors:\", e.g."
+}
+
+@test "explains that an authors file with only email addresses has no authors" {
+  printf 'email_addresses:\n  jd: jane@hamsters.biz.local\n' > "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure
+  assert_line "$GIT_DUET_AUTHORS_FILE does not contain any authors, list them under \"authors:\", e.g."
+}
+
+@test "rejects emails outside of allowed_domains" {
+  echo "allowed_domains: [hamsters.biz.local, pika.info.local]" >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet jd fb
+  assert_failure "email f.bar@hamster.info.local for fb is not in an allowed domain (hamsters.biz.local, pika.info.local)"
+
+  run git duet -q jd zs
+  assert_success
+}
+
+@test "uses usernames containing @ as the full email address" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+pairs:
+  jd: Jane Doe
+  xy: Alex Yu; alex@agency.example
+  bd: Bad Address; bad@
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd xy
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='j.doe@hamster.info.local'"
+  assert_line "GIT_COMMITTER_EMAIL='alex@agency.example'"
+
+  run git duet jd bd
+  assert_failure "username \"bad@\" for bd is not a valid email address"
+}
+
+@test "uses GitHub noreply addresses of usernames with github_noreply" {
+  mkdir -p "$GIT_DUET_TEST_DIR/ghe/api/v3/users"
+  echo '{"login": "jdoe", "id": 1234}' > "$GIT_DUET_TEST_DIR/ghe/api/v3/users/jdoe"
+  start_test_server "$GIT_DUET_TEST_DIR/ghe"
+
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar
+  xx: Mystery Person; nobody
+email:
+  domain: hamster.info.local
+github_noreply:
+  api_url: $GIT_DUET_TEST_SERVER_URL/api/v3
+  domain: users.noreply.ghe.hamster.local
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='1234+jdoe@users.noreply.ghe.hamster.local'"
+  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+
+  GIT_DUET_GITHUB_NOREPLY_DOMAIN=users.noreply.example run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='1234+jdoe@users.noreply.example'"
+
+  run git duet xx fb
+  assert_failure "github lookup for xx failed: no GitHub user is named nobody"
+}
+
+@test "uses public GitLab emails or noreply addresses of usernames with gitlab" {
+  # the static server ignores the ?username= search, returning every user
+  mkdir -p "$GIT_DUET_TEST_DIR/gitlab/api/v4"
+  cat > "$GIT_DUET_TEST_DIR/gitlab/api/v4/users" <<EOF
+[
+  {"id": 41, "username": "jdoe2", "public_email": "other@gitlab.hamster.local"},
+  {"id": 42, "username": "jdoe", "public_email": ""},
+  {"id": 43, "username": "fbar", "public_email": "frances@gitlab.hamster.local"}
+]
+EOF
+  start_test_server "$GIT_DUET_TEST_DIR/gitlab"
+
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar; fbar
+  xx: Mystery Person; nobody
+gitlab:
+  url: $GIT_DUET_TEST_SERVER_URL
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='42-jdoe@users.noreply.127.0.0.1'"
+  assert_line "GIT_COMMITTER_EMAIL='frances@gitlab.hamster.local'"
+
+  GIT_DUET_GITLAB_NOREPLY_DOMAIN=users.noreply.gitlab.hamster.local run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='42-jdoe@users.noreply.gitlab.hamster.local'"
+
+  run git duet xx fb
+  assert_failure "gitlab lookup for xx failed: no GitLab user is named nobody"
+}
+
+@test "rejects someone given twice" {
+  run git duet jd fb jd
+  assert_failure 'jd is given more than once'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+}
+
+@test "rejects initials of the same person" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe
+  jn: Jane Nee
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+email_addresses:
+  jd: jane@hamsters.biz.local
+  jn: Jane@Hamsters.biz.local
+EOF
+
+  run git duet fb jd jn
+  assert_failure 'jd and jn are the same person (jane@hamsters.biz.local)'
+}
+
+@test "rejects someone given twice with prefix matching" {
+  export GIT_DUET_PREFIX_INITIALS=1
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jdo: Jane Doe
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+EOF
+
+  run git duet jd jdo
+  assert_failure 'jdo is given more than once'
+}
+
+@test "allows someone twice with --allow-duplicates" {
+  run git duet --allow-duplicates jd jd
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
+  assert_line "GIT_COMMITTER_EMAIL='jane@hamsters.biz.local'"
+}
+
+set_labeled_email_addresses() {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe
+  fb: Frances Bar
+  on: Oscar
+email:
+  domain: hamster.info.local
+email_addresses:
+  jd:
+    work: jane@hamsters.biz.local
+    oss: jane@oss.example
+  fb:
+    oss: frances@oss.example
+    work: f.bar@hamster.info.local
+EOF
+}
+
+@test "uses the first of labeled email addresses by default" {
+  set_labeled_email_addresses
+
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
+  assert_line "GIT_COMMITTER_EMAIL='frances@oss.example'"
+}
+
+@test "picks labeled email addresses with duet.emailLabel" {
+  set_labeled_email_addresses
+
+  git config --global duet.emailLabel oss
+  run git duet jd fb on
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jane@oss.example'"
+  assert_line "GIT_COMMITTER_EMAIL='frances@oss.example'"
+
+  git config duet.emailLabel work
+  run git duet --format '{{.Initials}} {{.Email}} {{.EmailLabel}}' jd fb on
+  assert_success
+  assert_line 'jd jane@hamsters.biz.local work'
+  assert_line 'fb f.bar@hamster.info.local work'
+  assert_line 'on oscar@hamster.info.local '
+}
+
+@test "lists the labels of an author when their email label is unknown" {
+  set_labeled_email_addresses
+  git config duet.emailLabel home
+
+  run git duet jd fb
+  assert_failure
+  assert_line 'unknown email label home for jd, known labels are: work, oss'
+  assert_line 'unknown email label home for fb, known labels are: oss, work'
+}
+
+@test "credits co-authors with the selected labeled address" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  set_labeled_email_addresses
+  git config duet.emailLabel oss
+  git duet -q jd fb
+
+  add_file
+  git duet-commit -q -m 'Labeled'
+  run git log -1 --format='%an <%ae>%n%(trailers:key=Co-authored-by)'
+  assert_success
+  assert_line 'Jane Doe <jane@oss.example>'
+  assert_line 'Co-authored-by: Frances Bar <frances@oss.example>'
+
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
+  assert_success 'frances@oss.example'
+}
+
+@test "ignores authors with invalid labeled email addresses" {
+  set_labeled_email_addresses
+  sed -i.bak 's/oss: jane@oss.example/oss: not-an-address/' "$GIT_DUET_AUTHORS_FILE"
+
+  run git duet jd fb
+  assert_failure
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author jd has an invalid email address \"not-an-address\" in email_addresses, ignoring it"
+}
+
+@test "renders templates in email_addresses" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar; fbar
+  on: Oscar
+email:
+  domain: corp.local
+email_addresses:
+  jd: "{{.Username}}+pair@{{.Domain}}"
+  fb:
+    work: "{{.Username}}@{{.Domain}}"
+    oss: "{{toLower .Initials}}@oss.example"
+  on: "{{.Name}}@plain.local"
+EOF
+  run git duet --format '{{.Initials}} {{.Email}}' jd fb on
+  assert_success
+  assert_line 'jd jdoe+pair@corp.local'
+  assert_line 'fb fbar@corp.local'
+  assert_line 'on Oscar@plain.local'
+
+  git config duet.emailLabel oss
+  run git duet --format '{{.Initials}} {{.Email}}' jd fb
+  assert_success
+  assert_line 'fb fb@oss.example'
+}
+
+@test "names the author when an email_addresses template fails" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar
+email:
+  domain: corp.local
+email_addresses:
+  jd: "{{index .Extra 0}}@{{.Domain}}"
+  fb: "{{.Username}}@{{.Domain}}"
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line 'email_addresses template "{{index .Extra 0}}@{{.Domain}}" failed for jd at line 1, column 2: executing "email" at <index .Extra 0>: error calling index: reflect: slice index out of range (name "Jane Doe", username "jdoe", team "", extra [], meta map[])'
+  assert_line 'email_addresses template "{{.Username}}@{{.Domain}}" made up "@corp.local" for fb, which is not an email address'
+}
+
+@test "ignores authors with invalid email_addresses templates" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar
+email:
+  domain: corp.local
+email_addresses:
+  jd: "{{.Username}@{{.Domain}}"
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line "git-duet: warning: $GIT_DUET_AUTHORS_FILE: author jd has an invalid email_addresses template \"{{.Username}@{{.Domain}}\" at line 1: bad character U+007D '}', ignoring it"
+}
+
+@test "uses noreply-style addresses with private_email" {
+  echo 'private_email: true' >> "$GIT_DUET_AUTHORS_FILE"
+
+  run git duet jd al
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jd@users.noreply.hamster.info.local'"
+  assert_line "GIT_COMMITTER_EMAIL='al@users.noreply.hamster.info.local'"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jd@users.noreply.hamster.info.local'
+
+  run git duet --format email
+  assert_success
+  assert_line 'jd@users.noreply.hamster.info.local'
+  refute_line 'jane@hamsters.biz.local'
+}
+
+@test "fails with private_email but neither a pattern nor an email domain" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe; jdoe
+  fb: Frances Bar
+email_addresses:
+  jd: jane@hamsters.biz.local
+  fb: f.bar@hamster.info.local
+private_email: true
+EOF
+  run git duet jd fb
+  assert_failure
+  assert_line 'private_email needs a pattern or an email domain to make up an address for jd'
+}
+
+@test "uses the private_email pattern from the authors file" {
+  echo "private_email: '{{.Initials}}+{{toLower (index (split .Name \" \") 0)}}@private.{{.Domain}}'" >> "$GIT_DUET_AUTHORS_FILE"
+
+  run git duet jd al
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jd+jane@private.hamster.info.local'"
+  assert_line "GIT_COMMITTER_EMAIL='al+abraham@private.hamster.info.local'"
+}
+
+@test "keeps the real address available to formats in private mode" {
+  echo 'private_email: true' >> "$GIT_DUET_AUTHORS_FILE"
+
+  run git duet --format '{{.Email}} {{.RealEmail}}' jd fb
+  assert_success
+  assert_line 'jd@users.noreply.hamster.info.local jane@hamsters.biz.local'
+  assert_line 'fb@users.noreply.hamster.info.local f.bar@hamster.info.local'
+}
+
+@test "duet.privateEmail in git config overrides private_email" {
+  git config duet.privateEmail true
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jd@users.noreply.hamster.info.local'"
+
+  git config duet.privateEmail '{{.Initials}}@noreply.example.com'
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jd@noreply.example.com'"
+
+  echo 'private_email: true' >> "$GIT_DUET_AUTHORS_FILE"
+  git config duet.privateEmail false
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
+}
+
+@test "credits co-authors with their private addresses" {
+  export GIT_DUET_CO_AUTHORED_BY=1
+  echo 'private_email: true' >> "$GIT_DUET_AUTHORS_FILE"
+  git duet -q jd fb
+
+  add_file
+  git duet-commit -q -m 'Private'
+  run git log -1 --format='%an <%ae>%n%(trailers:key=Co-authored-by)'
+  assert_success
+  assert_line 'Jane Doe <jd@users.noreply.hamster.info.local>'
+  assert_line 'Co-authored-by: Frances Bar <fb@users.noreply.hamster.info.local>'
+}
+
+@test "uses code host noreply addresses with private_email" {
+  mkdir -p "$GIT_DUET_TEST_DIR/gitlab/api/v4"
+  cat > "$GIT_DUET_TEST_DIR/gitlab/api/v4/users" <<EOF
+[
+  {"id": 43, "username": "fbar", "public_email": "frances@gitlab.hamster.local"}
+]
+EOF
+  start_test_server "$GIT_DUET_TEST_DIR/gitlab"
+
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jd: Jane Doe
+  fb: Frances Bar; fbar
+email:
+  domain: hamster.info.local
+gitlab:
+  url: $GIT_DUET_TEST_SERVER_URL
+private_email: true
+EOF
+  run git duet jd fb
+  assert_success
+  assert_line "GIT_AUTHOR_EMAIL='jd@users.noreply.hamster.info.local'"
+  assert_line "GIT_COMMITTER_EMAIL='43-fbar@users.noreply.127.0.0.1'"
+}
+
+@test "rejects private_email patterns that do not make up an address" {
+  echo "private_email: '{{.Name}}'" >> "$GIT_DUET_AUTHORS_FILE"
+
+  run git duet jd fb
+  assert_failure
+  assert_line 'private_email pattern made up "Jane Doe" for jd, which is not an email address'
+}
+
+@test "rejects authors files setting both github_noreply and gitlab" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+github_noreply: true
+gitlab: true
+EOF
+  run git duet jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: github_noreply and gitlab are both set, only one can resolve usernames"
+}
+
+@test "caches looked up emails when GIT_DUET_EMAIL_LOOKUP_CACHE_TTL is set" {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  export GIT_DUET_EMAIL_LOOKUP_CACHE_TTL=3600
+  printf '#!/usr/bin/env bash\necho run >> "%s"\necho "$1@lookie.me.local"\n' "$GIT_DUET_TEST_DIR/lookups" > "$GIT_DUET_TEST_LOOKUP"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jd@lookie.me.local'
+  [ "$(wc -l < "$GIT_DUET_TEST_DIR/lookups")" -eq 2 ]
+}
+
+@test "fails and then skips failing lookups when GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL is set" {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  export GIT_DUET_EMAIL_LOOKUP_CACHE_TTL=3600
+  export GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL=60
+  printf '#!/usr/bin/env bash\necho run >> "%s"\necho oops >&2\nexit 1\n' "$GIT_DUET_TEST_DIR/lookups" > "$GIT_DUET_TEST_LOOKUP"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_failure
+  assert_line "email lookup for jd failed: exit status 1: oops"
+  run env GIT_DUET_DEBUG=1 GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_failure
+  assert_line "skipping email lookup for jd, it failed recently: email lookup for jd failed: exit status 1: oops"
+  [ "$(wc -l < "$GIT_DUET_TEST_DIR/lookups")" -eq 2 ]
+}
+
+@test "falls back to the authors file and skips failing lookups with GIT_DUET_EMAIL_LOOKUP_FALLBACK and a negative cache" {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  export GIT_DUET_EMAIL_LOOKUP_CACHE_TTL=3600
+  export GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL=60
+  export GIT_DUET_EMAIL_LOOKUP_FALLBACK=1
+  printf '#!/usr/bin/env bash\necho run >> "%s"\nexit 1\n' "$GIT_DUET_TEST_DIR/lookups" > "$GIT_DUET_TEST_LOOKUP"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run env GIT_DUET_DEBUG=1 GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_success
+  assert_line "skipping email lookup for jd, it failed recently: email lookup for jd failed: exit status 1"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane@hamsters.biz.local'
+  [ "$(wc -l < "$GIT_DUET_TEST_DIR/lookups")" -eq 2 ]
+}
+
+@test "rejects a GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL longer than GIT_DUET_EMAIL_LOOKUP_CACHE_TTL" {
+  export GIT_DUET_EMAIL_LOOKUP_CACHE_TTL=30
+  export GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL=60
+  run git duet -q jd fb
+  assert_failure
+  assert_line "GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL (60) must not be longer than GIT_DUET_EMAIL_LOOKUP_CACHE_TTL (30)"
+}
+
+@test "forgets failed lookups when clearing the lookup cache" {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  export GIT_DUET_EMAIL_LOOKUP_CACHE_TTL=3600
+  export GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL=60
+  printf '#!/usr/bin/env bash\necho run >> "%s"\nexit 1\n' "$GIT_DUET_TEST_DIR/lookups" > "$GIT_DUET_TEST_LOOKUP"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_failure
+  run git duet --clear-lookup-cache
+  assert_success
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_failure
+  [ "$(wc -l < "$GIT_DUET_TEST_DIR/lookups")" -eq 4 ]
+}
+
+@test "fails on failing lookups without GIT_DUET_EMAIL_LOOKUP_NEGATIVE_CACHE_TTL" {
+  printf '#!/usr/bin/env bash\nexit 1\n' > "$GIT_DUET_TEST_LOOKUP"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_failure
+}
+
+@test "uses lookup_overrides instead of the lookup command for that author" {
+  printf '#!/usr/bin/env bash\necho "$2@$1"\n' > "$GIT_DUET_TEST_DIR/contractor-lookup"
+  chmod +x "$GIT_DUET_TEST_DIR/contractor-lookup"
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+lookup_overrides:
+  fb: "'$GIT_DUET_TEST_DIR/contractor-lookup' agency.example"
+EOF
+  run env GIT_DUET_DEBUG=1 GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_success
+  assert_line "using email lookup \"'$GIT_DUET_TEST_DIR/contractor-lookup' agency.example\" for fb from lookup_overrides"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane_doe@lookie.me.local'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
+  assert_success 'fb@agency.example'
+}
+
+@test "skips the lookup for authors with an empty lookup_overrides entry" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+lookup_overrides:
+  jd: ""
+EOF
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane@hamsters.biz.local'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
+  assert_success 'fb9000@dalek.info.local'
+}
+
+@test "rejects lookup_overrides with unterminated quotes" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+lookup_overrides:
+  fb: "'/bin/lookup"
+EOF
+  run git duet -q jd fb
+  assert_failure "could not parse $GIT_DUET_AUTHORS_FILE: lookup_overrides for fb: unterminated ' quote in \"'/bin/lookup\""
+}
+
+@test "rejects a lookup command missing from PATH when loading the authors file" {
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=git-duet-email-lookup-missing git duet -q jd fb
+  assert_failure "email lookup command 'git-duet-email-lookup-missing' not found in PATH"
+}
+
+@test "rejects a lookup command that does not exist" {
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/missing-lookup" git duet -q jd fb
+  assert_failure "email lookup command '$GIT_DUET_TEST_DIR/missing-lookup' does not exist"
+}
+
+@test "rejects a lookup command that is not executable" {
+  chmod -x "$GIT_DUET_TEST_LOOKUP"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_LOOKUP" git duet -q jd fb
+  assert_failure "email lookup command '$GIT_DUET_TEST_LOOKUP' is not executable"
+
+  run env PATH="$GIT_DUET_TEST_DIR:$PATH" GIT_DUET_EMAIL_LOOKUP_COMMAND=email-lookup git duet -q jd fb
+  assert_failure "email lookup command 'email-lookup' is not executable"
+}
+
+@test "looks up signing keys with GIT_DUET_KEY_LOOKUP_COMMAND" {
+  cat > "$GIT_DUET_TEST_DIR/key-lookup" <<'EOF'
+#!/usr/bin/env bash
+case "$1" in
+  jd) echo "KEY-$1-$2" ;;
+  *) exit 2 ;;
+esac
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/key-lookup"
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+signing_keys:
+  jd: FROM-FILE-JD
+  fb: FROM-FILE-FB
+EOF
+
+  run env GIT_DUET_KEY_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/key-lookup" git duet --format '{{.Initials}} {{.SigningKey}}' jd fb al
+  assert_success
+  assert_line 0 'jd KEY-jd-Jane Doe'
+  assert_line 1 'fb FROM-FILE-FB'
+  assert_line 2 'al '
+}
+
+@test "uses signing_keys without a key lookup command" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+signing_keys:
+  JD: 3AA5C34371567BD2
+EOF
+  run git duet --format '{{.Initials}} {{.SigningKey}}' jd fb
+  assert_success
+  assert_line 0 'jd 3AA5C34371567BD2'
+  assert_line 1 'fb '
+}
+
+@test "prefers the key and email of structured authors over lookups" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'YML'
+authors:
+  jd:
+    name: Jane Doe
+    email: jane@x.com
+    key: 3AA5C34371567BD2
+  fb: Frances Bar
+email:
+  domain: hamster.info.local
+YML
+  run env GIT_DUET_KEY_LOOKUP_COMMAND="$(command -v echo)" GIT_DUET_EMAIL_LOOKUP_COMMAND="$(command -v echo)" git duet --format '{{.Initials}} {{.Email}} {{.SigningKey}}' jd fb
+  assert_success
+  assert_line 0 'jd jane@x.com 3AA5C34371567BD2'
+  assert_line 1 'fb fb Frances Bar fb Frances Bar'
+}
+
+@test "fails when the key lookup command fails" {
+  run env GIT_DUET_KEY_LOOKUP_COMMAND=false git duet -q jd fb
+  assert_failure
+  assert_line 'signing key lookup for jd failed: exit status 1'
+}
+
+@test "traces signing key resolution with GIT_DUET_DEBUG" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+signing_keys:
+  fb: FROM-FILE-FB
+EOF
+  run env GIT_DUET_DEBUG=1 GIT_DUET_KEY_LOOKUP_COMMAND="$(command -v true)" git duet -q jd fb
+  assert_success
+  assert_line "using signing key lookup \"$(command -v true)\" for jd"
+  assert_line 'signing key lookup has no key for jd'
+  assert_line 'no signing key for jd'
+  assert_line 'using signing key from signing_keys for fb'
+}
+
+@test "rejects a key lookup command that does not exist" {
+  run env GIT_DUET_KEY_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/missing-lookup" git duet -q jd fb
+  assert_failure "signing key lookup command '$GIT_DUET_TEST_DIR/missing-lookup' does not exist"
+}
+
+@test "fails lookups taking longer than GIT_DUET_EMAIL_LOOKUP_TIMEOUT" {
+  cat > "$GIT_DUET_TEST_DIR/slow-lookup" <<'EOF'
+#!/usr/bin/env bash
+sleep 10
+echo slow@lookie.me.local
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/slow-lookup"
+  SECONDS=0
+  run env GIT_DUET_EMAIL_LOOKUP_TIMEOUT=1 GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/slow-lookup" git duet -q jd fb
+  assert_failure
+  assert_line 'email lookup for jd failed: no answer within 1s'
+  [ "$SECONDS" -lt 5 ]
+}
+
+@test "falls back to the authors file when a lookup times out with GIT_DUET_EMAIL_LOOKUP_FALLBACK" {
+  cat > "$GIT_DUET_TEST_DIR/slow-lookup" <<'EOF'
+#!/usr/bin/env bash
+sleep 10
+EOF
+  chmod +x "$GIT_DUET_TEST_DIR/slow-lookup"
+  run env GIT_DUET_EMAIL_LOOKUP_TIMEOUT=1 GIT_DUET_EMAIL_LOOKUP_FALLBACK=1 GIT_DUET_EMAIL_LOOKUP_COMMAND="$GIT_DUET_TEST_DIR/slow-lookup" git duet --format '{{.Initials}} {{.Email}}' jd fb
+  assert_success
+  assert_line 0 'jd jane@hamsters.biz.local'
+  assert_line 1 'fb f.bar@hamster.info.local'
+}
+
+@test "prints how long the pair has been pairing" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.session-start" "$(( $(date +%s) - 7980 ))"
+  run git duet
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line '# pairing for 2h13m'
+}
+
+@test "keeps the session when the same pair is set again in whatever roles" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.session-start" 1000
+  git duet -q jd fb
+  git duet -q fb jd
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.session-start"
+  assert_success '1000'
+}
+
+@test "starts a new session when the pair changes" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.session-start" 1000
+  git duet -q jd zs
+  run git duet
+  assert_line '# pairing for 0m'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.session-members"
+  assert_success 'jd,zs'
+}
+
+@test "counts a session starting in the future as just started" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.session-start" "$(( $(date +%s) + 3600 ))"
+  run git duet
+  assert_line '# pairing for 0m'
+  run bash -c "git duet --format json | jq .session.seconds"
+  assert_success '0'
+}
+
+@test "prints the pair and session duration with --format prompt" {
+  git duet -q jd fb zs
+  git config "$GIT_DUET_CONFIG_NAMESPACE.session-start" "$(( $(date +%s) - 2700 ))"
+  run git duet --format prompt
+  assert_success 'jd+fb+zs (45m)'
+}
+
+@test "prints nothing with --format prompt when nothing is configured" {
+  run git duet --format prompt
+  assert_success ''
+}
+
+@test "prints the session start as JSON" {
+  git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.session-start" "$(( $(date +%s) - 120 ))"
+  run bash -c "git duet --format json | jq -c '.session | [(.start | fromdateiso8601 | type), (.seconds >= 120 and .seconds < 180)]'"
+  assert_success '["number",true]'
+}
+
+@test "makes up email addresses from awkward names" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  po: Pat O'Brien
+  am: Anne-Marie Smith
+  je: J. R. Ewing
+  lb: Ludwig van Beethoven
+  jn: José Núñez
+  co: Chloë O'Neil--Smith
+  dj: Dale Jr., Jr.
+  on: "'Oscar'"
+  pm: "-.- Morse"
+email:
+  domain: hamster.info.local
+EOF
+  run git duet --format '{{.Initials}} {{.Email}}' po am je lb jn co dj on pm
+  assert_success 'po p.obrien@hamster.info.local
+am a.smith@hamster.info.local
+je j.r.ewing@hamster.info.local
+lb l.vanbeethoven@hamster.info.local
+jn j.nunez@hamster.info.local
+co c.oneil-smith@hamster.info.local
+dj d.jr@hamster.info.local
+on oscar@hamster.info.local
+pm morse@hamster.info.local'
+}
+
+@test "fails to make up an email address from a name without ASCII letters" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  zw: 张伟
+email:
+  domain: hamster.info.local
+EOF
+  run git duet jd zw
+  assert_failure
+  assert_line 'cannot make up an email for zw from "张伟": it has no letters or digits that can be spelled in ASCII'
+}
+
+@test "keeps explicit and templated email addresses as they are" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  po:
+    name: Pat O'Brien
+    email: pat.o'brien@hamster.info.local
+  jd: Jane Doe
+email_template: '{{replace (toLower .Name) " " "_" -1}}@hamster.info.local'
+EOF
+  run git duet --format '{{.Email}}' po jd
+  assert_success "pat.o'brien@hamster.info.local
+jane_doe@hamster.info.local"
+}
+
+@test "fails to make up an email address without an email domain" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar; fbar
+EOF
+  git config user.email 'test@example.com'
+  run git duet jd fb
+  assert_failure
+  assert_line 'cannot make up an email for jd: email.domain is not set in the authors file. Set it, or give an email with an email entry, email_addresses, email_template or GIT_DUET_EMAIL_LOOKUP_COMMAND (user.email is at example.com, `email: {domain: example.com}` would use it)'
+}
+
+@test "does not need an email domain for authors with an email" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  jd: Jane Doe
+  fb: Frances Bar; f.bar@hamster.info.local
+email_addresses:
+  jd: jane@hamsters.biz.local
+EOF
+  run git duet --format '{{.Email}}' jd fb
+  assert_success 'jane@hamsters.biz.local
+f.bar@hamster.info.local'
+}
+
+@test "finds lookup commands in PATH" {
+  run env PATH="$GIT_DUET_TEST_DIR:$PATH" GIT_DUET_EMAIL_LOOKUP_COMMAND=email-lookup git duet -q jd fb
+  assert_success
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane_doe@lookie.me.local'
+}
+
+@test "rejects lookup_overrides commands that cannot be run" {
+  cat >> "$GIT_DUET_AUTHORS_FILE" <<EOF
+lookup_overrides:
+  fb: git-duet-email-lookup-missing --team platform
+EOF
+  run git duet -q jd fb
+  assert_failure "lookup_overrides for fb: email lookup command 'git-duet-email-lookup-missing' not found in PATH"
+}
+
+@test "defers checking the lookup command with GIT_DUET_EMAIL_LOOKUP_DEFER_CHECK" {
+  GIT_DUET_EMAIL_LOOKUP_DEFER_CHECK=1 GIT_DUET_EMAIL_LOOKUP_FALLBACK=1 GIT_DUET_EMAIL_LOOKUP_COMMAND=git-duet-email-lookup-missing git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane@hamsters.biz.local'
+}
+
+@test "falls back to the authors file when the lookup prints nothing" {
+  printf '#!/usr/bin/env bash\nexit 0\n' > "$GIT_DUET_TEST_LOOKUP"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane@hamsters.biz.local'
+}
+
+@test "falls back to the authors file when the lookup exits 2" {
+  printf '#!/usr/bin/env bash\necho "no email for $1" >&2\nexit 2\n' > "$GIT_DUET_TEST_LOOKUP"
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
+  assert_success 'f.bar@hamster.info.local'
+}
+
+@test "includes the stderr of failing lookups in the error" {
+  printf '#!/usr/bin/env bash\necho "directory unreachable" >&2\nexit 1\n' > "$GIT_DUET_TEST_LOOKUP"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  assert_failure
+  assert_line "email lookup for jd failed: exit status 1: directory unreachable"
+}
+
+@test "falls back to the authors file on failing lookups with GIT_DUET_EMAIL_LOOKUP_FALLBACK" {
+  printf '#!/usr/bin/env bash\nexit 1\n' > "$GIT_DUET_TEST_LOOKUP"
+  GIT_DUET_EMAIL_LOOKUP_FALLBACK=1 GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane@hamsters.biz.local'
+}
+
+# lookup_markers makes the lookup command record when each lookup starts and
+# ends in $GIT_DUET_TEST_DIR/lookups, the lookup for $1 (if given) waiting up
+# to 5s for the one for $2 to start
+lookup_markers() {
+  cat > "$GIT_DUET_TEST_LOOKUP" <<EOF
+#!/usr/bin/env bash
+echo "start \$1" >> "$GIT_DUET_TEST_DIR/lookups"
+if [ "\$1" = "$1" ]; then
+  for i in \$(seq 50); do
+    grep -qx "start $2" "$GIT_DUET_TEST_DIR/lookups" && break
+    sleep 0.1
+  done
+fi
+sleep 0.1
+echo "end \$1" >> "$GIT_DUET_TEST_DIR/lookups"
+echo "\$1@lookie.me.local"
+EOF
+}
+
+@test "resolves emails concurrently keeping the initials in order" {
+  lookup_markers jd fb
+  GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb zp zs
+  # the lookup for fb started while the one for jd was running
+  run grep -nx -e 'start fb' -e 'end jd' "$GIT_DUET_TEST_DIR/lookups"
+  [[ ${lines[0]} == *:'start fb' ]]
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jd@lookie.me.local'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb, +zp, +zs'
+}
+
+@test "resolves emails serially with GIT_DUET_EMAIL_LOOKUP_CONCURRENCY=1" {
+  lookup_markers
+  GIT_DUET_EMAIL_LOOKUP_CONCURRENCY=1 GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet -q jd fb zp zs
+  # every lookup ended before the next one started
+  run bash -c "paste -d ' ' - - < '$GIT_DUET_TEST_DIR/lookups' | awk '\$2 != \$4 || \$1 != \"start\" || \$3 != \"end\"'"
+  assert_success ''
+  [ "$(wc -l < "$GIT_DUET_TEST_DIR/lookups")" -eq 8 ]
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb, +zp, +zs'
+}
+
+@test "reports every author that could not be resolved" {
+  run git duet jd xx fb yy
+  assert_failure
+  assert_line "unknown initials xx, known initials are: al (Abraham Lincoln), fb (Frances Bar), jd (Jane Doe), on (Oscar), zp (Zubaz Pants), zs (Zubaz Shirts)"
+  assert_line "unknown initials yy, known initials are: al (Abraham Lincoln), fb (Frances Bar), jd (Jane Doe), on (Oscar), zp (Zubaz Pants), zs (Zubaz Shirts)"
+}
+
+@test "suggests the closest initials on rosters larger than GIT_DUET_INITIALS_HINT_LIMIT" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=3 git duet jx fb
+  assert_failure "unknown initials jx, did you mean: jd (Jane Doe)"
+
+  run env GIT_DUET_INITIALS_HINT_LIMIT=3 git duet zz fb
+  assert_failure "unknown initials zz, did you mean: zp (Zubaz Pants), zs (Zubaz Shirts)"
+}
+
+@test "suggests the authors whose name or username was given instead of initials" {
+  run git duet jane fb
+  assert_failure "unknown initials jane, did you mean: jd (Jane Doe)"
+
+  run git duet fb zubaz
+  assert_failure "unknown initials zubaz, did you mean: zp (Zubaz Pants), zs (Zubaz Shirts)"
+
+  run git duet ABE fb
+  assert_failure "unknown initials ABE, did you mean: al (Abraham Lincoln)"
+}
+
+set_authors_with_shell_characters() {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'EOF'
+authors:
+  ob: Fran O'Brien
+  dq: Dee "Quote" $HOME `id`
+email_addresses:
+  ob: o'brien+$(id)@hamsters.biz.local
+  dq: "dq\\'s@hamsters.biz.local"
+EOF
+}
+
+@test "quotes names and emails so that eval keeps them intact" {
+  set_authors_with_shell_characters
+  output_file="$GIT_DUET_TEST_DIR/exports"
+  git duet ob dq > "$output_file"
+
+  run sh -c '. "$1"; printf "%s|%s|%s|%s" "$GIT_AUTHOR_NAME" "$GIT_AUTHOR_EMAIL" "$GIT_COMMITTER_NAME" "$GIT_COMMITTER_EMAIL"' sh "$output_file"
+  assert_success "Fran O'Brien|o'brien+\$(id)@hamsters.biz.local|Dee \"Quote\" \$HOME \`id\`|dq\\'s@hamsters.biz.local"
+
+  run sh -c 'eval "$(git duet --show)"; printf %s "$GIT_AUTHOR_NAME"'
+  assert_success "Fran O'Brien"
+}
+
+@test "quotes names and emails for fish with --shell fish" {
+  set_authors_with_shell_characters
+  run git duet --shell fish ob dq
+  assert_success
+  assert_line "set -gx GIT_AUTHOR_NAME 'Fran O\\'Brien'"
+  assert_line "set -gx GIT_COMMITTER_EMAIL 'dq\\\\\\'s@hamsters.biz.local'"
+
+  if ! command -v fish > /dev/null; then
+    skip "fish is not installed"
+  fi
+  run fish -c 'eval (git duet --show --shell fish | string collect); printf %s $GIT_COMMITTER_NAME'
+  assert_success 'Dee "Quote" $HOME `id`'
+}
+
+@test "refuses to print values containing a newline" {
+  git duet -q jd fb
+  # authors files cannot contain such names, but git config can
+  git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-name" "$(printf 'New\nLine')"
+  run git duet
+  assert_failure 'refusing to print GIT_COMMITTER_NAME="New\nLine": it contains a newline'
+}
+
+@test "rejects unknown shells" {
+  run git duet --shell csh jd fb
+  assert_failure 'unknown shell "csh", must be one of: posix, fish'
+}
+
+@test "accepts initials separated by commas or plus signs in one argument" {
+  git duet -q jd,fb
+  run git duet --show --format '{{.Initials}}'
+  assert_success "jd
+fb"
+
+  git duet -q 'zs+ jd'
+  run git duet --show --format '{{.Initials}}'
+  assert_success "zs
+jd"
+}
+
+@test "accepts initials separated by whitespace in one argument" {
+  git duet -q 'jd fb'
+  run git duet --show --format '{{.Initials}}'
+  assert_success "jd
+fb"
+}
+
+@test "accepts a mix of arguments and separated initials in order" {
+  git duet -q jd fb,zs al+on
+  run git duet --show --format '{{.Initials}}'
+  assert_success "jd
+fb
+zs
+al
+on"
+}
+
+@test "rejects empty initials between separators" {
+  run git duet jd,,fb
+  assert_failure 'empty initials in "jd,,fb", separate initials with spaces, commas or plus signs'
+
+  run git duet jd fb+
+  assert_failure 'empty initials in "fb+", separate initials with spaces, commas or plus signs'
+}
+
+@test "explains the separators when unsplit initials are unknown" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet 'jd;fb' zs
+  assert_failure "unknown initials jd;fb (separate initials with spaces, commas or plus signs)"
+}
+
+@test "accepts unique prefixes of initials with GIT_DUET_PREFIX_INITIALS" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<EOF
+authors:
+  jdo: Jane Doe; jane
+  fba: Frances Bar
+  fbo: Fred Bob
+  al: Abraham Lincoln
+  alx: Alex Xu
+email:
+  domain: hamster.info.local
+EOF
+  GIT_DUET_PREFIX_INITIALS=1 git duet -q jd al
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jdo'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-name"
+  assert_success 'Abraham Lincoln'
+
+  run env GIT_DUET_PREFIX_INITIALS=1 git duet jd fb
+  assert_failure "ambiguous initials fb, could be any of: fba, fbo"
+}
+
+@test "requires exact initials without GIT_DUET_PREFIX_INITIALS" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet j fb
+  assert_failure "unknown initials j"
+}
+
+@test "does not list initials when GIT_DUET_INITIALS_HINT_LIMIT is 0" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git duet jx fb
+  assert_failure "unknown initials jx"
+}
+
+@test "rejects looked up emails outside of allowed_domains" {
+  echo "allowed_domains: [hamsters.biz.local]" >> "$GIT_DUET_AUTHORS_FILE"
+  run env GIT_DUET_EMAIL_LOOKUP_COMMAND=$GIT_DUET_TEST_LOOKUP git duet jd fb
+  assert_failure
+  assert_line "email jane_doe@lookie.me.local for jd is not in an allowed domain (hamsters.biz.local)"
+  assert_line "email fb9000@dalek.info.local for fb is not in an allowed domain (hamsters.biz.local)"
+}
+
 @test "uses custom email template for author when provided" {
   local suffix=$RANDOM
 
@@ -77,101 +1861,559 @@ load test_helper
   run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
   assert_success "zubaz.pants$suffix@mompopshop.local"
 
-  clear_custom_email_template
+  clear_custom_email_template
+}
+
+@test "sets the git user email globally" {
+  git duet -g -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
+  assert_success 'jane@hamsters.biz.local'
+}
+
+@test "sets the git user initials globally" {
+  git duet -g -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "sets the git user name globally" {
+  git duet -g -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-name"
+  assert_success 'Jane Doe'
+}
+
+@test "sets the git committer email globally" {
+  git duet -g -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-committer-name"
+  assert_success 'Frances Bar'
+}
+
+@test "sets the git committer initials globally" {
+  git duet -g -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb'
+}
+
+@test "sets the git committer name globally" {
+  git duet -g -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
+  assert_success 'f.bar@hamster.info.local'
+}
+
+@test "reads configuration globally" {
+  git duet -g -q jd fb
+  git duet fb on
+  run git duet -g
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+}
+
+@test "respects GIT_DUET_GLOBAL" {
+  GIT_DUET_GLOBAL=1 git duet -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "sets the pair in the repository config with --local even if GIT_DUET_GLOBAL is set" {
+  GIT_DUET_GLOBAL=1 git duet -q --local jd fb
+  run git config --local "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+}
+
+@test "uses the global config by default if duet.global is set" {
+  git config duet.global true
+  git duet -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "prefers GIT_DUET_GLOBAL over duet.global" {
+  git config duet.global yes
+  GIT_DUET_GLOBAL=0 git duet -q jd fb
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+  run git config --local "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "rejects an invalid duet.global" {
+  git config duet.global sometimes
+  run git duet jd fb
+  assert_failure 'duet.global: invalid boolean "sometimes"'
+}
+
+@test "rejects --global with --local" {
+  run git duet -g -l jd fb
+  assert_failure '--global and --local are mutually exclusive'
+}
+
+@test "warns when showing a repository pair that shadows the global one" {
+  git duet -g -q jd fb
+  git duet -q fb on
+  run git duet
+  assert_success
+  assert_line "git-duet: warning: the pair in the repository config (fb) shadows the global one (jd), \`git duet --local --clear\` removes it"
+}
+
+@test "warns when setting a global pair shadowed by the repository pair" {
+  git duet -q fb on
+  run git duet -g jd fb
+  assert_success
+  assert_line "git-duet: warning: the pair in the repository config (fb) shadows the global one (jd), \`git duet --local --clear\` removes it"
+}
+
+@test "does not warn about shadowing when GIT_DUET_GLOBAL is set" {
+  git duet -q fb on
+  run env GIT_DUET_GLOBAL=1 git duet jd fb
+  assert_success
+  refute_line "git-duet: warning: the pair in the repository config (fb) shadows the global one (jd), \`git duet --local --clear\` removes it"
+}
+
+@test "warns that commits use the global pair when setting a repository pair with GIT_DUET_GLOBAL set" {
+  run env GIT_DUET_GLOBAL=1 git duet --local jd fb
+  assert_success
+  assert_line "git-duet: warning: commits use the global pair as GIT_DUET_GLOBAL or duet.global is set"
+}
+
+@test "does not sets git user.name and user.email by default" {
+  git duet -q jd fb
+  run git config "user.name"
+  assert_success 'Test User'
+  run git config "user.email"
+  assert_success 'test@example.com'
+}
+
+@test "sets git user.name and user.email if GIT_DUET_SET_GIT_USER_CONFIG" {
+  GIT_DUET_SET_GIT_USER_CONFIG=1 git duet -q jd fb
+  run git config "user.name"
+  assert_success 'Jane Doe'
+  run git config "user.email"
+  assert_success 'jane@hamsters.biz.local'
+}
+
+@test "sets git user.name and user.email if GIT_DUET_CO_AUTHORED_BY" {
+  # since GIT_DUET_CO_AUTHORED_BY implicitly sets GIT_DUET_SET_GIT_USER_CONFIG
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  run git config "user.name"
+  assert_success 'Jane Doe'
+  run git config "user.email"
+  assert_success 'jane@hamsters.biz.local'
+}
+
+@test "output is displayed" {
+  run git duet jd fb
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+}
+
+@test "output is not displayed when quieted" {
+  run git duet -q jd fb
+  assert_success ""
+}
+
+@test "picks a random committer excluding the author and excluded initials" {
+  echo "exclude: [fb, al, on, zp]" >> "$GIT_DUET_AUTHORS_FILE"
+  run git duet --random --yes jd
+  assert_success
+  assert_line "random pair: jd zs"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'zs'
+}
+
+@test "excludes initials whatever their case" {
+  echo "exclude: [FB, ' Al', ON, zP]" >> "$GIT_DUET_AUTHORS_FILE"
+  for seed in 1 2 3 4 5 6 7 8; do
+    GIT_DUET_RANDOM_SEED=$seed git duet -q --random --yes jd
+    run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+    assert_success 'zs'
+  done
+}
+
+@test "picks a reproducible random pair when seeded" {
+  GIT_DUET_RANDOM_SEED=42 git duet -q -r -y
+  first="$(git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials") $(git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials")"
+  GIT_DUET_RANDOM_SEED=42 git duet -q -r -y
+  second="$(git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials") $(git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials")"
+  assert_equal "$first" "$second"
+}
+
+@test "picks a reproducible random pair when seeded with 0" {
+  GIT_DUET_RANDOM_SEED=0 git duet -q -r -y
+  first="$(git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials") $(git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials")"
+  for i in 1 2 3 4; do
+    GIT_DUET_RANDOM_SEED=0 git duet -q -r -y
+    second="$(git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials") $(git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials")"
+    assert_equal "$first" "$second"
+  done
+}
+
+@test "prints the random pair on stderr, and not at all when quieted" {
+  echo "exclude: [fb, al, on, zp]" >> "$GIT_DUET_AUTHORS_FILE"
+  run bash -c 'git duet --random --yes jd 2>&1 >/dev/null'
+  assert_success 'random pair: jd zs'
+  run git duet -q --random --yes jd
+  assert_success ''
+}
+
+@test "does not apply a random pair unless confirmed" {
+  run bash -c 'echo n | git duet -r jd'
+  assert_failure
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_failure
+}
+
+@test "suggests the partner paired with least often" {
+  echo "exclude: [on, zp, zs]" >> "$GIT_DUET_AUTHORS_FILE"
+  git duet -q jd al
+  add_file first.txt
+  git duet-commit -q -m 'first'
+  add_file second.txt
+  git duet-commit -q -m 'second'
+  git duet -q jd fb
+  add_file third.txt
+  git duet-commit -q -m 'third'
+
+  run git duet --suggest --yes jd
+  assert_success
+  assert_line "suggested partner: fb (Frances Bar)"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'fb'
+}
+
+@test "prints the suggested partner on stderr, and not at all when quieted" {
+  echo "exclude: [on, zp, zs]" >> "$GIT_DUET_AUTHORS_FILE"
+  git duet -q jd fb
+  add_file first.txt
+  git duet-commit -q -m 'first'
+
+  run bash -c 'git duet --suggest --yes jd 2>&1 >/dev/null'
+  assert_success 'suggested partner: al (Abraham Lincoln)'
+  run git duet -q --suggest --yes jd
+  assert_success ''
+}
+
+@test "suggests partners never paired with first, alphabetically" {
+  git duet -q jd al
+  add_file first.txt
+  git duet-commit -q -m 'first'
+
+  run bash -c 'echo n | git duet --suggest'
+  assert_failure
+  assert_line "suggested partner: fb (Frances Bar)"
+}
+
+@test "suggests partners in a repository without commits" {
+  echo "exclude: [on, zp, zs]" >> "$GIT_DUET_AUTHORS_FILE"
+  git init -q empty
+  cd empty
+
+  run git duet --suggest --yes jd
+  assert_success
+  assert_line "suggested partner: al (Abraham Lincoln)"
+}
+
+@test "ignores separators in the names of the history when suggesting partners" {
+  echo "exclude: [on, zp, zs]" >> "$GIT_DUET_AUTHORS_FILE"
+  git duet -q jd al
+  add_file first.txt
+  git duet-commit -q -m 'first'
+  add_file second.txt
+  git -c user.name="$(printf 'Jane\x1e Doe')" -c user.email=jane@hamsters.biz.local commit -q \
+    -m "$(printf 'second\n\nCo-authored-by: Mallory\x1ff.bar@hamster.info.local\nCo-authored-by: Eve <f.bar@hamster.info.local> Jr <eve@evil.local>')"
+
+  run git duet --suggest --yes jd
+  assert_success
+  assert_line "suggested partner: fb (Frances Bar)"
+}
+
+@test "prints current config" {
+  git duet -q jd fb
+  run git duet
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+}
+
+@test "prints current config with --show" {
+  git duet -q jd fb
+  run git duet --show
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
+  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
+}
+
+@test "prints current config using a format preset" {
+  git duet -q jd fb
+  run git duet --show --format email
+  assert_success "jane@hamsters.biz.local
+f.bar@hamster.info.local"
+}
+
+@test "prints the new pair using a format template" {
+  run git duet --format '{{.Initials}}={{toUpper .Name}}' jd fb
+  assert_success "jd=JANE DOE
+fb=FRANCES BAR"
+}
+
+@test "swaps author and committer with --swap" {
+  git duet -q jd fb
+  run git duet --swap
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_NAME='Jane Doe'"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'fb'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'jd'
 }
 
-@test "sets the git user email globally" {
-  git duet -g -q jd fb
-  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
-  assert_success 'jane@hamsters.biz.local'
+@test "rotates a mob by one with --rotate" {
+  git duet -q jd fb zs
+  run git duet --rotate --format '{{.Initials}}'
+  assert_success "fb
+zs
+jd"
 }
 
-@test "sets the git user initials globally" {
-  git duet -g -q jd fb
-  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+@test "makes the second initials the author with --invert" {
+  run git duet --invert jd fb
+  assert_success
+  assert_line 'git-duet: roles inverted, fb is the author'
+  assert_line "GIT_AUTHOR_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_NAME='Jane Doe'"
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'fb'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
   assert_success 'jd'
 }
 
-@test "sets the git user name globally" {
-  git duet -g -q jd fb
-  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-name"
-  assert_success 'Jane Doe'
+@test "shows the inverted roles with --show" {
+  GIT_DUET_INVERT=1 git duet -q jd fb
+  run git duet --show
+  assert_success
+  assert_line "GIT_AUTHOR_NAME='Frances Bar'"
+  assert_line "GIT_COMMITTER_NAME='Jane Doe'"
 }
 
-@test "sets the git committer email globally" {
-  git duet -g -q jd fb
-  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-committer-name"
-  assert_success 'Frances Bar'
+@test "makes the last initials of a mob the author with GIT_DUET_INVERT" {
+  GIT_DUET_INVERT=1 git duet -q jd fb zs
+  run git duet --show --format '{{.Initials}}'
+  assert_success "zs
+fb
+jd"
 }
 
-@test "sets the git committer initials globally" {
-  git duet -g -q jd fb
-  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
-  assert_success 'fb'
+@test "rotates an inverted mob without inverting again" {
+  git duet -q --invert jd fb zs
+  run git duet --rotate --format '{{.Initials}}'
+  assert_success "fb
+jd
+zs"
 }
 
-@test "sets the git committer name globally" {
-  git duet -g -q jd fb
-  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-committer-email"
-  assert_success 'f.bar@hamster.info.local'
+@test "re-resolves emails from the authors file when swapping" {
+  git duet -q jd fb
+  sed -i.bak 's/jane@hamsters.biz.local/jane@new.hamsters.biz.local/' "$GIT_DUET_AUTHORS_FILE"
+  run git duet --swap
+  assert_success
+  assert_line "GIT_COMMITTER_EMAIL='jane@new.hamsters.biz.local'"
 }
 
-@test "reads configuration globally" {
-  git duet -g -q jd fb
-  git duet fb on
-  run git duet -g
-  assert_success
-  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
-  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
-  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
-  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+@test "refuses to swap when working solo" {
+  git solo -q jd
+  run git duet --swap
+  assert_failure 'cannot swap roles when working solo, pair up with `git duet` first'
 }
 
-@test "does not sets git user.name and user.email by default" {
+@test "forgets the configured pair with --clear" {
   git duet -q jd fb
-  run git config "user.name"
+  run git duet --clear
+  assert_success
+  run git config --get-regexp "^$GIT_DUET_CONFIG_NAMESPACE\\."
+  assert_failure
+  run git duet --show --format json
+  assert_success 'null'
+}
+
+@test "restores user.name and user.email with --clear" {
+  GIT_DUET_SET_GIT_USER_CONFIG=1 git duet -q jd fb
+  GIT_DUET_SET_GIT_USER_CONFIG=1 git duet -q fb jd
+  run git config user.name
+  assert_success 'Frances Bar'
+  git duet --clear
+  run git config user.name
   assert_success 'Test User'
-  run git config "user.email"
+  run git config user.email
   assert_success 'test@example.com'
 }
 
-@test "sets git user.name and user.email if GIT_DUET_SET_GIT_USER_CONFIG" {
+@test "falls back to the global user.name and user.email with --clear" {
+  export GIT_CONFIG_GLOBAL="$GIT_DUET_TEST_DIR/gitconfig"
+  git config --global user.name 'Global User'
+  git config --global user.email 'global@example.com'
+  git config --unset user.name
+  git config --unset user.email
+
   GIT_DUET_SET_GIT_USER_CONFIG=1 git duet -q jd fb
-  run git config "user.name"
-  assert_success 'Jane Doe'
-  run git config "user.email"
-  assert_success 'jane@hamsters.biz.local'
+  GIT_DUET_SET_GIT_USER_CONFIG=1 git duet -q fb jd
+  run git config --local user.name
+  assert_success 'Frances Bar'
+  git duet --clear
+  run git config --local user.name
+  assert_failure
+  run git config --local user.email
+  assert_failure
+  run git config user.name
+  assert_success 'Global User'
+  run git config user.email
+  assert_success 'global@example.com'
 }
 
-@test "sets git user.name and user.email if GIT_DUET_CO_AUTHORED_BY" {
-  # since GIT_DUET_CO_AUTHORED_BY implicitly sets GIT_DUET_SET_GIT_USER_CONFIG
-  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
-  run git config "user.name"
-  assert_success 'Jane Doe'
-  run git config "user.email"
-  assert_success 'jane@hamsters.biz.local'
+@test "forgets the global pair with --clear -g" {
+  git duet -q -g jd fb
+  git duet -q jd zs
+  git duet --clear -g
+  run git config --global --get-regexp "^$GIT_DUET_CONFIG_NAMESPACE\\."
+  assert_failure
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-committer-initials"
+  assert_success 'zs'
 }
 
-@test "output is displayed" {
-  run git duet jd fb
-  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
-  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
-  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
-  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+@test "does nothing with --clear when nothing is configured" {
+  run git duet --clear
+  assert_success
+  run git duet --clear -g
+  assert_success
 }
 
-@test "output is not displayed when quieted" {
-  run git duet -q jd fb
-  assert_success ""
+@test "records when the pair expires with GIT_DUET_EXPIRE_AFTER" {
+  GIT_DUET_EXPIRE_AFTER=3600 git duet -q jd fb
+  run git duet --porcelain
+  assert_success
+  [[ $output = *"expires "* ]]
+  [[ $output != *"expired"* ]]
+
+  git duet -q jd fb
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.expires"
+  assert_failure
 }
 
-@test "prints current config" {
+@test "reports an expired pair" {
+  GIT_DUET_EXPIRE_AFTER=3600 git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.expires" 1
+  run git duet --porcelain
+  assert_success
+  assert_line "expires 1"
+  assert_line "expired true"
+  run git duet --show --format json
+  assert_failure
+  [[ $output = "the pair expired at "* ]]
+}
+
+@test "setting the pair again resets its expiry" {
+  GIT_DUET_EXPIRE_AFTER=3600 git duet -q jd fb
+  git config "$GIT_DUET_CONFIG_NAMESPACE.expires" 1
+  GIT_DUET_EXPIRE_AFTER=3600 git duet -q jd fb
+  run git duet --show --format json
+  assert_success
+}
+
+@test "prints current config as JSON" {
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb zs
+  run bash -c "GIT_DUET_CO_AUTHORED_BY=1 git duet --show --format json | jq 'del(.mtime, .session)'"
+  assert_success '{
+  "author": {
+    "name": "Jane Doe",
+    "email": "jane@hamsters.biz.local",
+    "initials": "jd"
+  },
+  "committer": {
+    "name": "Frances Bar",
+    "email": "f.bar@hamster.info.local",
+    "initials": "fb"
+  },
+  "co_authors": [
+    {
+      "name": "Frances Bar",
+      "email": "f.bar@hamster.info.local",
+      "initials": "fb"
+    },
+    {
+      "name": "Zubaz Shirts",
+      "email": "z.shirts@pika.info.local",
+      "initials": "zs"
+    }
+  ],
+  "scope": "local",
+  "co_authored_by": true,
+  "authors_file": "'"$GIT_DUET_AUTHORS_FILE"'"
+}'
+}
+
+@test "prints null as JSON when nothing is configured" {
+  run git duet --show --format json
+  assert_success 'null'
+}
+
+@test "prints current config as JSON with --json" {
   git duet -q jd fb
-  run git duet
-  assert_line "GIT_AUTHOR_NAME='Jane Doe'"
-  assert_line "GIT_AUTHOR_EMAIL='jane@hamsters.biz.local'"
-  assert_line "GIT_COMMITTER_NAME='Frances Bar'"
-  assert_line "GIT_COMMITTER_EMAIL='f.bar@hamster.info.local'"
+  run bash -c "git duet --json | jq -c '[.author.initials, .committer.initials, .authors_file]'"
+  assert_success "[\"jd\",\"fb\",\"$GIT_DUET_AUTHORS_FILE\"]"
+}
+
+@test "rejects --json with another --format" {
+  run git duet --json --format short
+  assert_failure '--json and --format are mutually exclusive'
+}
+
+@test "rejects --quiet with --format before changing config" {
+  run git duet -q --format short jd fb
+  assert_failure '--format and --quiet are mutually exclusive'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+  run git duet -q --json jd fb
+  assert_failure '--format and --quiet are mutually exclusive'
+}
+
+@test "rejects an invalid format template before changing config" {
+  run git duet --format '{{.Name' jd fb
+  assert_failure
+  [[ $output = *'"{{.Name"'* ]]
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+}
+
+@test "prints current config in porcelain format" {
+  git duet -q jd fb zs
+  run bash -c "git duet --porcelain | grep -v '^mtime '"
+  assert_success "version 1
+author.initials jd
+author.name Jane Doe
+author.email jane@hamsters.biz.local
+committer.initials fb
+committer.name Frances Bar
+committer.email f.bar@hamster.info.local
+coauthor.1.initials fb
+coauthor.1.name Frances Bar
+coauthor.1.email f.bar@hamster.info.local
+coauthor.2.initials zs
+coauthor.2.name Zubaz Shirts
+coauthor.2.email z.shirts@pika.info.local"
+  run git duet --porcelain
+  assert_line "mtime $(git config "$GIT_DUET_CONFIG_NAMESPACE.mtime")"
+}
+
+@test "prints NUL-terminated porcelain records with -z" {
+  run bash -c "git duet --porcelain -z jd fb | tr '\\0' '|' | cut -d'|' -f1-3"
+  assert_success "version 1|author.initials jd|author.name Jane Doe"
 }
 
 @test "honors source when printing config" {
@@ -321,6 +2563,73 @@ load test_helper
   grep 'Co-authored-by: Zubaz Shirts <z.shirts@pika.info.local>' .git/COMMIT_EDITMSG
 }
 
+@test "writes Co-authored-by trailers in the configured order for three co-authors" {
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb zs al
+  add_file first.txt
+  git commit -q -m 'Testing trailer order'
+
+  run bash -c "git log -1 --format=%B | grep Co-authored-by"
+  assert_success "Co-authored-by: Frances Bar <f.bar@hamster.info.local>
+Co-authored-by: Zubaz Shirts <z.shirts@pika.info.local>
+Co-authored-by: Abraham Lincoln <abe@hamster.info.local>"
+}
+
+@test "normalizes the order of existing Co-authored-by trailers for four co-authors when amending" {
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb zs al zp
+  add_file first.txt
+  git commit -q -F - <<EOF
+Testing trailer normalization
+
+Co-authored-by: Zubaz Pants <z.pants@hamster.info.local>
+Co-authored-by: Abraham Lincoln <abe@hamster.info.local>
+Co-authored-by: Frances Bar <f.bar@hamster.info.local>
+Co-authored-by: Zubaz Shirts <z.shirts@pika.info.local>
+EOF
+  git commit -q --amend --no-edit
+
+  run bash -c "git log -1 --format=%B | grep Co-authored-by"
+  assert_success "Co-authored-by: Frances Bar <f.bar@hamster.info.local>
+Co-authored-by: Zubaz Shirts <z.shirts@pika.info.local>
+Co-authored-by: Abraham Lincoln <abe@hamster.info.local>
+Co-authored-by: Zubaz Pants <z.pants@hamster.info.local>"
+}
+
+@test "uses trailer_key from the authors file for co-author trailers" {
+  echo "trailer_key: Paired-with" >> "$GIT_DUET_AUTHORS_FILE"
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  add_file first.txt
+  git commit -q -m 'Testing custom trailer key'
+
+  grep 'Paired-with: Frances Bar <f.bar@hamster.info.local>' .git/COMMIT_EDITMSG
+  run grep 'Co-authored-by' .git/COMMIT_EDITMSG
+  assert_failure
+}
+
+@test "GIT_DUET_TRAILER_KEY overrides trailer_key from the authors file" {
+  echo "trailer_key: Paired-with" >> "$GIT_DUET_AUTHORS_FILE"
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  add_file first.txt
+  GIT_DUET_TRAILER_KEY=Co-Authored-By git commit -q -m 'Testing trailer key override'
+
+  grep 'Co-Authored-By: Frances Bar <f.bar@hamster.info.local>' .git/COMMIT_EDITMSG
+}
+
+@test "does not credit a co-author twice when the trailer key changes" {
+  GIT_DUET_CO_AUTHORED_BY=1 git duet -q jd fb
+  add_file first.txt
+  git commit -q -m 'I get amended'
+
+  GIT_DUET_TRAILER_KEY=Paired-with git commit -q --amend --no-edit
+  [[ $(grep -c 'Frances Bar' .git/COMMIT_EDITMSG) = 1 ]]
+}
+
+@test "rejects trailer keys containing whitespace or colons" {
+  run env GIT_DUET_TRAILER_KEY='Paired with' git duet jd fb
+  assert_failure
+  run env GIT_DUET_TRAILER_KEY='Paired-with:' git duet jd fb
+  assert_failure
+}
+
 @test "does not rotate author by default" {
   export GIT_DUET_CO_AUTHORED_BY=1
   git duet -q jd fb
@@ -449,6 +2758,94 @@ load test_helper
   assert_equal 1 $status
 }
 
+@test "nudges about outdated hooks once per day" {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  printf '#!/usr/bin/env bash\nexec git duet-pre-commit "$@"' > .git/hooks/pre-commit
+
+  run git duet jd fb
+  assert_success
+  assert_line 'git-duet: the pre-commit hook is outdated, upgrade it with `git duet-install-hook --force pre-commit`'
+
+  run git duet jd fb
+  assert_success
+  refute_line 'git-duet: the pre-commit hook is outdated, upgrade it with `git duet-install-hook --force pre-commit`'
+}
+
+@test "nudges about outdated hooks in every repository" {
+  export XDG_CACHE_HOME="$GIT_DUET_TEST_DIR/cache"
+  git duet -q jd fb
+  git init -q "$GIT_DUET_TEST_DIR/other"
+  cd "$GIT_DUET_TEST_DIR/other"
+  printf '#!/usr/bin/env bash\nexec git duet-pre-commit "$@"' > .git/hooks/pre-commit
+
+  run git duet jd fb
+  assert_success
+  assert_line 'git-duet: the pre-commit hook is outdated, upgrade it with `git duet-install-hook --force pre-commit`'
+}
+
+@test "post-commit hook rotates plain git commits if GIT_DUET_ROTATE_AUTHOR" {
+  export GIT_DUET_ROTATE_AUTHOR=1
+  git duet -q jd fb
+  git duet-install-hook -q post-commit
+
+  add_file first.txt
+  run git commit -q -m 'first'
+  assert_success ''
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'fb'
+}
+
+@test "post-commit hook is a silent no-op without GIT_DUET_ROTATE_AUTHOR" {
+  git duet-install-hook -q post-commit
+
+  add_file first.txt
+  run git commit -q -m 'not configured'
+  assert_success ''
+
+  git duet -q jd fb
+  add_file second.txt
+  run git commit -q -m 'not rotating'
+  assert_success ''
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "post-commit hook does not rotate when rebasing or cherry-picking" {
+  add_file first.txt
+  git commit -q -m 'first'
+  add_file second.txt
+  git commit -q -m 'second'
+  git checkout -q -b picked HEAD~2
+  add_file picked.txt
+  git commit -q -m 'picked'
+  git checkout -q -b other HEAD~1
+  add_file third.txt
+  git commit -q -m 'third'
+
+  export GIT_DUET_ROTATE_AUTHOR=1
+  git duet -q jd fb
+  git duet-install-hook -q post-commit
+
+  git rebase -q --force-rebase master
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+
+  git cherry-pick picked >/dev/null
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+}
+
+@test "post-commit hook does not rotate commits made with git duet-commit twice" {
+  export GIT_DUET_ROTATE_AUTHOR=1
+  git duet -q jd fb zs
+  git duet-install-hook -q post-commit
+
+  add_file first.txt
+  git duet-commit -q -m 'first'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'fb'
+}
+
 @test "rotates committer and adds Co-authored-by trailer for new author when amending a commit and GIT_DUET_CO_AUTHORED_BY and GIT_DUET_ROTATE_AUTHOR" {
   export GIT_DUET_CO_AUTHORED_BY=1
   export GIT_DUET_ROTATE_AUTHOR=1
@@ -471,3 +2868,190 @@ load test_helper
   grep 'Co-authored-by: Frances Bar <f.bar@hamster.info.local>' .git/COMMIT_EDITMSG
   grep 'Co-authored-by: Jane Doe <jane@hamsters.biz.local>' .git/COMMIT_EDITMSG
 }
+
+@test "adds the co-authors to commit.template if GIT_DUET_COMMIT_TEMPLATE is set" {
+  export GIT_DUET_COMMIT_TEMPLATE=1
+  write_commit_template "$GIT_DUET_TEST_REPO/.gitmessage"
+
+  git duet -q jd fb al
+  run cat .gitmessage
+  assert_success "$(cat .gitmessage.orig)
+# --- git-duet co-authors (updated by git duet, do not edit) ---
+
+Co-authored-by: Frances Bar <f.bar@hamster.info.local>
+Co-authored-by: Abraham Lincoln <abe@hamster.info.local>
+# --- end of git-duet co-authors ---"
+}
+
+@test "leaves commit.template alone without GIT_DUET_COMMIT_TEMPLATE" {
+  write_commit_template "$GIT_DUET_TEST_REPO/.gitmessage"
+
+  git duet -q jd fb
+  cmp .gitmessage .gitmessage.orig
+}
+
+@test "keeps the rest of commit.template byte-identical when the pair changes" {
+  export GIT_DUET_COMMIT_TEMPLATE=1
+  write_commit_template "$GIT_DUET_TEST_REPO/.gitmessage"
+
+  git duet -q jd fb
+  git duet -q jd al
+  run grep -c 'Co-authored-by' .gitmessage
+  assert_success '1'
+  run grep 'Co-authored-by' .gitmessage
+  assert_success 'Co-authored-by: Abraham Lincoln <abe@hamster.info.local>'
+
+  git solo -q jd
+  cmp .gitmessage .gitmessage.orig
+
+  git duet -q jd fb
+  git duet --clear
+  cmp .gitmessage .gitmessage.orig
+}
+
+@test "updates the git-duet section of commit.template in place" {
+  export GIT_DUET_COMMIT_TEMPLATE=1
+  write_commit_template "$GIT_DUET_TEST_REPO/.gitmessage"
+  git duet -q jd fb
+  echo '# Signed-off-by lines go below' >> .gitmessage
+  cp .gitmessage .gitmessage.expected
+
+  git duet -q jd fb
+  cmp .gitmessage .gitmessage.expected
+
+  git duet -q --swap
+  sed 's/Frances Bar <f.bar@hamster.info.local>/Jane Doe <jane@hamsters.biz.local>/' .gitmessage.expected > .gitmessage.swapped
+  cmp .gitmessage .gitmessage.swapped
+
+  git solo -q jd
+  run tail -n 1 .gitmessage
+  assert_success '# Signed-off-by lines go below'
+  run grep -c 'git-duet' .gitmessage
+  assert_output '0'
+}
+
+@test "updates commit.template when rotating the author" {
+  export GIT_DUET_COMMIT_TEMPLATE=1
+  export GIT_DUET_ROTATE_AUTHOR=1
+  write_commit_template "$GIT_DUET_TEST_REPO/.gitmessage"
+  git duet -q jd fb
+
+  add_file first.txt
+  git duet-commit -q -m 'first'
+  run grep 'Co-authored-by' .gitmessage
+  assert_success 'Co-authored-by: Jane Doe <jane@hamsters.biz.local>'
+}
+
+@test "refuses to edit commit.template outside the home and the repository" {
+  export GIT_DUET_COMMIT_TEMPLATE=1
+  write_commit_template "$GIT_DUET_TEST_DIR/gitmessage"
+
+  run git duet jd fb
+  assert_failure
+  assert_line "refusing to edit commit.template $GIT_DUET_TEST_DIR/gitmessage outside your home and the repository, set GIT_DUET_COMMIT_TEMPLATE_FORCE to edit it anyway"
+  cmp "$GIT_DUET_TEST_DIR/gitmessage" "$GIT_DUET_TEST_DIR/gitmessage.orig"
+
+  GIT_DUET_COMMIT_TEMPLATE_FORCE=1 git duet -q jd fb
+  run grep 'Co-authored-by' "$GIT_DUET_TEST_DIR/gitmessage"
+  assert_success 'Co-authored-by: Frances Bar <f.bar@hamster.info.local>'
+}
+
+@test "fails on a git-duet section of commit.template without an end marker" {
+  export GIT_DUET_COMMIT_TEMPLATE=1
+  write_commit_template "$GIT_DUET_TEST_REPO/.gitmessage"
+  echo '# --- git-duet co-authors (updated by git duet, do not edit) ---' >> .gitmessage
+
+  run git duet jd fb
+  assert_failure
+  assert_line "could not update commit.template $GIT_DUET_TEST_REPO/.gitmessage: the git-duet section has no end marker (# --- end of git-duet co-authors ---)"
+}
+
+commit_as() {
+  git -c user.name="$1" -c user.email="$2" commit -q --allow-empty -m "commit by $1"
+}
+
+@test "imports authors from history, applying the mailmap" {
+  commit_as 'Jane Doe' jane@old.local
+  commit_as 'Jane D' jd@work.local
+  commit_as 'Jane Doe' jane@hamsters.biz.local
+  commit_as 'Frances Bar' f.bar@hamster.info.local
+  cat > .mailmap <<EOF
+# Jane changed jobs twice
+Jane Doe <jane@hamsters.biz.local> <jane@old.local>
+Jane Doe <jane@hamsters.biz.local> Jane D <jd@work.local>
+EOF
+
+  run git duet --import-history
+  assert_success
+  cat > "$GIT_DUET_TEST_DIR/expected" <<EOF
+version: 1
+authors:
+  fb:
+    name: Frances Bar
+  jd:
+    name: Jane Doe
+    meta:
+      aliases: jane@old.local, jd@work.local
+  tu:
+    name: Test User
+email_addresses:
+  fb: f.bar@hamster.info.local
+  jd: jane@hamsters.biz.local
+  tu: test@example.com
+EOF
+  assert_output "$(cat "$GIT_DUET_TEST_DIR/expected")"
+}
+
+@test "uses mailmap.file when importing authors from history" {
+  commit_as 'Jane Doe' jane@old.local
+  commit_as 'Jane Doe' jane@hamsters.biz.local
+  echo 'Jane Doe <jane@hamsters.biz.local> <jane@old.local>' > "$GIT_DUET_TEST_DIR/mailmap"
+  git config mailmap.file "$GIT_DUET_TEST_DIR/mailmap"
+
+  run git duet --import-history
+  assert_success
+  assert_line '      aliases: jane@old.local'
+  refute_line '  jd2:'
+}
+
+@test "reports people still duplicated after applying the mailmap when importing history" {
+  commit_as 'Frances Bar' fb@one.local
+  commit_as 'Frances Bar' fb@one.local
+  commit_as 'Frances Bar' fb@two.local
+
+  run git duet --import-history
+  assert_success
+  assert_line 'git-duet: warning: fb (Frances Bar) committed as fb@one.local and fb@two.local, using fb@one.local: map them in .mailmap if they are the same person'
+  assert_line '  fb: fb@one.local'
+  refute_line '  fb2:'
+}
+
+@test "makes up unique initials when importing history" {
+  commit_as 'Jane Doe' jane@hamsters.biz.local
+  commit_as 'Jane Doe' jane@hamsters.biz.local
+  commit_as 'John Dory' john@dory.local
+  commit_as 'John Dory' john@dory.local
+  commit_as 'Jo Dalton' jo@dalton.local
+  commit_as 'Cher' cher@example.com
+
+  run git duet --import-history
+  assert_success
+  assert_line '  jd: jane@hamsters.biz.local'
+  assert_line '  jod: john@dory.local'
+  assert_line '  jd2: jo@dalton.local'
+  assert_line '  ch: cher@example.com'
+}
+
+@test "transliterates names when making up initials on import" {
+  commit_as 'José Núñez' jose@example.com
+  commit_as 'Mary Smith-Jones' mary@example.com
+  commit_as 'Łukasz Ærø' lukasz@example.com
+  commit_as '张伟' wei@example.com
+
+  run git duet --import-history
+  assert_success
+  assert_line '  jn: jose@example.com'
+  assert_line '  msj: mary@example.com'
+  assert_line '  la: lukasz@example.com'
+  assert_line 'git-duet: warning: skipped 张伟 <wei@example.com>, add them by hand: cannot suggest initials for "张伟": it has no letters that can be spelled in ASCII'
+}
@@ -94,6 +94,22 @@ load test_helper
   assert_success 'jane@hamsters.biz.local'
 }
 
+@test "sets the author in the repository config with --local even if GIT_DUET_GLOBAL is set" {
+  GIT_DUET_GLOBAL=1 git solo -q --local jd
+  run git config --local "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_success 'jd'
+  run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+}
+
+@test "warns when showing a repository author that shadows the global one" {
+  git solo -g -q jd
+  git solo -q fb
+  run git solo
+  assert_success
+  assert_line "git-duet: warning: the pair in the repository config (fb) shadows the global one (jd), \`git duet --local --clear\` removes it"
+}
+
 @test "sets the git user email globally" {
   git solo -g jd
   run git config --global "$GIT_DUET_CONFIG_NAMESPACE.git-author-email"
@@ -147,6 +163,43 @@ load test_helper
   assert_success 'jane@hamsters.biz.local'
 }
 
+@test "prints the author using a format preset" {
+  run git solo --format short jd
+  assert_success "jd:jane@hamsters.biz.local"
+}
+
+@test "rejects --quiet with --format before changing config" {
+  run git solo -q --format short jd
+  assert_failure '--format and --quiet are mutually exclusive'
+  run git config "$GIT_DUET_CONFIG_NAMESPACE.git-author-initials"
+  assert_failure
+}
+
+@test "prints the author as JSON" {
+  run bash -c "git solo --format json -g jd | jq 'del(.mtime, .session)'"
+  assert_success '{
+  "author": {
+    "name": "Jane Doe",
+    "email": "jane@hamsters.biz.local",
+    "initials": "jd"
+  },
+  "committer": null,
+  "co_authors": null,
+  "scope": "global",
+  "co_authored_by": false,
+  "authors_file": "'"$GIT_DUET_AUTHORS_FILE"'"
+}'
+}
+
+@test "prints the author in porcelain format" {
+  git solo -q jd
+  run bash -c "git solo --porcelain | grep -v '^mtime '"
+  assert_success "version 1
+author.initials jd
+author.name Jane Doe
+author.email jane@hamsters.biz.local"
+}
+
 @test "prints current config" {
   git solo -q al
   run git solo
@@ -199,3 +252,19 @@ load test_helper
   run grep 'Co-authored-by:' .git/COMMIT_EDITMSG
   assert_failure
 }
+
+@test "explains the separators when given several initials in one argument" {
+  run env GIT_DUET_INITIALS_HINT_LIMIT=0 git solo jd,fb
+  assert_failure "unknown initials jd,fb (separate initials with spaces, commas or plus signs)"
+}
+
+@test "quotes the author so that eval keeps them intact" {
+  cat > "$GIT_DUET_AUTHORS_FILE" <<'AUTHORS'
+authors:
+  ob: Fran O'Brien
+email:
+  domain: hamsters.biz.local
+AUTHORS
+  run sh -c 'eval "$(git solo ob)"; printf %s "$GIT_AUTHOR_NAME"'
+  assert_success "Fran O'Brien"
+}
@@ -52,8 +52,14 @@ EOF
 }
 
 teardown() {
+  if [[ -n "$GIT_DUET_TEST_SERVER_PID" ]]; then
+    kill "$GIT_DUET_TEST_SERVER_PID" || true
+  fi
+
   git config --global --remove-section $GIT_DUET_CONFIG_NAMESPACE || true
   git config --global --unset init.templateDir || true
+  git config --global --unset duet.authorsfile || true
+  git config --global --unset duet.emailLabel || true
 
   #Reset original git global config. Otherwise tests would potentially change the system config.
   if [[ -n "$HOOKS_PATH_BAK" ]]; then
@@ -127,6 +133,20 @@ clear_custom_email_template() {
   mv "$GIT_DUET_AUTHORS_FILE.bak" "$GIT_DUET_AUTHORS_FILE"
 }
 
+write_commit_template() {
+  cat > "$1" <<EOF
+[PROJ-] 
+
+# Why is this change needed?
+#
+# How does it address the issue?
+#
+Refs: PROJ-
+EOF
+  cp "$1" "$1.orig"
+  git config commit.template "$1"
+}
+
 flunk() {
   { if [ "$#" -eq 0 ]; then cat -
     else echo "$@"
@@ -167,6 +187,18 @@ assert_output() {
   assert_equal "$expected" "$output"
 }
 
+# assert_golden compares the output with test/golden/NAME, the test directory
+# written as $TEST_DIR, and rewrites the file if GIT_DUET_UPDATE_GOLDEN is set
+assert_golden() {
+  local golden="$BATS_TEST_DIRNAME/golden/$1"
+  local actual="${output//$GIT_DUET_TEST_DIR/\$TEST_DIR}"
+  if [ -n "$GIT_DUET_UPDATE_GOLDEN" ]; then
+    mkdir -p "$(dirname "$golden")"
+    printf '%s\n' "$actual" > "$golden"
+  fi
+  assert_equal "$(cat "$golden")" "$actual"
+}
+
 assert_line() {
   if [ "$1" -ge 0 ] 2>/dev/null; then
     assert_equal "$2" "${lines[$1]}"
@@ -194,3 +226,24 @@ refute_line() {
     done
   fi
 }
+
+# serves the files below $1 over HTTP, the URL is in $GIT_DUET_TEST_SERVER_URL
+# If a plan file is given as $2, the requests misbehave as it says first (see
+# flaky_server.py).
+start_test_server() {
+  local port=$((20000 + RANDOM % 20000))
+  if [ -n "$2" ]; then
+    python3 "$BATS_TEST_DIRNAME/flaky_server.py" "$1" "$port" "$2" >/dev/null 2>&1 &
+  else
+    python3 -m http.server --bind 127.0.0.1 --directory "$1" "$port" >/dev/null 2>&1 &
+  fi
+  GIT_DUET_TEST_SERVER_PID=$!
+  GIT_DUET_TEST_SERVER_URL="http://127.0.0.1:$port"
+
+  local i
+  for i in $(seq 50); do
+    if (echo >"/dev/tcp/127.0.0.1/$port") 2>/dev/null; then return 0; fi
+    sleep 0.1
+  done
+  flunk "test server did not start on port $port"
+}
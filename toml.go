@@ -0,0 +1,470 @@
+package duet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// tomlToYAML converts a TOML authors file to YAML, so that it goes through
+// the same parsing (see parsePairsFile) as a YAML one
+func tomlToYAML(contents []byte) ([]byte, error) {
+	contents, err := stripBOM(contents)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeTOML(string(normalizeNewlines(contents)))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// decodeTOML decodes the TOML document src into nested maps, the way
+// yaml.Unmarshal decodes into an interface{}: tables are
+// map[string]interface{}, arrays []interface{}, integers int64 and floats
+// float64. Dates and times are not supported, authors files have no use for
+// them.
+func decodeTOML(src string) (doc map[string]interface{}, err error) {
+	p := &tomlParser{src: src, line: 1}
+	doc = map[string]interface{}{}
+	if err = p.parse(doc); err != nil {
+		return nil, fmt.Errorf("line %d: %v", p.line, err)
+	}
+	return doc, nil
+}
+
+// tomlParser reads src from pos, line being the line pos is on
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+	// defined are the tables defined with a [header] so far, to reject
+	// defining them twice
+	defined map[string]bool
+	// arrays are the arrays of tables defined with a [[header]] so far, to
+	// reject appending tables to arrays of values
+	arrays map[string]bool
+}
+
+func (p *tomlParser) parse(doc map[string]interface{}) error {
+	p.defined = map[string]bool{}
+	p.arrays = map[string]bool{}
+	table := doc
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil
+		}
+
+		if p.peek() == '[' {
+			var err error
+			if table, err = p.header(doc); err != nil {
+				return err
+			}
+		} else if err := p.keyValue(table); err != nil {
+			return err
+		}
+
+		p.skipBlank(false)
+		if !p.eof() && p.peek() != '\n' {
+			return fmt.Errorf("expected the end of the line, found %q", p.peek())
+		}
+	}
+}
+
+// header reads a [table] or [[array of tables]] header and returns the table
+// the following keys go in
+func (p *tomlParser) header(doc map[string]interface{}) (table map[string]interface{}, err error) {
+	p.pos++
+	array := p.consume('[')
+	p.skipBlank(false)
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank(false)
+	if !p.consume(']') || (array && !p.consume(']')) {
+		return nil, fmt.Errorf("unterminated table header")
+	}
+
+	parent, err := p.descend(doc, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	path := strings.Join(keys, ".")
+
+	if array {
+		existing, ok := parent[last]
+		if !ok {
+			existing = []interface{}{}
+			p.arrays[path] = true
+		}
+		tables, ok := existing.([]interface{})
+		if !ok || !p.arrays[path] {
+			return nil, fmt.Errorf("%s is not an array of tables", path)
+		}
+		table = map[string]interface{}{}
+		parent[last] = append(tables, table)
+		return table, nil
+	}
+
+	if p.defined[path] {
+		return nil, fmt.Errorf("table %s is defined twice", path)
+	}
+	p.defined[path] = true
+	switch existing := parent[last].(type) {
+	case nil:
+		table = map[string]interface{}{}
+		parent[last] = table
+	case map[string]interface{}:
+		table = existing
+	default:
+		return nil, fmt.Errorf("%s is already a value, not a table", path)
+	}
+	return table, nil
+}
+
+// descend returns the table at keys under table, creating the missing ones
+// (the last element of an array of tables for arrays)
+func (p *tomlParser) descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for i, k := range keys {
+		switch next := table[k].(type) {
+		case nil:
+			created := map[string]interface{}{}
+			table[k] = created
+			table = created
+		case map[string]interface{}:
+			table = next
+		case []interface{}:
+			if len(next) == 0 {
+				return nil, fmt.Errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+			}
+			last, ok := next[len(next)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s is already a value, not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+// keyValue reads a `key = value` line into table
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if !p.consume('=') {
+		return fmt.Errorf("expected = after %s", strings.Join(keys, "."))
+	}
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("%s is defined twice", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// key reads a bare, quoted or dotted key
+func (p *tomlParser) key() (keys []string, err error) {
+	for {
+		p.skipBlank(false)
+		var k string
+		switch {
+		case p.eof():
+			return nil, fmt.Errorf("expected a key")
+		case p.peek() == '"':
+			if k, err = p.basicString(); err != nil {
+				return nil, err
+			}
+		case p.peek() == '\'':
+			if k, err = p.literalString(); err != nil {
+				return nil, err
+			}
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("expected a key, found %q", p.peek())
+			}
+			k = p.src[start:p.pos]
+		}
+		keys = append(keys, k)
+
+		p.skipBlank(false)
+		if !p.consume('.') {
+			return keys, nil
+		}
+	}
+}
+
+// value reads a string, number, boolean, array or inline table
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch c := p.peek(); {
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.src[p.pos:], `'''`):
+		return p.multilineString(`'''`)
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		return p.literalString()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, fmt.Errorf("expected a value, found %q", p.peek())
+	}
+	number := strings.ReplaceAll(word, "_", "")
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	if strings.Contains(word, "-") || strings.Contains(word, ":") {
+		return nil, fmt.Errorf("dates and times (%s) are not supported", word)
+	}
+	return nil, fmt.Errorf("invalid value %s (strings need quotes)", word)
+}
+
+func (p *tomlParser) array() (values []interface{}, err error) {
+	p.pos++
+	values = []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.consume(']') {
+			return values, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		p.skipBlank(true)
+		if p.consume(']') {
+			return values, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (table map[string]interface{}, err error) {
+	p.pos++
+	table = map[string]interface{}{}
+	p.skipBlank(false)
+	if p.consume('}') {
+		return table, nil
+	}
+	for {
+		if err = p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.consume('}') {
+			return table, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// basicString reads a "string" with escapes
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+				// only multi-line strings go on on the next line
+				return "", fmt.Errorf("invalid escape \\%q", p.peek())
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// literalString reads a 'string' without escapes
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// multilineString reads a multi-line string ending with delimiter (three
+// double or single quotes), a newline right after the opening one being
+// trimmed
+func (p *tomlParser) multilineString(delimiter string) (string, error) {
+	p.pos += len(delimiter)
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.consume('\n') {
+		p.line++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated multi-line string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delimiter) {
+			p.pos += len(delimiter)
+			return b.String(), nil
+		}
+		c := p.peek()
+		p.pos++
+		if c == '\n' {
+			p.line++
+		}
+		if c == '\\' && delimiter == `"""` {
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+}
+
+// escape reads the escape sequence after a backslash into b
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return fmt.Errorf("invalid escape \\%c", c)
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid escape \\%c%s", c, p.src[p.pos:p.pos+size])
+		}
+		p.pos += size
+		b.WriteRune(rune(code))
+	case '\n', ' ', '\t', '\r':
+		// a line ending backslash trims the whitespace up to the next text
+		p.pos--
+		for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+			if p.peek() == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines if newlines is set
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.src) }
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+// consume skips c if it is next, reporting whether it was
+func (p *tomlParser) consume(c byte) bool {
+	if p.eof() || p.peek() != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
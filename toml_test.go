@@ -0,0 +1,130 @@
+package duet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]interface{}
+	}{
+		{
+			name: "escapes",
+			src:  `s = "tab\there \"quoted\" back\\slash\nnew line \u00e9 \U0001F600"`,
+			want: map[string]interface{}{"s": "tab\there \"quoted\" back\\slash\nnew line é 😀"},
+		},
+		{
+			name: "literal string",
+			src:  `s = 'C:\Users\jane "as is"'`,
+			want: map[string]interface{}{"s": `C:\Users\jane "as is"`},
+		},
+		{
+			name: "multi-line string",
+			src:  "s = \"\"\"\nfirst\\tline\nsecond \\\n    line\"\"\"",
+			want: map[string]interface{}{"s": "first\tline\nsecond line"},
+		},
+		{
+			name: "multi-line literal string",
+			src:  "s = '''\nno \\escapes\n'here'\n'''",
+			want: map[string]interface{}{"s": "no \\escapes\n'here'\n"},
+		},
+		{
+			name: "dotted keys",
+			src:  "email.domain = \"hamster.info.local\"\n\"site\".'name' = \"x\"\na . b . c = 1",
+			want: map[string]interface{}{
+				"email": map[string]interface{}{"domain": "hamster.info.local"},
+				"site":  map[string]interface{}{"name": "x"},
+				"a":     map[string]interface{}{"b": map[string]interface{}{"c": int64(1)}},
+			},
+		},
+		{
+			name: "tables",
+			src:  "[authors]\njd = \"Jane Doe\"\n\n[email.template]\nformat = \"{{.Initials}}\"",
+			want: map[string]interface{}{
+				"authors": map[string]interface{}{"jd": "Jane Doe"},
+				"email":   map[string]interface{}{"template": map[string]interface{}{"format": "{{.Initials}}"}},
+			},
+		},
+		{
+			name: "inline tables",
+			src:  `meta = { jd = { team = "api" }, fb = {} }`,
+			want: map[string]interface{}{
+				"meta": map[string]interface{}{
+					"jd": map[string]interface{}{"team": "api"},
+					"fb": map[string]interface{}{},
+				},
+			},
+		},
+		{
+			name: "arrays",
+			src:  "a = [1, 2.5, \"x\", true]\nb = [\n  [1], # comment\n  [],\n]",
+			want: map[string]interface{}{
+				"a": []interface{}{int64(1), 2.5, "x", true},
+				"b": []interface{}{[]interface{}{int64(1)}, []interface{}{}},
+			},
+		},
+		{
+			name: "arrays of tables",
+			src:  "[[squad]]\nname = \"api\"\n[squad.lead]\ninitials = \"jd\"\n\n[[squad]]\nname = \"web\"",
+			want: map[string]interface{}{
+				"squad": []interface{}{
+					map[string]interface{}{"name": "api", "lead": map[string]interface{}{"initials": "jd"}},
+					map[string]interface{}{"name": "web"},
+				},
+			},
+		},
+		{
+			name: "numbers",
+			src:  "a = 1_000\nb = 0x1f\nc = -3\nd = 1e3",
+			want: map[string]interface{}{"a": int64(1000), "b": int64(31), "c": int64(-3), "d": 1000.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeTOML(tt.src)
+			if err != nil {
+				t.Fatalf("decodeTOML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeTOML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"invalid escape", `s = "\q"`, `line 1: invalid escape \q`},
+		{"invalid unicode escape", `s = "\uD800"`, `line 1: invalid escape \uD800`},
+		{"unterminated string", "s = \"abc\nt = 1", "line 1: unterminated string"},
+		{"line ending backslash", "s = \"abc\\\ndef\"", `line 1: invalid escape \'\n'`},
+		{"unterminated literal string", "s = 'abc", "line 1: unterminated string"},
+		{"unterminated multi-line string", "\ns = '''abc\n", "line 3: unterminated multi-line string"},
+		{"table defined twice", "[a]\nx = 1\n[a]", "line 3: table a is defined twice"},
+		{"key defined twice", "a.b = 1\na.b = 2", "line 2: a.b is defined twice"},
+		{"value as a table", "a = 1\n[a.b]", "line 2: a is already a value, not a table"},
+		{"array of values as tables", "a = [1]\n[[a]]", "line 2: a is not an array of tables"},
+		{"unterminated header", "[a\nx = 1", "line 1: unterminated table header"},
+		{"unterminated inline table", `a = { x = 1`, "line 1: expected , or } in inline table"},
+		{"unterminated array", `a = [1 2]`, "line 1: expected , or ] in array"},
+		{"two values", `a = 1 2`, `line 1: expected the end of the line, found '2'`},
+		{"unquoted string", `a = jane`, "line 1: invalid value jane (strings need quotes)"},
+		{"date", `a = 1979-05-27`, "line 1: dates and times (1979-05-27) are not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeTOML(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("decodeTOML: got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
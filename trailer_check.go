@@ -0,0 +1,215 @@
+package duet
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	wellFormedTrailerRegexp = regexp.MustCompile(`^(.+?)\s+<([^<>\s]+@[^<>\s]+)>$`)
+	trailerEmailRegexp      = regexp.MustCompile(`[^\s<>]+@[^\s<>]+`)
+	exemptSubjectRegexp     = regexp.MustCompile(`^(fixup|squash|amend)! `)
+)
+
+// TrailerProblem is something wrong with the co-author trailers of a commit
+// message (see ValidateCoAuthorTrailers). Line is the number of the offending
+// line, starting at 1, and Text the line itself; Line is 0 if the trailers are
+// missing altogether. Suggestions are the correct trailers, when the authors
+// file tells them.
+type TrailerProblem struct {
+	Line        int
+	Text        string
+	Problem     string
+	Suggestions []string
+}
+
+func (p *TrailerProblem) Error() string {
+	message := p.Problem
+	if p.Line > 0 {
+		message = fmt.Sprintf("line %d: %q %s", p.Line, p.Text, p.Problem)
+	}
+	if len(p.Suggestions) == 0 {
+		return message
+	}
+
+	var quoted []string
+	for _, suggestion := range p.Suggestions {
+		quoted = append(quoted, fmt.Sprintf("%q", suggestion))
+	}
+	if p.Line == 0 {
+		return message + ", add " + strings.Join(quoted, " and ")
+	}
+	return message + ", use " + quoted[0]
+}
+
+// TrailerCheckExempt returns whether the co-author trailers of msg are not to
+// be checked: fixup!, squash! and amend! commits, which are folded into
+// another commit
+func TrailerCheckExempt(msg []byte) bool {
+	for _, line := range strings.Split(string(msg), "\n") {
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		return exemptSubjectRegexp.MatchString(line)
+	}
+	return false
+}
+
+// ValidateCoAuthorTrailers checks the co-author trailers (under key or
+// Co-authored-by) of the commit message msg: every one must credit someone in
+// pairs as `Name <email>`, and there must be at least one if coAuthors is not
+// empty. Comment lines and anything below the scissors line are ignored. The
+// problems are returned in the order of the lines. Trailers are matched
+// against coAuthors first, and only for those that credit someone else are
+// the authors the trailer may mean resolved (see Pairs.resolvable), leaving
+// out those that cannot be.
+func ValidateCoAuthorTrailers(msg []byte, key string, pairs *Pairs, coAuthors []*Pair) (problems []*TrailerProblem, err error) {
+
+	trailerRegexp := regexp.MustCompile(`(?i)^(` + trailerKeysPattern(key) + `)\s*:\s*(.*?)\s*$`)
+	credited := false
+	for i, line := range strings.Split(string(msg), "\n") {
+		if strings.Contains(line, " >8 ") {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := trailerRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		problem := checkCoAuthorTrailer(match[1], match[2], coAuthors)
+		if problem != nil {
+			name, email := trailerPerson(match[2])
+			people := append(append([]*Pair{}, coAuthors...), pairs.resolvable(name, email)...)
+			problem = checkCoAuthorTrailer(match[1], match[2], people)
+		}
+		if problem == nil {
+			credited = true
+			continue
+		}
+		problem.Line, problem.Text = i+1, line
+		problems = append(problems, problem)
+	}
+
+	if !credited && len(problems) == 0 && len(coAuthors) > 0 {
+		var initials []string
+		for _, p := range coAuthors {
+			initials = append(initials, p.Initials)
+		}
+		if key == "" {
+			key = DefaultTrailerKey
+		}
+		problems = append(problems, &TrailerProblem{
+			Problem: fmt.Sprintf("there is no %s trailer although pairing with %s",
+				key, strings.Join(initials, ", ")),
+			Suggestions: CoAuthorTrailers(key, coAuthors),
+		})
+	}
+
+	return problems, nil
+}
+
+// checkCoAuthorTrailer returns the problem with the trailer crediting value
+// under key, nil if it credits someone in people properly
+func checkCoAuthorTrailer(key, value string, people []*Pair) *TrailerProblem {
+	if match := wellFormedTrailerRegexp.FindStringSubmatch(value); match != nil {
+		for _, p := range people {
+			if strings.EqualFold(p.Email, match[2]) {
+				return nil
+			}
+		}
+		if p := findPerson(people, match[1], ""); p != nil {
+			return &TrailerProblem{
+				Problem:     fmt.Sprintf("credits %s with an email that is not in the authors file", p.Initials),
+				Suggestions: []string{Trailer(key, p)},
+			}
+		}
+		return &TrailerProblem{Problem: "credits someone who is not in the authors file"}
+	}
+
+	name, email := trailerPerson(value)
+	problem := &TrailerProblem{Problem: "has no email in angle brackets"}
+	switch {
+	case value == "":
+		problem.Problem = "credits no one"
+	case email == "":
+		problem.Problem = "has no email"
+	}
+	if p := findPerson(people, name, email); p != nil {
+		problem.Suggestions = []string{Trailer(key, p)}
+	}
+	return problem
+}
+
+// trailerPerson returns the name and email credited by value, a co-author
+// trailer, either empty if it has none
+func trailerPerson(value string) (name, email string) {
+	if match := wellFormedTrailerRegexp.FindStringSubmatch(value); match != nil {
+		return match[1], match[2]
+	}
+	email = trailerEmailRegexp.FindString(value)
+	name = strings.TrimSpace(strings.NewReplacer("<", "", ">", "").Replace(strings.Replace(value, email, "", 1)))
+	return name, email
+}
+
+// resolvable returns the authors of pairs a trailer crediting name and email
+// may mean, sorted by initials: those named name (or with the initials name)
+// or with email in the authors file (as their `email` or in
+// `email_addresses`). Only they are resolved, which leaves out those whose
+// email cannot be (e.g. outside of allowed_domains).
+func (a *Pairs) resolvable(name, email string) (people []*Pair) {
+	var initials []string
+	for i := range a.file.Pairs {
+		if a.file.mayBe(i, name, email) {
+			initials = append(initials, i)
+		}
+	}
+	sortInitials(initials)
+
+	for _, i := range initials {
+		if p, err := a.ByInitials(i); err == nil {
+			people = append(people, p)
+		}
+	}
+	return people
+}
+
+// mayBe returns whether the author with the given initials may be the person
+// named name with email, going by the authors file alone
+func (af *pairsFile) mayBe(initials, name, email string) bool {
+	if authorName, _, _ := af.author(initials); name != "" && (strings.EqualFold(authorName, name) || initials == name) {
+		return true
+	}
+	if email == "" {
+		return false
+	}
+	addresses := af.EmailAddresses[initials].all()
+	if explicit, ok := af.Emails[initials]; ok {
+		addresses = append(addresses, explicit)
+	}
+	for _, address := range addresses {
+		if strings.EqualFold(address, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// findPerson returns the person in people with the given email, or name (or
+// initials), nil if there is none
+func findPerson(people []*Pair, name, email string) *Pair {
+	for _, p := range people {
+		if email != "" && strings.EqualFold(p.Email, email) {
+			return p
+		}
+	}
+	for _, p := range people {
+		if name != "" && (strings.EqualFold(p.Name, name) || p.Initials == name) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package duet
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultTrailerKey is the trailer used to credit co-authors unless configured
+// otherwise (via `trailer_key` in the authors file or $GIT_DUET_TRAILER_KEY)
+const DefaultTrailerKey = "Co-authored-by"
+
+// TrailerOrderConfigKey is the git config key choosing the order of the
+// co-author trailers (see ParseTrailerOrder), $GIT_DUET_TRAILER_ORDER
+// overrides it
+const TrailerOrderConfigKey = "duet.trailerOrder"
+
+// Orders of the co-author trailers (see OrderCoAuthors)
+const (
+	// TrailerOrderDuet is the order in which the initials were given
+	TrailerOrderDuet = "duet"
+	// TrailerOrderAlphabetical is the alphabetical order of the names
+	TrailerOrderAlphabetical = "alphabetical"
+)
+
+// ParseTrailerOrder parses the value of TrailerOrderConfigKey: `duet` or
+// `alphabetical`, `duet` if empty
+func ParseTrailerOrder(order string) (string, error) {
+	switch strings.ToLower(order) {
+	case "", TrailerOrderDuet:
+		return TrailerOrderDuet, nil
+	case TrailerOrderAlphabetical:
+		return TrailerOrderAlphabetical, nil
+	}
+	return "", fmt.Errorf("invalid trailer order %q: must be %s or %s", order, TrailerOrderDuet, TrailerOrderAlphabetical)
+}
+
+// OrderCoAuthors returns coAuthors in the trailer order (see
+// ParseTrailerOrder), coAuthors itself is left alone
+func OrderCoAuthors(order string, coAuthors []*Pair) []*Pair {
+	ordered := append([]*Pair(nil), coAuthors...)
+	if order == TrailerOrderAlphabetical {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return strings.ToLower(ordered[i].Name) < strings.ToLower(ordered[j].Name)
+		})
+	}
+	return ordered
+}
+
+// ValidateTrailerKey returns an error if key cannot be used as a trailer key
+func ValidateTrailerKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("trailer key must not be empty")
+	}
+	if strings.ContainsAny(key, ": \t\r\n") {
+		return fmt.Errorf("invalid trailer key %q: must not contain whitespace or colons", key)
+	}
+	return nil
+}
+
+// Trailer returns the co-author trailer crediting p under the given key
+func Trailer(key string, p *Pair) string {
+	return fmt.Sprintf("%s: %s <%s>", key, p.Name, p.Email)
+}
+
+// CoAuthorTrailers returns the trailers crediting coAuthors under key
+// The trailers are always in the order of coAuthors, e.g. the order in which
+// the initials were given when the pair was set (see GetCommitters and
+// OrderCoAuthors), so that re-generating them never shuffles an existing
+// commit message.
+func CoAuthorTrailers(key string, coAuthors []*Pair) (trailers []string) {
+	for _, p := range coAuthors {
+		trailers = append(trailers, Trailer(key, p))
+	}
+	return trailers
+}
+
+// RemoveCoAuthorTrailers removes every trailer crediting one of coAuthors
+// (matched by email, under key or Co-authored-by) from msg so that they can be
+// re-added in a normalized order. Anything below the scissors line of a
+// verbose commit message is left untouched.
+func RemoveCoAuthorTrailers(msg []byte, key string, coAuthors []*Pair) []byte {
+	lines := strings.SplitAfter(string(msg), "\n")
+	var kept []string
+	scissors := false
+	for _, line := range lines {
+		if strings.Contains(line, " >8 ") {
+			scissors = true
+		}
+		if !scissors && credits([]byte(line), key, coAuthors) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return []byte(strings.Join(kept, ""))
+}
+
+// coAuthorTrailerEmailRegexp matches a trailer crediting a co-author, under
+// key or Co-authored-by, capturing the email
+func coAuthorTrailerEmailRegexp(key string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^(?:` + trailerKeysPattern(key) + `):\s.+\s<(.+)>\s*$`)
+}
+
+// DeduplicateCoAuthorTrailers removes the trailers (under key or
+// Co-authored-by) crediting an email, case-insensitively, that a trailer above
+// credits already, e.g. after merging messages. Every other line is kept where
+// it is, anything below the scissors line of a verbose commit message too.
+func DeduplicateCoAuthorTrailers(msg []byte, key string) []byte {
+	trailer := coAuthorTrailerEmailRegexp(key)
+	credited := map[string]bool{}
+	var kept []string
+	scissors := false
+	for _, line := range strings.SplitAfter(string(msg), "\n") {
+		if strings.Contains(line, " >8 ") {
+			scissors = true
+		}
+		if match := trailer.FindStringSubmatch(strings.TrimRight(line, "\r\n")); !scissors && match != nil {
+			email := strings.ToLower(match[1])
+			if credited[email] {
+				continue
+			}
+			credited[email] = true
+		}
+		kept = append(kept, line)
+	}
+	return []byte(strings.Join(kept, ""))
+}
+
+func credits(line []byte, key string, coAuthors []*Pair) bool {
+	for _, p := range coAuthors {
+		if HasCoAuthorTrailerFor(line, key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCoAuthorTrailer returns whether msg already credits a co-author, either
+// under key or under the standard Co-authored-by key (keys are case-insensitive)
+func HasCoAuthorTrailer(msg []byte, key string) bool {
+	return coAuthorTrailerRegexp(key).Match(msg)
+}
+
+// HasCoAuthorTrailerFor returns whether msg already credits p (matched by
+// email) under key or under the standard Co-authored-by key
+func HasCoAuthorTrailerFor(msg []byte, key string, p *Pair) bool {
+	return regexp.MustCompile(`(?mi)^(?:` + trailerKeysPattern(key) + `):\s.+\s<` +
+		regexp.QuoteMeta(p.Email) + `>\s*$`).Match(msg)
+}
+
+func coAuthorTrailerRegexp(key string) *regexp.Regexp {
+	return regexp.MustCompile(`(?mi)^(?:` + trailerKeysPattern(key) + `):\s.+\s<.+>`)
+}
+
+func trailerKeysPattern(key string) string {
+	keys := regexp.QuoteMeta(DefaultTrailerKey)
+	if key != "" && !strings.EqualFold(key, DefaultTrailerKey) {
+		keys += "|" + regexp.QuoteMeta(key)
+	}
+	return keys
+}
@@ -0,0 +1,89 @@
+package duet
+
+import (
+	"sort"
+	"strings"
+)
+
+// transliterations maps the accented and special latin letters that have an
+// obvious ASCII spelling to it (lower case only, see transliterate)
+var transliterations = map[rune]string{}
+
+func init() {
+	for ascii, letters := range map[string]string{
+		"a":  "àáâãäåāăą",
+		"c":  "çćĉċč",
+		"d":  "ďđð",
+		"e":  "èéêëēĕėęě",
+		"g":  "ĝğġģ",
+		"h":  "ĥħ",
+		"i":  "ìíîïĩīĭįı",
+		"j":  "ĵ",
+		"k":  "ķ",
+		"l":  "ĺļľŀł",
+		"n":  "ñńņňŉ",
+		"o":  "òóôõöøōŏő",
+		"r":  "ŕŗř",
+		"s":  "śŝşšș",
+		"t":  "ţťŧț",
+		"u":  "ùúûüũūŭůűų",
+		"w":  "ŵ",
+		"y":  "ýÿŷ",
+		"z":  "źżž",
+		"ae": "æ",
+		"oe": "œ",
+		"ss": "ß",
+		"th": "þ",
+	} {
+		for _, letter := range letters {
+			transliterations[letter] = ascii
+		}
+	}
+}
+
+// transliterate lower-cases s and spells its letters in ASCII, dropping the
+// ones it does not know how to spell. Other ASCII characters are kept.
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r < 0x80 {
+			b.WriteRune(r)
+		} else if ascii, ok := transliterations[r]; ok {
+			b.WriteString(ascii)
+		}
+	}
+	return b.String()
+}
+
+// CompareInitials orders initials (or team names) for people, the same on
+// every platform: ignoring case and accents (so Åb sorts with ab, not after
+// z), and by their bytes if that leaves them equal. Returns -1, 0 or +1 like
+// strings.Compare. Every sorted listing of authors uses it, use it to order
+// them the same way.
+func CompareInitials(a, b string) int {
+	if c := strings.Compare(sortKey(a), sortKey(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// sortKey is s lower-cased with the letters transliterate knows spelled in
+// ASCII, other letters being kept as they are
+func sortKey(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if ascii, ok := transliterations[r]; ok {
+			b.WriteString(ascii)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sortInitials sorts initials (or team names) in place with CompareInitials
+func sortInitials(initials []string) {
+	sort.Slice(initials, func(i, j int) bool {
+		return CompareInitials(initials[i], initials[j]) < 0
+	})
+}
@@ -0,0 +1,14 @@
+//go:build go1.20
+// +build go1.20
+
+package duet
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setWaitDelay stops waiting for the output of cmd d after it is killed
+func setWaitDelay(cmd *exec.Cmd, d time.Duration) {
+	cmd.WaitDelay = d
+}
@@ -0,0 +1,13 @@
+//go:build !go1.20
+// +build !go1.20
+
+package duet
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setWaitDelay does nothing before Go 1.20, where a killed command is waited
+// for until its children close its output
+func setWaitDelay(cmd *exec.Cmd, d time.Duration) {}